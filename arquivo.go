@@ -0,0 +1,372 @@
+package meufs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// AbrirVolume abre um meufs.fs já criado para ser usado pela API de arquivos (OpenFile, Open, Create)
+// com a identidade do processo, que pode ser trocada no campo Identidade do volume
+func AbrirVolume(caminho string) (*Volume, error) {
+	return AbrirVolumeComSenha(caminho, "")
+}
+
+// AbrirVolumeComSenha é o AbrirVolume de um volume cifrado, que é desbloqueado com a senha. Em volumes não cifrados
+// a senha é ignorada
+func AbrirVolumeComSenha(caminho string, senha string) (*Volume, error) {
+	meuFS, cabecalho, erro := AbrirMeuFS(caminho)
+	if erro != nil {
+		return nil, erro
+	}
+	if meuFS.Cifrado() {
+		if senha == "" {
+			meuFS.Close()
+			return nil, ErrVolumeBloqueado
+		}
+		if erro = DesbloquearVolume(cabecalho, meuFS, senha); erro != nil {
+			meuFS.Close()
+			return nil, erro
+		}
+	}
+	return &Volume{Arquivo: meuFS, Cabecalho: cabecalho, Identidade: IdentidadeDoProcesso()}, nil
+}
+
+// Close fecha o meufs.fs do volume
+func (v *Volume) Close() error {
+	return v.Arquivo.Close()
+}
+
+// Arquivo é um arquivo do meufs aberto, com posição atual, no estilo de *os.File.
+// Cada operação acessa o meufs com a trava do volume, então handles diferentes sempre veem o conteúdo atual
+type Arquivo struct {
+	volume     *Volume
+	identidade Identidade
+	nome       string
+	caminho    []string
+	flag       int
+	posicao    int64
+	fechado    bool
+	cifra      *CifraArquivo
+}
+
+// caminhoNoVolume converte um nome no estilo do pacote os ("/docs/a.txt", "docs/../a.txt") em componentes
+func caminhoNoVolume(nome string) []string {
+	return DividirCaminho(path.Clean("/" + nome))
+}
+
+// erroDeCaminho embrulha o erro em um *fs.PathError, como os erros do pacote os
+func erroDeCaminho(operacao string, nome string, erro error) error {
+	return &fs.PathError{Op: operacao, Path: nome, Err: erro}
+}
+
+// OpenFile abre um arquivo do meufs com a mesma semântica de os.OpenFile: os.O_RDONLY, os.O_WRONLY e os.O_RDWR
+// escolhem o acesso, os.O_CREATE cria o arquivo se ele não existir, os.O_EXCL (com os.O_CREATE) falha se ele existir,
+// os.O_TRUNC o esvazia e os.O_APPEND faz toda escrita ir para o fim. Os erros podem ser testados com errors.Is contra
+// fs.ErrNotExist, fs.ErrExist e fs.ErrPermission. As permissões da Identidade do volume são conferidas ao abrir,
+// como no Unix, assim como os atributos, e de novo a cada escrita com a Identidade de quem abriu, e um arquivo criado fica com as permissões perm sem os bits de MascaraCriacao.
+// Arquivos cifrados são abertos com a SenhaArquivos do volume e decifrados nas leituras
+func (v *Volume) OpenFile(nome string, flag int, perm fs.FileMode) (*Arquivo, error) {
+	v.Lock()
+	defer v.Unlock()
+	partes := caminhoNoVolume(nome)
+	escrita := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	acesso := AcessoLeitura
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		acesso = AcessoEscrita
+	case os.O_RDWR:
+		acesso |= AcessoEscrita
+	}
+	if len(partes) == 0 {
+		// O root só pode ser aberto para leitura
+		if escrita {
+			return nil, erroDeCaminho("open", nome, errors.New("é um diretorio"))
+		}
+		return &Arquivo{volume: v, identidade: v.Identidade, nome: nome, flag: flag}, nil
+	}
+	var cifra *CifraArquivo
+	dir, indice, _, erro := resolverComPermissao(v.Cabecalho, v.Arquivo, v.Identidade, partes)
+	switch {
+	case erro == nil:
+		entrada := dir.Entradas[indice]
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, erroDeCaminho("open", nome, fs.ErrExist)
+		}
+		if entrada.EhDir == 1 && escrita {
+			return nil, erroDeCaminho("open", nome, errors.New("é um diretorio"))
+		}
+		// Como no Linux, um arquivo somente anexar só é aberto para escrita com os.O_APPEND e sem os.O_TRUNC
+		if escrita {
+			if erro = verificarConteudo(entrada, partes, flag&os.O_APPEND != 0 && flag&os.O_TRUNC == 0); erro != nil {
+				return nil, erroDeCaminho("open", nome, erro)
+			}
+		}
+		if !PodeAcessar(v.Identidade, entrada, acesso) {
+			return nil, erroDeCaminho("open", nome, erroDePermissao(partes, acesso))
+		}
+		// Sem a senha, um arquivo cifrado só pode ser aberto para ser esvaziado, e deixa de ser cifrado
+		truncar := flag&os.O_TRUNC != 0 && escrita
+		if cifra, erro = AbrirCifra(v.Cabecalho, v.Arquivo, entrada, v.SenhaArquivos); erro != nil && !(truncar && errors.Is(erro, ErrArquivoCifrado)) {
+			return nil, erroDeCaminho("open", nome, erro)
+		}
+		if truncar && entrada.Tamanho > 0 {
+			if _, erro = TruncarArquivo(v.Cabecalho, v.Arquivo, v.Identidade, partes, cifra, 0); erro != nil {
+				return nil, erroDeCaminho("open", nome, erro)
+			}
+		}
+	case errors.Is(erro, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		if _, erro = CriarEntrada(v.Cabecalho, v.Arquivo, v.Identidade, partes[:len(partes)-1], partes[len(partes)-1], false, nil); erro != nil {
+			return nil, erroDeCaminho("open", nome, erro)
+		}
+		if erro = DefinirModo(v.Cabecalho, v.Arquivo, v.Identidade, partes, ModoUnix(perm)&^MascaraCriacao); erro != nil {
+			return nil, erroDeCaminho("open", nome, erro)
+		}
+	default:
+		return nil, erroDeCaminho("open", nome, erro)
+	}
+	if flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_WRONLY {
+		if erro = MarcarAcesso(v.Cabecalho, v.Arquivo, partes); erro != nil {
+			return nil, erroDeCaminho("open", nome, erro)
+		}
+	}
+	return &Arquivo{volume: v, identidade: v.Identidade, nome: nome, caminho: partes, flag: flag, cifra: cifra}, nil
+}
+
+// Open abre um arquivo do meufs somente para leitura, como os.Open
+func (v *Volume) Open(nome string) (*Arquivo, error) {
+	return v.OpenFile(nome, os.O_RDONLY, 0)
+}
+
+// Create cria ou esvazia um arquivo do meufs e o abre para leitura e escrita, como os.Create
+func (v *Volume) Create(nome string) (*Arquivo, error) {
+	return v.OpenFile(nome, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Name retorna o nome usado para abrir o arquivo
+func (a *Arquivo) Name() string {
+	return a.nome
+}
+
+// entrada lê a entrada de diretório atual do arquivo. Deve ser chamada com a trava do volume
+func (a *Arquivo) entrada() (DiretorioRoot, error) {
+	if len(a.caminho) == 0 {
+		return entradaDoRoot, nil
+	}
+	dir, indice, erro := ResolverCaminho(a.volume.Cabecalho, a.volume.Arquivo, a.caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return dir.Entradas[indice], nil
+}
+
+// verificar confere se o arquivo está aberto e se o acesso pedido é permitido pela flag
+func (a *Arquivo) verificar(operacao string, escrita bool) error {
+	if a.fechado {
+		return erroDeCaminho(operacao, a.nome, fs.ErrClosed)
+	}
+	acesso := a.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if escrita && acesso == os.O_RDONLY {
+		return erroDeCaminho(operacao, a.nome, errors.New("arquivo não foi aberto para escrita"))
+	}
+	if !escrita && acesso == os.O_WRONLY {
+		return erroDeCaminho(operacao, a.nome, errors.New("arquivo não foi aberto para leitura"))
+	}
+	return nil
+}
+
+// lerEm lê a partir do offset sem mexer na posição. Deve ser chamada com a trava do volume
+func (a *Arquivo) lerEm(p []byte, offset int64) (int, error) {
+	entrada, erro := a.entrada()
+	if erro != nil {
+		return 0, erroDeCaminho("read", a.nome, erro)
+	}
+	if entrada.EhDir == 1 {
+		return 0, erroDeCaminho("read", a.nome, errors.New("é um diretorio"))
+	}
+	if offset >= int64(entrada.Tamanho) {
+		return 0, io.EOF
+	}
+	var conteudo bytes.Buffer
+	if erro = CopiarConteudo(a.volume.Cabecalho, a.volume.Arquivo, entrada, a.cifra, &conteudo, offset, int64(len(p))); erro != nil {
+		return 0, erroDeCaminho("read", a.nome, erro)
+	}
+	return copy(p, conteudo.Bytes()), nil
+}
+
+// Read lê a partir da posição atual e a avança. Retorna io.EOF no fim do arquivo
+func (a *Arquivo) Read(p []byte) (int, error) {
+	if erro := a.verificar("read", false); erro != nil {
+		return 0, erro
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	n, erro := a.lerEm(p, a.posicao)
+	a.posicao += int64(n)
+	return n, erro
+}
+
+// ReadAt lê a partir do offset sem mudar a posição atual
+func (a *Arquivo) ReadAt(p []byte, offset int64) (int, error) {
+	if erro := a.verificar("read", false); erro != nil {
+		return 0, erro
+	}
+	if offset < 0 {
+		return 0, erroDeCaminho("readat", a.nome, errors.New("offset negativo"))
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	lidos := 0
+	for lidos < len(p) {
+		n, erro := a.lerEm(p[lidos:], offset+int64(lidos))
+		lidos += n
+		if erro != nil {
+			return lidos, erro
+		}
+	}
+	return lidos, nil
+}
+
+// Write escreve na posição atual e a avança. Com os.O_APPEND a escrita sempre vai para o fim do arquivo
+func (a *Arquivo) Write(p []byte) (int, error) {
+	if erro := a.verificar("write", true); erro != nil {
+		return 0, erro
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	var entrada DiretorioRoot
+	var erro error
+	if a.flag&os.O_APPEND != 0 {
+		entrada, erro = AnexarAoArquivo(a.volume.Cabecalho, a.volume.Arquivo, a.identidade, a.caminho, a.cifra, p)
+		a.posicao = int64(entrada.Tamanho)
+	} else {
+		_, erro = EscreverNoArquivo(a.volume.Cabecalho, a.volume.Arquivo, a.identidade, a.caminho, a.cifra, a.posicao, p)
+		a.posicao += int64(len(p))
+	}
+	if erro != nil {
+		return 0, erroDeCaminho("write", a.nome, erro)
+	}
+	return len(p), nil
+}
+
+// WriteAt escreve a partir do offset sem mudar a posição atual. Como no pacote os, não é permitido com os.O_APPEND
+func (a *Arquivo) WriteAt(p []byte, offset int64) (int, error) {
+	if erro := a.verificar("write", true); erro != nil {
+		return 0, erro
+	}
+	if a.flag&os.O_APPEND != 0 {
+		return 0, erroDeCaminho("writeat", a.nome, errors.New("WriteAt não é permitido em arquivo aberto com O_APPEND"))
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	if _, erro := EscreverNoArquivo(a.volume.Cabecalho, a.volume.Arquivo, a.identidade, a.caminho, a.cifra, offset, p); erro != nil {
+		return 0, erroDeCaminho("writeat", a.nome, erro)
+	}
+	return len(p), nil
+}
+
+// Seek muda a posição atual (io.SeekStart, io.SeekCurrent ou io.SeekEnd)
+func (a *Arquivo) Seek(offset int64, deOnde int) (int64, error) {
+	if a.fechado {
+		return 0, erroDeCaminho("seek", a.nome, fs.ErrClosed)
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	base := int64(0)
+	switch deOnde {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = a.posicao
+	case io.SeekEnd:
+		entrada, erro := a.entrada()
+		if erro != nil {
+			return 0, erroDeCaminho("seek", a.nome, erro)
+		}
+		base = int64(entrada.Tamanho)
+	default:
+		return 0, erroDeCaminho("seek", a.nome, fs.ErrInvalid)
+	}
+	if base+offset < 0 {
+		return 0, erroDeCaminho("seek", a.nome, fs.ErrInvalid)
+	}
+	a.posicao = base + offset
+	return a.posicao, nil
+}
+
+// Truncate muda o tamanho do arquivo sem mudar a posição atual
+func (a *Arquivo) Truncate(tamanho int64) error {
+	if erro := a.verificar("truncate", true); erro != nil {
+		return erro
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	if _, erro := TruncarArquivo(a.volume.Cabecalho, a.volume.Arquivo, a.identidade, a.caminho, a.cifra, tamanho); erro != nil {
+		return erroDeCaminho("truncate", a.nome, erro)
+	}
+	return nil
+}
+
+// Stat retorna as informações do arquivo como um fs.FileInfo
+func (a *Arquivo) Stat() (fs.FileInfo, error) {
+	if a.fechado {
+		return nil, erroDeCaminho("stat", a.nome, fs.ErrClosed)
+	}
+	a.volume.Lock()
+	defer a.volume.Unlock()
+	entrada, erro := a.entrada()
+	if erro != nil {
+		return nil, erroDeCaminho("stat", a.nome, erro)
+	}
+	nome := "/"
+	if len(a.caminho) > 0 {
+		nome = a.caminho[len(a.caminho)-1]
+	}
+	return infoArquivo{nome: nome, entrada: entrada}, nil
+}
+
+// Close fecha o arquivo. Como as escritas vão direto para o meufs, não há nada a gravar
+func (a *Arquivo) Close() error {
+	if a.fechado {
+		return erroDeCaminho("close", a.nome, fs.ErrClosed)
+	}
+	a.fechado = true
+	return nil
+}
+
+// infoArquivo implementa fs.FileInfo para uma entrada do meufs
+type infoArquivo struct {
+	nome    string
+	entrada DiretorioRoot
+}
+
+func (i infoArquivo) Name() string       { return i.nome }
+func (i infoArquivo) Size() int64        { return int64(i.entrada.Tamanho) }
+func (i infoArquivo) ModTime() time.Time { return TempoDaEntrada(i.entrada.Modificado) }
+func (i infoArquivo) IsDir() bool        { return i.entrada.EhDir == 1 }
+func (i infoArquivo) Sys() any           { return i.entrada }
+
+// Mode informa o modo guardado na entrada, com fs.ModeDir nos diretórios, fs.ModeAppend nos arquivos somente anexar
+// e sem permissão de escrita nos arquivos somente leitura e imutáveis
+func (i infoArquivo) Mode() fs.FileMode {
+	modo := ModoGo(i.entrada.Modo)
+	if i.entrada.EhDir == 1 {
+		return fs.ModeDir | modo
+	}
+	if i.entrada.Atributos&(AtributoSomenteLeitura|AtributoImutavel) != 0 {
+		return modo &^ 0222
+	}
+	if i.entrada.Atributos&AtributoSomenteAnexar != 0 {
+		return modo | fs.ModeAppend
+	}
+	return modo
+}
+
+// String descreve o arquivo, útil em mensagens de depuração
+func (i infoArquivo) String() string {
+	return fmt.Sprintf("%s %s %d", i.Mode(), i.nome, i.Size())
+}
@@ -0,0 +1,242 @@
+package meufs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// novoVolume cria um meufs.fs vazio em um diretório temporário e o abre como root
+func novoVolume(t *testing.T) *meufs.Volume {
+	t.Helper()
+	caminho := filepath.Join(t.TempDir(), "meufs.fs")
+	if erro := meufs.CriarVolume(caminho, 100, ""); erro != nil {
+		t.Fatal(erro)
+	}
+	volume, erro := meufs.AbrirVolume(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	volume.Identidade = meufs.IdentidadeRoot
+	t.Cleanup(func() { volume.Close() })
+	return volume
+}
+
+// gravar cria o arquivo com o conteúdo informado
+func gravar(t *testing.T, volume *meufs.Volume, nome string, conteudo string) {
+	t.Helper()
+	arquivo, erro := volume.Create(nome)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = arquivo.Write([]byte(conteudo)); erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.Close()
+}
+
+// conteudo lê o arquivo inteiro
+func conteudo(t *testing.T, volume *meufs.Volume, nome string) string {
+	t.Helper()
+	arquivo, erro := volume.Open(nome)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer arquivo.Close()
+	dados, erro := io.ReadAll(arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return string(dados)
+}
+
+func TestOpenFileCriarExclusivo(t *testing.T) {
+	volume := novoVolume(t)
+	arquivo, erro := volume.OpenFile("/a.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.Close()
+	_, erro = volume.OpenFile("/a.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if !errors.Is(erro, fs.ErrExist) {
+		t.Fatalf("O_EXCL em arquivo existente: esperava fs.ErrExist, veio %v", erro)
+	}
+	var erroCaminho *fs.PathError
+	if !errors.As(erro, &erroCaminho) || erroCaminho.Path != "/a.txt" {
+		t.Fatalf("esperava um *fs.PathError de /a.txt, veio %#v", erro)
+	}
+}
+
+func TestOpenFileInexistente(t *testing.T) {
+	volume := novoVolume(t)
+	if _, erro := volume.Open("/nao/existe.txt"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("esperava fs.ErrNotExist, veio %v", erro)
+	}
+	if _, erro := volume.OpenFile("/existe.txt", os.O_WRONLY|os.O_TRUNC, 0); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("O_TRUNC sem O_CREATE: esperava fs.ErrNotExist, veio %v", erro)
+	}
+}
+
+func TestOpenFileTruncar(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", "conteúdo antigo")
+	arquivo, erro := volume.OpenFile("/a.txt", os.O_WRONLY|os.O_TRUNC, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.Write([]byte("novo"))
+	arquivo.Close()
+	if texto := conteudo(t, volume, "/a.txt"); texto != "novo" {
+		t.Fatalf("depois do O_TRUNC o conteúdo deveria ser 'novo', é %q", texto)
+	}
+	erro = meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a.txt"}, meufs.AtributoSomenteLeitura)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = volume.OpenFile("/a.txt", os.O_WRONLY|os.O_TRUNC, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("O_TRUNC em arquivo somente leitura: esperava fs.ErrPermission, veio %v", erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "novo" {
+		t.Fatalf("o O_TRUNC recusado não pode mudar o conteúdo, que ficou %q", texto)
+	}
+}
+
+func TestOpenFileAnexar(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/log.txt", "um\n")
+	erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"log.txt"}, meufs.AtributoSomenteAnexar)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = volume.OpenFile("/log.txt", os.O_WRONLY, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("somente anexar sem O_APPEND: esperava fs.ErrPermission, veio %v", erro)
+	}
+	if _, erro = volume.OpenFile("/log.txt", os.O_WRONLY|os.O_APPEND|os.O_TRUNC, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("somente anexar com O_TRUNC: esperava fs.ErrPermission, veio %v", erro)
+	}
+	arquivo, erro := volume.OpenFile("/log.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	// Com O_APPEND a escrita vai para o fim mesmo depois de voltar ao início
+	arquivo.Seek(0, io.SeekStart)
+	if _, erro = arquivo.Write([]byte("dois\n")); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = arquivo.WriteAt([]byte("x"), 0); erro == nil {
+		t.Fatal("WriteAt com O_APPEND deveria falhar")
+	}
+	arquivo.Close()
+	if texto := conteudo(t, volume, "/log.txt"); texto != "um\ndois\n" {
+		t.Fatalf("conteúdo depois do O_APPEND: %q", texto)
+	}
+}
+
+func TestOpenFilePermissoes(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/segredo.txt", "só do root")
+	if erro := meufs.DefinirModo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"segredo.txt"}, 0600); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "privado", true, nil); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := meufs.DefinirModo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"privado"}, 0755); erro != nil {
+		t.Fatal(erro)
+	}
+	volume.Identidade = meufs.Identidade{Uid: 1000, Gid: 1000}
+	if _, erro := volume.Open("/segredo.txt"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("leitura sem permissão: esperava fs.ErrPermission, veio %v", erro)
+	}
+	if _, erro := volume.OpenFile("/segredo.txt", os.O_WRONLY|os.O_APPEND, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("escrita sem permissão: esperava fs.ErrPermission, veio %v", erro)
+	}
+	if _, erro := volume.OpenFile("/privado/novo.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("criação sem permissão no diretório: esperava fs.ErrPermission, veio %v", erro)
+	}
+	// As funções que alteram o conteúdo também conferem a identidade, sem passar pelo OpenFile
+	_, erro := meufs.EscreverNoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"segredo.txt"}, nil, 0, []byte("x"))
+	if !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("EscreverNoArquivo sem permissão: esperava fs.ErrPermission, veio %v", erro)
+	}
+	_, erro = meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"segredo.txt"}, nil, 0)
+	if !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("TruncarArquivo sem permissão: esperava fs.ErrPermission, veio %v", erro)
+	}
+	volume.Identidade = meufs.IdentidadeRoot
+	if texto := conteudo(t, volume, "/segredo.txt"); texto != "só do root" {
+		t.Fatalf("o conteúdo não podia mudar, ficou %q", texto)
+	}
+}
+
+func TestIdentidadeZero(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/do-root.txt", "root")
+	if erro := meufs.DefinirModo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"do-root.txt"}, 0640); erro != nil {
+		t.Fatal(erro)
+	}
+	// Um Volume montado sem identidade não pode nada além dos bits dos outros, mesmo nas entradas do uid 0
+	volume.Identidade = meufs.Identidade{}
+	if _, erro := volume.Open("/do-root.txt"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("a identidade zero não deveria ler um arquivo 0640 do root, veio %v", erro)
+	}
+	if erro := meufs.DefinirModo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"do-root.txt"}, 0666); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("a identidade zero não é dona do arquivo do root, chmod veio %v", erro)
+	}
+	if erro := meufs.CriarSnapshot(volume.Cabecalho, volume.Arquivo, volume.Identidade, "s"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("a identidade zero não é o root e não deveria criar snapshots, veio %v", erro)
+	}
+	// Mesmo no root, que é 1777, ela não cria entradas, que ficariam sem dono
+	if _, erro := volume.Create("/de-ninguem.txt"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("a identidade zero não deveria criar arquivos, veio %v", erro)
+	}
+}
+
+func TestCadeiaCorrompida(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", strings.Repeat("a", 10000))
+	inicio := enderecoFAT(t, volume, "a.txt")
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	blocos, erro := meufs.CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	// Um laço do último bloco de volta ao primeiro e um bloco fora da FAT precisam virar erro, não um loop infinito
+	// nem um pânico
+	for _, proximo := range []uint32{inicio, uint32(len(fat)) + 10} {
+		fat[blocos[len(blocos)-1]] = proximo
+		if erro = meufs.SalvarFAT(volume.Cabecalho, volume.Arquivo, fat); erro != nil {
+			t.Fatal(erro)
+		}
+		if _, erro = meufs.CadeiaDeBlocos(fat, inicio); !errors.Is(erro, meufs.ErrCadeiaCorrompida) {
+			t.Fatalf("a cadeia que segue para %d deveria falhar com ErrCadeiaCorrompida, veio %v", proximo, erro)
+		}
+		arquivo, erro := volume.Open("/a.txt")
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if _, erro = io.ReadAll(arquivo); !errors.Is(erro, meufs.ErrCadeiaCorrompida) {
+			t.Fatalf("ler a cadeia que segue para %d deveria falhar com ErrCadeiaCorrompida, veio %v", proximo, erro)
+		}
+		arquivo.Close()
+		relatorio, erro := meufs.VerificarFS(volume.Cabecalho, volume.Arquivo)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if relatorio.Ok {
+			t.Fatalf("o fsck deveria apontar a cadeia que segue para %d", proximo)
+		}
+	}
+	if _, erro = meufs.CadeiaDeBlocos(fat, uint32(len(fat))); !errors.Is(erro, meufs.ErrCadeiaCorrompida) {
+		t.Fatalf("uma cadeia que começa fora da FAT deveria falhar com ErrCadeiaCorrompida, veio %v", erro)
+	}
+}
@@ -0,0 +1,201 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Atributos de uma entrada, combinados como bits no campo Atributos. O bit de AtributoSomenteLeitura é o mesmo
+// do antigo campo Protegido, então as entradas protegidas por versões anteriores continuam somente leitura
+const (
+	// AtributoSomenteLeitura impede alterar o conteúdo e remover a entrada, mas não renomeá-la ou movê-la
+	AtributoSomenteLeitura uint8 = 1 << iota
+	// AtributoImutavel impede qualquer mudança na entrada: conteúdo, nome, lugar, modo, dono e datas.
+	// Em um diretório, também impede criar, remover e renomear entradas dentro dele
+	AtributoImutavel
+	// AtributoSomenteAnexar só deixa o conteúdo crescer pelo fim e impede remover, renomear e mudar modo, dono e
+	// datas. Em um diretório, entradas podem ser criadas dentro dele, mas não removidas nem renomeadas
+	AtributoSomenteAnexar
+	// AtributoOculto tira a entrada da listagem padrão do ls
+	AtributoOculto
+	// AtributoSistema marca arquivos do sistema, que também ficam fora da listagem padrão do ls
+	AtributoSistema
+	// AtributoCifrado indica que o conteúdo está cifrado com AES-GCM (ver cifra.go). Não é mudado pelo chattr, e sim
+	// pelo encrypt e pelo decrypt
+	AtributoCifrado
+	// AtributoComprimido indica que o conteúdo está comprimido com DEFLATE (ver compressao.go). Não é mudado pelo
+	// chattr, e sim pelo compress e pelo decompress
+	AtributoComprimido
+)
+
+// atributosDoRoot só podem ser ligados ou desligados pelo root, como o CAP_LINUX_IMMUTABLE do chattr
+const atributosDoRoot = AtributoImutavel | AtributoSomenteAnexar | AtributoSistema
+
+// atributosDoConteudo dizem como o conteúdo está guardado e são mantidos pelo chattr
+const atributosDoConteudo = AtributoCifrado | AtributoComprimido
+
+// letrasAtributos são as letras do lsattr e do chattr, na ordem dos bits
+var letrasAtributos = []struct {
+	letra    byte
+	atributo uint8
+}{
+	{'r', AtributoSomenteLeitura},
+	{'i', AtributoImutavel},
+	{'a', AtributoSomenteAnexar},
+	{'h', AtributoOculto},
+	{'s', AtributoSistema},
+	{'E', AtributoCifrado},
+	{'c', AtributoComprimido},
+}
+
+// TextoDosAtributos formata os atributos como no lsattr, uma letra por atributo e '-' nos desligados (ex: r--h---)
+func TextoDosAtributos(atributos uint8) string {
+	texto := make([]byte, len(letrasAtributos))
+	for indice, item := range letrasAtributos {
+		texto[indice] = '-'
+		if atributos&item.atributo != 0 {
+			texto[indice] = item.letra
+		}
+	}
+	return string(texto)
+}
+
+// MudarAtributos aplica aos atributos atuais uma mudança no formato do chattr: +letras liga, -letras desliga e
+// =letras define exatamente os atributos, podendo combinar grupos (ex: +i-a). As letras são r, i, a, h e s, e os
+// atributosDoConteudo nunca mudam
+func MudarAtributos(atuais uint8, mudanca string) (uint8, error) {
+	if mudanca == "" || !strings.ContainsRune("+-=", rune(mudanca[0])) {
+		return 0, fmt.Errorf("mudança de atributos inválida '%s', use +, - ou = seguido de r, i, a, h ou s", mudanca)
+	}
+	atributos := atuais
+	var operacao byte
+	for indice := 0; indice < len(mudanca); indice++ {
+		caractere := mudanca[indice]
+		if strings.IndexByte("+-=", caractere) != -1 {
+			operacao = caractere
+			if operacao == '=' {
+				atributos &= atributosDoConteudo
+			}
+			continue
+		}
+		atributo := uint8(0)
+		for _, item := range letrasAtributos {
+			if item.letra == caractere {
+				atributo = item.atributo
+			}
+		}
+		switch atributo {
+		case AtributoCifrado:
+			return 0, errors.New("o atributo E é mudado pelos comandos encrypt e decrypt")
+		case AtributoComprimido:
+			return 0, errors.New("o atributo c é mudado pelos comandos compress e decompress")
+		}
+		if atributo == 0 {
+			return 0, fmt.Errorf("atributo desconhecido '%c', use r, i, a, h ou s", caractere)
+		}
+		if operacao == '-' {
+			atributos &^= atributo
+		} else {
+			atributos |= atributo
+		}
+	}
+	return atributos, nil
+}
+
+// DefinirAtributos troca os atributos da entrada indicada pelo caminho, o que só o dono e o root podem fazer.
+// Ligar ou desligar os atributos imutável, somente anexar e sistema é só para o root, e se o volume tiver senha
+// de administrador desligar o somente leitura pede a senha
+func DefinirAtributos(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, atributos uint8) error {
+	if len(caminho) == 0 {
+		return NovoErroFS(fs.ErrPermission, "os atributos do root não podem ser alterados")
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	entrada := &dir.Entradas[indice]
+	if erro = verificarDono(identidade, *entrada, caminho); erro != nil {
+		return erro
+	}
+	if (entrada.Atributos^atributos)&atributosDoConteudo != 0 {
+		return NovoErroFS(fs.ErrInvalid, "os atributos que dizem como o conteúdo de '/%s' está guardado não podem ser mudados", strings.Join(caminho, "/"))
+	}
+	if (entrada.Atributos^atributos)&atributosDoRoot != 0 && !identidade.EhRoot() {
+		return NovoErroFS(fs.ErrPermission, "só o root pode mudar os atributos i, a e s de '/%s'", strings.Join(caminho, "/"))
+	}
+	if entrada.Atributos&^atributos&AtributoSomenteLeitura != 0 {
+		if erro = exigirSenhaAdmin(cabecalho, meuFS, identidade); erro != nil {
+			return erro
+		}
+	}
+	entrada.Atributos = atributos
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// EhOculta informa se a entrada fica fora da listagem padrão, por ser oculta ou do sistema
+func EhOculta(entrada DiretorioRoot) bool {
+	return entrada.Atributos&(AtributoOculto|AtributoSistema) != 0
+}
+
+// verificarConteudo confere se os atributos deixam alterar o conteúdo da entrada. Com anexando, a alteração
+// só acrescenta dados no fim, o que os arquivos somente anexar aceitam
+func verificarConteudo(entrada DiretorioRoot, caminho []string, anexando bool) error {
+	switch {
+	case entrada.Atributos&AtributoImutavel != 0:
+		return erroDeAtributo(caminho, AtributoImutavel)
+	case entrada.Atributos&AtributoSomenteLeitura != 0:
+		return erroDeAtributo(caminho, AtributoSomenteLeitura)
+	case entrada.Atributos&AtributoSomenteAnexar != 0 && !anexando:
+		return erroDeAtributo(caminho, AtributoSomenteAnexar)
+	}
+	return nil
+}
+
+// verificarRemocao confere se os atributos deixam remover a entrada
+func verificarRemocao(entrada DiretorioRoot, caminho []string) error {
+	if erro := verificarEntradaAlteravel(entrada, caminho); erro != nil {
+		return erro
+	}
+	if entrada.Atributos&AtributoSomenteLeitura != 0 {
+		return erroDeAtributo(caminho, AtributoSomenteLeitura)
+	}
+	return nil
+}
+
+// verificarEntradaAlteravel confere se os atributos deixam renomear ou mover a entrada e mudar seu modo, dono e datas,
+// o que as entradas imutáveis e somente anexar não deixam
+func verificarEntradaAlteravel(entrada DiretorioRoot, caminho []string) error {
+	for _, atributo := range []uint8{AtributoImutavel, AtributoSomenteAnexar} {
+		if entrada.Atributos&atributo != 0 {
+			return erroDeAtributo(caminho, atributo)
+		}
+	}
+	return nil
+}
+
+// verificarDiretorioAlteravel confere se os atributos do diretório deixam mudar as suas entradas. Criando, só o
+// imutável impede; removendo ou renomeando, o somente anexar também impede
+func verificarDiretorioAlteravel(entradaDir DiretorioRoot, caminhoDir []string, criando bool) error {
+	if entradaDir.Atributos&AtributoImutavel != 0 {
+		return erroDeAtributo(caminhoDir, AtributoImutavel)
+	}
+	if entradaDir.Atributos&AtributoSomenteAnexar != 0 && !criando {
+		return erroDeAtributo(caminhoDir, AtributoSomenteAnexar)
+	}
+	return nil
+}
+
+// erroDeAtributo monta o erro de uma operação recusada pelo atributo da entrada
+func erroDeAtributo(caminho []string, atributo uint8) error {
+	descricao := map[uint8]string{
+		AtributoSomenteLeitura: "é somente leitura",
+		AtributoImutavel:       "é imutável",
+		AtributoSomenteAnexar:  "é somente anexar",
+	}[atributo]
+	return NovoErroFS(fs.ErrPermission, "'/%s' %s", strings.Join(caminho, "/"), descricao)
+}
@@ -0,0 +1,173 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestMudarAtributos(t *testing.T) {
+	casos := []struct {
+		atuais   uint8
+		mudanca  string
+		esperado string
+	}{
+		{0, "+rh", "r--h---"},
+		{meufs.AtributoSomenteLeitura | meufs.AtributoOculto, "-r", "---h---"},
+		{meufs.AtributoOculto, "+i-h", "-i-----"},
+		{meufs.AtributoSomenteLeitura, "=as", "--a-s--"},
+		// O = mantém os atributos que dizem como o conteúdo está guardado
+		{meufs.AtributoCifrado | meufs.AtributoOculto, "=r", "r----E-"},
+	}
+	for _, caso := range casos {
+		atributos, erro := meufs.MudarAtributos(caso.atuais, caso.mudanca)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if texto := meufs.TextoDosAtributos(atributos); texto != caso.esperado {
+			t.Errorf("%s sobre %s deveria dar %s, deu %s", caso.mudanca, meufs.TextoDosAtributos(caso.atuais), caso.esperado, texto)
+		}
+	}
+	for _, mudanca := range []string{"", "r", "+x", "+E", "-c"} {
+		if _, erro := meufs.MudarAtributos(0, mudanca); erro == nil {
+			t.Errorf("a mudança %q deveria ser recusada", mudanca)
+		}
+	}
+}
+
+func TestAtributoImutavel(t *testing.T) {
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "dir")
+	gravar(t, volume, "/dir/a.txt", "fixo")
+	definir := func(atributos uint8, caminho ...string) {
+		t.Helper()
+		if erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, atributos); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	arquivo := []string{"dir", "a.txt"}
+	definir(meufs.AtributoImutavel, arquivo...)
+	operacoes := map[string]func() error{
+		"anexar": func() error {
+			_, erro := meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, nil, []byte("x"))
+			return erro
+		},
+		"renomear": func() error {
+			return meufs.RenomearEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, "b.txt")
+		},
+		"remover": func() error {
+			return meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo)
+		},
+		"mudar o modo": func() error {
+			return meufs.DefinirModo(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, 0600)
+		},
+	}
+	for nome, operacao := range operacoes {
+		if erro := operacao(); !errors.Is(erro, fs.ErrPermission) {
+			t.Errorf("%s um arquivo imutável deveria falhar com fs.ErrPermission, falhou com %v", nome, erro)
+		}
+	}
+	if texto := conteudo(t, volume, "/dir/a.txt"); texto != "fixo" {
+		t.Fatalf("o arquivo imutável não deveria ter mudado, tem %q", texto)
+	}
+
+	// Um diretório imutável não aceita entradas novas
+	definir(meufs.AtributoImutavel, "dir")
+	if _, erro := meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"dir"}, "novo", false, nil); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("criar em um diretório imutável deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+
+	// Só o root liga ou desliga o imutável, mesmo sendo o dono
+	definir(0, "dir")
+	definir(0, arquivo...)
+	if erro := meufs.DefinirDono(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, 1000, 1000); erro != nil {
+		t.Fatal(erro)
+	}
+	usuario := meufs.Identidade{Uid: 1000, Gid: 1000}
+	if erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, usuario, arquivo, meufs.AtributoImutavel); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("um usuário comum ligando o imutável deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	if erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, usuario, arquivo, meufs.AtributoOculto); erro != nil {
+		t.Fatalf("o dono deveria poder ligar o oculto: %v", erro)
+	}
+}
+
+func TestAtributoSomenteAnexar(t *testing.T) {
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "logs")
+	gravar(t, volume, "/logs/log.txt", "um\n")
+	arquivo := []string{"logs", "log.txt"}
+	for _, caminho := range [][]string{arquivo, {"logs"}} {
+		if erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, meufs.AtributoSomenteAnexar); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	if _, erro := meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, nil, []byte("dois\n")); erro != nil {
+		t.Fatalf("acrescentar a um arquivo somente anexar deveria funcionar: %v", erro)
+	}
+	if _, erro := meufs.SubstituirConteudo(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, nil, []byte("x")); !errors.Is(erro, fs.ErrPermission) {
+		t.Errorf("substituir deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	if _, erro := meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, arquivo, nil, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Errorf("truncar deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	if texto := conteudo(t, volume, "/logs/log.txt"); texto != "um\ndois\n" {
+		t.Fatalf("o arquivo somente anexar só deveria ter crescido, tem %q", texto)
+	}
+	// No diretório somente anexar dá para criar, mas não remover
+	if _, erro := meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"logs"}, "outro.txt", false, nil); erro != nil {
+		t.Fatalf("criar em um diretório somente anexar deveria funcionar: %v", erro)
+	}
+	if erro := meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"logs", "outro.txt"}); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("remover de um diretório somente anexar deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+}
+
+func TestAtributosOcultos(t *testing.T) {
+	volume := novoVolume(t)
+	for _, nome := range []string{"visivel", "oculto", "sistema"} {
+		gravar(t, volume, "/"+nome, nome)
+	}
+	for nome, atributo := range map[string]uint8{"oculto": meufs.AtributoOculto, "sistema": meufs.AtributoSistema} {
+		if erro := meufs.DefinirAtributos(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{nome}, atributo); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	for todas, esperado := range map[bool]string{false: "visivel", true: "visivel oculto sistema"} {
+		infos, erro := meufs.ListarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, todas)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if nomes := nomesDe(infos); nomes != esperado {
+			t.Errorf("a listagem com todas=%v deveria ter %q, tem %q", todas, esperado, nomes)
+		}
+	}
+}
+
+func TestShellAtributos(t *testing.T) {
+	volume := novoVolume(t)
+	shell := novoShell(volume)
+	executar(t, shell, "mkdir dir")
+	executar(t, shell, "chattr +hr dir")
+	if saida := executar(t, shell, "ls"); strings.Contains(saida, "dir") {
+		t.Fatalf("o ls não deveria mostrar o diretório oculto: %q", saida)
+	}
+	if saida := executar(t, shell, "ls -a"); !strings.Contains(saida, "dir") {
+		t.Fatalf("o ls -a deveria mostrar o diretório oculto: %q", saida)
+	}
+	if saida := executar(t, shell, "lsattr -a"); strings.TrimSpace(saida) != "r--h--- dir" {
+		t.Fatalf("saída do lsattr -a inesperada: %q", saida)
+	}
+	executar(t, shell, "chattr =h dir")
+	if saida := executar(t, shell, "lsattr -a"); strings.TrimSpace(saida) != "---h--- dir" {
+		t.Fatalf("o chattr = deveria ter deixado só o h: %q", saida)
+	}
+	for _, linha := range [][]string{{"chattr", "+E", "dir"}, {"chattr", "+h", "/"}, {"chattr", "x", "dir"}} {
+		if _, erro := shell.ExecutarComando(linha); erro == nil {
+			t.Errorf("%q deveria falhar", linha)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package meufs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Um arquivo cifrado (com AtributoCifrado) guarda na sua cadeia primeiro o cabecalhoCifra, seguido da tabela com o
+// nonce e a tag do AES-GCM de cada bloco de conteúdo, ocupando quantos blocos forem necessários, e depois o conteúdo
+// cifrado. Como o GCM não muda o tamanho dos dados, cada bloco de conteúdo cifrado corresponde ao mesmo bloco do
+// conteúdo original, o que permite ler só os blocos de um trecho. A chave é derivada da senha com o scrypt
+
+// magicaCifra identifica o cabeçalho de um arquivo cifrado
+var magicaCifra = [4]byte{'M', 'F', 'S', 'C'}
+
+// versaoCifra é a versão dos arquivos cifrados gravados por esta versão do meufs. A partir da versão 2, o último
+// bloco de conteúdo autentica também o tamanho do arquivo, e um arquivo vazio guarda o selo de um bloco vazio, para
+// que cortar o arquivo no limite de um bloco seja percebido. Arquivos da versão 1 continuam legíveis
+const versaoCifra = 2
+
+// cabecalhoCifra fica no início do primeiro bloco de um arquivo cifrado
+type cabecalhoCifra struct {
+	Magica      [4]byte
+	CustoLog2   uint8 // Parâmetros do scrypt: n = 2^CustoLog2, r e p
+	BlocosR     uint8
+	Paralelismo uint8
+	Versao      uint8
+	Sal         [16]byte
+	// 16 bytes zerados cifrados com a chave, que permitem recusar uma senha errada antes de ler o conteúdo
+	NonceVerificador [12]byte
+	Verificador      [32]byte
+}
+
+// selo é o nonce e a tag do AES-GCM de um bloco de conteúdo, guardados na tabela depois do cabecalhoCifra
+type selo struct {
+	Nonce [12]byte
+	Tag   [16]byte
+}
+
+// ErrArquivoCifrado é retornado, também reconhecido como fs.ErrPermission, quando o conteúdo de um arquivo
+// cifrado é lido ou alterado sem a cifra dele
+var ErrArquivoCifrado error = &ErroFS{Mensagem: "o arquivo está cifrado, é preciso a senha dele", Tipo: fs.ErrPermission}
+
+// CifraArquivo é a chave de um arquivo cifrado, derivada da senha e do sal do arquivo. Derivar a chave é lento de
+// propósito, então ela é aberta uma vez (por comando ou por handle) e usada em todas as leituras e escritas
+type CifraArquivo struct {
+	cabecalho cabecalhoCifra
+	aead      cipher.AEAD
+}
+
+// NovaCifraArquivo deriva da senha uma chave com sal novo, para cifrar um arquivo com CifrarArquivo ou GravarCifrado
+func NovaCifraArquivo(senha string) (*CifraArquivo, error) {
+	if senha == "" {
+		return nil, errors.New("a senha do arquivo não pode ser vazia")
+	}
+	cabecalho := cabecalhoCifra{Magica: magicaCifra, CustoLog2: custoLog2Senha, BlocosR: blocosRSenha, Paralelismo: paralelismoSenha, Versao: versaoCifra}
+	if _, erro := rand.Read(cabecalho.Sal[:]); erro != nil {
+		return nil, fmt.Errorf("erro ao gerar o sal do arquivo: %w", erro)
+	}
+	cifra, erro := derivarCifra(cabecalho, senha)
+	if erro != nil {
+		return nil, erro
+	}
+	if _, erro = rand.Read(cifra.cabecalho.NonceVerificador[:]); erro != nil {
+		return nil, fmt.Errorf("erro ao gerar o nonce do arquivo: %w", erro)
+	}
+	cifra.aead.Seal(cifra.cabecalho.Verificador[:0], cifra.cabecalho.NonceVerificador[:], make([]byte, 16), cifra.cabecalho.Sal[:])
+	return cifra, nil
+}
+
+// AbrirCifra deriva a chave do arquivo cifrado a partir da senha e a confere, sem ler nada do conteúdo. Arquivos
+// que não são cifrados retornam nil, que é a cifra que as funções de conteúdo esperam para eles
+func AbrirCifra(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot, senha string) (*CifraArquivo, error) {
+	if entrada.Atributos&AtributoCifrado == 0 {
+		return nil, nil
+	}
+	if senha == "" {
+		return nil, ErrArquivoCifrado
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return nil, erro
+	}
+	lido, selos, erro := lerCabecalhoCifra(cabecalho, meuFS, blocos, entrada.Tamanho)
+	if erro != nil {
+		return nil, erro
+	}
+	cifra, erro := derivarCifra(lido, senha)
+	if erro != nil {
+		return nil, erro
+	}
+	if _, erro = cifra.aead.Open(nil, lido.NonceVerificador[:], lido.Verificador[:], lido.Sal[:]); erro != nil {
+		return nil, NovoErroFS(fs.ErrPermission, "senha do arquivo cifrado incorreta")
+	}
+	cifra.cabecalho = lido
+	// Um arquivo vazio não tem blocos para ler, então o selo do bloco vazio, que mostra que ele não foi cortado,
+	// é conferido aqui
+	if entrada.Tamanho == 0 && lido.Versao >= 2 {
+		if _, erro = cifra.aead.Open(nil, selos[0].Nonce[:], selos[0].Tag[:], cifra.dadosAdicionais(lido.Versao, 0, 0, cabecalho.TamanhoBloco)); erro != nil {
+			return nil, errors.New("o arquivo cifrado foi corrompido ou alterado")
+		}
+	}
+	return cifra, nil
+}
+
+// derivarCifra deriva a chave AES-256 da senha com os parâmetros e o sal do cabeçalho
+func derivarCifra(cabecalho cabecalhoCifra, senha string) (*CifraArquivo, error) {
+	if cabecalho.CustoLog2 >= 31 {
+		return nil, errors.New("parâmetros da cifra do arquivo inválidos")
+	}
+	chave, erro := derivarChave([]byte(senha), cabecalho.Sal[:], 1<<cabecalho.CustoLog2, int(cabecalho.BlocosR), int(cabecalho.Paralelismo), 32)
+	if erro != nil {
+		return nil, erro
+	}
+	bloco, erro := aes.NewCipher(chave)
+	if erro != nil {
+		return nil, erro
+	}
+	aead, erro := cipher.NewGCM(bloco)
+	if erro != nil {
+		return nil, erro
+	}
+	return &CifraArquivo{cabecalho: cabecalho, aead: aead}, nil
+}
+
+// blocosDoCabecalhoCifra é quantos blocos o cabeçalho e a tabela de selos ocupam em um arquivo com
+// blocosDeConteudo blocos. Mesmo um arquivo cifrado vazio tem o bloco do cabeçalho
+func blocosDoCabecalhoCifra(tamanhoBloco uint32, blocosDeConteudo int) int {
+	tamanho := binary.Size(cabecalhoCifra{}) + blocosDeConteudo*binary.Size(selo{})
+	return (tamanho + int(tamanhoBloco) - 1) / int(tamanhoBloco)
+}
+
+// BlocosDoArquivoCifrado é quantos blocos um arquivo cifrado com o tamanho informado ocupa
+func BlocosDoArquivoCifrado(tamanhoBloco uint32, tamanho uint32) int {
+	blocosDeConteudo := int((int64(tamanho) + int64(tamanhoBloco) - 1) / int64(tamanhoBloco))
+	return blocosDoCabecalhoCifra(tamanhoBloco, blocosDeConteudo) + blocosDeConteudo
+}
+
+// lerCabecalhoCifra lê o cabeçalho e a tabela de selos de um arquivo cifrado com o tamanho informado,
+// conferindo se a cadeia tem os blocos esperados. A tabela tem ao menos um selo, o do bloco vazio de um arquivo
+// vazio (zerado na versão 1)
+func lerCabecalhoCifra(cabecalho Cabecalho, meuFS *MeuFS, blocos []uint32, tamanho uint32) (cabecalhoCifra, []selo, error) {
+	if len(blocos) != BlocosDoArquivoCifrado(cabecalho.TamanhoBloco, tamanho) {
+		return cabecalhoCifra{}, nil, errors.New("a cadeia do arquivo cifrado não corresponde ao seu tamanho")
+	}
+	tamanhoBloco := int(cabecalho.TamanhoBloco)
+	blocosDeConteudo := (int(tamanho) + tamanhoBloco - 1) / tamanhoBloco
+	dados := make([]byte, blocosDoCabecalhoCifra(cabecalho.TamanhoBloco, blocosDeConteudo)*tamanhoBloco)
+	for i := 0; i*tamanhoBloco < len(dados); i++ {
+		if _, erro := meuFS.ReadAt(dados[i*tamanhoBloco:(i+1)*tamanhoBloco], PosicaoDoBloco(cabecalho, blocos[i])); erro != nil {
+			return cabecalhoCifra{}, nil, fmt.Errorf("erro ao ler o cabeçalho do arquivo cifrado: %w", erro)
+		}
+	}
+	leitor := bytes.NewReader(dados)
+	var lido cabecalhoCifra
+	selos := make([]selo, max(blocosDeConteudo, 1))
+	if erro := binary.Read(leitor, binary.LittleEndian, &lido); erro != nil {
+		return cabecalhoCifra{}, nil, fmt.Errorf("erro ao ler o cabeçalho do arquivo cifrado: %w", erro)
+	}
+	if lido.Magica != magicaCifra {
+		return cabecalhoCifra{}, nil, errors.New("o cabeçalho do arquivo cifrado está corrompido")
+	}
+	if erro := binary.Read(leitor, binary.LittleEndian, selos); erro != nil {
+		return cabecalhoCifra{}, nil, fmt.Errorf("erro ao ler os selos do arquivo cifrado: %w", erro)
+	}
+	return lido, selos, nil
+}
+
+// dadosAdicionais autenticam, junto com cada bloco, o sal do arquivo e a posição do bloco, para que blocos não
+// possam ser trocados de lugar nem entre arquivos. A partir da versão 2, o último bloco autentica também o tamanho
+// do arquivo e uma marca de fim, para que o arquivo não possa ser cortado
+func (c *CifraArquivo) dadosAdicionais(versao uint8, indice int, tamanho uint32, tamanhoBloco uint32) []byte {
+	dados := make([]byte, len(c.cabecalho.Sal)+8, len(c.cabecalho.Sal)+17)
+	copy(dados, c.cabecalho.Sal[:])
+	binary.LittleEndian.PutUint64(dados[len(c.cabecalho.Sal):], uint64(indice))
+	ultimo := max((int64(tamanho)+int64(tamanhoBloco)-1)/int64(tamanhoBloco)-1, 0)
+	if versao >= 2 && int64(indice) == ultimo {
+		dados = binary.LittleEndian.AppendUint64(dados, uint64(tamanho))
+		dados = append(dados, 1)
+	}
+	return dados
+}
+
+// cifrar monta o conteúdo da cadeia de um arquivo cifrado com os dados, com nonces novos em todos os blocos e na
+// versão atual. O resultado ocupa um número inteiro de blocos
+func (c *CifraArquivo) cifrar(tamanhoBloco uint32, dados []byte) ([]byte, error) {
+	blocosDeConteudo := (len(dados) + int(tamanhoBloco) - 1) / int(tamanhoBloco)
+	inicio := blocosDoCabecalhoCifra(tamanhoBloco, blocosDeConteudo) * int(tamanhoBloco)
+	cadeia := make([]byte, inicio+blocosDeConteudo*int(tamanhoBloco))
+	selos := make([]selo, max(blocosDeConteudo, 1))
+	for i := range selos {
+		if _, erro := rand.Read(selos[i].Nonce[:]); erro != nil {
+			return nil, fmt.Errorf("erro ao gerar o nonce do bloco: %w", erro)
+		}
+		bloco := dados[min(i*int(tamanhoBloco), len(dados)):min((i+1)*int(tamanhoBloco), len(dados))]
+		selado := c.aead.Seal(nil, selos[i].Nonce[:], bloco, c.dadosAdicionais(versaoCifra, i, uint32(len(dados)), tamanhoBloco))
+		copy(cadeia[inicio+i*int(tamanhoBloco):], selado[:len(bloco)])
+		copy(selos[i].Tag[:], selado[len(bloco):])
+	}
+	cabecalhoAtual := c.cabecalho
+	cabecalhoAtual.Versao = versaoCifra
+	var cabecalho bytes.Buffer
+	binary.Write(&cabecalho, binary.LittleEndian, cabecalhoAtual)
+	binary.Write(&cabecalho, binary.LittleEndian, selos)
+	copy(cadeia, cabecalho.Bytes())
+	return cadeia, nil
+}
+
+// copiarCifrado decifra os blocos do trecho [offset, fim) do arquivo e escreve o trecho no destino. O destino só
+// recebe os dados depois que todos os blocos do trecho foram conferidos, então um bloco alterado não deixa
+// uma saída pela metade
+func copiarCifrado(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot, cifra *CifraArquivo, destino io.Writer, offset int64, fim int64) error {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return erro
+	}
+	lido, selos, erro := lerCabecalhoCifra(cabecalho, meuFS, blocos, entrada.Tamanho)
+	if erro != nil {
+		return erro
+	}
+	if lido.Sal != cifra.cabecalho.Sal {
+		return errors.New("a cifra informada não é a deste arquivo")
+	}
+	tamanhoBloco := int64(cabecalho.TamanhoBloco)
+	blocos = blocos[len(blocos)-int((int64(entrada.Tamanho)+tamanhoBloco-1)/tamanhoBloco):]
+	var conteudo bytes.Buffer
+	bloco := make([]byte, tamanhoBloco+int64(cifra.aead.Overhead()))
+	for i := offset / tamanhoBloco; i*tamanhoBloco < fim; i++ {
+		tamanho := min(tamanhoBloco, int64(entrada.Tamanho)-i*tamanhoBloco)
+		if _, erro = meuFS.ReadAt(bloco[:tamanho], PosicaoDoBloco(cabecalho, blocos[i])); erro != nil {
+			return fmt.Errorf("erro ao ler bloco do arquivo: %w", erro)
+		}
+		copy(bloco[tamanho:], selos[i].Tag[:])
+		aberto, erro := cifra.aead.Open(nil, selos[i].Nonce[:], bloco[:tamanho+int64(len(selos[i].Tag))], cifra.dadosAdicionais(lido.Versao, int(i), entrada.Tamanho, cabecalho.TamanhoBloco))
+		if erro != nil {
+			return fmt.Errorf("o bloco %d do arquivo cifrado foi corrompido ou alterado", i)
+		}
+		de := max(offset-i*tamanhoBloco, 0)
+		ate := min(fim-i*tamanhoBloco, tamanho)
+		conteudo.Write(aberto[de:ate])
+	}
+	if _, erro = destino.Write(conteudo.Bytes()); erro != nil {
+		return fmt.Errorf("erro ao escrever conteúdo do arquivo: %w", erro)
+	}
+	return nil
+}
+
+// gravarCifrado troca o conteúdo do arquivo pelos dados cifrados com a cifra, reaproveitando os blocos da cadeia,
+// e atualiza a entrada em memória. Altera só a FAT em memória
+func gravarCifrado(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada *DiretorioRoot, cifra *CifraArquivo, dados []byte) error {
+	cadeia, erro := cifra.cifrar(cabecalho.TamanhoBloco, dados)
+	if erro != nil {
+		return erro
+	}
+	blocos, erro := redimensionarCadeia(cabecalho, meuFS, fat, entrada.EnderecoFAT, len(cadeia)/int(cabecalho.TamanhoBloco))
+	if erro != nil {
+		return erro
+	}
+	if erro = escreverNosBlocos(cabecalho, meuFS, blocos, 0, cadeia); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = blocos[0]
+	entrada.Tamanho = uint32(len(dados))
+	entrada.Atributos = entrada.Atributos&^atributosDoConteudo | AtributoCifrado
+	return nil
+}
+
+// GravarCifrado troca todo o conteúdo do arquivo pelos dados cifrados com a cifra, que pode ser nova (então
+// o arquivo passa a usar a senha dela) ou a do próprio arquivo. Os dados nunca chegam ao meufs sem cifra. Pede
+// escrita no arquivo e respeita os atributos, como SubstituirConteudo
+func GravarCifrado(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, dados []byte) (DiretorioRoot, error) {
+	return trocarCifra(cabecalho, meuFS, identidade, caminho, AcessoEscrita, func(DiretorioRoot) (*CifraArquivo, []byte, error) {
+		return cifra, dados, nil
+	})
+}
+
+// CifrarArquivo cifra com a cifra o conteúdo de um arquivo que ainda não é cifrado. Um arquivo comprimido é guardado
+// cifrado sem a compressão. Pede leitura e escrita no arquivo
+func CifrarArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo) error {
+	_, erro := trocarCifra(cabecalho, meuFS, identidade, caminho, AcessoLeitura|AcessoEscrita, func(entrada DiretorioRoot) (*CifraArquivo, []byte, error) {
+		if entrada.Atributos&AtributoCifrado != 0 {
+			return nil, nil, fmt.Errorf("'/%s' já está cifrado", strings.Join(caminho, "/"))
+		}
+		dados, erro := LerConteudo(cabecalho, meuFS, entrada, nil)
+		return cifra, dados, erro
+	})
+	return erro
+}
+
+// DecifrarArquivo guarda sem cifra o conteúdo de um arquivo cifrado, aberto com a cifra dele. Pede leitura e escrita
+// no arquivo
+func DecifrarArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo) error {
+	_, erro := trocarCifra(cabecalho, meuFS, identidade, caminho, AcessoLeitura|AcessoEscrita, func(entrada DiretorioRoot) (*CifraArquivo, []byte, error) {
+		if entrada.Atributos&AtributoCifrado == 0 {
+			return nil, nil, fmt.Errorf("'/%s' não está cifrado", strings.Join(caminho, "/"))
+		}
+		dados, erro := LerConteudo(cabecalho, meuFS, entrada, cifra)
+		return nil, dados, erro
+	})
+	return erro
+}
+
+// trocarCifra regrava todo o conteúdo do arquivo com a cifra e os dados escolhidos a partir da entrada atual.
+// Sem cifra, o conteúdo é gravado em blocos comuns e o arquivo deixa de ser cifrado
+func trocarCifra(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, acesso uint32, escolher func(DiretorioRoot) (*CifraArquivo, []byte, error)) (DiretorioRoot, error) {
+	return regravarConteudo(cabecalho, meuFS, identidade, caminho, acesso, func(fat []uint32, entrada *DiretorioRoot) error {
+		cifra, dados, erro := escolher(*entrada)
+		if erro != nil {
+			return erro
+		}
+		if len(dados) > int(^uint32(0)) {
+			return errors.New("arquivo não coube no sistema de arquivos")
+		}
+		if cifra != nil {
+			return gravarCifrado(cabecalho, meuFS, fat, entrada, cifra, dados)
+		}
+		return gravarEmBlocosComuns(cabecalho, meuFS, fat, entrada, dados)
+	})
+}
@@ -0,0 +1,137 @@
+package meufs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"meufs"
+)
+
+func TestArquivoCifrado(t *testing.T) {
+	volume := novoVolume(t)
+	original := string(bytes.Repeat([]byte("segredo "), 1500))
+	gravar(t, volume, "/s.txt", original)
+	cifra, erro := meufs.NovaCifraArquivo("certa")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = meufs.CifrarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"s.txt"}, cifra); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = volume.Open("/s.txt"); !errors.Is(erro, meufs.ErrArquivoCifrado) {
+		t.Fatalf("abrir sem a senha deveria falhar com ErrArquivoCifrado, falhou com %v", erro)
+	}
+	volume.SenhaArquivos = "errada"
+	if _, erro = volume.Open("/s.txt"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("abrir com a senha errada deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	volume.SenhaArquivos = "certa"
+	if texto := conteudo(t, volume, "/s.txt"); texto != original {
+		t.Fatalf("s.txt decifrado tem %d bytes diferentes do original", len(texto))
+	}
+	// O conteúdo fica no fim da cadeia, depois do cabeçalho e dos selos. Um byte trocado no último bloco precisa
+	// ser recusado pela tag do GCM
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	blocos, erro := meufs.CadeiaDeBlocos(fat, enderecoFAT(t, volume, "s.txt"))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	bruto := make([]byte, volume.Cabecalho.TamanhoBloco)
+	volume.Arquivo.ReadAt(bruto, meufs.PosicaoDoBloco(volume.Cabecalho, blocos[len(blocos)-3]))
+	if bytes.Contains(bruto, []byte("segredo")) {
+		t.Fatal("o conteúdo deveria estar cifrado no meufs.fs")
+	}
+	posicao := meufs.PosicaoDoBloco(volume.Cabecalho, blocos[len(blocos)-1])
+	volume.Arquivo.ReadAt(bruto[:1], posicao)
+	bruto[0] ^= 1
+	volume.Arquivo.WriteAt(bruto[:1], posicao)
+	arquivo, erro := volume.Open("/s.txt")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer arquivo.Close()
+	if _, erro = io.ReadAll(arquivo); erro == nil {
+		t.Fatal("ler um arquivo cifrado alterado deveria falhar")
+	}
+	// Os blocos anteriores ao alterado continuam legíveis
+	inicio := make([]byte, 100)
+	if _, erro = arquivo.ReadAt(inicio, 0); erro != nil || string(inicio) != original[:100] {
+		t.Fatalf("o início do arquivo deveria continuar legível, leu %q com %v", inicio, erro)
+	}
+}
+
+// cortarCifrado encurta um arquivo cifrado do root direto na entrada e na FAT, como faria quem altera o meufs.fs
+// sem a senha: a cadeia fica só com os blocos do tamanho novo, que continuam com os selos originais
+func cortarCifrado(t *testing.T, volume *meufs.Volume, nome string, tamanho uint32) {
+	t.Helper()
+	root, erro := meufs.LerDiretorioRaiz(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	indice := meufs.BuscarEntrada(root, nome)
+	blocos, erro := meufs.CadeiaDeBlocos(fat, root.Entradas[indice].EnderecoFAT)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	mantidos := meufs.BlocosDoArquivoCifrado(volume.Cabecalho.TamanhoBloco, tamanho)
+	fat[blocos[mantidos-1]] = meufs.FimDaCadeia
+	for _, bloco := range blocos[mantidos:] {
+		fat[bloco] = 0
+	}
+	root.Entradas[indice].Tamanho = tamanho
+	if erro = meufs.SalvarFAT(volume.Cabecalho, volume.Arquivo, fat); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = meufs.SalvarDiretorio(volume.Cabecalho, volume.Arquivo, root); erro != nil {
+		t.Fatal(erro)
+	}
+}
+
+func TestArquivoCifradoCortado(t *testing.T) {
+	volume := novoVolume(t)
+	cifra, erro := meufs.NovaCifraArquivo("certa")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	tamanhoBloco := int(volume.Cabecalho.TamanhoBloco)
+	original := bytes.Repeat([]byte("segredo!"), 3*tamanhoBloco/8)
+	for _, nome := range []string{"bloco.txt", "vazio.txt", "legitimo.txt"} {
+		gravar(t, volume, "/"+nome, "")
+		dados := original
+		if nome == "legitimo.txt" {
+			dados = nil
+		}
+		if _, erro = meufs.GravarCifrado(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{nome}, cifra, dados); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	volume.SenhaArquivos = "certa"
+	// Um arquivo cifrado vazio de verdade é lido normalmente
+	if texto := conteudo(t, volume, "/legitimo.txt"); texto != "" {
+		t.Fatalf("legitimo.txt deveria estar vazio, tem %q", texto)
+	}
+	// Cortado no limite de um bloco ou até ficar vazio, o arquivo precisa ser recusado
+	cortarCifrado(t, volume, "bloco.txt", uint32(tamanhoBloco))
+	cortarCifrado(t, volume, "vazio.txt", 0)
+	arquivo, erro := volume.Open("/bloco.txt")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer arquivo.Close()
+	if lido, erro := io.ReadAll(arquivo); erro == nil {
+		t.Fatalf("ler bloco.txt cortado deveria falhar, leu %d bytes", len(lido))
+	}
+	if _, erro = volume.Open("/vazio.txt"); erro == nil {
+		t.Fatal("abrir vazio.txt cortado deveria falhar")
+	}
+}
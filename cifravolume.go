@@ -0,0 +1,498 @@
+package meufs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Num volume cifrado, tudo depois do cabeçalho (root, FAT e dados) é cifrado com AES-256-XTS em setores de
+// tamanhoSetor bytes, usando uma chave mestra aleatória criada junto com o volume. A chave mestra fica na
+// AreaChaves do cabeçalho, cifrada em cada slot com uma chave derivada de uma senha, então trocar a senha só
+// regrava um slot e os dados não são cifrados de novo
+const (
+	tamanhoSetor       = 512
+	numSlotsChave      = 4
+	tamanhoChaveMestra = 64 // Duas chaves AES-256: uma para os dados e outra para o ajuste de cada setor
+)
+
+// SlotChave guarda a chave mestra do volume cifrada com AES-GCM pela chave derivada de uma senha com o scrypt
+type SlotChave struct {
+	Ativo       uint8
+	CustoLog2   uint8 // Parâmetros do scrypt: n = 2^CustoLog2, r e p
+	BlocosR     uint8
+	Paralelismo uint8
+	Sal         [16]byte
+	Nonce       [12]byte
+	ChaveMestra [tamanhoChaveMestra + 16]byte // Chave mestra cifrada seguida da tag do AES-GCM
+}
+
+// AreaChaves fica no cabeçalho, logo depois da CredencialAdmin, e informa se o volume é cifrado
+type AreaChaves struct {
+	Cifrado uint8
+	Slots   [numSlotsChave]SlotChave
+}
+
+// ErrVolumeBloqueado é retornado ao acessar o root, a FAT ou os dados de um volume cifrado antes de desbloqueá-lo
+var ErrVolumeBloqueado error = &ErroFS{Mensagem: "o volume está cifrado e precisa ser desbloqueado com a senha", Tipo: fs.ErrPermission}
+
+// MeuFS é o meufs.fs aberto. Num volume cifrado, as leituras e escritas depois do cabeçalho decifram e cifram os
+// setores no caminho, e enquanto o volume não é desbloqueado essa parte não pode ser acessada
+type MeuFS struct {
+	arquivo       *os.File
+	cifrado       bool
+	inicioCifrado int64
+	cifra         *cifraXTS  // nil enquanto o volume não é desbloqueado
+	transacao     *Transacao // Transação que registra as escritas, se houver uma em andamento
+}
+
+// AbrirMeuFS abre o meufs.fs indicado e lê o cabeçalho. Se o volume for cifrado, ele fica bloqueado até
+// DesbloquearVolume
+func AbrirMeuFS(caminho string) (*MeuFS, Cabecalho, error) {
+	arquivo, erro := os.OpenFile(caminho, os.O_RDWR, 0644)
+	if erro != nil {
+		return nil, Cabecalho{}, erro
+	}
+	meuFS := &MeuFS{arquivo: arquivo}
+	cabecalho, erro := LerCabecalho(meuFS)
+	if erro != nil {
+		arquivo.Close()
+		return nil, Cabecalho{}, erro
+	}
+	area, erro := LerAreaChaves(cabecalho, meuFS)
+	if erro != nil {
+		arquivo.Close()
+		return nil, Cabecalho{}, erro
+	}
+	meuFS.cifrado = area.Cifrado == 1
+	meuFS.inicioCifrado = int64(cabecalho.InicioRoot)
+	return meuFS, cabecalho, nil
+}
+
+// Cifrado informa se o volume é cifrado
+func (m *MeuFS) Cifrado() bool {
+	return m.cifrado
+}
+
+// Bloqueado informa se o volume é cifrado e ainda não foi desbloqueado
+func (m *MeuFS) Bloqueado() bool {
+	return m.cifrado && m.cifra == nil
+}
+
+// Name retorna o caminho do meufs.fs
+func (m *MeuFS) Name() string {
+	return m.arquivo.Name()
+}
+
+// Stat retorna as informações do meufs.fs no sistema real
+func (m *MeuFS) Stat() (fs.FileInfo, error) {
+	return m.arquivo.Stat()
+}
+
+// Sync garante que as escritas estejam no disco
+func (m *MeuFS) Sync() error {
+	return m.arquivo.Sync()
+}
+
+// Close fecha o meufs.fs
+func (m *MeuFS) Close() error {
+	return m.arquivo.Close()
+}
+
+// Seek muda a posição usada por Read e Write
+func (m *MeuFS) Seek(offset int64, deOnde int) (int64, error) {
+	return m.arquivo.Seek(offset, deOnde)
+}
+
+// Read lê a partir da posição atual, como ReadAt, e a avança
+func (m *MeuFS) Read(p []byte) (int, error) {
+	posicao, erro := m.arquivo.Seek(0, io.SeekCurrent)
+	if erro != nil {
+		return 0, erro
+	}
+	n, erro := m.ReadAt(p, posicao)
+	if n > 0 && erro == io.EOF {
+		erro = nil
+	}
+	if _, erroSeek := m.arquivo.Seek(posicao+int64(n), io.SeekStart); erro == nil {
+		erro = erroSeek
+	}
+	return n, erro
+}
+
+// Write escreve a partir da posição atual, como WriteAt, e a avança
+func (m *MeuFS) Write(p []byte) (int, error) {
+	posicao, erro := m.arquivo.Seek(0, io.SeekCurrent)
+	if erro != nil {
+		return 0, erro
+	}
+	n, erro := m.WriteAt(p, posicao)
+	if _, erroSeek := m.arquivo.Seek(posicao+int64(n), io.SeekStart); erro == nil {
+		erro = erroSeek
+	}
+	return n, erro
+}
+
+// ReadAt lê a partir do offset, decifrando o que estiver depois do cabeçalho num volume cifrado
+func (m *MeuFS) ReadAt(p []byte, offset int64) (int, error) {
+	if !m.cifrado || offset+int64(len(p)) <= m.inicioCifrado {
+		return m.arquivo.ReadAt(p, offset)
+	}
+	if m.cifra == nil {
+		return 0, ErrVolumeBloqueado
+	}
+	lidos := 0
+	if offset < m.inicioCifrado {
+		n, erro := m.arquivo.ReadAt(p[:m.inicioCifrado-offset], offset)
+		if erro != nil {
+			return n, erro
+		}
+		lidos, p, offset = n, p[n:], m.inicioCifrado
+	}
+	// Lendo os setores inteiros que contêm o trecho
+	primeiro := (offset - m.inicioCifrado) / tamanhoSetor
+	ultimo := (offset - m.inicioCifrado + int64(len(p)) + tamanhoSetor - 1) / tamanhoSetor
+	setores := make([]byte, (ultimo-primeiro)*tamanhoSetor)
+	n, erro := m.arquivo.ReadAt(setores, m.inicioCifrado+primeiro*tamanhoSetor)
+	setores = setores[:n-n%tamanhoSetor]
+	for i := 0; i < len(setores); i += tamanhoSetor {
+		m.cifra.decifrarSetor(setores[i:i+tamanhoSetor], uint64(primeiro)+uint64(i/tamanhoSetor))
+	}
+	inicio := offset - m.inicioCifrado - primeiro*tamanhoSetor
+	copiados := 0
+	if inicio < int64(len(setores)) {
+		copiados = copy(p, setores[inicio:])
+	}
+	if copiados < len(p) && erro == nil {
+		erro = io.EOF
+	}
+	return lidos + copiados, erro
+}
+
+// WriteAt escreve a partir do offset, cifrando o que estiver depois do cabeçalho num volume cifrado. Os setores
+// que a escrita só alcança em parte são lidos e decifrados antes
+func (m *MeuFS) WriteAt(p []byte, offset int64) (int, error) {
+	if m.transacao != nil {
+		if erro := m.transacao.guardar(offset, len(p)); erro != nil {
+			return 0, erro
+		}
+	}
+	if !m.cifrado || offset+int64(len(p)) <= m.inicioCifrado {
+		return m.arquivo.WriteAt(p, offset)
+	}
+	if m.cifra == nil {
+		return 0, ErrVolumeBloqueado
+	}
+	escritos := 0
+	if offset < m.inicioCifrado {
+		n, erro := m.arquivo.WriteAt(p[:m.inicioCifrado-offset], offset)
+		if erro != nil {
+			return n, erro
+		}
+		escritos, p, offset = n, p[n:], m.inicioCifrado
+	}
+	primeiro := (offset - m.inicioCifrado) / tamanhoSetor
+	ultimo := (offset - m.inicioCifrado + int64(len(p)) + tamanhoSetor - 1) / tamanhoSetor
+	setores := make([]byte, (ultimo-primeiro)*tamanhoSetor)
+	inicio := offset - m.inicioCifrado - primeiro*tamanhoSetor
+	if inicio != 0 || len(p)%tamanhoSetor != 0 {
+		if _, erro := m.ReadAt(setores, m.inicioCifrado+primeiro*tamanhoSetor); erro != nil && erro != io.EOF {
+			return escritos, erro
+		}
+	}
+	copy(setores[inicio:], p)
+	for i := 0; i < len(setores); i += tamanhoSetor {
+		m.cifra.cifrarSetor(setores[i:i+tamanhoSetor], uint64(primeiro)+uint64(i/tamanhoSetor))
+	}
+	if _, erro := m.arquivo.WriteAt(setores, m.inicioCifrado+primeiro*tamanhoSetor); erro != nil {
+		return escritos, erro
+	}
+	return escritos + len(p), nil
+}
+
+// lerBruto lê os bytes como estão no meufs.fs, sem decifrar
+func (m *MeuFS) lerBruto(p []byte, offset int64) (int, error) {
+	return m.arquivo.ReadAt(p, offset)
+}
+
+// escreverBruto escreve os bytes no meufs.fs sem cifrar
+func (m *MeuFS) escreverBruto(p []byte, offset int64) (int, error) {
+	if m.transacao != nil {
+		if erro := m.transacao.guardar(offset, len(p)); erro != nil {
+			return 0, erro
+		}
+	}
+	return m.arquivo.WriteAt(p, offset)
+}
+
+// arredondarSetor arredonda a posição para cima, até o próximo múltiplo de tamanhoSetor
+func arredondarSetor(posicao uint32) uint32 {
+	return (posicao + tamanhoSetor - 1) / tamanhoSetor * tamanhoSetor
+}
+
+// posicaoAreaChaves é onde a AreaChaves fica no meufs.fs, logo depois da CredencialAdmin
+func posicaoAreaChaves() int64 {
+	return posicaoCredencial() + int64(binary.Size(CredencialAdmin{}))
+}
+
+// LerAreaChaves lê a área de chaves do volume
+func LerAreaChaves(cabecalho Cabecalho, meuFS *MeuFS) (AreaChaves, error) {
+	var area AreaChaves
+	dados := make([]byte, binary.Size(area))
+	if _, erro := meuFS.ReadAt(dados, posicaoAreaChaves()); erro != nil {
+		return AreaChaves{}, fmt.Errorf("erro ao ler as chaves do volume: %w", erro)
+	}
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &area); erro != nil {
+		return AreaChaves{}, fmt.Errorf("erro ao ler as chaves do volume: %w", erro)
+	}
+	return area, nil
+}
+
+// salvarAreaChaves grava a área de chaves no cabeçalho
+func salvarAreaChaves(meuFS *MeuFS, area AreaChaves) error {
+	var dados bytes.Buffer
+	binary.Write(&dados, binary.LittleEndian, area)
+	if _, erro := meuFS.WriteAt(dados.Bytes(), posicaoAreaChaves()); erro != nil {
+		return fmt.Errorf("erro ao gravar as chaves do volume: %w", erro)
+	}
+	return meuFS.Sync()
+}
+
+// cifrarVolume torna cifrado o volume recém-criado com o cabeçalho informado: cria a chave mestra, guarda-a no
+// primeiro slot com a senha e grava zeros cifrados em tudo depois do cabeçalho, que então lê como um volume vazio
+func cifrarVolume(cabecalho Cabecalho, meuFS *MeuFS, senha string) error {
+	if cabecalho.InicioRoot%tamanhoSetor != 0 {
+		return errors.New("o root do volume não começa num setor inteiro")
+	}
+	chaveMestra := make([]byte, tamanhoChaveMestra)
+	if _, erro := rand.Read(chaveMestra); erro != nil {
+		return fmt.Errorf("erro ao gerar a chave do volume: %w", erro)
+	}
+	area := AreaChaves{Cifrado: 1}
+	if erro := preencherSlot(&area, 0, chaveMestra, senha); erro != nil {
+		return erro
+	}
+	cifra, erro := novaCifraXTS(chaveMestra)
+	if erro != nil {
+		return erro
+	}
+	meuFS.cifrado, meuFS.inicioCifrado, meuFS.cifra = true, int64(cabecalho.InicioRoot), cifra
+	zeros := make([]byte, 1024*1024)
+	for posicao := int64(cabecalho.InicioRoot); posicao < int64(cabecalho.TamanhoMeuFS); posicao += int64(len(zeros)) {
+		if _, erro = meuFS.WriteAt(zeros[:min(int64(len(zeros)), int64(cabecalho.TamanhoMeuFS)-posicao)], posicao); erro != nil {
+			return fmt.Errorf("erro ao cifrar o volume: %w", erro)
+		}
+	}
+	return salvarAreaChaves(meuFS, area)
+}
+
+// DesbloquearVolume abre a chave mestra de um volume cifrado com a senha de um dos slots, liberando o acesso
+// ao root, à FAT e aos dados
+func DesbloquearVolume(cabecalho Cabecalho, meuFS *MeuFS, senha string) error {
+	if !meuFS.cifrado {
+		return errors.New("o volume não é cifrado")
+	}
+	area, erro := LerAreaChaves(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	_, chaveMestra, erro := abrirSlots(area, senha)
+	if erro != nil {
+		return erro
+	}
+	meuFS.cifra, erro = novaCifraXTS(chaveMestra)
+	return erro
+}
+
+// SlotsAtivos lista os slots de chave do volume que têm uma senha
+func SlotsAtivos(cabecalho Cabecalho, meuFS *MeuFS) ([]int, error) {
+	area, erro := LerAreaChaves(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	var ativos []int
+	for indice, slot := range area.Slots {
+		if slot.Ativo == 1 {
+			ativos = append(ativos, indice)
+		}
+	}
+	return ativos, nil
+}
+
+// AdicionarSenhaVolume guarda a chave mestra do volume desbloqueado com mais uma senha, no primeiro slot livre,
+// e retorna o slot usado. Só o root pode mudar as senhas do volume
+func AdicionarSenhaVolume(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senhaAtual string, nova string) (int, error) {
+	area, chaveMestra, erro := slotsParaMudar(cabecalho, meuFS, identidade, senhaAtual)
+	if erro != nil {
+		return 0, erro
+	}
+	for indice, slot := range area.Slots {
+		if slot.Ativo == 0 {
+			if erro = preencherSlot(&area, indice, chaveMestra, nova); erro != nil {
+				return 0, erro
+			}
+			return indice, salvarAreaChaves(meuFS, area)
+		}
+	}
+	return 0, fmt.Errorf("todos os %d slots de chave do volume estão em uso", numSlotsChave)
+}
+
+// TrocarSenhaVolume troca a senha atual pela nova no mesmo slot, sem cifrar os dados de novo
+func TrocarSenhaVolume(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senhaAtual string, nova string) error {
+	area, chaveMestra, erro := slotsParaMudar(cabecalho, meuFS, identidade, senhaAtual)
+	if erro != nil {
+		return erro
+	}
+	indice, _, _ := abrirSlots(area, senhaAtual)
+	if erro = preencherSlot(&area, indice, chaveMestra, nova); erro != nil {
+		return erro
+	}
+	return salvarAreaChaves(meuFS, area)
+}
+
+// RemoverSenhaVolume apaga o slot da senha informada. A última senha do volume não pode ser removida
+func RemoverSenhaVolume(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senha string) error {
+	area, _, erro := slotsParaMudar(cabecalho, meuFS, identidade, senha)
+	if erro != nil {
+		return erro
+	}
+	ativos := 0
+	for _, slot := range area.Slots {
+		ativos += int(slot.Ativo)
+	}
+	if ativos == 1 {
+		return errors.New("a última senha do volume não pode ser removida")
+	}
+	indice, _, _ := abrirSlots(area, senha)
+	area.Slots[indice] = SlotChave{}
+	return salvarAreaChaves(meuFS, area)
+}
+
+// slotsParaMudar confere se a identidade pode mudar as senhas do volume e se a senha atual abre um dos slots
+func slotsParaMudar(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senhaAtual string) (AreaChaves, []byte, error) {
+	if !identidade.EhRoot() {
+		return AreaChaves{}, nil, NovoErroFS(fs.ErrPermission, "só o root pode mudar as senhas do volume")
+	}
+	if !meuFS.cifrado {
+		return AreaChaves{}, nil, errors.New("o volume não é cifrado")
+	}
+	area, erro := LerAreaChaves(cabecalho, meuFS)
+	if erro != nil {
+		return AreaChaves{}, nil, erro
+	}
+	_, chaveMestra, erro := abrirSlots(area, senhaAtual)
+	return area, chaveMestra, erro
+}
+
+// abrirSlots procura o slot que a senha abre e retorna seu índice e a chave mestra
+func abrirSlots(area AreaChaves, senha string) (int, []byte, error) {
+	for indice, slot := range area.Slots {
+		if slot.Ativo != 1 || slot.CustoLog2 >= 31 {
+			continue
+		}
+		aead, erro := cifraDoSlot(slot, senha)
+		if erro != nil {
+			return 0, nil, erro
+		}
+		chaveMestra, erro := aead.Open(nil, slot.Nonce[:], slot.ChaveMestra[:], []byte{byte(indice)})
+		if erro == nil {
+			return indice, chaveMestra, nil
+		}
+	}
+	return 0, nil, NovoErroFS(fs.ErrPermission, "senha do volume incorreta")
+}
+
+// preencherSlot guarda no slot a chave mestra cifrada com a senha, com sal e nonce novos
+func preencherSlot(area *AreaChaves, indice int, chaveMestra []byte, senha string) error {
+	if senha == "" {
+		return errors.New("a senha do volume não pode ser vazia")
+	}
+	slot := SlotChave{Ativo: 1, CustoLog2: custoLog2Senha, BlocosR: blocosRSenha, Paralelismo: paralelismoSenha}
+	if _, erro := rand.Read(slot.Sal[:]); erro != nil {
+		return fmt.Errorf("erro ao gerar o sal da senha: %w", erro)
+	}
+	if _, erro := rand.Read(slot.Nonce[:]); erro != nil {
+		return fmt.Errorf("erro ao gerar o nonce da senha: %w", erro)
+	}
+	aead, erro := cifraDoSlot(slot, senha)
+	if erro != nil {
+		return erro
+	}
+	aead.Seal(slot.ChaveMestra[:0], slot.Nonce[:], chaveMestra, []byte{byte(indice)})
+	area.Slots[indice] = slot
+	return nil
+}
+
+// cifraDoSlot deriva da senha, com o sal e os parâmetros do slot, a chave AES-GCM que cifra a chave mestra
+func cifraDoSlot(slot SlotChave, senha string) (cipher.AEAD, error) {
+	chave, erro := derivarChave([]byte(senha), slot.Sal[:], 1<<slot.CustoLog2, int(slot.BlocosR), int(slot.Paralelismo), 32)
+	if erro != nil {
+		return nil, erro
+	}
+	bloco, erro := aes.NewCipher(chave)
+	if erro != nil {
+		return nil, erro
+	}
+	return cipher.NewGCM(bloco)
+}
+
+// cifraXTS é o AES-XTS (IEEE 1619) com setores de tamanhoSetor bytes, numerados a partir do fim do cabeçalho
+type cifraXTS struct {
+	dados  cipher.Block
+	ajuste cipher.Block
+}
+
+// novaCifraXTS cria a cifra a partir da chave mestra: a primeira metade cifra os dados e a segunda o ajuste
+func novaCifraXTS(chaveMestra []byte) (*cifraXTS, error) {
+	dados, erro := aes.NewCipher(chaveMestra[:tamanhoChaveMestra/2])
+	if erro != nil {
+		return nil, erro
+	}
+	ajuste, erro := aes.NewCipher(chaveMestra[tamanhoChaveMestra/2:])
+	if erro != nil {
+		return nil, erro
+	}
+	return &cifraXTS{dados: dados, ajuste: ajuste}, nil
+}
+
+func (c *cifraXTS) cifrarSetor(setor []byte, numero uint64) {
+	c.processarSetor(setor, numero, c.dados.Encrypt)
+}
+
+func (c *cifraXTS) decifrarSetor(setor []byte, numero uint64) {
+	c.processarSetor(setor, numero, c.dados.Decrypt)
+}
+
+// processarSetor cifra ou decifra o setor no lugar, bloco a bloco, com o ajuste derivado do número do setor e
+// multiplicado por x no GF(2^128) a cada bloco
+func (c *cifraXTS) processarSetor(setor []byte, numero uint64, operacao func(destino, origem []byte)) {
+	var ajuste [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(ajuste[:], numero)
+	c.ajuste.Encrypt(ajuste[:], ajuste[:])
+	for inicio := 0; inicio < len(setor); inicio += aes.BlockSize {
+		bloco := setor[inicio : inicio+aes.BlockSize]
+		for i := range bloco {
+			bloco[i] ^= ajuste[i]
+		}
+		operacao(bloco, bloco)
+		for i := range bloco {
+			bloco[i] ^= ajuste[i]
+		}
+		var vaiUm byte
+		for i := range ajuste {
+			proximo := ajuste[i] >> 7
+			ajuste[i] = ajuste[i]<<1 | vaiUm
+			vaiUm = proximo
+		}
+		if vaiUm != 0 {
+			ajuste[0] ^= 0x87
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package meufs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"meufs"
+)
+
+// alterarByte troca um bit do byte na posição do meufs.fs, direto no arquivo, sem passar pela cifra do volume
+func alterarByte(t *testing.T, caminho string, posicao int64) {
+	t.Helper()
+	arquivo, erro := os.OpenFile(caminho, os.O_RDWR, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer arquivo.Close()
+	valor := make([]byte, 1)
+	arquivo.ReadAt(valor, posicao)
+	valor[0] ^= 1
+	if _, erro = arquivo.WriteAt(valor, posicao); erro != nil {
+		t.Fatal(erro)
+	}
+}
+
+func TestVolumeCifrado(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "meufs.fs")
+	if erro := meufs.CriarVolume(caminho, 100, "certa"); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := meufs.AbrirVolume(caminho); !errors.Is(erro, meufs.ErrVolumeBloqueado) {
+		t.Fatalf("abrir sem a senha deveria falhar com ErrVolumeBloqueado, falhou com %v", erro)
+	}
+	if _, erro := meufs.AbrirVolumeComSenha(caminho, "errada"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("abrir com a senha errada deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	volume, erro := meufs.AbrirVolumeComSenha(caminho, "certa")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	volume.Identidade = meufs.IdentidadeRoot
+	defer volume.Close()
+	original := string(bytes.Repeat([]byte("segredo "), 1000))
+	gravar(t, volume, "/s.txt", original)
+	if texto := conteudo(t, volume, "/s.txt"); texto != original {
+		t.Fatalf("s.txt tem %d bytes diferentes do original", len(texto))
+	}
+	bruto, erro := os.ReadFile(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if bytes.Contains(bruto, []byte("segredo")) || bytes.Contains(bruto, []byte("s.txt")) {
+		t.Fatal("o conteúdo e os nomes deveriam estar cifrados no meufs.fs")
+	}
+
+	// O XTS não detecta alterações, mas uma alteração só embaralha o bloco de 16 bytes em que cai
+	posicao := meufs.PosicaoDoBloco(volume.Cabecalho, enderecoFAT(t, volume, "s.txt")) + 100
+	alterarByte(t, caminho, posicao)
+	texto := conteudo(t, volume, "/s.txt")
+	if texto == original {
+		t.Fatal("o byte alterado no meufs.fs deveria mudar o conteúdo decifrado")
+	}
+	if texto[:96] != original[:96] || texto[112:] != original[112:] {
+		t.Fatal("a alteração deveria mudar só o bloco de 16 bytes em que caiu")
+	}
+	volume.Close()
+
+	// Já a chave mestra é guardada com o AES-GCM, e uma alteração nela impede o desbloqueio mesmo com a senha certa
+	chaveDoSlot := binary.Size(meufs.Cabecalho{}) + binary.Size(meufs.CredencialAdmin{}) + 1 + 4 + 16 + 12
+	alterarByte(t, caminho, int64(chaveDoSlot))
+	if _, erro = meufs.AbrirVolumeComSenha(caminho, "certa"); erro == nil {
+		t.Fatal("uma chave mestra alterada não deveria ser aceita")
+	}
+}
+
+// Vetor 10 do IEEE 1619-2007 (XTS-AES-256), com a chave de dados seguida da chave de ajuste como chave mestra
+func TestCifraXTS(t *testing.T) {
+	chaveMestra, _ := hex.DecodeString("2718281828459045235360287471352662497757247093699959574966967627" +
+		"3141592653589793238462643383279502884197169399375105820974944592")
+	esperado, _ := hex.DecodeString("" +
+		"1c3b3a102f770386e4836c99e370cf9bea00803f5e482357a4ae12d414a3e63b5d31e276f8fe4a8d66b317f9ac683f44680a86ac35adfc3345befecb4bb188fd" +
+		"5776926c49a3095eb108fd1098baec70aaa66999a72a82f27d848b21d4a741b0c5cd4d5fff9dac89aeba122961d03a757123e9870f8acf1000020887891429ca" +
+		"2a3e7a7d7df7b10355165c8b9a6d0a7de8b062c4500dc4cd120c0f7418dae3d0b5781c34803fa75421c790dfe1de1834f280d7667b327f6c8cd7557e12ac3a0f" +
+		"93ec05c52e0493ef31a12d3d9260f79a289d6a379bc70c50841473d1a8cc81ec583e9645e07b8d9670655ba5bbcfecc6dc3966380ad8fecb17b6ba02469a020a" +
+		"84e18e8f84252070c13e9f1f289be54fbc481457778f616015e1327a02b140f1505eb309326d68378f8374595c849d84f4c333ec4423885143cb47bd71c5edae" +
+		"9be69a2ffeceb1bec9de244fbe15992b11b77c040f12bd8f6a975a44a0f90c29a9abc3d4d893927284c58754cce294529f8614dcd2aba991925fedc4ae74ffac" +
+		"6e333b93eb4aff0479da9a410e4450e0dd7ae4c6e2910900575da401fc07059f645e8b7e9bfdef33943054ff84011493c27b3429eaedb4ed5376441a77ed4385" +
+		"1ad77f16f541dfd269d50d6a5f14fb0aab1cbb4c1550be97f7ab4066193c4caa773dad38014bd2092fa755c824bb5e54c4f36ffda9fcea70b9c6e693e148c151")
+	claro := make([]byte, 512)
+	for i := range claro {
+		claro[i] = byte(i)
+	}
+	setor := bytes.Clone(claro)
+	if erro := meufs.CifrarSetorXTS(chaveMestra, setor, 0xff); erro != nil {
+		t.Fatal(erro)
+	}
+	if !bytes.Equal(setor, esperado) {
+		t.Fatalf("o setor cifrado não confere com o vetor do IEEE 1619:\n%x", setor)
+	}
+	if erro := meufs.DecifrarSetorXTS(chaveMestra, setor, 0xff); erro != nil {
+		t.Fatal(erro)
+	}
+	if !bytes.Equal(setor, claro) {
+		t.Fatal("decifrar o vetor do IEEE 1619 deveria devolver o texto claro")
+	}
+}
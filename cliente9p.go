@@ -0,0 +1,170 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Cliente9P é um cliente 9P2000 mínimo. Ligado ao servidor por um net.Pipe permite exercitar o servidor no mesmo processo
+type Cliente9P struct {
+	conn       net.Conn
+	msize      uint32
+	tag        uint16
+	proximoFid uint32
+}
+
+// NovoCliente9P negocia a versão do protocolo na conexão informada
+func NovoCliente9P(conn net.Conn) (*Cliente9P, error) {
+	c := &Cliente9P{conn: conn, msize: msizeMaximo9P}
+	var corpo mensagem9P
+	corpo.putU32(c.msize)
+	corpo.putTexto(versao9P)
+	if erro := escreverMensagem9P(conn, tversion9P, semTag9P, corpo.dados); erro != nil {
+		return nil, erro
+	}
+	tipo, _, r, erro := lerMensagem9P(conn, c.msize)
+	if erro != nil {
+		return nil, erro
+	}
+	if tipo != rversion9P {
+		return nil, fmt.Errorf("resposta inesperada ao Tversion: %d", tipo)
+	}
+	c.msize = r.u32()
+	if versao := r.texto(); versao != versao9P {
+		return nil, fmt.Errorf("servidor não suporta %s: %s", versao9P, versao)
+	}
+	return c, nil
+}
+
+// chamar envia uma requisição e espera sua resposta, convertendo Rerror em erro
+func (c *Cliente9P) chamar(tipo uint8, corpo []byte) (*mensagem9P, error) {
+	c.tag++
+	if erro := escreverMensagem9P(c.conn, tipo, c.tag, corpo); erro != nil {
+		return nil, erro
+	}
+	tipoResposta, _, r, erro := lerMensagem9P(c.conn, c.msize)
+	if erro != nil {
+		return nil, erro
+	}
+	if tipoResposta == rerror9P {
+		return nil, errors.New(r.texto())
+	}
+	if tipoResposta != tipo+1 {
+		return nil, fmt.Errorf("resposta 9P inesperada: %d", tipoResposta)
+	}
+	return r, nil
+}
+
+func (c *Cliente9P) novoFid() uint32 {
+	c.proximoFid++
+	return c.proximoFid
+}
+
+// Anexar conecta ao root do servidor como o usuário informado (nome ou uid) e retorna o fid do root
+func (c *Cliente9P) Anexar(usuario string) (uint32, error) {
+	fid := c.novoFid()
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putU32(semFid9P)
+	corpo.putTexto(usuario)
+	corpo.putTexto("")
+	_, erro := c.chamar(tattach9P, corpo.dados)
+	return fid, erro
+}
+
+// Caminhar percorre os nomes a partir do fid e retorna um novo fid para o destino
+func (c *Cliente9P) Caminhar(fid uint32, nomes ...string) (uint32, error) {
+	novoFid := c.novoFid()
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putU32(novoFid)
+	corpo.putU16(uint16(len(nomes)))
+	for _, nome := range nomes {
+		corpo.putTexto(nome)
+	}
+	r, erro := c.chamar(twalk9P, corpo.dados)
+	if erro != nil {
+		return 0, erro
+	}
+	if n := r.u16(); int(n) != len(nomes) {
+		return 0, fmt.Errorf("'%s' não existe", nomes[n])
+	}
+	return novoFid, nil
+}
+
+// Abrir abre o fid no modo 9P informado (0 leitura, 1 escrita, 2 leitura e escrita)
+func (c *Cliente9P) Abrir(fid uint32, modo uint8) error {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putU8(modo)
+	_, erro := c.chamar(topen9P, corpo.dados)
+	return erro
+}
+
+// Criar cria um arquivo no diretório do fid, que passa a representar o arquivo criado e aberto
+func (c *Cliente9P) Criar(fid uint32, nome string, perm uint32, modo uint8) error {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putTexto(nome)
+	corpo.putU32(perm)
+	corpo.putU8(modo)
+	_, erro := c.chamar(tcreate9P, corpo.dados)
+	return erro
+}
+
+// Ler lê até quantidade bytes a partir do offset
+func (c *Cliente9P) Ler(fid uint32, offset uint64, quantidade uint32) ([]byte, error) {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putU64(offset)
+	corpo.putU32(quantidade)
+	r, erro := c.chamar(tread9P, corpo.dados)
+	if erro != nil {
+		return nil, erro
+	}
+	return r.bytes(int(r.u32())), nil
+}
+
+// Escrever escreve os dados a partir do offset
+func (c *Cliente9P) Escrever(fid uint32, offset uint64, dados []byte) (uint32, error) {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	corpo.putU64(offset)
+	corpo.putU32(uint32(len(dados)))
+	corpo.dados = append(corpo.dados, dados...)
+	r, erro := c.chamar(twrite9P, corpo.dados)
+	if erro != nil {
+		return 0, erro
+	}
+	return r.u32(), nil
+}
+
+// Stat retorna os metadados do arquivo do fid
+func (c *Cliente9P) Stat(fid uint32) (Stat9P, error) {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	r, erro := c.chamar(tstat9P, corpo.dados)
+	if erro != nil {
+		return Stat9P{}, erro
+	}
+	r.u16()
+	return r.stat(), nil
+}
+
+// Remover remove o arquivo do fid e libera o fid
+func (c *Cliente9P) Remover(fid uint32) error {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	_, erro := c.chamar(tremove9P, corpo.dados)
+	return erro
+}
+
+// Fechar libera o fid. As escritas já foram gravadas pelo servidor a cada Escrever, então um fid aberto com ORCLOSE
+// é o único caso em que fechar altera o volume
+func (c *Cliente9P) Fechar(fid uint32) error {
+	var corpo mensagem9P
+	corpo.putU32(fid)
+	_, erro := c.chamar(tclunk9P, corpo.dados)
+	return erro
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"meufs"
+)
+
+func main() {
+	// Um meufs.fs de uma versão anterior não pode ser aberto, então ele é convertido antes de qualquer outra coisa
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if erro := meufs.MigrarVolume("meufs.fs"); erro != nil {
+			log.Fatal(erro)
+		}
+		fmt.Println("meufs.fs convertido para o formato atual")
+		return
+	}
+	// Verificando se o arquivo meufs.fs já existe no diretório atual
+	_, erro := os.Stat("meufs.fs")
+	if erro != nil {
+		// Arquivo não existe
+		if os.IsNotExist(erro) {
+			// Criando o sistema de arquivos
+			if erro = meufs.CriarFS(); erro != nil {
+				log.Fatal(erro)
+			}
+		} else {
+			log.Fatalf("erro ao verificar existência do arquivo: %v", erro)
+		}
+	}
+	// Abrindo o arquivo para leitura e escrita
+	meuFS, cabecalho, erro := meufs.AbrirMeuFS("meufs.fs")
+	if erro != nil {
+		log.Fatal(erro)
+	}
+	defer meuFS.Close()
+	// Um volume cifrado é desbloqueado com a senha antes de qualquer acesso ao root
+	if meuFS.Cifrado() {
+		senha, erro := meufs.LerSenha("senha do volume: ")
+		if erro != nil {
+			log.Fatal(erro)
+		}
+		if erro = meufs.DesbloquearVolume(cabecalho, meuFS, senha); erro != nil {
+			log.Fatal(erro)
+		}
+	}
+	// Executando o subcomando passado na linha de comando, se houver, no lugar do menu
+	if len(os.Args) > 1 {
+		if erro = meufs.ExecutarSubcomando(meuFS, cabecalho, os.Args[1:]); erro != nil {
+			log.Fatal(erro)
+		}
+		return
+	}
+	if erro = meufs.ExecutarMenu(meuFS, cabecalho); erro != nil {
+		log.Fatal(erro)
+	}
+}
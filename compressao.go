@@ -0,0 +1,330 @@
+package meufs
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Um arquivo comprimido (com AtributoComprimido) guarda na sua cadeia primeiro o cabecalhoCompressao, seguido da
+// tabela com o tamanho comprimido de cada pedaço de TamanhoPedaco bytes do conteúdo, e depois os pedaços comprimidos
+// com DEFLATE, um logo depois do outro. Cada pedaço é comprimido sozinho, então ler um trecho só descomprime os
+// pedaços dele. O tamanho original fica no Tamanho da entrada e o comprimido no cabeçalho
+
+// magicaCompressao identifica o cabeçalho de um arquivo comprimido
+var magicaCompressao = [4]byte{'M', 'F', 'S', 'Z'}
+
+// tamanhoPedaco é quantos bytes do conteúdo cada pedaço dos arquivos novos comprime
+const tamanhoPedaco = 64 * 1024
+
+// cabecalhoCompressao fica no início do primeiro bloco de um arquivo comprimido
+type cabecalhoCompressao struct {
+	Magica            [4]byte
+	Versao            uint8
+	Reservado         [3]byte
+	TamanhoPedaco     uint32
+	TamanhoComprimido uint32 // Bytes usados na cadeia: cabeçalho, tabela e pedaços
+}
+
+// InfoCompressao soma o tamanho original e o comprimido dos arquivos comprimidos do meufs
+type InfoCompressao struct {
+	Arquivos   int     `json:"compressed_files"`
+	Original   uint64  `json:"uncompressed_bytes"`
+	Comprimido uint64  `json:"compressed_bytes"`
+	Taxa       float64 `json:"compression_ratio"`
+}
+
+// TaxaDeCompressao é quantas vezes o conteúdo original é maior que o comprimido (ex: 10 para um log que ficou
+// com um décimo do tamanho)
+func TaxaDeCompressao(original uint64, comprimido uint64) float64 {
+	if comprimido == 0 {
+		return 1
+	}
+	return float64(original) / float64(comprimido)
+}
+
+// numeroDePedacos é quantos pedaços um conteúdo com o tamanho informado tem
+func numeroDePedacos(tamanho uint32, tamanhoDoPedaco uint32) int {
+	return int((int64(tamanho) + int64(tamanhoDoPedaco) - 1) / int64(tamanhoDoPedaco))
+}
+
+// comprimir monta o conteúdo da cadeia de um arquivo comprimido com os dados. Um pedaço que o DEFLATE não diminui
+// é guardado como está, o que a tabela indica com o tamanho igual ao do pedaço original. O resultado ocupa um número
+// inteiro de blocos
+func comprimir(tamanhoBloco uint32, dados []byte) ([]byte, error) {
+	tabela := make([]uint32, numeroDePedacos(uint32(len(dados)), tamanhoPedaco))
+	var pedacos bytes.Buffer
+	compressor, erro := flate.NewWriter(nil, flate.DefaultCompression)
+	if erro != nil {
+		return nil, erro
+	}
+	for i := range tabela {
+		pedaco := dados[i*tamanhoPedaco : min((i+1)*tamanhoPedaco, len(dados))]
+		var comprimido bytes.Buffer
+		compressor.Reset(&comprimido)
+		compressor.Write(pedaco)
+		if erro = compressor.Close(); erro != nil {
+			return nil, fmt.Errorf("erro ao comprimir o arquivo: %w", erro)
+		}
+		if comprimido.Len() >= len(pedaco) {
+			comprimido.Reset()
+			comprimido.Write(pedaco)
+		}
+		tabela[i] = uint32(comprimido.Len())
+		pedacos.Write(comprimido.Bytes())
+	}
+	cabecalho := cabecalhoCompressao{Magica: magicaCompressao, Versao: 1, TamanhoPedaco: tamanhoPedaco}
+	inicio := binary.Size(cabecalho) + binary.Size(tabela)
+	if int64(inicio)+int64(pedacos.Len()) > int64(^uint32(0)) {
+		return nil, errors.New("arquivo não coube no sistema de arquivos")
+	}
+	cabecalho.TamanhoComprimido = uint32(inicio + pedacos.Len())
+	var cadeia bytes.Buffer
+	binary.Write(&cadeia, binary.LittleEndian, cabecalho)
+	binary.Write(&cadeia, binary.LittleEndian, tabela)
+	cadeia.Write(pedacos.Bytes())
+	numBlocos := (cadeia.Len() + int(tamanhoBloco) - 1) / int(tamanhoBloco)
+	cadeia.Write(make([]byte, numBlocos*int(tamanhoBloco)-cadeia.Len()))
+	return cadeia.Bytes(), nil
+}
+
+// lerDosBlocos lê len(dados) bytes a partir da posição offset do arquivo cujos blocos são informados
+func lerDosBlocos(cabecalho Cabecalho, meuFS *MeuFS, blocos []uint32, offset int64, dados []byte) error {
+	tamanhoBloco := int64(cabecalho.TamanhoBloco)
+	for len(dados) > 0 {
+		if offset/tamanhoBloco >= int64(len(blocos)) {
+			return errors.New("a leitura passou do fim da cadeia do arquivo")
+		}
+		dentroDoBloco := offset % tamanhoBloco
+		quantidade := min(int64(len(dados)), tamanhoBloco-dentroDoBloco)
+		posicao := PosicaoDoBloco(cabecalho, blocos[offset/tamanhoBloco]) + dentroDoBloco
+		if _, erro := meuFS.ReadAt(dados[:quantidade], posicao); erro != nil {
+			return fmt.Errorf("erro ao ler bloco do arquivo: %w", erro)
+		}
+		dados = dados[quantidade:]
+		offset += quantidade
+	}
+	return nil
+}
+
+// lerCabecalhoCompressao lê o cabeçalho e a tabela de pedaços de um arquivo comprimido com o tamanho original
+// informado, conferindo se eles correspondem à cadeia
+func lerCabecalhoCompressao(cabecalho Cabecalho, meuFS *MeuFS, blocos []uint32, tamanho uint32) (cabecalhoCompressao, []uint32, error) {
+	var lido cabecalhoCompressao
+	dados := make([]byte, binary.Size(lido))
+	if erro := lerDosBlocos(cabecalho, meuFS, blocos, 0, dados); erro != nil {
+		return cabecalhoCompressao{}, nil, fmt.Errorf("erro ao ler o cabeçalho do arquivo comprimido: %w", erro)
+	}
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, &lido)
+	if lido.Magica != magicaCompressao || lido.TamanhoPedaco == 0 {
+		return cabecalhoCompressao{}, nil, errors.New("o cabeçalho do arquivo comprimido está corrompido")
+	}
+	numBlocos := (int64(lido.TamanhoComprimido) + int64(cabecalho.TamanhoBloco) - 1) / int64(cabecalho.TamanhoBloco)
+	if int64(len(blocos)) != numBlocos {
+		return cabecalhoCompressao{}, nil, errors.New("a cadeia do arquivo comprimido não corresponde ao seu tamanho")
+	}
+	tabela := make([]uint32, numeroDePedacos(tamanho, lido.TamanhoPedaco))
+	dados = make([]byte, binary.Size(tabela))
+	if erro := lerDosBlocos(cabecalho, meuFS, blocos, int64(binary.Size(lido)), dados); erro != nil {
+		return cabecalhoCompressao{}, nil, fmt.Errorf("erro ao ler a tabela do arquivo comprimido: %w", erro)
+	}
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, tabela)
+	total := int64(binary.Size(lido) + len(dados))
+	for _, tamanhoComprimido := range tabela {
+		total += int64(tamanhoComprimido)
+	}
+	if total != int64(lido.TamanhoComprimido) {
+		return cabecalhoCompressao{}, nil, errors.New("a tabela do arquivo comprimido não corresponde ao seu tamanho")
+	}
+	return lido, tabela, nil
+}
+
+// TamanhoComprimido retorna quantos bytes o arquivo comprimido ocupa na sua cadeia, contando o cabeçalho e a tabela
+func TamanhoComprimido(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot) (uint32, error) {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return 0, erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return 0, erro
+	}
+	lido, _, erro := lerCabecalhoCompressao(cabecalho, meuFS, blocos, entrada.Tamanho)
+	return lido.TamanhoComprimido, erro
+}
+
+// copiarComprimido descomprime os pedaços do trecho [offset, fim) do arquivo e escreve o trecho no destino
+func copiarComprimido(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot, destino io.Writer, offset int64, fim int64) error {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return erro
+	}
+	lido, tabela, erro := lerCabecalhoCompressao(cabecalho, meuFS, blocos, entrada.Tamanho)
+	if erro != nil {
+		return erro
+	}
+	tamanhoDoPedaco := int64(lido.TamanhoPedaco)
+	// Os pedaços começam logo depois da tabela
+	posicao := int64(binary.Size(lido) + binary.Size(tabela))
+	for i, tamanhoComprimido := range tabela {
+		inicioPedaco := int64(i) * tamanhoDoPedaco
+		if inicioPedaco >= fim {
+			break
+		}
+		if inicioPedaco+tamanhoDoPedaco <= offset {
+			posicao += int64(tamanhoComprimido)
+			continue
+		}
+		tamanho := min(tamanhoDoPedaco, int64(entrada.Tamanho)-inicioPedaco)
+		comprimido := make([]byte, tamanhoComprimido)
+		if erro = lerDosBlocos(cabecalho, meuFS, blocos, posicao, comprimido); erro != nil {
+			return erro
+		}
+		posicao += int64(tamanhoComprimido)
+		pedaco := comprimido
+		if int64(tamanhoComprimido) != tamanho {
+			pedaco = make([]byte, tamanho)
+			descompressor := flate.NewReader(bytes.NewReader(comprimido))
+			if _, erro = io.ReadFull(descompressor, pedaco); erro != nil {
+				return fmt.Errorf("o pedaço %d do arquivo comprimido está corrompido", i)
+			}
+		}
+		de := max(offset-inicioPedaco, 0)
+		ate := min(fim-inicioPedaco, tamanho)
+		if _, erro = destino.Write(pedaco[de:ate]); erro != nil {
+			return fmt.Errorf("erro ao escrever conteúdo do arquivo: %w", erro)
+		}
+	}
+	return nil
+}
+
+// gravarComprimido troca o conteúdo do arquivo pelos dados comprimidos, reaproveitando os blocos da cadeia, e
+// atualiza a entrada em memória. Altera só a FAT em memória
+func gravarComprimido(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada *DiretorioRoot, dados []byte) error {
+	cadeia, erro := comprimir(cabecalho.TamanhoBloco, dados)
+	if erro != nil {
+		return erro
+	}
+	blocos, erro := redimensionarCadeia(cabecalho, meuFS, fat, entrada.EnderecoFAT, len(cadeia)/int(cabecalho.TamanhoBloco))
+	if erro != nil {
+		return erro
+	}
+	if erro = escreverNosBlocos(cabecalho, meuFS, blocos, 0, cadeia); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = blocos[0]
+	entrada.Tamanho = uint32(len(dados))
+	entrada.Atributos = entrada.Atributos&^atributosDoConteudo | AtributoComprimido
+	return nil
+}
+
+// GravarComprimido troca todo o conteúdo do arquivo pelos dados comprimidos. Pede escrita no arquivo e respeita os
+// atributos, como SubstituirConteudo
+func GravarComprimido(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, dados []byte) (DiretorioRoot, error) {
+	return regravarConteudo(cabecalho, meuFS, identidade, caminho, AcessoEscrita, func(fat []uint32, entrada *DiretorioRoot) error {
+		if entrada.Atributos&AtributoCifrado != 0 {
+			return erroCompressaoCifrado(caminho)
+		}
+		return gravarComprimido(cabecalho, meuFS, fat, entrada, dados)
+	})
+}
+
+// ComprimirArquivo comprime o conteúdo de um arquivo que ainda não é comprimido. Pede leitura e escrita no arquivo.
+// Arquivos cifrados não são comprimidos, já que o conteúdo cifrado não diminui
+func ComprimirArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string) error {
+	_, erro := regravarConteudo(cabecalho, meuFS, identidade, caminho, AcessoLeitura|AcessoEscrita, func(fat []uint32, entrada *DiretorioRoot) error {
+		switch {
+		case entrada.Atributos&AtributoComprimido != 0:
+			return fmt.Errorf("'/%s' já está comprimido", strings.Join(caminho, "/"))
+		case entrada.Atributos&AtributoCifrado != 0:
+			return erroCompressaoCifrado(caminho)
+		}
+		dados, erro := LerConteudo(cabecalho, meuFS, *entrada, nil)
+		if erro != nil {
+			return erro
+		}
+		return gravarComprimido(cabecalho, meuFS, fat, entrada, dados)
+	})
+	return erro
+}
+
+// DescomprimirArquivo guarda sem compressão o conteúdo de um arquivo comprimido. Pede leitura e escrita no arquivo
+func DescomprimirArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string) error {
+	_, erro := regravarConteudo(cabecalho, meuFS, identidade, caminho, AcessoLeitura|AcessoEscrita, func(fat []uint32, entrada *DiretorioRoot) error {
+		if entrada.Atributos&AtributoComprimido == 0 {
+			return fmt.Errorf("'/%s' não está comprimido", strings.Join(caminho, "/"))
+		}
+		dados, erro := LerConteudo(cabecalho, meuFS, *entrada, nil)
+		if erro != nil {
+			return erro
+		}
+		return gravarEmBlocosComuns(cabecalho, meuFS, fat, entrada, dados)
+	})
+	return erro
+}
+
+// erroCompressaoCifrado é o erro de comprimir um arquivo cifrado
+func erroCompressaoCifrado(caminho []string) error {
+	return fmt.Errorf("'/%s' está cifrado e não pode ser comprimido (a cifra do volume pode ser usada junto com a compressão)", strings.Join(caminho, "/"))
+}
+
+// CalcularCompressao soma, em todos os diretórios, o tamanho original e o comprimido dos arquivos comprimidos
+func CalcularCompressao(cabecalho Cabecalho, meuFS *MeuFS) (InfoCompressao, error) {
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return InfoCompressao{}, erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return InfoCompressao{}, erro
+	}
+	var info InfoCompressao
+	if erro = somarCompressao(cabecalho, meuFS, fat, raiz, &info); erro != nil {
+		return InfoCompressao{}, erro
+	}
+	info.Taxa = TaxaDeCompressao(info.Original, info.Comprimido)
+	return info, nil
+}
+
+// somarCompressao acrescenta à info os arquivos comprimidos do diretório e dos seus subdiretórios
+func somarCompressao(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, dir Diretorio, info *InfoCompressao) error {
+	for indice, nome := range dir.Nomes {
+		if nome == "" {
+			continue
+		}
+		entrada := dir.Entradas[indice]
+		if entrada.EhDir == 1 {
+			subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+			if erro != nil {
+				return erro
+			}
+			if erro = somarCompressao(cabecalho, meuFS, fat, subdir, info); erro != nil {
+				return erro
+			}
+			continue
+		}
+		if entrada.Atributos&AtributoComprimido == 0 {
+			continue
+		}
+		blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+		if erro != nil {
+			return fmt.Errorf("'%s': %w", nome, erro)
+		}
+		lido, _, erro := lerCabecalhoCompressao(cabecalho, meuFS, blocos, entrada.Tamanho)
+		if erro != nil {
+			return fmt.Errorf("'%s': %w", nome, erro)
+		}
+		info.Arquivos++
+		info.Original += uint64(entrada.Tamanho)
+		info.Comprimido += uint64(lido.TamanhoComprimido)
+	}
+	return nil
+}
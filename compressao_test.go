@@ -0,0 +1,71 @@
+package meufs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"meufs"
+)
+
+func TestLeituraParcialComprimida(t *testing.T) {
+	volume := novoVolume(t)
+	// Três pedaços de 64KB e um resto: texto repetido, que comprime, e bytes aleatórios no segundo pedaço, que o
+	// DEFLATE não diminui e ficam guardados como estão
+	dados := bytes.Repeat([]byte("linha de log repetida\n"), 10000)[:200000]
+	rand.New(rand.NewSource(1)).Read(dados[65536 : 2*65536])
+	gravar(t, volume, "/log.txt", string(dados))
+	if erro := meufs.ComprimirArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"log.txt"}); erro != nil {
+		t.Fatal(erro)
+	}
+	dir, indice, erro := meufs.ResolverCaminho(volume.Cabecalho, volume.Arquivo, []string{"log.txt"})
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	comprimido, erro := meufs.TamanhoComprimido(volume.Cabecalho, volume.Arquivo, dir.Entradas[indice])
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if comprimido >= uint32(len(dados))*3/4 {
+		t.Fatalf("o arquivo comprimido ocupa %d bytes de %d", comprimido, len(dados))
+	}
+	if texto := conteudo(t, volume, "/log.txt"); texto != string(dados) {
+		t.Fatalf("log.txt tem %d bytes diferentes do original", len(texto))
+	}
+	arquivo, erro := volume.Open("/log.txt")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer arquivo.Close()
+	trechos := []struct{ offset, tamanho int }{
+		{0, 10},               // Começo do primeiro pedaço
+		{65536 - 10, 20},      // Fim do pedaço comprimido e começo do guardado como está
+		{70000, 100},          // Meio do pedaço guardado como está
+		{2*65536 - 5, 65536},  // Do fim do segundo pedaço até o meio do quarto
+		{3*65536 + 100, 1000}, // Só o último pedaço, menor que os outros
+	}
+	for _, trecho := range trechos {
+		lido := make([]byte, trecho.tamanho)
+		if _, erro = arquivo.ReadAt(lido, int64(trecho.offset)); erro != nil {
+			t.Fatalf("ler %d bytes em %d: %v", trecho.tamanho, trecho.offset, erro)
+		}
+		if !bytes.Equal(lido, dados[trecho.offset:trecho.offset+trecho.tamanho]) {
+			t.Fatalf("os %d bytes lidos em %d são diferentes do original", trecho.tamanho, trecho.offset)
+		}
+	}
+	// Um trecho que passa do fim lê só até o fim, como num *os.File
+	lido := make([]byte, 100)
+	n, erro := arquivo.ReadAt(lido, int64(len(dados)-30))
+	if n != 30 || !errors.Is(erro, io.EOF) || !bytes.Equal(lido[:n], dados[len(dados)-30:]) {
+		t.Fatalf("ler além do fim deveria retornar os 30 bytes finais e io.EOF, retornou %d bytes e %v", n, erro)
+	}
+	if erro = meufs.DescomprimirArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"log.txt"}); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/log.txt"); texto != string(dados) {
+		t.Fatalf("log.txt descomprimido tem %d bytes diferentes do original", len(texto))
+	}
+	verificar(t, volume)
+}
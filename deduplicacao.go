@@ -0,0 +1,498 @@
+package meufs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Arquivos guardados em blocos comuns (sem cifra e sem compressão) com o mesmo conteúdo compartilham os mesmos
+// blocos: ao gravar um arquivo inteiro, o meufs procura pelo SHA-256 outro arquivo igual e, se achar, a nova entrada
+// aponta para a cadeia dele. A tabela de referências conta quantas entradas usam cada bloco compartilhado, e um
+// bloco só é zerado e liberado quando a última entrada que o usa deixa de usá-lo. Como a FAT guarda um único
+// próximo bloco para cada bloco, o compartilhamento é sempre da cadeia inteira, e alterar um arquivo compartilhado
+// faz antes uma cópia só dele da cadeia
+
+// AreaReferencias fica no cabeçalho, logo depois da AreaChaves, e diz onde está a tabela de referências.
+// A tabela só é criada, em blocos da área de dados, quando o primeiro bloco é compartilhado
+type AreaReferencias struct {
+	Criada        uint8  // 1 se a tabela já existe
+	PrimeiroBloco uint32 // Primeiro bloco da cadeia da tabela
+}
+
+// posicaoAreaReferencias é onde a AreaReferencias fica no meufs.fs, logo depois da AreaChaves
+func posicaoAreaReferencias() int64 {
+	return posicaoAreaChaves() + int64(binary.Size(AreaChaves{}))
+}
+
+// lerAreaReferencias lê a AreaReferencias do cabeçalho
+func lerAreaReferencias(cabecalho Cabecalho, meuFS *MeuFS) (AreaReferencias, error) {
+	var area AreaReferencias
+	dados := make([]byte, binary.Size(area))
+	if _, erro := meuFS.ReadAt(dados, posicaoAreaReferencias()); erro != nil {
+		return AreaReferencias{}, fmt.Errorf("erro ao ler a posição da tabela de referências: %w", erro)
+	}
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &area); erro != nil {
+		return AreaReferencias{}, fmt.Errorf("erro ao ler a posição da tabela de referências: %w", erro)
+	}
+	return area, nil
+}
+
+// LerReferencias lê a tabela de referências, que tem uma posição para cada bloco da FAT com quantas entradas usam
+// o bloco. Blocos livres e blocos com uma única entrada ficam com 0, então um volume em que nenhum bloco foi
+// compartilhado ainda não tem tabela e todas as posições ficam com 0
+func LerReferencias(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32) ([]uint32, error) {
+	referencias := make([]uint32, len(fat))
+	area, erro := lerAreaReferencias(cabecalho, meuFS)
+	if erro != nil || area.Criada == 0 {
+		return referencias, erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, area.PrimeiroBloco)
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao ler a tabela de referências: %w", erro)
+	}
+	dados := make([]byte, binary.Size(referencias))
+	if erro = lerDosBlocos(cabecalho, meuFS, blocos, 0, dados); erro != nil {
+		return nil, fmt.Errorf("erro ao ler a tabela de referências: %w", erro)
+	}
+	if erro = binary.Read(bytes.NewReader(dados), binary.LittleEndian, referencias); erro != nil {
+		return nil, fmt.Errorf("erro ao ler a tabela de referências: %w", erro)
+	}
+	return referencias, nil
+}
+
+// salvarReferencias grava a tabela de referências. Na primeira vez em que algum bloco é compartilhado, a tabela é
+// criada em blocos livres da FAT em memória, então quem chama é responsável por salvar a FAT
+func salvarReferencias(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, referencias []uint32) error {
+	area, erro := lerAreaReferencias(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if area.Criada == 0 && !slices.ContainsFunc(referencias, func(contagem uint32) bool { return contagem > 1 }) {
+		return nil
+	}
+	var dados bytes.Buffer
+	binary.Write(&dados, binary.LittleEndian, referencias)
+	if area.Criada == 1 {
+		blocos, erro := CadeiaDeBlocos(fat, area.PrimeiroBloco)
+		if erro != nil {
+			return fmt.Errorf("erro ao gravar a tabela de referências: %w", erro)
+		}
+		return escreverNosBlocos(cabecalho, meuFS, blocos, 0, dados.Bytes())
+	}
+	inicio, erro := GravarConteudo(cabecalho, meuFS, fat, dados.Bytes())
+	if erro != nil {
+		return fmt.Errorf("erro ao criar a tabela de referências: %w", erro)
+	}
+	dados.Reset()
+	binary.Write(&dados, binary.LittleEndian, AreaReferencias{Criada: 1, PrimeiroBloco: inicio})
+	if _, erro = meuFS.WriteAt(dados.Bytes(), posicaoAreaReferencias()); erro != nil {
+		return fmt.Errorf("erro ao gravar a posição da tabela de referências: %w", erro)
+	}
+	return nil
+}
+
+// AreaIndiceConteudo fica no cabeçalho, logo depois da AreaSnapshots, e diz onde está o índice de conteúdo.
+// O índice tem uma posição para cada bloco da FAT: no primeiro bloco da cadeia de um arquivo guardado em blocos
+// comuns fica o começo do SHA-256 do conteúdo dele, e nas outras posições fica 0. Com ele, achar um arquivo igual
+// não precisa percorrer a árvore. O índice é criado na primeira vez em que um arquivo é gravado, a partir dos
+// arquivos que já existem, e a posição do primeiro bloco é zerada sempre que a cadeia é alterada ou liberada
+type AreaIndiceConteudo struct {
+	Criado        uint8  // 1 se o índice já existe
+	PrimeiroBloco uint32 // Primeiro bloco da cadeia do índice
+}
+
+// posicaoAreaIndice é onde a AreaIndiceConteudo fica no meufs.fs, logo depois da AreaSnapshots
+func posicaoAreaIndice() int64 {
+	return posicaoAreaSnapshots() + int64(binary.Size(AreaSnapshots{}))
+}
+
+// lerAreaIndice lê a AreaIndiceConteudo do cabeçalho
+func lerAreaIndice(cabecalho Cabecalho, meuFS *MeuFS) (AreaIndiceConteudo, error) {
+	var area AreaIndiceConteudo
+	dados := make([]byte, binary.Size(area))
+	if _, erro := meuFS.ReadAt(dados, posicaoAreaIndice()); erro != nil {
+		return AreaIndiceConteudo{}, fmt.Errorf("erro ao ler a posição do índice de conteúdo: %w", erro)
+	}
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &area); erro != nil {
+		return AreaIndiceConteudo{}, fmt.Errorf("erro ao ler a posição do índice de conteúdo: %w", erro)
+	}
+	return area, nil
+}
+
+// chaveDoConteudo é o valor guardado no índice para o SHA-256, os seus primeiros 8 bytes. Como 0 marca as
+// posições vazias, um hash que começa com 8 zeros fica com 1
+func chaveDoConteudo(hash [sha256.Size]byte) uint64 {
+	return max(binary.LittleEndian.Uint64(hash[:8]), 1)
+}
+
+// lerIndiceConteudo lê o índice de conteúdo. Enquanto ele não foi criado, é montado em memória percorrendo a árvore
+func lerIndiceConteudo(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32) ([]uint64, error) {
+	area, erro := lerAreaIndice(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	indice := make([]uint64, len(fat))
+	if area.Criado == 0 {
+		root, erro := LerDiretorioRaiz(cabecalho, meuFS)
+		if erro != nil {
+			return nil, erro
+		}
+		return indice, montarIndiceDoDiretorio(cabecalho, meuFS, fat, root, indice)
+	}
+	blocos, erro := CadeiaDeBlocos(fat, area.PrimeiroBloco)
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao ler o índice de conteúdo: %w", erro)
+	}
+	dados := make([]byte, binary.Size(indice))
+	if erro = lerDosBlocos(cabecalho, meuFS, blocos, 0, dados); erro != nil {
+		return nil, fmt.Errorf("erro ao ler o índice de conteúdo: %w", erro)
+	}
+	if erro = binary.Read(bytes.NewReader(dados), binary.LittleEndian, indice); erro != nil {
+		return nil, fmt.Errorf("erro ao ler o índice de conteúdo: %w", erro)
+	}
+	return indice, nil
+}
+
+// montarIndiceDoDiretorio põe no índice os arquivos guardados em blocos comuns do diretório e dos seus
+// subdiretórios. Cada cadeia só é lida uma vez, mesmo que várias entradas a compartilhem
+func montarIndiceDoDiretorio(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, dir Diretorio, indice []uint64) error {
+	for posicao, nome := range dir.Nomes {
+		entrada := dir.Entradas[posicao]
+		if nome == "" || entrada.EnderecoFAT == SemBlocos || fat[entrada.EnderecoFAT] == 0 {
+			continue
+		}
+		if entrada.EhDir == 1 {
+			subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+			if erro != nil {
+				return erro
+			}
+			if erro = montarIndiceDoDiretorio(cabecalho, meuFS, fat, subdir, indice); erro != nil {
+				return erro
+			}
+			continue
+		}
+		if entrada.Tamanho == 0 || entrada.Atributos&atributosDoConteudo != 0 || indice[entrada.EnderecoFAT] != 0 {
+			continue
+		}
+		hash, erro := hashDaCadeia(cabecalho, meuFS, fat, entrada.EnderecoFAT, entrada.Tamanho)
+		if erro != nil {
+			return erro
+		}
+		indice[entrada.EnderecoFAT] = chaveDoConteudo(hash)
+	}
+	return nil
+}
+
+// registrarConteudo guarda no índice o SHA-256 da cadeia iniciada em inicio, recém-gravada com o conteúdo inteiro
+// de um arquivo em blocos comuns. Na primeira vez o índice é criado em blocos livres da FAT em memória, então quem
+// chama é responsável por salvar a FAT
+func registrarConteudo(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32, hash [sha256.Size]byte) error {
+	if inicio == SemBlocos {
+		return nil
+	}
+	area, erro := lerAreaIndice(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	var dados bytes.Buffer
+	if area.Criado == 1 {
+		blocos, erro := CadeiaDeBlocos(fat, area.PrimeiroBloco)
+		if erro != nil {
+			return fmt.Errorf("erro ao gravar o índice de conteúdo: %w", erro)
+		}
+		binary.Write(&dados, binary.LittleEndian, chaveDoConteudo(hash))
+		return escreverNosBlocos(cabecalho, meuFS, blocos, int64(inicio)*8, dados.Bytes())
+	}
+	indice, erro := lerIndiceConteudo(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	indice[inicio] = chaveDoConteudo(hash)
+	binary.Write(&dados, binary.LittleEndian, indice)
+	primeiro, erro := GravarConteudo(cabecalho, meuFS, fat, dados.Bytes())
+	if erro != nil {
+		return fmt.Errorf("erro ao criar o índice de conteúdo: %w", erro)
+	}
+	dados.Reset()
+	binary.Write(&dados, binary.LittleEndian, AreaIndiceConteudo{Criado: 1, PrimeiroBloco: primeiro})
+	if _, erro = meuFS.WriteAt(dados.Bytes(), posicaoAreaIndice()); erro != nil {
+		return fmt.Errorf("erro ao gravar a posição do índice de conteúdo: %w", erro)
+	}
+	return nil
+}
+
+// esquecerConteudo zera a posição do índice do primeiro bloco da cadeia, que vai ser alterada ou liberada
+func esquecerConteudo(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32) error {
+	if inicio == SemBlocos {
+		return nil
+	}
+	area, erro := lerAreaIndice(cabecalho, meuFS)
+	if erro != nil || area.Criado == 0 {
+		return erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, area.PrimeiroBloco)
+	if erro != nil {
+		return fmt.Errorf("erro ao ler o índice de conteúdo: %w", erro)
+	}
+	valor := make([]byte, 8)
+	if erro = lerDosBlocos(cabecalho, meuFS, blocos, int64(inicio)*8, valor); erro != nil {
+		return fmt.Errorf("erro ao ler o índice de conteúdo: %w", erro)
+	}
+	if binary.LittleEndian.Uint64(valor) == 0 {
+		return nil
+	}
+	return escreverNosBlocos(cabecalho, meuFS, blocos, int64(inicio)*8, make([]byte, 8))
+}
+
+// soltarBloco tira uma referência do bloco e informa se ele ficou sem nenhuma entrada, quando deve ser liberado
+func soltarBloco(referencias []uint32, bloco uint32) bool {
+	if referencias[bloco] <= 1 {
+		return true
+	}
+	referencias[bloco]--
+	if referencias[bloco] == 1 {
+		referencias[bloco] = 0
+	}
+	return false
+}
+
+// soltarCadeia tira uma referência de cada bloco da cadeia iniciada em inicio, sobrescrevendo com zeros e marcando
+// livres na FAT em memória os que ficarem sem nenhuma entrada. Informa se algum bloco continuou compartilhado, quando
+// as referências em memória mudaram e precisam ser salvas
+func soltarCadeia(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, referencias []uint32, inicio uint32) (bool, error) {
+	compartilhados := false
+	blocoDeZeros := make([]byte, cabecalho.TamanhoBloco)
+	blocos, erro := CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		return false, erro
+	}
+	if len(blocos) > 0 && referencias[inicio] <= 1 {
+		// A cadeia vai ser liberada e sai do índice de conteúdo
+		if erro := esquecerConteudo(cabecalho, meuFS, fat, inicio); erro != nil {
+			return false, erro
+		}
+	}
+	for _, indice := range blocos {
+		if !soltarBloco(referencias, indice) {
+			compartilhados = true
+			continue
+		}
+		if _, erro := meuFS.WriteAt(blocoDeZeros, PosicaoDoBloco(cabecalho, indice)); erro != nil {
+			return compartilhados, fmt.Errorf("erro ao sobrescrever bloco do arquivo com zeros: %w", erro)
+		}
+		fat[indice] = 0
+	}
+	return compartilhados, nil
+}
+
+// referenciarCadeia soma uma referência em memória a cada bloco da cadeia iniciada em inicio
+func referenciarCadeia(fat []uint32, referencias []uint32, inicio uint32) error {
+	blocos, erro := CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		return erro
+	}
+	for _, indice := range blocos {
+		referencias[indice] = max(referencias[indice], 1) + 1
+	}
+	return nil
+}
+
+// cadeiaCompartilhada informa se algum dos blocos é usado por mais de uma entrada
+func cadeiaCompartilhada(referencias []uint32, blocos []uint32) bool {
+	for _, indice := range blocos {
+		if referencias[indice] > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// compartilharCadeia soma uma referência a cada bloco da cadeia iniciada em inicio, que passa a ser usada por mais
+// uma entrada. Altera a FAT em memória se a tabela de referências ainda não existir
+func compartilharCadeia(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32) error {
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	if erro = referenciarCadeia(fat, referencias, inicio); erro != nil {
+		return erro
+	}
+	return salvarReferencias(cabecalho, meuFS, fat, referencias)
+}
+
+// separarCadeia copia os primeiros numBlocos blocos da cadeia compartilhada para blocos livres, que formam uma
+// cadeia só do arquivo, e tira uma referência de cada bloco da cadeia antiga. Altera a FAT em memória, salva a
+// tabela de referências e retorna os blocos da nova cadeia
+func separarCadeia(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, referencias []uint32, blocos []uint32, numBlocos int) ([]uint32, error) {
+	novos, erro := buscarBlocosLivres(fat, min(numBlocos, len(blocos)))
+	if erro != nil {
+		return nil, erro
+	}
+	bloco := make([]byte, cabecalho.TamanhoBloco)
+	for i, indice := range novos {
+		if _, erro = meuFS.ReadAt(bloco, PosicaoDoBloco(cabecalho, blocos[i])); erro != nil {
+			return nil, fmt.Errorf("erro ao ler bloco compartilhado: %w", erro)
+		}
+		if _, erro = meuFS.WriteAt(bloco, PosicaoDoBloco(cabecalho, indice)); erro != nil {
+			return nil, fmt.Errorf("erro ao copiar bloco compartilhado: %w", erro)
+		}
+		fat[indice] = FimDaCadeia
+		if i > 0 {
+			fat[novos[i-1]] = indice
+		}
+	}
+	if _, erro = soltarCadeia(cabecalho, meuFS, fat, referencias, blocos[0]); erro != nil {
+		return nil, erro
+	}
+	return novos, salvarReferencias(cabecalho, meuFS, fat, referencias)
+}
+
+// hashDaCadeia retorna o SHA-256 dos primeiros tamanho bytes guardados na cadeia iniciada em inicio
+func hashDaCadeia(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32, tamanho uint32) ([sha256.Size]byte, error) {
+	hash := sha256.New()
+	bloco := make([]byte, cabecalho.TamanhoBloco)
+	restante := int64(tamanho)
+	blocos, erro := CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		return [sha256.Size]byte{}, erro
+	}
+	for _, indice := range blocos {
+		if restante <= 0 {
+			break
+		}
+		if _, erro := meuFS.ReadAt(bloco, PosicaoDoBloco(cabecalho, indice)); erro != nil {
+			return [sha256.Size]byte{}, fmt.Errorf("erro ao ler bloco do arquivo: %w", erro)
+		}
+		quantidade := min(restante, int64(len(bloco)))
+		hash.Write(bloco[:quantidade])
+		restante -= quantidade
+	}
+	return [sha256.Size]byte(hash.Sum(nil)), nil
+}
+
+// buscarConteudoIgual procura pelo índice de conteúdo um arquivo guardado em blocos comuns com o tamanho e o
+// SHA-256 informados e retorna o primeiro bloco dele, ou SemBlocos se não houver. Cada candidato do índice tem a
+// cadeia lida para conferir o SHA-256 inteiro
+func buscarConteudoIgual(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, tamanho uint32, hash [sha256.Size]byte) (uint32, error) {
+	if tamanho == 0 {
+		return SemBlocos, nil
+	}
+	indice, erro := lerIndiceConteudo(cabecalho, meuFS, fat)
+	if erro != nil {
+		return SemBlocos, erro
+	}
+	chave := chaveDoConteudo(hash)
+	numBlocos := int((tamanho + cabecalho.TamanhoBloco - 1) / cabecalho.TamanhoBloco)
+	for inicio, valor := range indice {
+		if valor != chave || fat[inicio] == 0 {
+			continue
+		}
+		// O índice é só uma pista: um candidato com a cadeia corrompida não é compartilhado
+		if blocos, erro := CadeiaDeBlocos(fat, uint32(inicio)); erro != nil || len(blocos) != numBlocos {
+			continue
+		}
+		hashCadeia, erro := hashDaCadeia(cabecalho, meuFS, fat, uint32(inicio), tamanho)
+		if erro != nil {
+			return SemBlocos, erro
+		}
+		if hashCadeia == hash {
+			return uint32(inicio), nil
+		}
+	}
+	return SemBlocos, nil
+}
+
+// hashDoLeitor retorna o tamanho e o SHA-256 de tudo o que o leitor tiver
+func hashDoLeitor(leitor io.Reader) (int64, [sha256.Size]byte, error) {
+	hash := sha256.New()
+	tamanho, erro := io.Copy(hash, leitor)
+	if erro != nil {
+		return 0, [sha256.Size]byte{}, erro
+	}
+	return tamanho, [sha256.Size]byte(hash.Sum(nil)), nil
+}
+
+// gravarDeduplicado grava os dados como GravarConteudo, mas se outro arquivo guardado em blocos comuns já tiver o
+// mesmo conteúdo, compartilha a cadeia dele em vez de ocupar blocos novos. Quem chama é responsável por salvar a FAT
+func gravarDeduplicado(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, dados []byte) (uint32, error) {
+	hash := sha256.Sum256(dados)
+	inicio, erro := buscarConteudoIgual(cabecalho, meuFS, fat, uint32(len(dados)), hash)
+	if erro != nil {
+		return 0, erro
+	}
+	if inicio == SemBlocos {
+		if inicio, erro = GravarConteudo(cabecalho, meuFS, fat, dados); erro != nil {
+			return 0, erro
+		}
+		return inicio, registrarConteudo(cabecalho, meuFS, fat, inicio, hash)
+	}
+	return inicio, compartilharCadeia(cabecalho, meuFS, fat, inicio)
+}
+
+// substituirDeduplicado troca todo o conteúdo de um arquivo guardado em blocos comuns pelos dados como
+// modificarBlocos, mas compartilha a cadeia de outro arquivo com o mesmo conteúdo se houver. Altera só a FAT em
+// memória e a entrada em memória
+func substituirDeduplicado(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada *DiretorioRoot, dados []byte) error {
+	hash := sha256.Sum256(dados)
+	inicio, erro := buscarConteudoIgual(cabecalho, meuFS, fat, uint32(len(dados)), hash)
+	if erro != nil {
+		return erro
+	}
+	switch inicio {
+	case SemBlocos:
+		if erro = modificarBlocos(cabecalho, meuFS, fat, entrada, 0, dados, int64(len(dados))); erro != nil {
+			return erro
+		}
+		return registrarConteudo(cabecalho, meuFS, fat, entrada.EnderecoFAT, hash)
+	case entrada.EnderecoFAT:
+		// O arquivo já tem esse conteúdo
+		return nil
+	}
+	if erro = LiberarBlocos(cabecalho, meuFS, fat, entrada.EnderecoFAT); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = inicio
+	entrada.Tamanho = uint32(len(dados))
+	return compartilharCadeia(cabecalho, meuFS, fat, inicio)
+}
+
+// InfoDeduplicacao resume quanto espaço os blocos compartilhados economizam. Os bytes lógicos são os que os blocos
+// usados ocupariam se cada entrada tivesse os seus próprios, e os físicos são os que ocupam de fato
+type InfoDeduplicacao struct {
+	BlocosCompartilhados uint32 `json:"shared_blocks"`
+	BytesLogicos         uint64 `json:"logical_bytes"`
+	BytesFisicos         uint64 `json:"physical_bytes"`
+	BytesEconomizados    uint64 `json:"saved_bytes"`
+}
+
+// CalcularDeduplicacao conta os blocos usados e os compartilhados usando a tabela de referências
+func CalcularDeduplicacao(cabecalho Cabecalho, meuFS *MeuFS) (InfoDeduplicacao, error) {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return InfoDeduplicacao{}, erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return InfoDeduplicacao{}, erro
+	}
+	var info InfoDeduplicacao
+	var logicos, fisicos uint64
+	for indice, entrada := range fat {
+		if entrada == 0 {
+			continue
+		}
+		fisicos++
+		logicos += uint64(max(referencias[indice], 1))
+		if referencias[indice] > 1 {
+			info.BlocosCompartilhados++
+		}
+	}
+	info.BytesLogicos = logicos * uint64(cabecalho.TamanhoBloco)
+	info.BytesFisicos = fisicos * uint64(cabecalho.TamanhoBloco)
+	info.BytesEconomizados = info.BytesLogicos - info.BytesFisicos
+	return info, nil
+}
@@ -0,0 +1,144 @@
+package meufs_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"meufs"
+)
+
+// enderecoFAT retorna o primeiro bloco do arquivo
+func enderecoFAT(t *testing.T, volume *meufs.Volume, nome string) uint32 {
+	t.Helper()
+	dir, indice, erro := meufs.ResolverCaminho(volume.Cabecalho, volume.Arquivo, []string{nome})
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return dir.Entradas[indice].EnderecoFAT
+}
+
+// verificar falha o teste se o fsck apontar algum problema
+func verificar(t *testing.T, volume *meufs.Volume) {
+	t.Helper()
+	relatorio, erro := meufs.VerificarFS(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if !relatorio.Ok {
+		t.Fatalf("fsck apontou problemas: %v", relatorio.Problemas)
+	}
+}
+
+func TestIndiceConteudo(t *testing.T) {
+	volume := novoVolume(t)
+	original := string(bytes.Repeat([]byte("meufs"), 2000))
+	gravar(t, volume, "/a", original)
+	gravar(t, volume, "/b", original)
+	if enderecoFAT(t, volume, "a") != enderecoFAT(t, volume, "b") {
+		t.Fatal("arquivos iguais deveriam compartilhar a cadeia")
+	}
+	// Um arquivo alterado no lugar sai do índice: outro com o conteúdo antigo dele não pode apontar para ele
+	gravar(t, volume, "/x", original+"x")
+	arquivo, erro := volume.OpenFile("/x", os.O_WRONLY, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = arquivo.WriteAt([]byte("M"), 0); erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.Close()
+	gravar(t, volume, "/y", original+"x")
+	if enderecoFAT(t, volume, "y") == enderecoFAT(t, volume, "x") {
+		t.Fatal("y apontou para x, que não tem mais o mesmo conteúdo")
+	}
+	if conteudo(t, volume, "/x")[0] != 'M' || conteudo(t, volume, "/y") != original+"x" {
+		t.Fatal("conteúdo errado depois de alterar x")
+	}
+	// Removidos os arquivos, a cadeia liberada sai do índice, e o diretório que reaproveita o bloco não é achado
+	for _, nome := range []string{"a", "b"} {
+		if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{nome}); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	if _, erro = meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "docs", true, nil); erro != nil {
+		t.Fatal(erro)
+	}
+	verificar(t, volume)
+	gravar(t, volume, "/c", "outro conteúdo")
+	gravar(t, volume, "/d", original)
+	gravar(t, volume, "/e", original)
+	if enderecoFAT(t, volume, "d") != enderecoFAT(t, volume, "e") {
+		t.Fatal("os arquivos gravados depois das remoções também deveriam ser achados pelo índice")
+	}
+	if texto := conteudo(t, volume, "/c"); texto != "outro conteúdo" {
+		t.Fatalf("c foi alterado: %q", texto)
+	}
+	verificar(t, volume)
+}
+
+func TestRemoverDeduplicado(t *testing.T) {
+	volume := novoVolume(t)
+	original := string(bytes.Repeat([]byte("meufs"), 2000))
+	for _, nome := range []string{"/a", "/b", "/c"} {
+		gravar(t, volume, nome, original)
+	}
+	inicio := enderecoFAT(t, volume, "a")
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	blocos, erro := meufs.CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	livresAntes := blocosLivres(t, volume)
+	// referenciasDaCadeia confere quantas entradas usam cada bloco da cadeia compartilhada
+	referenciasDaCadeia := func(esperadas uint32) {
+		t.Helper()
+		fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		referencias, erro := meufs.LerReferencias(volume.Cabecalho, volume.Arquivo, fat)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		for _, bloco := range blocos {
+			if max(referencias[bloco], 1) != esperadas {
+				t.Fatalf("o bloco %d tem %d referências, deveria ter %d", bloco, referencias[bloco], esperadas)
+			}
+		}
+	}
+	referenciasDaCadeia(3)
+	info, erro := meufs.CalcularDeduplicacao(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if info.BlocosCompartilhados != uint32(len(blocos)) || info.BytesEconomizados != uint64(2*len(blocos))*uint64(volume.Cabecalho.TamanhoBloco) {
+		t.Fatalf("com três cópias de %d blocos, o resumo deu %+v", len(blocos), info)
+	}
+	// Removidas as cópias, os blocos perdem uma referência de cada vez e só são liberados com a última
+	for i, nome := range []string{"c", "b"} {
+		if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{nome}); erro != nil {
+			t.Fatal(erro)
+		}
+		referenciasDaCadeia(uint32(2 - i))
+		if livres := blocosLivres(t, volume); livres != livresAntes {
+			t.Fatalf("remover %s com a cadeia ainda em uso liberou %d blocos", nome, livres-livresAntes)
+		}
+		if texto := conteudo(t, volume, "/a"); texto != original {
+			t.Fatalf("a foi alterado ao remover %s", nome)
+		}
+	}
+	if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a"}); erro != nil {
+		t.Fatal(erro)
+	}
+	if livres := blocosLivres(t, volume); livres != livresAntes+len(blocos) {
+		t.Fatalf("remover a última cópia deveria liberar %d blocos, liberou %d", len(blocos), livres-livresAntes)
+	}
+	if info, erro = meufs.CalcularDeduplicacao(volume.Cabecalho, volume.Arquivo); erro != nil || info.BlocosCompartilhados != 0 {
+		t.Fatalf("sem cópias não deveria sobrar bloco compartilhado, o resumo deu %+v (%v)", info, erro)
+	}
+	verificar(t, volume)
+}
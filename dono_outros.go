@@ -0,0 +1,21 @@
+//go:build !unix && !windows
+
+package meufs
+
+import "io/fs"
+
+// donoDoArquivo não tem como obter o dono fora dos sistemas Unix, então o dono fica desconhecido
+func donoDoArquivo(info fs.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// mudarDono não faz nada fora dos sistemas Unix, que não têm uid e gid
+func mudarDono(caminho string, dono uint32, grupo uint32) error {
+	return nil
+}
+
+// identidadeDoProcesso não tem um usuário para identificar fora dos sistemas Unix e do Windows, então o processo
+// é ninguém e só usa os bits dos outros
+func identidadeDoProcesso() Identidade {
+	return Identidade{}
+}
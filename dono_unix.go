@@ -0,0 +1,39 @@
+//go:build unix
+
+package meufs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// donoDoArquivo retorna o uid e o gid de um arquivo do sistema real
+func donoDoArquivo(info fs.FileInfo) (uint32, uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return stat.Uid, stat.Gid, true
+}
+
+// mudarDono troca o dono de um arquivo do sistema real. Como no cp -p, só quem tem permissão (em geral o root)
+// pode dar o arquivo a outro usuário, então a falta de permissão é ignorada e o arquivo fica com o dono atual
+func mudarDono(caminho string, dono uint32, grupo uint32) error {
+	erro := os.Lchown(caminho, int(dono), int(grupo))
+	if errors.Is(erro, fs.ErrPermission) {
+		return nil
+	}
+	return erro
+}
+
+// identidadeDoProcesso retorna o uid, o gid e os grupos suplementares do processo
+func identidadeDoProcesso() Identidade {
+	identidade := Identidade{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), Root: os.Getuid() == 0}
+	grupos, _ := os.Getgroups()
+	for _, grupo := range grupos {
+		identidade.Grupos = append(identidade.Grupos, uint32(grupo))
+	}
+	return identidade
+}
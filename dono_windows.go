@@ -0,0 +1,59 @@
+//go:build windows
+
+package meufs
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// tokenElevation é a classe do GetTokenInformation que informa se o processo roda como administrador
+const tokenElevation = 20
+
+// donoDoArquivo não tem como obter o dono no Windows, que não usa uid e gid, então o dono fica desconhecido
+func donoDoArquivo(info fs.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// mudarDono não faz nada no Windows, que não tem uid e gid
+func mudarDono(caminho string, dono uint32, grupo uint32) error {
+	return nil
+}
+
+// identidadeDoProcesso usa como uid e gid o último número (RID) do SID do usuário e do grupo principal do processo.
+// Só um processo elevado (executado como administrador) é o root
+func identidadeDoProcesso() Identidade {
+	token, erro := syscall.OpenCurrentProcessToken()
+	if erro != nil {
+		return Identidade{}
+	}
+	defer token.Close()
+	var identidade Identidade
+	if usuario, erro := token.GetTokenUser(); erro == nil {
+		identidade.Uid = ridDoSID(usuario.User.Sid)
+	}
+	if grupo, erro := token.GetTokenPrimaryGroup(); erro == nil {
+		identidade.Gid = ridDoSID(grupo.PrimaryGroup)
+	}
+	var elevado, tamanho uint32
+	if syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevado)), uint32(unsafe.Sizeof(elevado)), &tamanho) == nil {
+		identidade.Root = elevado != 0
+	}
+	return identidade
+}
+
+// ridDoSID retorna o último número de um SID (ex: 1001 em S-1-5-21-...-1001), ou SemDono se não for possível lê-lo
+func ridDoSID(sid *syscall.SID) uint32 {
+	texto, erro := sid.String()
+	if erro != nil {
+		return SemDono
+	}
+	rid, erro := strconv.ParseUint(texto[strings.LastIndex(texto, "-")+1:], 10, 32)
+	if erro != nil {
+		return SemDono
+	}
+	return uint32(rid)
+}
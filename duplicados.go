@@ -0,0 +1,195 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// PoliticaDuplicado diz o que fazer quando o nome escolhido já existe no diretório de destino
+type PoliticaDuplicado int
+
+const (
+	// DuplicadoFalhar recusa a operação com um erro fs.ErrExist
+	DuplicadoFalhar PoliticaDuplicado = iota
+	// DuplicadoSobrescrever substitui a entrada existente, desde que seus atributos permitam
+	DuplicadoSobrescrever
+	// DuplicadoRenomear usa o primeiro nome livre entre nome(1), nome(2)...
+	DuplicadoRenomear
+	// DuplicadoPular mantém o que já existe sem alterar nada, retornando um erro ErrPulado
+	DuplicadoPular
+)
+
+// ErrPulado é retornado, embrulhado, quando a política DuplicadoPular manteve o que já existia.
+// Nas cópias recursivas não conta como falha
+var ErrPulado = errors.New("já existe e foi mantido")
+
+// LerPoliticaDuplicado converte o valor da opção --if-exists (fail, overwrite, rename ou skip) em uma PoliticaDuplicado
+func LerPoliticaDuplicado(texto string) (PoliticaDuplicado, error) {
+	switch texto {
+	case "", "fail":
+		return DuplicadoFalhar, nil
+	case "overwrite":
+		return DuplicadoSobrescrever, nil
+	case "rename":
+		return DuplicadoRenomear, nil
+	case "skip":
+		return DuplicadoPular, nil
+	}
+	return DuplicadoFalhar, fmt.Errorf("política inválida '%s', use fail, overwrite, rename ou skip", texto)
+}
+
+// NomeLivre retorna o primeiro nome no formato nome(1), nome(2)... que não existe nas entradas.
+// O número entra antes da extensão (relatorio(1).pdf) e o nome é encurtado se passar do tamanho máximo
+func NomeLivre(dir Diretorio, nome string) (string, error) {
+	// Sempre há um nome livre entre os len(dir.Entradas)+1 primeiros números
+	for numero := 1; numero <= len(dir.Entradas)+1; numero++ {
+		candidato, ok := nomeNumerado(nome, numero)
+		if !ok {
+			break
+		}
+		if BuscarEntrada(dir, candidato) == -1 {
+			return candidato, nil
+		}
+	}
+	return "", fmt.Errorf("não foi possível encontrar um nome livre para '%s'", nome)
+}
+
+// nomeNumerado retorna o nome com o número antes da extensão (relatorio(1).pdf), encurtado se passar do tamanho
+// máximo. Retorna false se nem encurtando o nome fica válido
+func nomeNumerado(nome string, numero int) (string, bool) {
+	extensao := path.Ext(nome)
+	base := strings.TrimSuffix(nome, extensao)
+	if base == "" {
+		// Nomes como ".keep" não têm extensão
+		base, extensao = nome, ""
+	}
+	sufixo := fmt.Sprintf("(%d)%s", numero, extensao)
+	for ValidarNome(base+sufixo) != nil && base != "" {
+		runas := []rune(base)
+		base = string(runas[:len(runas)-1])
+	}
+	return base + sufixo, ValidarNome(base+sufixo) == nil
+}
+
+// CriarEntradaComPolitica cria um arquivo ou diretório como CriarEntrada, tratando um nome já existente conforme a política,
+// e retorna também o nome usado. Sobrescrever um arquivo troca seu conteúdo reaproveitando os blocos. Sobrescrever
+// um diretório com outro não altera nada (como mkdir -p). Arquivos e diretórios nunca sobrescrevem um ao outro.
+// Criar pede escrita no diretório e sobrescrever pede escrita no arquivo existente, que se for cifrado só pode ser
+// sobrescrito por dados vazios (deixando de ser cifrado) ou com GravarCifrado
+func CriarEntradaComPolitica(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminhoDir []string, nome string, ehDir bool, dados []byte, politica PoliticaDuplicado) (DiretorioRoot, string, error) {
+	dir, entradaDir, erro := abrirComPermissao(cabecalho, meuFS, identidade, caminhoDir)
+	if erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	indice := BuscarEntrada(dir, nome)
+	if indice == -1 {
+		entrada, erro := criarNoDiretorio(cabecalho, meuFS, identidade, caminhoDir, dir, entradaDir, nome, ehDir, dados)
+		return entrada, nome, erro
+	}
+	existente := dir.Entradas[indice]
+	switch politica {
+	case DuplicadoSobrescrever:
+		if existente.EhDir == 1 && ehDir {
+			return existente, nome, nil
+		}
+		if existente.EhDir == 1 || ehDir {
+			return DiretorioRoot{}, "", NovoErroFS(fs.ErrExist, "'%s' já existe e não pode ser sobrescrito por um %s", nome, descreverTipo(ehDir))
+		}
+		caminho := append(append([]string(nil), caminhoDir...), nome)
+		entrada, erro := SubstituirConteudo(cabecalho, meuFS, identidade, caminho, nil, dados)
+		return entrada, nome, erro
+	case DuplicadoRenomear:
+		if nome, erro = NomeLivre(dir, nome); erro != nil {
+			return DiretorioRoot{}, "", erro
+		}
+		entrada, erro := criarNoDiretorio(cabecalho, meuFS, identidade, caminhoDir, dir, entradaDir, nome, ehDir, dados)
+		return entrada, nome, erro
+	case DuplicadoPular:
+		return existente, nome, fmt.Errorf("'%s' %w", nome, ErrPulado)
+	}
+	return DiretorioRoot{}, "", NovoErroFS(fs.ErrExist, "um arquivo com o nome '%s' já existe no sistema", nome)
+}
+
+// RenomearEntradaComPolitica renomeia como RenomearEntrada, tratando um nome já existente conforme a política,
+// e retorna o nome usado. Sobrescrever remove a entrada de destino, que precisa poder ser removida e, se for
+// um diretório, estar vazia. Arquivos e diretórios nunca sobrescrevem um ao outro. A identidade precisa de
+// escrita no diretório, e entradas imutáveis ou somente anexar não são renomeadas
+func RenomearEntradaComPolitica(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, nomeNovo string, politica PoliticaDuplicado) (string, error) {
+	if erro := ValidarNome(nomeNovo); erro != nil {
+		return "", erro
+	}
+	dir, indice, entradaDir, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return "", erro
+	}
+	if erro = verificarAlteracao(identidade, entradaDir, dir.Entradas[indice], caminho); erro != nil {
+		return "", erro
+	}
+	if erro = verificarEntradaAlteravel(dir.Entradas[indice], caminho); erro != nil {
+		return "", erro
+	}
+	indiceDestino := BuscarEntrada(dir, nomeNovo)
+	if indiceDestino == indice {
+		return nomeNovo, nil
+	}
+	if indiceDestino != -1 {
+		switch politica {
+		case DuplicadoSobrescrever:
+			if dir.Entradas[indiceDestino].EhDir != dir.Entradas[indice].EhDir {
+				return "", NovoErroFS(fs.ErrExist, "'%s' já existe e não pode ser sobrescrito por um %s", nomeNovo, descreverTipo(dir.Entradas[indice].EhDir == 1))
+			}
+			caminhoDestino := append(append([]string(nil), caminho[:len(caminho)-1]...), nomeNovo)
+			if erro = RemoverEntrada(cabecalho, meuFS, identidade, caminhoDestino); erro != nil {
+				return "", erro
+			}
+			// A remoção já salvou o diretório, então ele é lido de novo
+			if dir, indice, erro = ResolverCaminho(cabecalho, meuFS, caminho); erro != nil {
+				return "", erro
+			}
+		case DuplicadoRenomear:
+			if nomeNovo, erro = NomeLivre(dir, nomeNovo); erro != nil {
+				return "", erro
+			}
+		case DuplicadoPular:
+			return caminho[len(caminho)-1], fmt.Errorf("'%s' %w", nomeNovo, ErrPulado)
+		default:
+			return "", NovoErroFS(fs.ErrExist, "um arquivo com o nome '%s' já existe no sistema", nomeNovo)
+		}
+	}
+	// Um nome maior pode precisar de mais entradas de continuação, então a entrada pode mudar de lugar no diretório
+	entrada := dir.Entradas[indice]
+	LiberarEntrada(&dir, indice)
+	novoIndice := EntradaLivre(dir, nomeNovo)
+	if novoIndice == -1 {
+		return "", errors.New("diretorio cheio")
+	}
+	EscreverEntrada(&dir, novoIndice, entrada, nomeNovo)
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return "", erro
+	}
+	return nomeNovo, tocarDiretorio(cabecalho, meuFS, caminho[:len(caminho)-1])
+}
+
+// criarNoDiretorio confere se a identidade pode criar entradas no diretório, cria a entrada e atualiza a data
+// de modificação do diretório onde ela foi criada
+func criarNoDiretorio(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminhoDir []string, dir Diretorio, entradaDir DiretorioRoot, nome string, ehDir bool, dados []byte) (DiretorioRoot, error) {
+	if erro := verificarCriacao(identidade, entradaDir, caminhoDir); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	entrada, erro := criarEntrada(cabecalho, meuFS, identidade, dir, nome, ehDir, dados)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return entrada, tocarDiretorio(cabecalho, meuFS, caminhoDir)
+}
+
+// descreverTipo retorna "diretorio" ou "arquivo", usado nas mensagens de erro
+func descreverTipo(ehDir bool) string {
+	if ehDir {
+		return "diretorio"
+	}
+	return "arquivo"
+}
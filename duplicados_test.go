@@ -0,0 +1,98 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// criarComPolitica cria um arquivo no root com a política informada e retorna o nome usado
+func criarComPolitica(volume *meufs.Volume, nome string, dados string, politica meufs.PoliticaDuplicado) (string, error) {
+	_, usado, erro := meufs.CriarEntradaComPolitica(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, nome, false, []byte(dados), politica)
+	return usado, erro
+}
+
+func TestCriarEntradaComPolitica(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/relatorio.pdf", "original")
+	if _, erro := criarComPolitica(volume, "relatorio.pdf", "novo", meufs.DuplicadoFalhar); !errors.Is(erro, fs.ErrExist) {
+		t.Fatalf("fail deveria recusar o nome existente com fs.ErrExist, recusou com %v", erro)
+	}
+	for _, esperado := range []string{"relatorio(1).pdf", "relatorio(2).pdf"} {
+		if nome, erro := criarComPolitica(volume, "relatorio.pdf", "renomeado", meufs.DuplicadoRenomear); erro != nil || nome != esperado {
+			t.Fatalf("rename deveria usar %s, usou %q (%v)", esperado, nome, erro)
+		}
+	}
+	gravar(t, volume, "/.keep", "")
+	if nome, erro := criarComPolitica(volume, ".keep", "", meufs.DuplicadoRenomear); erro != nil || nome != ".keep(1)" {
+		t.Fatalf("um nome começado por ponto não tem extensão e deveria virar .keep(1), virou %q (%v)", nome, erro)
+	}
+	// Um nome no tamanho máximo é encurtado para caber o número
+	longo := strings.Repeat("n", 251) + ".txt"
+	gravar(t, volume, "/"+longo, "")
+	if nome, erro := criarComPolitica(volume, longo, "", meufs.DuplicadoRenomear); erro != nil || nome != strings.Repeat("n", 248)+"(1).txt" {
+		t.Fatalf("o nome longo deveria ser encurtado antes do número, virou %q (%v)", nome, erro)
+	}
+	if _, erro := criarComPolitica(volume, "relatorio.pdf", "pulado", meufs.DuplicadoPular); !errors.Is(erro, meufs.ErrPulado) {
+		t.Fatalf("skip deveria retornar ErrPulado, retornou %v", erro)
+	}
+	if texto := conteudo(t, volume, "/relatorio.pdf"); texto != "original" {
+		t.Fatalf("fail e skip não deveriam alterar o arquivo, que tem %q", texto)
+	}
+	if _, erro := criarComPolitica(volume, "relatorio.pdf", "sobrescrito", meufs.DuplicadoSobrescrever); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/relatorio.pdf"); texto != "sobrescrito" {
+		t.Fatalf("overwrite deveria trocar o conteúdo, que ficou %q", texto)
+	}
+
+	// Sobrescrever respeita a proteção, e arquivos e diretórios não sobrescrevem um ao outro
+	if erro := meufs.DefinirProtecao(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"relatorio.pdf"}, true); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := criarComPolitica(volume, "relatorio.pdf", "x", meufs.DuplicadoSobrescrever); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("sobrescrever um arquivo protegido deveria falhar com fs.ErrPermission, falhou com %v", erro)
+	}
+	criarDiretorio(t, volume, "dir")
+	if _, erro := criarComPolitica(volume, "dir", "x", meufs.DuplicadoSobrescrever); !errors.Is(erro, fs.ErrExist) {
+		t.Fatalf("um arquivo não deveria sobrescrever um diretório, erro %v", erro)
+	}
+	if _, _, erro := meufs.CriarEntradaComPolitica(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "dir", true, nil, meufs.DuplicadoSobrescrever); erro != nil {
+		t.Fatalf("mkdir com overwrite deveria aceitar o diretório existente: %v", erro)
+	}
+	if _, erro := meufs.LerPoliticaDuplicado("replace"); erro == nil {
+		t.Fatal("uma política desconhecida deveria ser recusada")
+	}
+	verificar(t, volume)
+}
+
+func TestRenomearEntradaComPolitica(t *testing.T) {
+	volume := novoVolume(t)
+	renomear := func(de string, para string, politica meufs.PoliticaDuplicado) (string, error) {
+		return meufs.RenomearEntradaComPolitica(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{de}, para, politica)
+	}
+	gravar(t, volume, "/a.txt", "a")
+	gravar(t, volume, "/b.txt", "b")
+	if _, erro := renomear("b.txt", "a.txt", meufs.DuplicadoFalhar); !errors.Is(erro, fs.ErrExist) {
+		t.Fatalf("fail deveria recusar o nome existente, recusou com %v", erro)
+	}
+	if _, erro := renomear("b.txt", "a.txt", meufs.DuplicadoPular); !errors.Is(erro, meufs.ErrPulado) {
+		t.Fatalf("skip deveria retornar ErrPulado, retornou %v", erro)
+	}
+	if nome, erro := renomear("b.txt", "a.txt", meufs.DuplicadoRenomear); erro != nil || nome != "a(1).txt" {
+		t.Fatalf("rename deveria usar a(1).txt, usou %q (%v)", nome, erro)
+	}
+	if _, erro := renomear("a(1).txt", "a.txt", meufs.DuplicadoSobrescrever); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "b" {
+		t.Fatalf("overwrite deveria deixar o conteúdo do b.txt em a.txt, que tem %q", texto)
+	}
+	if existe(volume, "a(1).txt") || existe(volume, "b.txt") {
+		t.Fatal("o arquivo renomeado não deveria continuar com o nome antigo")
+	}
+	verificar(t, volume)
+}
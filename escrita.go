@@ -0,0 +1,281 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// redimensionarCadeia deixa a cadeia iniciada em inicio com numBlocos blocos, alocando blocos livres
+// no fim ou zerando e liberando os que sobrarem. Altera só a FAT em memória e retorna os blocos da cadeia.
+// Uma cadeia compartilhada com outros arquivos é antes copiada para blocos só deste (ver deduplicacao.go), uma cadeia
+// só deste sai do índice de conteúdo, e como uma cadeia sem blocos começa em SemBlocos, quem chama deve sempre
+// atualizar o EnderecoFAT da entrada
+func redimensionarCadeia(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32, numBlocos int) ([]uint32, error) {
+	blocos, erro := CadeiaDeBlocos(fat, inicio)
+	if erro != nil {
+		return nil, erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return nil, erro
+	}
+	if cadeiaCompartilhada(referencias, blocos) {
+		if blocos, erro = separarCadeia(cabecalho, meuFS, fat, referencias, blocos, numBlocos); erro != nil {
+			return nil, erro
+		}
+	} else if erro = esquecerConteudo(cabecalho, meuFS, fat, inicio); erro != nil {
+		return nil, erro
+	}
+	if numBlocos < len(blocos) {
+		// Liberando os blocos que sobraram
+		blocoDeZeros := make([]byte, cabecalho.TamanhoBloco)
+		for _, indice := range blocos[numBlocos:] {
+			if _, erro := meuFS.WriteAt(blocoDeZeros, PosicaoDoBloco(cabecalho, indice)); erro != nil {
+				return nil, fmt.Errorf("erro ao sobrescrever bloco do arquivo com zeros: %w", erro)
+			}
+			fat[indice] = 0
+		}
+		blocos = blocos[:numBlocos]
+		if len(blocos) > 0 {
+			fat[blocos[len(blocos)-1]] = FimDaCadeia
+		}
+		return blocos, nil
+	}
+	// Procurando blocos livres para estender a cadeia. Eles já estão zerados
+	novos, erro := buscarBlocosLivres(fat, numBlocos-len(blocos))
+	if erro != nil {
+		return nil, erro
+	}
+	for _, indice := range novos {
+		if len(blocos) > 0 {
+			fat[blocos[len(blocos)-1]] = indice
+		}
+		blocos = append(blocos, indice)
+	}
+	if len(blocos) > 0 {
+		fat[blocos[len(blocos)-1]] = FimDaCadeia
+	}
+	return blocos, nil
+}
+
+// buscarBlocosLivres retorna os primeiros quantidade blocos livres da FAT, sem marcá-los como usados
+func buscarBlocosLivres(fat []uint32, quantidade int) ([]uint32, error) {
+	livres := make([]uint32, 0, quantidade)
+	for indice, entrada := range fat {
+		if len(livres) == quantidade {
+			break
+		}
+		if entrada == 0 {
+			livres = append(livres, uint32(indice))
+		}
+	}
+	if len(livres) < quantidade {
+		return nil, errors.New("arquivo não coube no sistema de arquivos")
+	}
+	return livres, nil
+}
+
+// escreverNosBlocos escreve os dados a partir da posição offset do arquivo cujos blocos são informados
+func escreverNosBlocos(cabecalho Cabecalho, meuFS *MeuFS, blocos []uint32, offset int64, dados []byte) error {
+	tamanhoBloco := int64(cabecalho.TamanhoBloco)
+	for len(dados) > 0 {
+		dentroDoBloco := offset % tamanhoBloco
+		quantidade := min(int64(len(dados)), tamanhoBloco-dentroDoBloco)
+		posicao := PosicaoDoBloco(cabecalho, blocos[offset/tamanhoBloco]) + dentroDoBloco
+		if _, erro := meuFS.WriteAt(dados[:quantidade], posicao); erro != nil {
+			return fmt.Errorf("erro ao escrever bloco no meufs: %w", erro)
+		}
+		dados = dados[quantidade:]
+		offset += quantidade
+	}
+	return nil
+}
+
+// modificarArquivo escreve os dados no offset do arquivo e deixa o arquivo com novoTamanho bytes,
+// reaproveitando os blocos que ele já ocupa. Os bytes após o fim do arquivo no último bloco são mantidos zerados.
+// Os atributos do arquivo são respeitados: somente leitura e imutável recusam tudo, somente anexar só aceita
+// dados acrescentados ao fim. Trocar todo o conteúdo de um arquivo sem cifra pode passar a compartilhar os blocos de
+// outro arquivo igual (ver deduplicacao.go). Um arquivo cifrado é todo regravado com a cifra, e sem ela só pode ser esvaziado,
+// o que o deixa sem cifra. A identidade precisa de escrita no arquivo e de busca nos diretórios do caminho
+func modificarArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, offset int64, dados []byte, novoTamanho int64) (DiretorioRoot, error) {
+	if offset < 0 || novoTamanho < 0 || novoTamanho > math.MaxUint32 {
+		return DiretorioRoot{}, errors.New("offset ou tamanho inválido")
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	entrada := &dir.Entradas[indice]
+	if entrada.EhDir == 1 {
+		return DiretorioRoot{}, errors.New("não é possível escrever em um diretorio")
+	}
+	if !PodeAcessar(identidade, *entrada, AcessoEscrita) {
+		return DiretorioRoot{}, erroDePermissao(caminho, AcessoEscrita)
+	}
+	// Só acrescentar dados no fim, sem mudar o que já existe, é permitido nos arquivos somente anexar
+	anexando := offset == int64(entrada.Tamanho) && novoTamanho == offset+int64(len(dados))
+	if erro = verificarConteudo(*entrada, caminho, anexando); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	switch {
+	case entrada.Atributos&AtributoComprimido != 0:
+		var conteudo []byte
+		if conteudo, erro = LerConteudo(cabecalho, meuFS, *entrada, nil); erro == nil {
+			erro = gravarComprimido(cabecalho, meuFS, fat, entrada, conteudoModificado(conteudo, offset, dados, novoTamanho))
+		}
+	case entrada.Atributos&AtributoCifrado == 0 && offset == 0 && novoTamanho == int64(len(dados)):
+		erro = substituirDeduplicado(cabecalho, meuFS, fat, entrada, dados)
+	case entrada.Atributos&AtributoCifrado == 0:
+		erro = modificarBlocos(cabecalho, meuFS, fat, entrada, offset, dados, novoTamanho)
+	case cifra != nil:
+		var conteudo []byte
+		if conteudo, erro = LerConteudo(cabecalho, meuFS, *entrada, cifra); erro == nil {
+			erro = gravarCifrado(cabecalho, meuFS, fat, entrada, cifra, conteudoModificado(conteudo, offset, dados, novoTamanho))
+		}
+	case novoTamanho == 0:
+		erro = gravarEmBlocosComuns(cabecalho, meuFS, fat, entrada, nil)
+	default:
+		erro = ErrArquivoCifrado
+	}
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	entrada.Modificado = agora()
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return *entrada, meuFS.Sync()
+}
+
+// conteudoModificado retorna o conteúdo com os dados escritos no offset e o tamanho mudado para novoTamanho
+func conteudoModificado(conteudo []byte, offset int64, dados []byte, novoTamanho int64) []byte {
+	novo := make([]byte, novoTamanho)
+	copy(novo, conteudo)
+	copy(novo[offset:], dados)
+	return novo
+}
+
+// modificarBlocos faz a modificação de modificarArquivo direto nos blocos de um arquivo sem cifra e atualiza
+// a entrada em memória. Altera só a FAT em memória
+func modificarBlocos(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada *DiretorioRoot, offset int64, dados []byte, novoTamanho int64) error {
+	tamanhoBloco := int64(cabecalho.TamanhoBloco)
+	numBlocos := int((novoTamanho + tamanhoBloco - 1) / tamanhoBloco)
+	blocos, erro := redimensionarCadeia(cabecalho, meuFS, fat, entrada.EnderecoFAT, numBlocos)
+	if erro != nil {
+		return erro
+	}
+	// Ao diminuir o arquivo, o resto do novo último bloco é zerado
+	if novoTamanho < int64(entrada.Tamanho) && novoTamanho%tamanhoBloco != 0 {
+		zeros := make([]byte, tamanhoBloco-novoTamanho%tamanhoBloco)
+		if erro = escreverNosBlocos(cabecalho, meuFS, blocos, novoTamanho, zeros); erro != nil {
+			return erro
+		}
+	}
+	if erro = escreverNosBlocos(cabecalho, meuFS, blocos, offset, dados); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = SemBlocos
+	if len(blocos) > 0 {
+		entrada.EnderecoFAT = blocos[0]
+	}
+	entrada.Tamanho = uint32(novoTamanho)
+	return nil
+}
+
+// gravarEmBlocosComuns troca o conteúdo do arquivo pelos dados em blocos comuns, com o fim do último bloco zerado, e
+// tira os atributosDoConteudo da entrada em memória, deixando o arquivo sem cifra e sem compressão. Altera só a FAT
+// em memória
+func gravarEmBlocosComuns(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada *DiretorioRoot, dados []byte) error {
+	numBlocos := (len(dados) + int(cabecalho.TamanhoBloco) - 1) / int(cabecalho.TamanhoBloco)
+	blocos, erro := redimensionarCadeia(cabecalho, meuFS, fat, entrada.EnderecoFAT, numBlocos)
+	if erro != nil {
+		return erro
+	}
+	preenchido := make([]byte, numBlocos*int(cabecalho.TamanhoBloco))
+	copy(preenchido, dados)
+	if erro = escreverNosBlocos(cabecalho, meuFS, blocos, 0, preenchido); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = SemBlocos
+	if len(blocos) > 0 {
+		entrada.EnderecoFAT = blocos[0]
+	}
+	entrada.Tamanho = uint32(len(dados))
+	entrada.Atributos &^= atributosDoConteudo
+	return nil
+}
+
+// regravarConteudo regrava todo o conteúdo do arquivo com a função gravar, que recebe a FAT e a entrada em memória
+// e é chamada depois de conferir o acesso pedido e os atributos do arquivo. Salva a entrada e a FAT no fim
+func regravarConteudo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, acesso uint32, gravar func(fat []uint32, entrada *DiretorioRoot) error) (DiretorioRoot, error) {
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	entrada := &dir.Entradas[indice]
+	if entrada.EhDir == 1 {
+		return DiretorioRoot{}, fmt.Errorf("'/%s' é um diretorio", strings.Join(caminho, "/"))
+	}
+	if !PodeAcessar(identidade, *entrada, acesso) {
+		return DiretorioRoot{}, erroDePermissao(caminho, acesso)
+	}
+	if erro = verificarConteudo(*entrada, caminho, false); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	if erro = gravar(fat, entrada); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	entrada.Modificado = agora()
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return *entrada, meuFS.Sync()
+}
+
+// EscreverNoArquivo escreve os dados a partir do offset, estendendo o arquivo se passar do fim.
+// Um offset além do fim deixa um trecho de zeros entre o fim antigo e os dados. A cifra é a do arquivo,
+// ou nil se ele não for cifrado
+func EscreverNoArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, offset int64, dados []byte) (DiretorioRoot, error) {
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	novoTamanho := max(int64(dir.Entradas[indice].Tamanho), offset+int64(len(dados)))
+	return modificarArquivo(cabecalho, meuFS, identidade, caminho, cifra, offset, dados, novoTamanho)
+}
+
+// AnexarAoArquivo escreve os dados no fim do arquivo, completando primeiro o último bloco
+func AnexarAoArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, dados []byte) (DiretorioRoot, error) {
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	tamanho := int64(dir.Entradas[indice].Tamanho)
+	return modificarArquivo(cabecalho, meuFS, identidade, caminho, cifra, tamanho, dados, tamanho+int64(len(dados)))
+}
+
+// TruncarArquivo muda o tamanho do arquivo, liberando os blocos que sobrarem ou estendendo-o com zeros
+func TruncarArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, tamanho int64) (DiretorioRoot, error) {
+	return modificarArquivo(cabecalho, meuFS, identidade, caminho, cifra, 0, nil, tamanho)
+}
+
+// SubstituirConteudo troca todo o conteúdo do arquivo pelos dados informados, reaproveitando seus blocos
+func SubstituirConteudo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, cifra *CifraArquivo, dados []byte) (DiretorioRoot, error) {
+	return modificarArquivo(cabecalho, meuFS, identidade, caminho, cifra, 0, dados, int64(len(dados)))
+}
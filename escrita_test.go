@@ -0,0 +1,101 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestAnexarSubstituirTruncar(t *testing.T) {
+	volume := novoVolume(t)
+	tamanhoBloco := int(volume.Cabecalho.TamanhoBloco)
+	caminho := []string{"a.txt"}
+	inicial := strings.Repeat("a", tamanhoBloco+100)
+	gravar(t, volume, "/a.txt", inicial)
+	primeiro := enderecoFAT(t, volume, "a.txt")
+	livres := blocosLivres(t, volume)
+
+	// Acrescentar completa o último bloco antes de pegar outro
+	if _, erro := meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, []byte(strings.Repeat("b", tamanhoBloco-100))); erro != nil {
+		t.Fatal(erro)
+	}
+	if livres := blocosLivres(t, volume) - livres; livres != 0 {
+		t.Fatalf("acrescentar até completar o último bloco não deveria usar blocos novos, usou %d", -livres)
+	}
+	if _, erro := meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, []byte("c")); erro != nil {
+		t.Fatal(erro)
+	}
+	esperado := inicial + strings.Repeat("b", tamanhoBloco-100) + "c"
+	if texto := conteudo(t, volume, "/a.txt"); texto != esperado {
+		t.Fatalf("a.txt tem %d bytes depois de acrescentar, deveria ter %d", len(texto), len(esperado))
+	}
+	if livres-blocosLivres(t, volume) != 1 {
+		t.Fatal("passar do último bloco deveria usar exatamente um bloco novo")
+	}
+
+	// Substituir reaproveita a cadeia e libera o que sobrar
+	if _, erro := meufs.SubstituirConteudo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, []byte("curto")); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "curto" {
+		t.Fatalf("a.txt deveria ter só o conteúdo novo, tem %q", texto)
+	}
+	if enderecoFAT(t, volume, "a.txt") != primeiro {
+		t.Fatal("substituir deveria reaproveitar o primeiro bloco da cadeia")
+	}
+	if blocosLivres(t, volume)-livres != 1 {
+		t.Fatal("substituir por um conteúdo de um bloco deveria liberar os outros dois")
+	}
+
+	// Truncar para mais estende com zeros, e para menos libera os blocos
+	if _, erro := meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, int64(tamanhoBloco+10)); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "curto"+strings.Repeat("\x00", tamanhoBloco+5) {
+		t.Fatalf("estender deveria completar com zeros, a.txt tem %d bytes", len(texto))
+	}
+	if _, erro := meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, 3); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "cur" {
+		t.Fatalf("a.txt deveria ter ficado com 'cur', tem %q", texto)
+	}
+	if _, erro := meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, 0); erro != nil {
+		t.Fatal(erro)
+	}
+	if blocosLivres(t, volume)-livres != 2 {
+		t.Fatal("truncar para zero deveria liberar todos os blocos do arquivo")
+	}
+	verificar(t, volume)
+}
+
+func TestEscritaRespeitaProtecao(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", "protegido")
+	caminho := []string{"a.txt"}
+	if erro := meufs.DefinirProtecao(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, true); erro != nil {
+		t.Fatal(erro)
+	}
+	operacoes := map[string]func() (meufs.DiretorioRoot, error){
+		"anexar": func() (meufs.DiretorioRoot, error) {
+			return meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, []byte("x"))
+		},
+		"substituir": func() (meufs.DiretorioRoot, error) {
+			return meufs.SubstituirConteudo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, []byte("x"))
+		},
+		"truncar": func() (meufs.DiretorioRoot, error) {
+			return meufs.TruncarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho, nil, 0)
+		},
+	}
+	for nome, operacao := range operacoes {
+		if _, erro := operacao(); !errors.Is(erro, fs.ErrPermission) {
+			t.Errorf("%s um arquivo protegido deveria falhar com fs.ErrPermission, falhou com %v", nome, erro)
+		}
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "protegido" {
+		t.Fatalf("o arquivo protegido não deveria ter mudado, tem %q", texto)
+	}
+}
@@ -0,0 +1,28 @@
+package meufs
+
+// Ganchos para os testes do pacote meufs_test alcançarem as primitivas criptográficas, que não são exportadas
+
+var (
+	DerivarChave = derivarChave
+	PBKDF2SHA256 = pbkdf2SHA256
+)
+
+// CifrarSetorXTS cifra um setor no lugar com o XTS do volume, usando a chave mestra dada
+func CifrarSetorXTS(chaveMestra []byte, setor []byte, numero uint64) error {
+	cifra, erro := novaCifraXTS(chaveMestra)
+	if erro != nil {
+		return erro
+	}
+	cifra.cifrarSetor(setor, numero)
+	return nil
+}
+
+// DecifrarSetorXTS desfaz CifrarSetorXTS
+func DecifrarSetorXTS(chaveMestra []byte, setor []byte, numero uint64) error {
+	cifra, erro := novaCifraXTS(chaveMestra)
+	if erro != nil {
+		return erro
+	}
+	cifra.decifrarSetor(setor, numero)
+	return nil
+}
@@ -0,0 +1,208 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportacao guarda o estado de uma cópia recursiva do meufs para o sistema real
+type exportacao struct {
+	cabecalho  Cabecalho
+	meuFS      *MeuFS
+	identidade Identidade
+	politica   PoliticaDuplicado
+	preservar  bool
+	relatorio  RelatorioCopia
+}
+
+// ExportarDiretorio copia o diretório do meufs indicado pela origem, com tudo que há dentro dele, para o diretório real
+// destino, que é criado se não existir (o conteúdo do root vai direto para o destino). Os caminhos reais são montados com
+// filepath.Join e nomes guardados que sairiam do destino são recusados. Diretórios reais que já existem são reaproveitados
+// e arquivos reais que já existem seguem a política. Links simbólicos no destino nunca são seguidos. Um item que falha
+// vai para as falhas do relatório sem interromper os demais. Com preservar, modo, datas e dono guardados são aplicados.
+// A identidade precisa de leitura e execução em cada diretório e de leitura em cada arquivo copiado
+func ExportarDiretorio(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, origem []string, destino string, politica PoliticaDuplicado, preservar bool) (RelatorioCopia, error) {
+	entrada := entradaDoRoot
+	if len(origem) > 0 {
+		dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, origem)
+		if erro != nil {
+			return RelatorioCopia{}, erro
+		}
+		entrada = dir.Entradas[indice]
+	}
+	if entrada.EhDir != 1 {
+		return RelatorioCopia{}, fmt.Errorf("'/%s' não é um diretorio", strings.Join(origem, "/"))
+	}
+	if !PodeAcessar(identidade, entrada, AcessoLeitura|AcessoExecucao) {
+		return RelatorioCopia{}, erroDePermissao(origem, AcessoLeitura|AcessoExecucao)
+	}
+	if erro := criarDiretorioReal(destino); erro != nil {
+		return RelatorioCopia{}, erro
+	}
+	e := &exportacao{cabecalho: cabecalho, meuFS: meuFS, identidade: identidade, politica: politica, preservar: preservar}
+	if len(origem) > 0 {
+		e.relatorio.Diretorios++
+	}
+	e.copiarDiretorio(origem, destino)
+	if preservar && len(origem) > 0 {
+		if erro := AplicarMetadados(destino, entrada); erro != nil {
+			e.falha(origem, erro)
+		}
+	}
+	return e.relatorio, nil
+}
+
+// ValidarNomeReal recusa nomes guardados no meufs que, usados no sistema real, sairiam do diretório onde são criados,
+// como "..", nomes com o separador do sistema ou, no Windows, nomes de dispositivos como "CON"
+func ValidarNomeReal(nome string) error {
+	if erro := ValidarNome(nome); erro != nil {
+		return erro
+	}
+	if !filepath.IsLocal(nome) || strings.ContainsRune(nome, filepath.Separator) {
+		return fmt.Errorf("nome '%s' não pode ser usado no sistema real", nome)
+	}
+	return nil
+}
+
+// criarDiretorioReal cria o diretório real ou aproveita o que já existe, desde que não seja um link simbólico
+func criarDiretorioReal(caminho string) error {
+	info, erro := os.Lstat(caminho)
+	if errors.Is(erro, fs.ErrNotExist) {
+		if erro = os.Mkdir(caminho, 0755); erro != nil {
+			return fmt.Errorf("erro ao criar o diretorio no sistema real: %w", erro)
+		}
+		return nil
+	}
+	if erro != nil {
+		return erro
+	}
+	if !info.IsDir() {
+		return NovoErroFS(fs.ErrExist, "'%s' já existe e não é um diretorio", caminho)
+	}
+	return nil
+}
+
+// falha registra um item que não foi copiado
+func (e *exportacao) falha(caminho []string, erro error) {
+	e.relatorio.Falhas = append(e.relatorio.Falhas, FalhaCopia{"/" + strings.Join(caminho, "/"), erro})
+}
+
+// copiarDiretorio copia as entradas do diretório do meufs para o diretório real, que já existe.
+// Os metadados de cada subdiretório são aplicados depois do seu conteúdo, que mudaria a data de modificação
+func (e *exportacao) copiarDiretorio(caminho []string, real string) {
+	dir, erro := AbrirDiretorio(e.cabecalho, e.meuFS, caminho)
+	if erro != nil {
+		e.falha(caminho, erro)
+		return
+	}
+	for indice, nome := range dir.Nomes {
+		if nome == "" {
+			continue
+		}
+		entrada := dir.Entradas[indice]
+		caminhoFilho := append(append([]string(nil), caminho...), nome)
+		if erro := ValidarNomeReal(nome); erro != nil {
+			e.falha(caminhoFilho, erro)
+			continue
+		}
+		realFilho := filepath.Join(real, nome)
+		if entrada.EhDir != 1 {
+			e.copiarArquivo(caminhoFilho, entrada, realFilho)
+			continue
+		}
+		if !PodeAcessar(e.identidade, entrada, AcessoLeitura|AcessoExecucao) {
+			e.falha(caminhoFilho, erroDePermissao(caminhoFilho, AcessoLeitura|AcessoExecucao))
+			continue
+		}
+		if erro := criarDiretorioReal(realFilho); erro != nil {
+			e.falha(caminhoFilho, fmt.Errorf("%w (o conteúdo do diretorio não foi copiado)", erro))
+			continue
+		}
+		e.relatorio.Diretorios++
+		e.copiarDiretorio(caminhoFilho, realFilho)
+		if e.preservar {
+			if erro := AplicarMetadados(realFilho, entrada); erro != nil {
+				e.falha(caminhoFilho, erro)
+			}
+		}
+	}
+}
+
+// copiarArquivo copia um arquivo do meufs para o caminho real, seguindo a política se ele já existir
+func (e *exportacao) copiarArquivo(caminho []string, entrada DiretorioRoot, real string) {
+	if !PodeAcessar(e.identidade, entrada, AcessoLeitura) {
+		e.falha(caminho, erroDePermissao(caminho, AcessoLeitura))
+		return
+	}
+	// Arquivos cifrados precisam da senha de cada um e só são copiados um a um pelo get
+	if entrada.Atributos&AtributoCifrado != 0 {
+		e.falha(caminho, ErrArquivoCifrado)
+		return
+	}
+	real, erro := e.destinoDoArquivo(real)
+	if errors.Is(erro, ErrPulado) {
+		e.relatorio.Pulados++
+		return
+	}
+	if erro != nil {
+		e.falha(caminho, erro)
+		return
+	}
+	// O_EXCL garante que o arquivo é novo, e não um link simbólico criado no lugar do que foi apagado
+	arquivo, erro := os.OpenFile(real, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if erro == nil {
+		erro = CopiarConteudo(e.cabecalho, e.meuFS, entrada, nil, arquivo, 0, int64(entrada.Tamanho))
+		if erroAoFechar := arquivo.Close(); erro == nil {
+			erro = erroAoFechar
+		}
+	}
+	if erro == nil && e.preservar {
+		erro = AplicarMetadados(real, entrada)
+	}
+	if erro == nil {
+		erro = MarcarAcesso(e.cabecalho, e.meuFS, caminho)
+	}
+	if erro != nil {
+		e.falha(caminho, erro)
+		return
+	}
+	e.relatorio.Arquivos++
+}
+
+// destinoDoArquivo decide onde criar o arquivo quando o caminho real já existe. Sobrescrever apaga o arquivo
+// existente (em vez de abri-lo, que seguiria um link simbólico), renomear usa o primeiro nome(1), nome(2)...
+// livre e pular retorna ErrPulado
+func (e *exportacao) destinoDoArquivo(real string) (string, error) {
+	info, erro := os.Lstat(real)
+	if errors.Is(erro, fs.ErrNotExist) {
+		return real, nil
+	}
+	if erro != nil {
+		return "", erro
+	}
+	switch e.politica {
+	case DuplicadoSobrescrever:
+		if info.IsDir() {
+			return "", NovoErroFS(fs.ErrExist, "'%s' já existe e é um diretorio", real)
+		}
+		return real, os.Remove(real)
+	case DuplicadoRenomear:
+		for numero := 1; ; numero++ {
+			nome, ok := nomeNumerado(filepath.Base(real), numero)
+			if !ok {
+				return "", fmt.Errorf("não foi possível encontrar um nome livre para '%s'", real)
+			}
+			candidato := filepath.Join(filepath.Dir(real), nome)
+			if _, erro := os.Lstat(candidato); errors.Is(erro, fs.ErrNotExist) {
+				return candidato, nil
+			}
+		}
+	case DuplicadoPular:
+		return "", fmt.Errorf("'%s' %w", real, ErrPulado)
+	}
+	return "", NovoErroFS(fs.ErrExist, "'%s' já existe no sistema real", real)
+}
@@ -0,0 +1,157 @@
+package meufs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"meufs"
+)
+
+// lerReal retorna o conteúdo de um arquivo do sistema real
+func lerReal(t *testing.T, caminho ...string) string {
+	t.Helper()
+	dados, erro := os.ReadFile(filepath.Join(caminho...))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return string(dados)
+}
+
+func TestExportarDiretorio(t *testing.T) {
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "proj")
+	criarDiretorio(t, volume, "proj", "sub")
+	criarDiretorio(t, volume, "proj", "sub", "vazio")
+	gravar(t, volume, "/proj/a.txt", "a")
+	gravar(t, volume, "/proj/sub/b.txt", "b")
+	destino := filepath.Join(t.TempDir(), "saida")
+	exportar := func(politica meufs.PoliticaDuplicado) meufs.RelatorioCopia {
+		t.Helper()
+		relatorio, erro := meufs.ExportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"proj"}, destino, politica, false)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		return relatorio
+	}
+	relatorio := exportar(meufs.DuplicadoFalhar)
+	if relatorio.Arquivos != 2 || relatorio.Diretorios != 3 || len(relatorio.Falhas) != 0 {
+		t.Fatalf("a cópia deveria ter 2 arquivos, 3 diretórios e nenhuma falha: %+v", relatorio)
+	}
+	if lerReal(t, destino, "a.txt") != "a" || lerReal(t, destino, "sub", "b.txt") != "b" {
+		t.Fatal("a árvore copiada não corresponde à original")
+	}
+	if info, erro := os.Stat(filepath.Join(destino, "sub", "vazio")); erro != nil || !info.IsDir() {
+		t.Fatalf("o diretório vazio deveria ter sido criado: %v", erro)
+	}
+
+	// Copiar de novo reaproveita os diretórios reais, e os arquivos que já existem seguem a política
+	os.WriteFile(filepath.Join(destino, "a.txt"), []byte("alterado"), 0644)
+	if relatorio = exportar(meufs.DuplicadoPular); relatorio.Pulados != 2 || lerReal(t, destino, "a.txt") != "alterado" {
+		t.Fatalf("com skip os 2 arquivos reais deveriam ser mantidos: %+v", relatorio)
+	}
+	if relatorio = exportar(meufs.DuplicadoFalhar); len(relatorio.Falhas) != 2 {
+		t.Fatalf("com fail os 2 arquivos reais existentes deveriam falhar: %+v", relatorio)
+	}
+	if relatorio = exportar(meufs.DuplicadoRenomear); relatorio.Arquivos != 2 || lerReal(t, destino, "a(1).txt") != "a" {
+		t.Fatalf("com rename as cópias deveriam ir para a(1).txt e b(1).txt: %+v", relatorio)
+	}
+	if relatorio = exportar(meufs.DuplicadoSobrescrever); relatorio.Arquivos != 2 || lerReal(t, destino, "a.txt") != "a" {
+		t.Fatalf("com overwrite os 2 arquivos reais deveriam ser regravados: %+v", relatorio)
+	}
+}
+
+func TestExportarDiretorioFalhas(t *testing.T) {
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "proj")
+	gravar(t, volume, "/proj/ok.txt", "ok")
+	gravar(t, volume, "/proj/fuga", "fora")
+	gravar(t, volume, "/proj/s.txt", "segredo")
+	cifra, erro := meufs.NovaCifraArquivo("senha")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = meufs.CifrarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"proj", "s.txt"}, cifra); erro != nil {
+		t.Fatal(erro)
+	}
+	// Um meufs.fs alterado à mão pode guardar ".." como nome, que sairia do destino
+	dir, erro := meufs.AbrirDiretorio(volume.Cabecalho, volume.Arquivo, []string{"proj"})
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	indice := meufs.BuscarEntrada(dir, "fuga")
+	meufs.EscreverEntrada(&dir, indice, dir.Entradas[indice], "..")
+	if erro = meufs.SalvarDiretorio(volume.Cabecalho, volume.Arquivo, dir); erro != nil {
+		t.Fatal(erro)
+	}
+
+	base := t.TempDir()
+	destino := filepath.Join(base, "saida")
+	relatorio, erro := meufs.ExportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"proj"}, destino, meufs.DuplicadoFalhar, false)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if relatorio.Arquivos != 1 || len(relatorio.Falhas) != 2 || lerReal(t, destino, "ok.txt") != "ok" {
+		t.Fatalf("só ok.txt deveria ter sido copiado, com 2 falhas: %+v", relatorio)
+	}
+	for _, falha := range relatorio.Falhas {
+		switch falha.Caminho {
+		case "/proj/s.txt":
+			if !errors.Is(falha.Erro, meufs.ErrArquivoCifrado) {
+				t.Errorf("o arquivo cifrado deveria falhar com ErrArquivoCifrado, falhou com %v", falha.Erro)
+			}
+		case "/proj/..":
+		default:
+			t.Errorf("falha inesperada em %s: %v", falha.Caminho, falha.Erro)
+		}
+	}
+	if entradas, _ := os.ReadDir(base); len(entradas) != 1 {
+		t.Fatalf("nada deveria ter sido criado fora do destino, há %d itens", len(entradas))
+	}
+
+	for _, nome := range []string{"..", ".", "a" + string(filepath.Separator) + "b"} {
+		if meufs.ValidarNomeReal(nome) == nil {
+			t.Errorf("o nome %q deveria ser recusado no sistema real", nome)
+		}
+	}
+	if erro = meufs.ValidarNomeReal("nota.txt"); erro != nil {
+		t.Errorf("nota.txt deveria ser aceito: %v", erro)
+	}
+}
+
+func TestExportarDiretorioNaoSegueLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("links simbólicos precisam de privilégios no windows")
+	}
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "proj")
+	criarDiretorio(t, volume, "proj", "sub")
+	gravar(t, volume, "/proj/sub/b.txt", "b")
+	gravar(t, volume, "/proj/a.txt", "a")
+	base := t.TempDir()
+	alvo := filepath.Join(base, "alvo")
+	destino := filepath.Join(base, "saida")
+	for _, caminho := range []string{alvo, destino} {
+		if erro := os.Mkdir(caminho, 0755); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+	// Os links no destino apontam para fora dele, e nenhum dos dois pode ser seguido
+	os.Symlink(alvo, filepath.Join(destino, "sub"))
+	os.Symlink(filepath.Join(alvo, "a.txt"), filepath.Join(destino, "a.txt"))
+	relatorio, erro := meufs.ExportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"proj"}, destino, meufs.DuplicadoSobrescrever, false)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if len(relatorio.Falhas) != 1 || relatorio.Falhas[0].Caminho != "/proj/sub" {
+		t.Fatalf("só o diretório que é link deveria falhar: %+v", relatorio)
+	}
+	if entradas, _ := os.ReadDir(alvo); len(entradas) != 0 {
+		t.Fatalf("nada deveria ter sido escrito pelos links, há %d itens no alvo", len(entradas))
+	}
+	if info, erro := os.Lstat(filepath.Join(destino, "a.txt")); erro != nil || !info.Mode().IsRegular() || lerReal(t, destino, "a.txt") != "a" {
+		t.Fatal("a.txt deveria ter substituído o link por um arquivo comum")
+	}
+}
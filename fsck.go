@@ -0,0 +1,268 @@
+package meufs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RelatorioFsck é o resultado da verificação de consistência do meufs
+type RelatorioFsck struct {
+	Ok                   bool     `json:"ok"`
+	Arquivos             int      `json:"files"`
+	Diretorios           int      `json:"directories"`
+	BlocosUsados         int      `json:"used_blocks"`
+	BlocosOrfaos         int      `json:"orphan_blocks"`
+	BlocosCompartilhados int      `json:"shared_blocks"`
+	Snapshots            int      `json:"snapshots"`
+	Problemas            []string `json:"problems"`
+}
+
+// verificacaoFsck guarda o estado da verificação enquanto a árvore é percorrida
+type verificacaoFsck struct {
+	cabecalho Cabecalho
+	meuFS     *MeuFS
+	fat       []uint32
+	dono      map[uint32]string // Primeira entrada que usa cada bloco
+	usos      map[uint32]int    // Quantas cadeias passam por cada bloco
+	inicios   map[uint32]bool   // Primeiros blocos dos arquivos guardados em blocos comuns
+	prefixo   string            // Antes dos caminhos nos problemas, para indicar o snapshot verificado
+	relatorio RelatorioFsck
+}
+
+// VerificarFS percorre todos os diretórios seguindo as cadeias da FAT e aponta inconsistências, sem alterar nada:
+// cadeias fora da FAT ou em laço, blocos usados por mais entradas do que a tabela de referências conta, tamanhos
+// que não batem com a quantidade de blocos, nomes inválidos, posições do índice de conteúdo que não são o começo de
+// um arquivo e blocos marcados como usados que nenhuma entrada alcança
+func VerificarFS(cabecalho Cabecalho, meuFS *MeuFS) (RelatorioFsck, error) {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	v := &verificacaoFsck{cabecalho: cabecalho, meuFS: meuFS, fat: fat, dono: make(map[uint32]string), usos: make(map[uint32]int), inicios: make(map[uint32]bool)}
+	v.relatorio.Problemas = []string{}
+	// A cadeia da tabela de referências pertence ao próprio meufs
+	area, erro := lerAreaReferencias(cabecalho, meuFS)
+	if erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	referencias := make([]uint32, len(fat))
+	if area.Criada == 1 {
+		if _, ok := v.verificarCadeia(area.PrimeiroBloco, "a tabela de referências"); ok {
+			if referencias, erro = LerReferencias(cabecalho, meuFS, fat); erro != nil {
+				v.problema("%v", erro)
+				referencias = make([]uint32, len(fat))
+			}
+		}
+	}
+	// Assim como a do índice de conteúdo
+	areaIndice, erro := lerAreaIndice(cabecalho, meuFS)
+	if erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	indiceOk := false
+	if areaIndice.Criado == 1 {
+		_, indiceOk = v.verificarCadeia(areaIndice.PrimeiroBloco, "o índice de conteúdo")
+	}
+	root, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	if erro = v.verificarDiretorio(root, nil); erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	if erro = v.verificarSnapshots(); erro != nil {
+		return RelatorioFsck{}, erro
+	}
+	if indiceOk {
+		v.verificarIndice()
+	}
+	for indice, entrada := range fat {
+		if entrada == 0 {
+			if referencias[indice] != 0 {
+				v.problema("bloco %d está livre mas a tabela de referências conta %d entradas", indice, referencias[indice])
+			}
+			continue
+		}
+		v.relatorio.BlocosUsados++
+		usos := v.usos[uint32(indice)]
+		if usos == 0 {
+			v.relatorio.BlocosOrfaos++
+			continue
+		}
+		if usos > 1 {
+			v.relatorio.BlocosCompartilhados++
+		}
+		if esperados := max(referencias[indice], 1); uint32(usos) != esperados {
+			v.problema("bloco %d é usado por %d entradas (a primeira é %s) mas a tabela de referências conta %d", indice, usos, v.dono[uint32(indice)], esperados)
+		}
+	}
+	if v.relatorio.BlocosOrfaos > 0 {
+		v.problema("%d blocos marcados como usados na FAT não pertencem a nenhuma entrada", v.relatorio.BlocosOrfaos)
+	}
+	v.relatorio.Ok = len(v.relatorio.Problemas) == 0
+	return v.relatorio, nil
+}
+
+func (v *verificacaoFsck) problema(formato string, argumentos ...any) {
+	v.relatorio.Problemas = append(v.relatorio.Problemas, fmt.Sprintf(formato, argumentos...))
+}
+
+// verificarIndice confere se cada posição preenchida do índice de conteúdo é o primeiro bloco de um arquivo
+// guardado em blocos comuns, do volume ou de um snapshot
+func (v *verificacaoFsck) verificarIndice() {
+	indice, erro := lerIndiceConteudo(v.cabecalho, v.meuFS, v.fat)
+	if erro != nil {
+		v.problema("%v", erro)
+		return
+	}
+	for bloco, valor := range indice {
+		if valor != 0 && !v.inicios[uint32(bloco)] {
+			v.problema("bloco %d está no índice de conteúdo mas não é o primeiro bloco de um arquivo", bloco)
+		}
+	}
+}
+
+// verificarSnapshots verifica a lista de snapshots, a cópia do root de cada snapshot e a árvore guardada nele. Os
+// arquivos e diretórios dos snapshots entram na contagem dos blocos, mas não na de arquivos e diretórios do volume
+func (v *verificacaoFsck) verificarSnapshots() error {
+	area, lista, erro := lerSnapshots(v.cabecalho, v.meuFS)
+	if erro != nil {
+		return erro
+	}
+	if area.Criada == 0 {
+		return nil
+	}
+	if blocos, ok := v.verificarCadeia(area.Bloco, "a lista de snapshots"); ok && len(blocos) != 1 {
+		v.problema("a lista de snapshots deveria ocupar 1 bloco mas ocupa %d", len(blocos))
+	}
+	arquivos, diretorios := v.relatorio.Arquivos, v.relatorio.Diretorios
+	for _, entrada := range lista {
+		if entrada.Nome[0] == 0 {
+			continue
+		}
+		v.relatorio.Snapshots++
+		v.prefixo = "snapshot " + nomeDoSnapshot(entrada) + ":"
+		blocos, ok := v.verificarCadeia(entrada.BlocoRoot, v.prefixo+"/")
+		if !ok {
+			continue
+		}
+		if len(blocos) != blocosDoRoot(v.cabecalho) || blocos[len(blocos)-1]-blocos[0] != uint32(len(blocos)-1) {
+			v.problema("%s/: a cópia do root deveria ocupar %d blocos seguidos", v.prefixo, blocosDoRoot(v.cabecalho))
+			continue
+		}
+		root, erro := LerDiretorioRaiz(cabecalhoDoSnapshot(v.cabecalho, entrada), v.meuFS)
+		if erro != nil {
+			return erro
+		}
+		if erro = v.verificarDiretorio(root, nil); erro != nil {
+			return erro
+		}
+	}
+	v.prefixo = ""
+	v.relatorio.Arquivos, v.relatorio.Diretorios = arquivos, diretorios
+	return nil
+}
+
+// verificarDiretorio verifica cada entrada do diretório e desce nos subdiretórios
+func (v *verificacaoFsck) verificarDiretorio(dir Diretorio, caminho []string) error {
+	for indice, entrada := range dir.Entradas {
+		// Entradas de continuação têm que vir logo depois de uma entrada principal ou de outra continuação
+		if ehContinuacao(entrada) && (indice == 0 || dir.Entradas[indice-1].NomeArquivo[0] == 0) {
+			v.problema("%s/%s: entrada %d é uma continuação de nome sem entrada principal", v.prefixo, strings.Join(caminho, "/"), indice)
+		}
+		nome := dir.Nomes[indice]
+		if nome == "" {
+			continue
+		}
+		caminhoEntrada := append(append([]string(nil), caminho...), nome)
+		descricao := v.prefixo + "/" + strings.Join(caminhoEntrada, "/")
+		if erro := ValidarNome(nome); erro != nil {
+			v.problema("%s: %v", descricao, erro)
+		}
+		if entrada.EnderecoFAT == SemBlocos {
+			// Arquivo vazio, sem cadeia para verificar
+			if entrada.EhDir == 1 {
+				v.relatorio.Diretorios++
+				v.problema("%s: diretório sem bloco", descricao)
+				continue
+			}
+			v.relatorio.Arquivos++
+			if entrada.Tamanho != 0 {
+				v.problema("%s: tamanho %d mas o arquivo não tem blocos", descricao, entrada.Tamanho)
+			}
+			continue
+		}
+		blocos, ok := v.verificarCadeia(entrada.EnderecoFAT, descricao)
+		if !ok {
+			continue
+		}
+		if entrada.EhDir == 1 {
+			v.relatorio.Diretorios++
+			if len(blocos) != 1 {
+				v.problema("%s: diretório deveria ocupar 1 bloco mas ocupa %d", descricao, len(blocos))
+			}
+			subdir, erro := LerSubdiretorio(v.cabecalho, v.meuFS, entrada.EnderecoFAT)
+			if erro != nil {
+				return erro
+			}
+			if erro = v.verificarDiretorio(subdir, caminhoEntrada); erro != nil {
+				return erro
+			}
+			continue
+		}
+		v.relatorio.Arquivos++
+		// Arquivos cifrados ocupam também os blocos do cabeçalho da cifra
+		if entrada.Atributos&AtributoCifrado != 0 {
+			if esperados := BlocosDoArquivoCifrado(v.cabecalho.TamanhoBloco, entrada.Tamanho); len(blocos) != esperados {
+				v.problema("%s: arquivo cifrado com tamanho %d deveria ocupar %d blocos mas ocupa %d", descricao, entrada.Tamanho, esperados, len(blocos))
+			}
+			continue
+		}
+		// Arquivos comprimidos ocupam os blocos indicados no seu cabeçalho
+		if entrada.Atributos&AtributoComprimido != 0 {
+			if _, _, erro := lerCabecalhoCompressao(v.cabecalho, v.meuFS, blocos, entrada.Tamanho); erro != nil {
+				v.problema("%s: %v", descricao, erro)
+			}
+			continue
+		}
+		v.inicios[entrada.EnderecoFAT] = true
+		// O tamanho tem que caber nos blocos e usar o último deles (arquivos vazios que ainda ocupam 1 bloco também são aceitos)
+		capacidade := uint64(len(blocos)) * uint64(v.cabecalho.TamanhoBloco)
+		minimo := capacidade - uint64(v.cabecalho.TamanhoBloco)
+		if uint64(entrada.Tamanho) > capacidade || (len(blocos) > 1 && uint64(entrada.Tamanho) <= minimo) {
+			v.problema("%s: tamanho %d não corresponde aos %d blocos da cadeia", descricao, entrada.Tamanho, len(blocos))
+		}
+	}
+	return nil
+}
+
+// verificarCadeia segue a cadeia com segurança e registra quantas entradas usam cada bloco e qual é a primeira
+func (v *verificacaoFsck) verificarCadeia(inicio uint32, descricao string) ([]uint32, bool) {
+	var blocos []uint32
+	visitados := make(map[uint32]bool)
+	bloco := inicio
+	for {
+		if bloco >= uint32(len(v.fat)) {
+			v.problema("%s: cadeia aponta para o bloco %d, fora da FAT", descricao, bloco)
+			return nil, false
+		}
+		if v.fat[bloco] == 0 {
+			v.problema("%s: cadeia passa pelo bloco %d, marcado como livre", descricao, bloco)
+			return nil, false
+		}
+		if visitados[bloco] {
+			v.problema("%s: cadeia tem um laço no bloco %d", descricao, bloco)
+			return nil, false
+		}
+		visitados[bloco] = true
+		if _, usado := v.dono[bloco]; !usado {
+			v.dono[bloco] = descricao
+		}
+		v.usos[bloco]++
+		blocos = append(blocos, bloco)
+		if v.fat[bloco] == FimDaCadeia {
+			return blocos, true
+		}
+		bloco = v.fat[bloco]
+	}
+}
@@ -0,0 +1,345 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FalhaCopia registra um item de uma cópia recursiva que não foi copiado e o motivo
+type FalhaCopia struct {
+	Caminho string
+	Erro    error
+}
+
+// RelatorioCopia resume uma cópia recursiva entre o sistema real e o meufs
+type RelatorioCopia struct {
+	Arquivos   int
+	Diretorios int
+	Pulados    int // Arquivos que já existiam e foram mantidos pela política DuplicadoPular
+	Falhas     []FalhaCopia
+}
+
+// itemImportacao é um arquivo ou diretório do sistema real a ser copiado para o caminho destino no meufs
+type itemImportacao struct {
+	real    string
+	destino []string
+	info    fs.FileInfo
+}
+
+// GuardarArquivo cria no diretório indicado pelo caminho um arquivo com os dados, tratando um nome já existente
+// conforme a política como CriarEntradaComPolitica, e retorna a entrada e o nome usado. Com uma cifra os dados são
+// guardados cifrados com ela, e com comprimido são guardados comprimidos. É o que put, put -r e o menu usam para
+// guardar um arquivo do sistema real. O conteúdo cifrado ou comprimido vai para uma cadeia nova, e a entrada só passa
+// a apontar para ela depois que ela foi toda gravada, então uma falha não deixa um arquivo vazio nem apaga o
+// conteúdo de um arquivo sobrescrito
+func GuardarArquivo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminhoDir []string, nome string, dados []byte, cifra *CifraArquivo, comprimido bool, politica PoliticaDuplicado) (DiretorioRoot, string, error) {
+	if cifra == nil && !comprimido {
+		return CriarEntradaComPolitica(cabecalho, meuFS, identidade, caminhoDir, nome, false, dados, politica)
+	}
+	if len(dados) > math.MaxUint32 {
+		return DiretorioRoot{}, "", errors.New("arquivo não coube no sistema de arquivos")
+	}
+	var cadeia []byte
+	var atributo uint8
+	var erro error
+	if cifra != nil {
+		cadeia, erro = cifra.cifrar(cabecalho.TamanhoBloco, dados)
+		atributo = AtributoCifrado
+	} else {
+		cadeia, erro = comprimir(cabecalho.TamanhoBloco, dados)
+		atributo = AtributoComprimido
+	}
+	if erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	dir, entradaDir, erro := abrirComPermissao(cabecalho, meuFS, identidade, caminhoDir)
+	if erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	indice := BuscarEntrada(dir, nome)
+	if indice != -1 {
+		existente := dir.Entradas[indice]
+		caminho := append(append([]string(nil), caminhoDir...), nome)
+		switch politica {
+		case DuplicadoSobrescrever:
+			// As mesmas conferências de SubstituirConteudo
+			if existente.EhDir == 1 {
+				return DiretorioRoot{}, "", NovoErroFS(fs.ErrExist, "'%s' já existe e não pode ser sobrescrito por um arquivo", nome)
+			}
+			if !PodeAcessar(identidade, existente, AcessoEscrita) {
+				return DiretorioRoot{}, "", erroDePermissao(caminho, AcessoEscrita)
+			}
+			if erro = verificarConteudo(existente, caminho, false); erro != nil {
+				return DiretorioRoot{}, "", erro
+			}
+		case DuplicadoRenomear:
+			if nome, erro = NomeLivre(dir, nome); erro != nil {
+				return DiretorioRoot{}, "", erro
+			}
+			indice = -1
+		case DuplicadoPular:
+			return existente, nome, fmt.Errorf("'%s' %w", nome, ErrPulado)
+		default:
+			return DiretorioRoot{}, "", NovoErroFS(fs.ErrExist, "um arquivo com o nome '%s' já existe no sistema", nome)
+		}
+	}
+	entrada := entradaNova(identidade)
+	criado := indice == -1
+	if criado {
+		if erro = verificarCriacao(identidade, entradaDir, caminhoDir); erro != nil {
+			return DiretorioRoot{}, "", erro
+		}
+		if erro = ValidarNome(nome); erro != nil {
+			return DiretorioRoot{}, "", erro
+		}
+		if indice = EntradaLivre(dir, nome); indice == -1 {
+			return DiretorioRoot{}, "", errors.New("diretorio cheio")
+		}
+	} else {
+		entrada = dir.Entradas[indice]
+		entrada.Modificado = agora()
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	// Até o diretório ser salvo, a cadeia nova só existe na FAT em memória e a entrada antiga continua intacta
+	inicio, erro := GravarConteudo(cabecalho, meuFS, fat, cadeia)
+	if erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	antigo := entrada.EnderecoFAT
+	entrada.EnderecoFAT = inicio
+	entrada.Tamanho = uint32(len(dados))
+	entrada.Atributos = entrada.Atributos&^atributosDoConteudo | atributo
+	EscreverEntrada(&dir, indice, entrada, nome)
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	// Com a entrada já na cadeia nova, a antiga de um arquivo sobrescrito é liberada
+	if erro = LiberarBlocos(cabecalho, meuFS, fat, antigo); erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	if erro = meuFS.Sync(); erro != nil {
+		return DiretorioRoot{}, "", erro
+	}
+	if criado {
+		erro = tocarDiretorio(cabecalho, meuFS, caminhoDir)
+	}
+	return entrada, nome, erro
+}
+
+// ImportarDiretorio copia o diretório real origem e tudo que há dentro dele para o caminho destino do meufs,
+// que passa a ser o diretório copiado. Antes de copiar qualquer coisa confere se há blocos e entradas de diretório
+// livres para tudo, retornando erro se não houver. Diretórios que já existem no destino são reaproveitados e os
+// arquivos com nome repetido seguem a política. Um item que falha vai para as falhas do relatório sem interromper
+// os demais. Com preservar, modo, data de modificação e dono dos itens reais são guardados nas entradas. As entradas
+// são criadas em nome da identidade, e as que ela não tem permissão de criar vão para as falhas. Com comprimir, os
+// arquivos são guardados comprimidos, e o espaço conferido antes é o que eles ocupariam sem compressão
+func ImportarDiretorio(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, origem string, destino []string, politica PoliticaDuplicado, preservar bool, comprimir bool) (RelatorioCopia, error) {
+	if len(destino) == 0 {
+		return RelatorioCopia{}, NovoErroFS(fs.ErrInvalid, "o destino não pode ser o root")
+	}
+	info, erro := os.Stat(origem)
+	if erro != nil {
+		return RelatorioCopia{}, fmt.Errorf("erro ao ler diretorio a ser guardado: %w", erro)
+	}
+	if !info.IsDir() {
+		return RelatorioCopia{}, fmt.Errorf("'%s' não é um diretorio", origem)
+	}
+	itens, falhas, erro := planejarImportacao(origem, destino)
+	if erro != nil {
+		return RelatorioCopia{}, erro
+	}
+	if erro = verificarEspacoImportacao(cabecalho, meuFS, itens, politica); erro != nil {
+		return RelatorioCopia{}, erro
+	}
+	relatorio := importarItens(cabecalho, meuFS, identidade, itens, politica, preservar, comprimir)
+	relatorio.Falhas = append(falhas, relatorio.Falhas...)
+	return relatorio, nil
+}
+
+// planejarImportacao percorre o diretório real com filepath.WalkDir e lista o que será copiado, sempre os pais antes
+// dos filhos. Links simbólicos, dispositivos, nomes inválidos no meufs e o que não pôde ser lido vão direto para as falhas
+func planejarImportacao(origem string, destino []string) ([]itemImportacao, []FalhaCopia, error) {
+	var itens []itemImportacao
+	var falhas []FalhaCopia
+	erro := filepath.WalkDir(origem, func(caminho string, entrada fs.DirEntry, erro error) error {
+		if erro != nil {
+			if caminho == origem {
+				return erro
+			}
+			// Um diretório que não pôde ser lido já foi planejado, mas seu conteúdo fica de fora
+			falhas = append(falhas, FalhaCopia{caminho, erro})
+			return nil
+		}
+		partes := append([]string(nil), destino...)
+		if relativo, _ := filepath.Rel(origem, caminho); relativo != "." {
+			partes = append(partes, strings.Split(filepath.ToSlash(relativo), "/")...)
+		}
+		if !entrada.IsDir() && !entrada.Type().IsRegular() {
+			falhas = append(falhas, FalhaCopia{caminho, errors.New("não é um arquivo regular nem um diretorio")})
+			return nil
+		}
+		info, erro := entrada.Info()
+		if erro == nil {
+			erro = ValidarNome(partes[len(partes)-1])
+		}
+		if erro != nil {
+			falhas = append(falhas, FalhaCopia{caminho, erro})
+			if entrada.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		itens = append(itens, itemImportacao{real: caminho, destino: partes, info: info})
+		return nil
+	})
+	if erro != nil {
+		return nil, nil, fmt.Errorf("erro ao percorrer '%s': %w", origem, erro)
+	}
+	return itens, falhas, nil
+}
+
+// verificarEspacoImportacao simula a cópia dos itens contando os blocos necessários e reservando, com EntradaLivre,
+// as entradas de cada diretório de destino, o que leva em conta nomes longos e diretórios já existentes com vagas
+// espalhadas. Arquivos que vão falhar por já existirem não contam, e os sobrescritos só contam os blocos que crescerem
+func verificarEspacoImportacao(cabecalho Cabecalho, meuFS *MeuFS, itens []itemImportacao, politica PoliticaDuplicado) error {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	livres := 0
+	for _, entrada := range fat {
+		if entrada == 0 {
+			livres++
+		}
+	}
+	necessarios := 0
+	// Cópias em memória dos diretórios de destino, pelo caminho, com as entradas já reservadas
+	diretorios := map[string]*Diretorio{}
+	for _, item := range itens {
+		caminhoDir, nome := item.destino[:len(item.destino)-1], item.destino[len(item.destino)-1]
+		dir, ok := diretorios[strings.Join(caminhoDir, "/")]
+		if !ok {
+			lido, erro := AbrirDiretorio(cabecalho, meuFS, caminhoDir)
+			if erro != nil {
+				return erro
+			}
+			dir = &lido
+			diretorios[strings.Join(caminhoDir, "/")] = dir
+		}
+		indice := BuscarEntrada(*dir, nome)
+		if item.info.IsDir() {
+			if indice != -1 {
+				if dir.Entradas[indice].EhDir != 1 {
+					return NovoErroFS(fs.ErrExist, "'/%s' já existe e não é um diretorio", strings.Join(item.destino, "/"))
+				}
+				// O diretório existente é reaproveitado e lido quando o primeiro filho precisar dele
+				continue
+			}
+			necessarios++
+			diretorios[strings.Join(item.destino, "/")] = &Diretorio{
+				Entradas: make([]DiretorioRoot, EntradasPorBloco(cabecalho)),
+				Nomes:    make([]string, EntradasPorBloco(cabecalho)),
+			}
+		} else {
+			blocos := int((item.info.Size() + int64(cabecalho.TamanhoBloco) - 1) / int64(cabecalho.TamanhoBloco))
+			if indice != -1 {
+				switch politica {
+				case DuplicadoSobrescrever:
+					existentes, erro := CadeiaDeBlocos(fat, dir.Entradas[indice].EnderecoFAT)
+					if erro != nil {
+						return erro
+					}
+					necessarios += max(blocos-len(existentes), 0)
+					continue
+				case DuplicadoRenomear:
+					if nome, erro = NomeLivre(*dir, nome); erro != nil {
+						return erro
+					}
+				default:
+					continue
+				}
+			}
+			necessarios += blocos
+		}
+		livre := EntradaLivre(*dir, nome)
+		if livre == -1 {
+			return fmt.Errorf("não há entradas livres suficientes em '/%s' para guardar '%s'", strings.Join(caminhoDir, "/"), nome)
+		}
+		EscreverEntrada(dir, livre, DiretorioRoot{}, nome)
+	}
+	if necessarios > livres {
+		return fmt.Errorf("a cópia precisa de %d blocos, mas só há %d livres", necessarios, livres)
+	}
+	return nil
+}
+
+// importarItens copia os itens na ordem planejada. Se um diretório não puder ser criado, tudo dentro dele é pulado
+func importarItens(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, itens []itemImportacao, politica PoliticaDuplicado, preservar bool, comprimir bool) RelatorioCopia {
+	var relatorio RelatorioCopia
+	var diretoriosComFalha [][]string
+	var diretoriosCopiados []itemImportacao
+	for _, item := range itens {
+		if slices.ContainsFunc(diretoriosComFalha, func(dir []string) bool { return ehDescendente(item.destino, dir) }) {
+			continue
+		}
+		caminhoDir, nome := item.destino[:len(item.destino)-1], item.destino[len(item.destino)-1]
+		if item.info.IsDir() {
+			// Sobrescrever um diretório com outro apenas o reaproveita
+			if _, _, erro := CriarEntradaComPolitica(cabecalho, meuFS, identidade, caminhoDir, nome, true, nil, DuplicadoSobrescrever); erro != nil {
+				relatorio.Falhas = append(relatorio.Falhas, FalhaCopia{item.real, fmt.Errorf("%w (o conteúdo do diretorio não foi copiado)", erro)})
+				diretoriosComFalha = append(diretoriosComFalha, item.destino)
+				continue
+			}
+			relatorio.Diretorios++
+			diretoriosCopiados = append(diretoriosCopiados, item)
+			continue
+		}
+		dados, erro := os.ReadFile(item.real)
+		if erro != nil {
+			relatorio.Falhas = append(relatorio.Falhas, FalhaCopia{item.real, erro})
+			continue
+		}
+		_, nomeUsado, erro := GuardarArquivo(cabecalho, meuFS, identidade, caminhoDir, nome, dados, nil, comprimir, politica)
+		caminho := append(append([]string(nil), caminhoDir...), nomeUsado)
+		if erro == nil && preservar {
+			erro = PreservarMetadados(cabecalho, meuFS, identidade, caminho, LerMetadadosReais(item.info))
+		}
+		if errors.Is(erro, ErrPulado) {
+			relatorio.Pulados++
+			continue
+		}
+		if erro != nil {
+			relatorio.Falhas = append(relatorio.Falhas, FalhaCopia{item.real, erro})
+			continue
+		}
+		relatorio.Arquivos++
+	}
+	if preservar {
+		// Criar entradas muda a data de modificação do diretório, então os metadados dos diretórios são guardados
+		// por último e dos mais fundos para os mais rasos
+		for indice := len(diretoriosCopiados) - 1; indice >= 0; indice-- {
+			item := diretoriosCopiados[indice]
+			if erro := PreservarMetadados(cabecalho, meuFS, identidade, item.destino, LerMetadadosReais(item.info)); erro != nil {
+				relatorio.Falhas = append(relatorio.Falhas, FalhaCopia{item.real, erro})
+			}
+		}
+	}
+	return relatorio
+}
+
+// ehDescendente informa se o caminho está dentro do diretório indicado
+func ehDescendente(caminho []string, dir []string) bool {
+	return len(caminho) > len(dir) && slices.Equal(caminho[:len(dir)], dir)
+}
@@ -0,0 +1,150 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestGuardarArquivoSemEspaco(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", "conteúdo antigo")
+	// Um arquivo grande deixa só 10 blocos livres, pouco para os dados aleatórios, que não diminuem comprimidos
+	livres := blocosLivres(t, volume)
+	gravar(t, volume, "/grande", strings.Repeat("g", (livres-10)*int(volume.Cabecalho.TamanhoBloco)))
+	livresAntes := blocosLivres(t, volume)
+	dados := make([]byte, 20*int(volume.Cabecalho.TamanhoBloco))
+	rand.New(rand.NewSource(1)).Read(dados)
+	cifra, erro := meufs.NovaCifraArquivo("senha")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	for _, caso := range []struct {
+		descricao  string
+		cifra      *meufs.CifraArquivo
+		comprimido bool
+	}{{"cifrado", cifra, false}, {"comprimido", nil, true}} {
+		// Sobrescrever sem espaço mantém o conteúdo antigo
+		if _, _, erro = meufs.GuardarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "a.txt", dados, caso.cifra, caso.comprimido, meufs.DuplicadoSobrescrever); erro == nil {
+			t.Fatalf("sobrescrever com um arquivo %s maior que o espaço livre deveria falhar", caso.descricao)
+		}
+		if texto := conteudo(t, volume, "/a.txt"); texto != "conteúdo antigo" {
+			t.Fatalf("a falha ao sobrescrever com um arquivo %s não deveria mudar a.txt, que tem %q", caso.descricao, texto)
+		}
+		// Criar sem espaço não deixa um arquivo vazio
+		if _, _, erro = meufs.GuardarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "novo", dados, caso.cifra, caso.comprimido, meufs.DuplicadoFalhar); erro == nil {
+			t.Fatalf("criar um arquivo %s maior que o espaço livre deveria falhar", caso.descricao)
+		}
+		if _, erro = volume.Open("/novo"); !errors.Is(erro, fs.ErrNotExist) {
+			t.Fatalf("a falha ao criar um arquivo %s não deveria deixar a entrada, abrir deu %v", caso.descricao, erro)
+		}
+		if livres := blocosLivres(t, volume); livres != livresAntes {
+			t.Fatalf("a falha ao guardar um arquivo %s não deveria ocupar blocos, faltam %d", caso.descricao, livresAntes-livres)
+		}
+	}
+	verificar(t, volume)
+
+	// Com espaço, sobrescrever troca o conteúdo e libera a cadeia antiga
+	dados = dados[:5*int(volume.Cabecalho.TamanhoBloco)]
+	if _, _, erro = meufs.GuardarArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "a.txt", dados, nil, true, meufs.DuplicadoSobrescrever); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != string(dados) {
+		t.Fatalf("a.txt comprimido tem %d bytes diferentes do original", len(texto))
+	}
+	verificar(t, volume)
+}
+
+// criarArvoreReal cria no sistema real os arquivos informados, pelo caminho relativo com '/', e os diretórios
+// terminados em '/'
+func criarArvoreReal(t *testing.T, raiz string, itens map[string]string) {
+	t.Helper()
+	for caminho, texto := range itens {
+		real := filepath.Join(raiz, filepath.FromSlash(caminho))
+		if strings.HasSuffix(caminho, "/") {
+			if erro := os.MkdirAll(real, 0755); erro != nil {
+				t.Fatal(erro)
+			}
+			continue
+		}
+		if erro := os.MkdirAll(filepath.Dir(real), 0755); erro != nil {
+			t.Fatal(erro)
+		}
+		if erro := os.WriteFile(real, []byte(texto), 0644); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+}
+
+func TestImportarDiretorio(t *testing.T) {
+	volume := novoVolume(t)
+	origem := filepath.Join(t.TempDir(), "proj")
+	criarArvoreReal(t, origem, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/vazio/": ""})
+	falhasEsperadas := 0
+	if runtime.GOOS != "windows" {
+		// Links simbólicos não são seguidos e aparecem como falhas
+		if erro := os.Symlink("a.txt", filepath.Join(origem, "link")); erro != nil {
+			t.Fatal(erro)
+		}
+		falhasEsperadas = 1
+	}
+	importar := func(politica meufs.PoliticaDuplicado) meufs.RelatorioCopia {
+		t.Helper()
+		relatorio, erro := meufs.ImportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, origem, []string{"proj"}, politica, false, false)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		return relatorio
+	}
+	relatorio := importar(meufs.DuplicadoFalhar)
+	if relatorio.Arquivos != 2 || relatorio.Diretorios != 3 || len(relatorio.Falhas) != falhasEsperadas {
+		t.Fatalf("a cópia deveria ter 2 arquivos, 3 diretórios e %d falhas: %+v", falhasEsperadas, relatorio)
+	}
+	if conteudo(t, volume, "/proj/a.txt") != "a" || conteudo(t, volume, "/proj/sub/b.txt") != "b" || !existe(volume, "proj", "sub", "vazio") {
+		t.Fatal("a árvore copiada não corresponde à original")
+	}
+	if existe(volume, "proj", "link") {
+		t.Fatal("o link simbólico não deveria ter sido copiado")
+	}
+
+	// Copiar de novo reaproveita os diretórios, e os arquivos repetidos seguem a política
+	criarArvoreReal(t, origem, map[string]string{"a.txt": "a nova"})
+	if relatorio = importar(meufs.DuplicadoPular); relatorio.Pulados != 2 || relatorio.Arquivos != 0 {
+		t.Fatalf("com skip os 2 arquivos deveriam ser mantidos: %+v", relatorio)
+	}
+	if relatorio = importar(meufs.DuplicadoFalhar); len(relatorio.Falhas) != 2+falhasEsperadas {
+		t.Fatalf("com fail os 2 arquivos existentes deveriam falhar: %+v", relatorio)
+	}
+	if relatorio = importar(meufs.DuplicadoSobrescrever); relatorio.Arquivos != 2 || conteudo(t, volume, "/proj/a.txt") != "a nova" {
+		t.Fatalf("com overwrite os 2 arquivos deveriam ser regravados: %+v", relatorio)
+	}
+	verificar(t, volume)
+
+	if _, erro := meufs.ImportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, origem, nil, meufs.DuplicadoFalhar, false, false); erro == nil {
+		t.Fatal("o root não pode ser o destino")
+	}
+}
+
+func TestImportarDiretorioSemEspaco(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/primeiro", "x")
+	livres := blocosLivres(t, volume)
+	gravar(t, volume, "/grande", strings.Repeat("g", (livres-5)*int(volume.Cabecalho.TamanhoBloco)))
+	// 2 diretórios e 4 arquivos de um bloco precisam de 6 blocos, e só há 5
+	origem := filepath.Join(t.TempDir(), "proj")
+	criarArvoreReal(t, origem, map[string]string{"a": "a", "b": "b", "sub/c": "c", "sub/d": "d"})
+	_, erro := meufs.ImportarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, origem, []string{"proj"}, meufs.DuplicadoFalhar, false, false)
+	if erro == nil || !strings.Contains(erro.Error(), "blocos") {
+		t.Fatalf("a cópia deveria ser recusada por falta de blocos, erro %v", erro)
+	}
+	if existe(volume, "proj") || blocosLivres(t, volume) != 5 {
+		t.Fatal("a cópia recusada não deveria ter criado nada")
+	}
+}
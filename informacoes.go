@@ -0,0 +1,314 @@
+package meufs
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfoEntrada descreve uma entrada do meufs nas listagens e na saída JSON
+type InfoEntrada struct {
+	Nome          string     `json:"name"`
+	Caminho       string     `json:"path"`
+	Tipo          string     `json:"type"`
+	Tamanho       uint32     `json:"size"`
+	Blocos        int        `json:"blocks"`
+	PrimeiroBloco *uint32    `json:"first_block"`
+	Fragmentos    int        `json:"fragments"`
+	Protegido     bool       `json:"protected"`
+	Atributos     string     `json:"attributes"`
+	Criado        *time.Time `json:"created,omitempty"`
+	Modificado    *time.Time `json:"modified,omitempty"`
+	Acessado      *time.Time `json:"accessed,omitempty"`
+	Modo          string     `json:"mode"`
+	Dono          *uint32    `json:"uid,omitempty"`
+	Grupo         *uint32    `json:"gid,omitempty"`
+	// Só nos arquivos comprimidos: bytes ocupados na cadeia e quantas vezes o tamanho original é maior
+	TamanhoComprimido *uint32 `json:"compressed_size,omitempty"`
+	TaxaCompressao    float64 `json:"compression_ratio,omitempty"`
+}
+
+// InfoEspaco resume a ocupação da área de dados do meufs
+type InfoEspaco struct {
+	TamanhoBloco  uint32           `json:"block_size"`
+	BlocosTotais  uint32           `json:"total_blocks"`
+	BlocosLivres  uint32           `json:"free_blocks"`
+	BytesTotais   uint64           `json:"total_bytes"`
+	BytesLivres   uint64           `json:"free_bytes"`
+	BytesUsados   uint64           `json:"used_bytes"`
+	TamanhoImagem uint32           `json:"image_size"`
+	Compressao    InfoCompressao   `json:"compression"`
+	Deduplicacao  InfoDeduplicacao `json:"deduplication"`
+}
+
+// ContarFragmentos conta quantos trechos de blocos consecutivos formam a cadeia
+func ContarFragmentos(blocos []uint32) int {
+	if len(blocos) == 0 {
+		return 0
+	}
+	fragmentos := 1
+	for i := 1; i < len(blocos); i++ {
+		if blocos[i] != blocos[i-1]+1 {
+			fragmentos++
+		}
+	}
+	return fragmentos
+}
+
+// DescreverEntrada monta a InfoEntrada da entrada indicada pelo caminho usando a FAT para contar seus blocos.
+// Arquivos vazios não têm primeiro bloco (null no JSON). Uma cadeia corrompida também deixa a info sem blocos, para
+// que o ls continue listando o resto, e é apontada pelo fsck
+func DescreverEntrada(entrada DiretorioRoot, fat []uint32, caminho []string) InfoEntrada {
+	blocos, _ := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	info := InfoEntrada{
+		Nome:       caminho[len(caminho)-1],
+		Caminho:    "/" + strings.Join(caminho, "/"),
+		Tipo:       "file",
+		Tamanho:    entrada.Tamanho,
+		Blocos:     len(blocos),
+		Fragmentos: ContarFragmentos(blocos),
+		Protegido:  entrada.Atributos&AtributoSomenteLeitura != 0,
+		Atributos:  TextoDosAtributos(entrada.Atributos),
+		Modo:       fmt.Sprintf("%04o", entrada.Modo),
+	}
+	if entrada.Dono != SemDono {
+		info.Dono, info.Grupo = &entrada.Dono, &entrada.Grupo
+	}
+	if len(blocos) > 0 {
+		info.PrimeiroBloco = &blocos[0]
+	}
+	info.Criado = ponteiroDeTempo(entrada.Criado)
+	info.Modificado = ponteiroDeTempo(entrada.Modificado)
+	info.Acessado = ponteiroDeTempo(entrada.Acessado)
+	if entrada.EhDir == 1 {
+		info.Tipo = "dir"
+	}
+	return info
+}
+
+// descreverCompressao completa a InfoEntrada de um arquivo comprimido com o tamanho comprimido, lido do cabeçalho
+// da cadeia, e a taxa de compressão. Um cabeçalho corrompido deixa a info sem eles, e é apontado pelo fsck
+func descreverCompressao(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, entrada DiretorioRoot, info *InfoEntrada) {
+	if entrada.Atributos&AtributoComprimido == 0 {
+		return
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return
+	}
+	lido, _, erro := lerCabecalhoCompressao(cabecalho, meuFS, blocos, entrada.Tamanho)
+	if erro != nil {
+		return
+	}
+	info.TamanhoComprimido = &lido.TamanhoComprimido
+	info.TaxaCompressao = TaxaDeCompressao(uint64(entrada.Tamanho), uint64(lido.TamanhoComprimido))
+}
+
+// ponteiroDeTempo converte um tempo guardado na entrada, usando nil quando ele não existe (omitido no JSON)
+func ponteiroDeTempo(nanossegundos int64) *time.Time {
+	if nanossegundos == 0 {
+		return nil
+	}
+	tempo := TempoDaEntrada(nanossegundos)
+	return &tempo
+}
+
+// valorDoTempo retorna o tempo apontado, ou o tempo zero se não houver
+func valorDoTempo(tempo *time.Time) time.Time {
+	if tempo == nil {
+		return time.Time{}
+	}
+	return *tempo
+}
+
+// textoDoTempo formata um tempo para as listagens, usando '-' quando ele não existe
+func textoDoTempo(tempo *time.Time) string {
+	if tempo == nil {
+		return "-"
+	}
+	return tempo.Local().Format("2006-01-02 15:04:05")
+}
+
+// CalcularEspaco conta os blocos livres da FAT, soma o tamanho dos arquivos comprimidos e conta os blocos
+// compartilhados
+func CalcularEspaco(cabecalho Cabecalho, meuFS *MeuFS) (InfoEspaco, error) {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return InfoEspaco{}, erro
+	}
+	espaco := InfoEspaco{
+		TamanhoBloco:  cabecalho.TamanhoBloco,
+		BlocosTotais:  uint32(len(fat)),
+		TamanhoImagem: cabecalho.TamanhoMeuFS,
+	}
+	for _, entrada := range fat {
+		if entrada == 0 {
+			espaco.BlocosLivres++
+		}
+	}
+	espaco.BytesTotais = uint64(espaco.BlocosTotais) * uint64(cabecalho.TamanhoBloco)
+	espaco.BytesLivres = uint64(espaco.BlocosLivres) * uint64(cabecalho.TamanhoBloco)
+	espaco.BytesUsados = espaco.BytesTotais - espaco.BytesLivres
+	if espaco.Compressao, erro = CalcularCompressao(cabecalho, meuFS); erro != nil {
+		return InfoEspaco{}, erro
+	}
+	if espaco.Deduplicacao, erro = CalcularDeduplicacao(cabecalho, meuFS); erro != nil {
+		return InfoEspaco{}, erro
+	}
+	return espaco, nil
+}
+
+// ListarDiretorio descreve as entradas do diretório indicado pelos componentes, ou a própria entrada se for um arquivo.
+// Listar um diretório pede permissão de leitura nele. As entradas ocultas e do sistema só entram com todas
+func ListarDiretorio(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, partes []string, todas bool) ([]InfoEntrada, error) {
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	if len(partes) > 0 {
+		dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, partes)
+		if erro != nil {
+			return nil, erro
+		}
+		if dir.Entradas[indice].EhDir != 1 {
+			info := DescreverEntrada(dir.Entradas[indice], fat, partes)
+			descreverCompressao(cabecalho, meuFS, fat, dir.Entradas[indice], &info)
+			return []InfoEntrada{info}, nil
+		}
+	}
+	dir, entradaDir, erro := abrirComPermissao(cabecalho, meuFS, identidade, partes)
+	if erro != nil {
+		return nil, erro
+	}
+	if !PodeAcessar(identidade, entradaDir, AcessoLeitura) {
+		return nil, erroDePermissao(partes, AcessoLeitura)
+	}
+	infos := []InfoEntrada{}
+	for indice, nome := range dir.Nomes {
+		if nome != "" && (todas || !EhOculta(dir.Entradas[indice])) {
+			caminho := append(append([]string(nil), partes...), nome)
+			info := DescreverEntrada(dir.Entradas[indice], fat, caminho)
+			descreverCompressao(cabecalho, meuFS, fat, dir.Entradas[indice], &info)
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// DescreverCaminho retorna a InfoEntrada do caminho informado, o que pede permissão de execução nos diretórios do
+// caminho. O root é descrito como um diretório sem blocos próprios
+func DescreverCaminho(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, partes []string) (InfoEntrada, error) {
+	if len(partes) == 0 {
+		return InfoEntrada{Nome: "/", Caminho: "/", Tipo: "dir", Atributos: TextoDosAtributos(0), Modo: fmt.Sprintf("%04o", entradaDoRoot.Modo)}, nil
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, partes)
+	if erro != nil {
+		return InfoEntrada{}, erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return InfoEntrada{}, erro
+	}
+	info := DescreverEntrada(dir.Entradas[indice], fat, partes)
+	descreverCompressao(cabecalho, meuFS, fat, dir.Entradas[indice], &info)
+	return info, nil
+}
+
+// FiltrarEOrdenar mantém só as entradas do tipo pedido ("file", "dir" ou vazio para todas)
+// e as ordena pelo critério informado ("name", "size", "time" ou vazio para a ordem do diretório)
+func FiltrarEOrdenar(infos []InfoEntrada, tipo string, criterio string) ([]InfoEntrada, error) {
+	if tipo != "" && tipo != "file" && tipo != "dir" {
+		return nil, fmt.Errorf("tipo inválido '%s', use file ou dir", tipo)
+	}
+	filtradas := []InfoEntrada{}
+	for _, info := range infos {
+		if tipo == "" || info.Tipo == tipo {
+			filtradas = append(filtradas, info)
+		}
+	}
+	switch criterio {
+	case "":
+	case "name":
+		slices.SortStableFunc(filtradas, func(a, b InfoEntrada) int { return strings.Compare(a.Nome, b.Nome) })
+	case "size":
+		// Maiores primeiro, como no ls -S
+		slices.SortStableFunc(filtradas, func(a, b InfoEntrada) int { return cmp.Compare(b.Tamanho, a.Tamanho) })
+	case "time":
+		// Modificados mais recentemente primeiro, como no ls -t
+		slices.SortStableFunc(filtradas, func(a, b InfoEntrada) int {
+			return valorDoTempo(b.Modificado).Compare(valorDoTempo(a.Modificado))
+		})
+	default:
+		return nil, fmt.Errorf("ordenação inválida '%s', use name, size ou time", criterio)
+	}
+	return filtradas, nil
+}
+
+// textoPrimeiroBloco formata o primeiro bloco, usando '-' para entradas sem blocos
+func textoPrimeiroBloco(info InfoEntrada) string {
+	if info.PrimeiroBloco == nil {
+		return "-"
+	}
+	return fmt.Sprint(*info.PrimeiroBloco)
+}
+
+// textoDoModoInfo formata o tipo e as permissões de uma InfoEntrada como no ls -l (ex: drwxr-xr-x)
+func textoDoModoInfo(info InfoEntrada) string {
+	modo, _ := strconv.ParseUint(info.Modo, 8, 32)
+	return TextoDoModo(info.Tipo == "dir", uint32(modo))
+}
+
+// textoDoDono formata o uid ou o gid, usando '-' quando o dono não é conhecido
+func textoDoDono(id *uint32) string {
+	if id == nil {
+		return "-"
+	}
+	return fmt.Sprint(*id)
+}
+
+// ImprimirLonga escreve uma InfoEntrada em uma linha no formato longo: tipo e permissões (drwxr-xr-x), atributos
+// (r--h---), dono, grupo, tamanho em bytes, blocos, primeiro bloco, fragmentos, data de modificação e nome. Os arquivos
+// comprimidos mostram a taxa de compressão depois do nome
+func ImprimirLonga(info InfoEntrada) {
+	fmt.Printf("%s %s %5s %5s %10d %6d %8s %4d  %19s  %s%s\n", textoDoModoInfo(info), info.Atributos, textoDoDono(info.Dono), textoDoDono(info.Grupo), info.Tamanho, info.Blocos, textoPrimeiroBloco(info), info.Fragmentos, textoDoTempo(info.Modificado), info.Nome, textoDaCompressao(info))
+}
+
+// textoDaCompressao formata a taxa de compressão de um arquivo comprimido para o ls -l, ou vazio nos outros
+func textoDaCompressao(info InfoEntrada) string {
+	if info.TamanhoComprimido == nil {
+		return ""
+	}
+	return fmt.Sprintf("  (comprimido %.1fx)", info.TaxaCompressao)
+}
+
+// ImprimirJSON escreve o valor em uma linha JSON na saída padrão
+func ImprimirJSON(valor any) error {
+	return json.NewEncoder(os.Stdout).Encode(valor)
+}
+
+// ImprimirInfo escreve os campos de uma InfoEntrada, um por linha
+func ImprimirInfo(info InfoEntrada) {
+	fmt.Printf("nome: %s\n", info.Nome)
+	fmt.Printf("caminho: %s\n", info.Caminho)
+	fmt.Printf("tipo: %s\n", info.Tipo)
+	fmt.Printf("tamanho: %d bytes\n", info.Tamanho)
+	if info.TamanhoComprimido != nil {
+		fmt.Printf("comprimido: %d bytes (%.1fx)\n", *info.TamanhoComprimido, info.TaxaCompressao)
+	}
+	fmt.Printf("blocos: %d\n", info.Blocos)
+	fmt.Printf("primeiro bloco: %s\n", textoPrimeiroBloco(info))
+	fmt.Printf("fragmentos: %d\n", info.Fragmentos)
+	fmt.Printf("atributos: %s\n", info.Atributos)
+	fmt.Printf("criado: %s\n", textoDoTempo(info.Criado))
+	fmt.Printf("modificado: %s\n", textoDoTempo(info.Modificado))
+	fmt.Printf("acessado: %s\n", textoDoTempo(info.Acessado))
+	fmt.Printf("modo: %s (%s)\n", info.Modo, textoDoModoInfo(info))
+	if info.Dono != nil {
+		fmt.Printf("dono: %d:%d\n", *info.Dono, *info.Grupo)
+	}
+}
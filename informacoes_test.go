@@ -0,0 +1,77 @@
+package meufs_test
+
+import (
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// nomesDe retorna os nomes das entradas, na ordem
+func nomesDe(infos []meufs.InfoEntrada) string {
+	var nomes []string
+	for _, info := range infos {
+		nomes = append(nomes, info.Nome)
+	}
+	return strings.Join(nomes, " ")
+}
+
+func TestListarDiretorio(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", strings.Repeat("a", 4096))
+	gravar(t, volume, "/b.txt", "b")
+	criarDiretorio(t, volume, "dir")
+	// Acrescentar ao a.txt depois do b.txt deixa a cadeia dele em dois trechos
+	if _, erro := meufs.AnexarAoArquivo(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a.txt"}, nil, []byte("mais")); erro != nil {
+		t.Fatal(erro)
+	}
+	infos, erro := meufs.ListarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, false)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if nomesDe(infos) != "a.txt b.txt dir" {
+		t.Fatalf("a listagem deveria seguir a ordem do diretório, é %q", nomesDe(infos))
+	}
+	a := infos[0]
+	if a.Tamanho != 4100 || a.Blocos != 2 || a.Fragmentos != 2 || a.PrimeiroBloco == nil || *a.PrimeiroBloco != enderecoFAT(t, volume, "a.txt") {
+		t.Fatalf("a.txt deveria ter 4100 bytes em 2 blocos e 2 fragmentos, começando no primeiro bloco da cadeia: %+v", a)
+	}
+	if infos[1].Fragmentos != 1 || infos[2].Tipo != "dir" {
+		t.Fatalf("b.txt deveria ter 1 fragmento e dir ser um diretório: %+v %+v", infos[1], infos[2])
+	}
+
+	ordenadas, erro := meufs.FiltrarEOrdenar(infos, "", "size")
+	if erro != nil || nomesDe(ordenadas) != "a.txt b.txt dir" {
+		t.Fatalf("--sort=size deveria pôr os maiores primeiro, deu %q (%v)", nomesDe(ordenadas), erro)
+	}
+	if ordenadas, erro = meufs.FiltrarEOrdenar(infos, "", "time"); erro != nil || ordenadas[0].Nome != "a.txt" {
+		t.Fatalf("--sort=time deveria pôr o a.txt, alterado por último, primeiro, deu %q (%v)", nomesDe(ordenadas), erro)
+	}
+	if ordenadas, erro = meufs.FiltrarEOrdenar(infos, "file", "name"); erro != nil || nomesDe(ordenadas) != "a.txt b.txt" {
+		t.Fatalf("--type=file deveria deixar só os arquivos, deixou %q (%v)", nomesDe(ordenadas), erro)
+	}
+	if ordenadas, erro = meufs.FiltrarEOrdenar(infos, "dir", ""); erro != nil || nomesDe(ordenadas) != "dir" {
+		t.Fatalf("--type=dir deveria deixar só os diretórios, deixou %q (%v)", nomesDe(ordenadas), erro)
+	}
+	if _, erro = meufs.FiltrarEOrdenar(infos, "link", ""); erro == nil {
+		t.Fatal("um tipo desconhecido deveria ser recusado")
+	}
+	if _, erro = meufs.FiltrarEOrdenar(infos, "", "owner"); erro == nil {
+		t.Fatal("uma ordenação desconhecida deveria ser recusada")
+	}
+}
+
+func TestShellListagemLonga(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", strings.Repeat("a", 5000))
+	criarDiretorio(t, volume, "dir")
+	linhas := strings.Split(strings.TrimSpace(executar(t, novoShell(volume), "ls -l --type=file")), "\n")
+	if len(linhas) != 1 {
+		t.Fatalf("ls -l --type=file deveria mostrar só a.txt, mostrou %q", linhas)
+	}
+	// Modo, atributos, dono, grupo, tamanho, blocos, primeiro bloco, fragmentos, data, hora e nome
+	campos := strings.Fields(linhas[0])
+	if len(campos) != 11 || !strings.HasPrefix(campos[0], "-rw") || campos[4] != "5000" || campos[5] != "2" || campos[7] != "1" || campos[10] != "a.txt" {
+		t.Fatalf("linha do ls -l inesperada: %q", linhas[0])
+	}
+}
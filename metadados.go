@@ -0,0 +1,114 @@
+package meufs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// SemDono é o Dono e o Grupo das entradas cujo dono no sistema real não é conhecido
+const SemDono uint32 = 0xFFFFFFFF
+
+// Modos dados às entradas criadas sem preservar os metadados do sistema real
+const (
+	ModoArquivoPadrao   uint32 = 0644
+	ModoDiretorioPadrao uint32 = 0755
+)
+
+// entradaDoRoot descreve o root, que não tem entrada própria, nas operações que precisam de uma.
+// Como o /tmp, todos podem criar entradas nele (1777), mas o sticky bit só deixa cada um remover as próprias
+var entradaDoRoot = DiretorioRoot{EhDir: 1, Modo: 01777, Dono: SemDono, Grupo: SemDono}
+
+// MetadadosReais são os metadados de um arquivo do sistema real que o meufs consegue guardar
+type MetadadosReais struct {
+	Modo       uint32 // Bits de permissão no formato Unix, incluindo setuid, setgid e sticky
+	Modificado time.Time
+	Dono       uint32 // uid e gid do dono, SemDono se o sistema não tiver essa informação (ex: Windows)
+	Grupo      uint32
+}
+
+// LerMetadadosReais extrai de um fs.FileInfo do sistema real os metadados guardados pelo meufs
+func LerMetadadosReais(info fs.FileInfo) MetadadosReais {
+	metadados := MetadadosReais{Modo: ModoUnix(info.Mode()), Modificado: info.ModTime(), Dono: SemDono, Grupo: SemDono}
+	if dono, grupo, ok := donoDoArquivo(info); ok {
+		metadados.Dono, metadados.Grupo = dono, grupo
+	}
+	return metadados
+}
+
+// ModoUnix converte um fs.FileMode para os bits de permissão no formato Unix (ex: 04755)
+func ModoUnix(modo fs.FileMode) uint32 {
+	unix := uint32(modo.Perm())
+	if modo&fs.ModeSetuid != 0 {
+		unix |= 04000
+	}
+	if modo&fs.ModeSetgid != 0 {
+		unix |= 02000
+	}
+	if modo&fs.ModeSticky != 0 {
+		unix |= 01000
+	}
+	return unix
+}
+
+// ModoGo converte bits de permissão no formato Unix para fs.FileMode, sem o tipo do arquivo
+func ModoGo(unix uint32) fs.FileMode {
+	modo := fs.FileMode(unix) & fs.ModePerm
+	if unix&04000 != 0 {
+		modo |= fs.ModeSetuid
+	}
+	if unix&02000 != 0 {
+		modo |= fs.ModeSetgid
+	}
+	if unix&01000 != 0 {
+		modo |= fs.ModeSticky
+	}
+	return modo
+}
+
+// PreservarMetadados grava na entrada indicada pelo caminho o modo, a data de modificação e o dono de um arquivo do
+// sistema real, o que só o dono da entrada e o root podem fazer. Como no cp -p, só o root passa a entrada para o
+// dono do arquivo real, os demais continuam donos dela
+func PreservarMetadados(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, metadados MetadadosReais) error {
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	entrada := &dir.Entradas[indice]
+	if erro = verificarDono(identidade, *entrada, caminho); erro != nil {
+		return erro
+	}
+	if erro = verificarEntradaAlteravel(*entrada, caminho); erro != nil {
+		return erro
+	}
+	entrada.Modo = metadados.Modo
+	if identidade.EhRoot() && metadados.Dono != SemDono {
+		entrada.Dono = metadados.Dono
+		entrada.Grupo = metadados.Grupo
+	}
+	if !metadados.Modificado.IsZero() {
+		entrada.Modificado = metadados.Modificado.UnixNano()
+	}
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// AplicarMetadados aplica ao arquivo do sistema real o dono (se conhecido), o modo e as datas guardados na entrada.
+// O dono é trocado primeiro porque a troca de dono desliga os bits setuid e setgid
+func AplicarMetadados(caminhoReal string, entrada DiretorioRoot) error {
+	if entrada.Dono != SemDono {
+		if erro := mudarDono(caminhoReal, entrada.Dono, entrada.Grupo); erro != nil {
+			return fmt.Errorf("erro ao definir o dono do arquivo no sistema real: %w", erro)
+		}
+	}
+	if erro := os.Chmod(caminhoReal, ModoGo(entrada.Modo)); erro != nil {
+		return fmt.Errorf("erro ao definir as permissões do arquivo no sistema real: %w", erro)
+	}
+	if erro := os.Chtimes(caminhoReal, TempoDaEntrada(entrada.Acessado), TempoDaEntrada(entrada.Modificado)); erro != nil {
+		return fmt.Errorf("erro ao definir as datas do arquivo no sistema real: %w", erro)
+	}
+	return nil
+}
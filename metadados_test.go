@@ -0,0 +1,74 @@
+package meufs_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"meufs"
+)
+
+func TestModoUnix(t *testing.T) {
+	for _, modo := range []uint32{0644, 0755, 04755, 02750, 01777, 0} {
+		if convertido := meufs.ModoUnix(meufs.ModoGo(modo)); convertido != modo {
+			t.Errorf("o modo %04o virou %04o ao passar por fs.FileMode", modo, convertido)
+		}
+	}
+	if modo := meufs.ModoGo(04755); modo != fs.ModeSetuid|0755 {
+		t.Fatalf("04755 deveria virar setuid com 0755, virou %v", modo)
+	}
+}
+
+func TestShellPreservarMetadados(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("o Windows não guarda os bits de permissão do Unix")
+	}
+	volume := novoVolume(t)
+	shell := novoShell(volume)
+	real := t.TempDir()
+	origem := filepath.Join(real, "dados.txt")
+	if erro := os.WriteFile(origem, []byte("dados"), 0600); erro != nil {
+		t.Fatal(erro)
+	}
+	modificado := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	if erro := os.Chmod(origem, 0640); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := os.Chtimes(origem, modificado, modificado); erro != nil {
+		t.Fatal(erro)
+	}
+
+	// Sem -p a entrada fica com o modo padrão e a data da cópia
+	executar(t, shell, "put "+origem+" /sem.txt")
+	var info meufs.InfoEntrada
+	decodificar(t, executar(t, shell, "stat --json /sem.txt"), &info)
+	if info.Modo != "0644" || info.Modificado == nil || info.Modificado.Equal(modificado) {
+		t.Fatalf("sem -p a entrada deveria ter o modo 0644 e a data da cópia: %+v", info)
+	}
+	executar(t, shell, "put -p "+origem+" /com.txt")
+	decodificar(t, executar(t, shell, "stat --json /com.txt"), &info)
+	if info.Modo != "0640" || info.Modificado == nil || !info.Modificado.Equal(modificado) {
+		t.Fatalf("com -p a entrada deveria ter o modo 0640 e a data do arquivo real: %+v", info)
+	}
+
+	// get -p devolve o modo e a data guardados ao arquivo real, e sem -p o arquivo é criado com o padrão
+	destino := t.TempDir()
+	executar(t, shell, "get -p /com.txt "+filepath.Join(destino, "com.txt"))
+	executar(t, shell, "get /com.txt "+filepath.Join(destino, "sem.txt"))
+	estado, erro := os.Stat(filepath.Join(destino, "com.txt"))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if estado.Mode().Perm() != 0640 || !estado.ModTime().Equal(modificado) {
+		t.Fatalf("get -p deveria aplicar o modo 0640 e a data guardada, o arquivo tem %v e %v", estado.Mode(), estado.ModTime())
+	}
+	if estado, erro = os.Stat(filepath.Join(destino, "sem.txt")); erro != nil {
+		t.Fatal(erro)
+	}
+	if estado.ModTime().Equal(modificado) {
+		t.Fatal("get sem -p não deveria aplicar a data guardada")
+	}
+}
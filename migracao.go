@@ -0,0 +1,308 @@
+package meufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Os volumes criados antes da versão de formato não têm Assinatura nem Versao no cabeçalho e não são abertos
+// (ver ErrFormatoAntigo). O formato deles é reconhecido pelo tamanho das entradas do root, que sempre teve 200:
+//   - 26 bytes: nome, EnderecoFAT, Protegido e EhDir. Os arquivos ocupavam blocos inteiros
+//   - 30 bytes: mais o Tamanho, com arquivos vazios em SemBlocos
+//   - 54 bytes: mais as datas, com nomes longos em entradas de continuação
+//   - 66 bytes: mais o modo, o dono e o grupo, como as entradas atuais
+// Com entradas de 66 bytes e espaço no cabeçalho para todas as áreas, só faltam a assinatura e a versão, e o
+// cabeçalho é convertido no lugar. Nos demais o conteúdo é copiado para um volume novo
+
+// cabecalhoAntigo é o Cabecalho dos volumes criados antes da versão de formato
+type cabecalhoAntigo struct {
+	TamanhoCabecalho uint32
+	TamanhoBloco     uint32
+	TamanhoMeuFS     uint32
+	InicioFAT        uint32
+	InicioRoot       uint32
+	InicioDados      uint32
+}
+
+// MigrarVolume converte o meufs.fs do caminho, criado por uma versão anterior do meufs, para o formato atual.
+// Quando o volume precisa ser copiado, o original é mantido com o sufixo ".antigo"
+func MigrarVolume(caminho string) error {
+	arquivo, erro := os.OpenFile(caminho, os.O_RDWR, 0644)
+	if erro != nil {
+		return erro
+	}
+	defer arquivo.Close()
+	dados := make([]byte, binary.Size(Cabecalho{}))
+	if _, erro = arquivo.ReadAt(dados, 0); erro != nil {
+		return fmt.Errorf("erro ao ler o cabeçalho: %w", erro)
+	}
+	var atual Cabecalho
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, &atual)
+	if atual.TamanhoCabecalho >= uint32(len(dados)) && atual.Assinatura == assinaturaMeuFS {
+		return fmt.Errorf("meufs.fs já está no formato %d e não precisa ser convertido", atual.Versao)
+	}
+	var antigo cabecalhoAntigo
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, &antigo)
+	tamanhoRoot := antigo.InicioFAT - antigo.InicioRoot
+	tamanhoEntrada := int(tamanhoRoot / 200)
+	if antigo.InicioRoot < antigo.TamanhoCabecalho || antigo.InicioFAT < antigo.InicioRoot || tamanhoRoot%200 != 0 ||
+		(tamanhoEntrada != 26 && tamanhoEntrada != 30 && tamanhoEntrada != 54 && tamanhoEntrada != 66) {
+		return errors.New("meufs.fs não está em nenhum formato conhecido do meufs")
+	}
+	if tamanhoEntrada == binary.Size(DiretorioRoot{}) && antigo.TamanhoCabecalho >= tamanhoCabecalhoAtual() {
+		return migrarCabecalho(arquivo, antigo)
+	}
+	return copiarVolumeAntigo(caminho, arquivo, antigo, tamanhoEntrada)
+}
+
+// migrarCabecalho grava a assinatura e a versão no cabeçalho de um volume que já tem as entradas e as áreas do
+// formato atual. As áreas depois do cabeçalho são deslocadas pelos campos novos, para o espaço livre no fim dele
+func migrarCabecalho(arquivo *os.File, antigo cabecalhoAntigo) error {
+	area := make([]byte, antigo.TamanhoCabecalho)
+	if _, erro := arquivo.ReadAt(area, 0); erro != nil {
+		return fmt.Errorf("erro ao ler o cabeçalho: %w", erro)
+	}
+	deslocamento := binary.Size(Cabecalho{}) - binary.Size(antigo)
+	if bytes.ContainsFunc(area[len(area)-deslocamento:], func(r rune) bool { return r != 0 }) {
+		return errors.New("o fim do cabeçalho de meufs.fs não está livre para os campos novos")
+	}
+	copy(area[binary.Size(Cabecalho{}):], area[binary.Size(antigo):len(area)-deslocamento])
+	cabecalho := Cabecalho{
+		TamanhoCabecalho: antigo.TamanhoCabecalho,
+		TamanhoBloco:     antigo.TamanhoBloco,
+		TamanhoMeuFS:     antigo.TamanhoMeuFS,
+		InicioFAT:        antigo.InicioFAT,
+		InicioRoot:       antigo.InicioRoot,
+		InicioDados:      antigo.InicioDados,
+		Assinatura:       assinaturaMeuFS,
+		Versao:           VersaoFormato,
+	}
+	var campos bytes.Buffer
+	binary.Write(&campos, binary.LittleEndian, cabecalho)
+	copy(area, campos.Bytes())
+	if _, erro := arquivo.WriteAt(area, 0); erro != nil {
+		return fmt.Errorf("erro ao gravar o cabeçalho: %w", erro)
+	}
+	return arquivo.Sync()
+}
+
+// migracao guarda o volume antigo, lido direto do arquivo, e o volume novo para onde a árvore é copiada
+type migracao struct {
+	antigo         cabecalhoAntigo
+	arquivo        *os.File
+	fatAntiga      []uint32
+	tamanhoEntrada int
+	cabecalho      Cabecalho
+	meuFS          *MeuFS
+	fat            []uint32
+}
+
+// copiarVolumeAntigo cria um volume vazio do mesmo tamanho, copia para ele a árvore do volume antigo e a senha de
+// administrador, se houver, e então troca um pelo outro
+func copiarVolumeAntigo(caminho string, arquivo *os.File, antigo cabecalhoAntigo, tamanhoEntrada int) error {
+	m := &migracao{antigo: antigo, arquivo: arquivo, tamanhoEntrada: tamanhoEntrada}
+	m.fatAntiga = make([]uint32, (antigo.TamanhoMeuFS-antigo.InicioDados)/antigo.TamanhoBloco)
+	dadosFAT := make([]byte, len(m.fatAntiga)*4)
+	if _, erro := arquivo.ReadAt(dadosFAT, int64(antigo.InicioFAT)); erro != nil {
+		return fmt.Errorf("erro ao ler a FAT: %w", erro)
+	}
+	binary.Read(bytes.NewReader(dadosFAT), binary.LittleEndian, m.fatAntiga)
+	root := make([]byte, 200*tamanhoEntrada)
+	if _, erro := arquivo.ReadAt(root, int64(antigo.InicioRoot)); erro != nil {
+		return fmt.Errorf("erro ao ler o diretorio raiz: %w", erro)
+	}
+	novo := caminho + ".migrando"
+	if erro := CriarVolume(novo, int(antigo.TamanhoMeuFS/(1024*1024)), ""); erro != nil {
+		return erro
+	}
+	erro := m.copiarPara(novo, root)
+	if erro != nil {
+		os.Remove(novo)
+		return erro
+	}
+	arquivo.Close()
+	if erro = os.Rename(caminho, caminho+".antigo"); erro != nil {
+		os.Remove(novo)
+		return fmt.Errorf("erro ao guardar o volume antigo: %w", erro)
+	}
+	if erro = os.Rename(novo, caminho); erro != nil {
+		return fmt.Errorf("erro ao colocar o volume convertido no lugar, que ficou em %s: %w", novo, erro)
+	}
+	return nil
+}
+
+// copiarPara copia a árvore do root antigo e a senha de administrador para o volume novo do caminho
+func (m *migracao) copiarPara(caminho string, root []byte) error {
+	meuFS, cabecalho, erro := AbrirMeuFS(caminho)
+	if erro != nil {
+		return erro
+	}
+	defer meuFS.Close()
+	m.meuFS, m.cabecalho = meuFS, cabecalho
+	if m.fat, erro = LerFAT(cabecalho, meuFS); erro != nil {
+		return erro
+	}
+	raiz := Diretorio{EhRoot: true, Entradas: make([]DiretorioRoot, 200), Nomes: make([]string, 200)}
+	if erro = m.copiarDiretorio(root, &raiz, "/"); erro != nil {
+		return erro
+	}
+	if erro = SalvarDiretorio(cabecalho, meuFS, raiz); erro != nil {
+		return erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, m.fat); erro != nil {
+		return erro
+	}
+	// A credencial ficava logo depois dos campos do cabeçalho antigo, nos volumes que tinham espaço para ela
+	if int(m.antigo.TamanhoCabecalho) >= binary.Size(m.antigo)+binary.Size(CredencialAdmin{}) {
+		credencial := make([]byte, binary.Size(CredencialAdmin{}))
+		if _, erro = m.arquivo.ReadAt(credencial, int64(binary.Size(m.antigo))); erro != nil {
+			return fmt.Errorf("erro ao ler a senha de administrador: %w", erro)
+		}
+		if _, erro = meuFS.WriteAt(credencial, posicaoCredencial()); erro != nil {
+			return fmt.Errorf("erro ao gravar a senha de administrador: %w", erro)
+		}
+	}
+	return meuFS.Sync()
+}
+
+// copiarDiretorio copia para o diretório novo as entradas antigas, com o conteúdo dos arquivos e, recursivamente,
+// os subdiretórios. Só altera o diretório novo em memória
+func (m *migracao) copiarDiretorio(dados []byte, destino *Diretorio, caminho string) error {
+	entradas, nomes := m.entradasAntigas(dados)
+	for indice, entrada := range entradas {
+		if nomes[indice] == "" {
+			continue
+		}
+		var erro error
+		if entrada.EhDir == 1 {
+			erro = m.copiarSubdiretorio(&entrada, caminho+nomes[indice]+"/")
+		} else {
+			erro = m.copiarArquivo(&entrada)
+		}
+		if erro != nil {
+			return fmt.Errorf("erro ao copiar %s%s: %w", caminho, nomes[indice], erro)
+		}
+		livre := EntradaLivre(*destino, nomes[indice])
+		if livre == -1 {
+			return fmt.Errorf("o diretório %s tem entradas demais para caber no formato atual", caminho)
+		}
+		EscreverEntrada(destino, livre, entrada, nomes[indice])
+	}
+	return nil
+}
+
+// copiarSubdiretorio copia o subdiretório da entrada para um bloco novo, para onde a entrada passa a apontar
+func (m *migracao) copiarSubdiretorio(entrada *DiretorioRoot, caminho string) error {
+	if int(entrada.EnderecoFAT) >= len(m.fatAntiga) {
+		return errors.New("o diretório aponta para fora da área de dados")
+	}
+	dados := make([]byte, m.antigo.TamanhoBloco)
+	if _, erro := m.arquivo.ReadAt(dados, int64(m.antigo.InicioDados)+int64(entrada.EnderecoFAT)*int64(m.antigo.TamanhoBloco)); erro != nil {
+		return fmt.Errorf("erro ao ler o diretório: %w", erro)
+	}
+	blocos, erro := buscarBlocosLivres(m.fat, 1)
+	if erro != nil {
+		return erro
+	}
+	m.fat[blocos[0]] = FimDaCadeia
+	quantidade := EntradasPorBloco(m.cabecalho)
+	sub := Diretorio{Bloco: blocos[0], Entradas: make([]DiretorioRoot, quantidade), Nomes: make([]string, quantidade)}
+	if erro = m.copiarDiretorio(dados, &sub, caminho); erro != nil {
+		return erro
+	}
+	entrada.EnderecoFAT = blocos[0]
+	return SalvarDiretorio(m.cabecalho, m.meuFS, sub)
+}
+
+// copiarArquivo copia bloco a bloco a cadeia do arquivo da entrada para blocos livres do volume novo, para onde
+// a entrada passa a apontar. Nas entradas de 26 bytes, sem Tamanho, o arquivo ocupa os blocos inteiros
+func (m *migracao) copiarArquivo(entrada *DiretorioRoot) error {
+	var cadeia []uint32
+	for bloco := entrada.EnderecoFAT; bloco != SemBlocos; bloco = m.fatAntiga[bloco] {
+		if int(bloco) >= len(m.fatAntiga) || len(cadeia) == len(m.fatAntiga) {
+			return errors.New("a cadeia de blocos do arquivo está corrompida")
+		}
+		cadeia = append(cadeia, bloco)
+	}
+	if m.tamanhoEntrada == 26 {
+		entrada.Tamanho = uint32(len(cadeia)) * m.antigo.TamanhoBloco
+	}
+	if len(cadeia) == 0 {
+		return nil
+	}
+	novos, erro := buscarBlocosLivres(m.fat, len(cadeia))
+	if erro != nil {
+		return erro
+	}
+	dados := make([]byte, m.antigo.TamanhoBloco)
+	for i, bloco := range cadeia {
+		if _, erro = m.arquivo.ReadAt(dados, int64(m.antigo.InicioDados)+int64(bloco)*int64(m.antigo.TamanhoBloco)); erro != nil {
+			return fmt.Errorf("erro ao ler bloco: %w", erro)
+		}
+		if _, erro = m.meuFS.WriteAt(dados, PosicaoDoBloco(m.cabecalho, novos[i])); erro != nil {
+			return fmt.Errorf("erro ao escrever bloco no meufs: %w", erro)
+		}
+		m.fat[novos[i]] = FimDaCadeia
+		if i > 0 {
+			m.fat[novos[i-1]] = novos[i]
+		}
+	}
+	entrada.EnderecoFAT = novos[0]
+	return nil
+}
+
+// entradasAntigas converte as entradas gravadas no formato antigo para DiretorioRoot e monta o nome completo de
+// cada entrada principal, como DecodificarNomes. Os campos que o formato não tinha recebem os valores padrão
+func (m *migracao) entradasAntigas(dados []byte) ([]DiretorioRoot, []string) {
+	t := m.tamanhoEntrada
+	entradas := make([]DiretorioRoot, len(dados)/t)
+	continuacoes := make([][]byte, len(entradas))
+	instante := agora()
+	for indice := range entradas {
+		bruta := dados[indice*t : (indice+1)*t]
+		entrada := &entradas[indice]
+		copy(entrada.NomeArquivo[:], bruta[:20])
+		entrada.EnderecoFAT = binary.LittleEndian.Uint32(bruta[20:])
+		if t == 26 {
+			entrada.Atributos, entrada.EhDir = bruta[24], bruta[25]
+		} else {
+			entrada.Tamanho = binary.LittleEndian.Uint32(bruta[24:])
+			entrada.Atributos, entrada.EhDir = bruta[28], bruta[posicaoEhDir]
+		}
+		// As entradas de continuação surgiram com as datas
+		if t >= 54 && ehContinuacao(*entrada) {
+			continuacoes[indice] = append(bruta[:posicaoEhDir:posicaoEhDir], bruta[posicaoEhDir+1:]...)
+			continue
+		}
+		entrada.Criado, entrada.Modificado, entrada.Acessado = instante, instante, instante
+		if t >= 54 {
+			entrada.Criado = int64(binary.LittleEndian.Uint64(bruta[30:]))
+			entrada.Modificado = int64(binary.LittleEndian.Uint64(bruta[38:]))
+			entrada.Acessado = int64(binary.LittleEndian.Uint64(bruta[46:]))
+		}
+		entrada.Modo, entrada.Dono, entrada.Grupo = ModoArquivoPadrao, SemDono, SemDono
+		if entrada.EhDir == 1 {
+			entrada.Modo = ModoDiretorioPadrao
+		}
+		if t >= 66 {
+			entrada.Modo = binary.LittleEndian.Uint32(bruta[54:])
+			entrada.Dono = binary.LittleEndian.Uint32(bruta[58:])
+			entrada.Grupo = binary.LittleEndian.Uint32(bruta[62:])
+		}
+	}
+	nomes := make([]string, len(entradas))
+	for indice, entrada := range entradas {
+		if entrada.NomeArquivo[0] == 0 || continuacoes[indice] != nil {
+			continue
+		}
+		nome := bytes.TrimRight(entrada.NomeArquivo[:], "\x00")
+		for proxima := indice + 1; proxima < len(entradas) && continuacoes[proxima] != nil; proxima++ {
+			nome = append(nome, bytes.TrimRight(continuacoes[proxima], "\x00")...)
+		}
+		nomes[indice] = string(nome)
+	}
+	return entradas, nomes
+}
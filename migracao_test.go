@@ -0,0 +1,131 @@
+package meufs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// entradaAntiga monta uma entrada de 26 bytes do primeiro formato: nome, EnderecoFAT, Protegido e EhDir
+func entradaAntiga(nome string, enderecoFAT uint32, protegido, ehDir uint8) []byte {
+	entrada := make([]byte, 26)
+	copy(entrada, nome)
+	binary.LittleEndian.PutUint32(entrada[20:], enderecoFAT)
+	entrada[24], entrada[25] = protegido, ehDir
+	return entrada
+}
+
+func TestMigrarPrimeiroFormato(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "meufs.fs")
+	arquivo, erro := os.Create(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	const tamanhoBloco, tamanhoMeuFS = 4096, 100 * 1024 * 1024
+	inicioFAT := uint32(24 + 200*26)
+	inicioDados := inicioFAT + 4*25575
+	arquivo.Truncate(tamanhoMeuFS)
+	var cabecalho bytes.Buffer
+	binary.Write(&cabecalho, binary.LittleEndian, []uint32{24, tamanhoBloco, tamanhoMeuFS, inicioFAT, 24, inicioDados})
+	arquivo.WriteAt(cabecalho.Bytes(), 0)
+	arquivo.WriteAt(entradaAntiga("velho.txt", 0, 1, 0), 24)
+	arquivo.WriteAt(entradaAntiga("pasta", 1, 0, 1), 24+26)
+	arquivo.WriteAt(entradaAntiga("dentro.txt", 2, 0, 0), int64(inicioDados)+tamanhoBloco)
+	var fat bytes.Buffer
+	binary.Write(&fat, binary.LittleEndian, []uint32{meufs.FimDaCadeia, meufs.FimDaCadeia, 3, meufs.FimDaCadeia})
+	arquivo.WriteAt(fat.Bytes(), int64(inicioFAT))
+	arquivo.WriteAt([]byte("antigo"), int64(inicioDados))
+	dentro := bytes.Repeat([]byte("d"), 2*tamanhoBloco)
+	arquivo.WriteAt(dentro, int64(inicioDados)+2*tamanhoBloco)
+	arquivo.Close()
+
+	if _, erro = meufs.AbrirVolume(caminho); !errors.Is(erro, meufs.ErrFormatoAntigo) {
+		t.Fatalf("abrir um volume antigo deveria falhar com ErrFormatoAntigo, falhou com %v", erro)
+	}
+	if erro = meufs.MigrarVolume(caminho); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = os.Stat(caminho + ".antigo"); erro != nil {
+		t.Fatalf("o volume antigo deveria ter sido guardado: %v", erro)
+	}
+	volume, erro := meufs.AbrirVolume(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	volume.Identidade = meufs.IdentidadeRoot
+	defer volume.Close()
+	// Sem o tamanho no formato antigo, os arquivos ficam com os blocos inteiros
+	if texto := conteudo(t, volume, "/velho.txt"); texto != "antigo"+strings.Repeat("\x00", tamanhoBloco-len("antigo")) {
+		t.Fatalf("velho.txt tem %d bytes diferentes do original", len(texto))
+	}
+	if texto := conteudo(t, volume, "/pasta/dentro.txt"); texto != string(dentro) {
+		t.Fatalf("pasta/dentro.txt tem %d bytes diferentes do original", len(texto))
+	}
+	if _, erro = volume.OpenFile("/velho.txt", os.O_WRONLY, 0); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("velho.txt era protegido e deveria continuar somente leitura, abrir para escrita deu %v", erro)
+	}
+	verificar(t, volume)
+	if erro = meufs.MigrarVolume(caminho); erro == nil {
+		t.Fatal("migrar de novo um volume já convertido deveria falhar")
+	}
+}
+
+func TestMigrarCabecalho(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "meufs.fs")
+	if erro := meufs.CriarVolume(caminho, 100, ""); erro != nil {
+		t.Fatal(erro)
+	}
+	volume, erro := meufs.AbrirVolume(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	volume.Identidade = meufs.IdentidadeRoot
+	gravar(t, volume, "/a.txt", "conteúdo")
+	if erro = meufs.DefinirSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatal(erro)
+	}
+	tamanhoCabecalho := volume.Cabecalho.TamanhoCabecalho
+	volume.Close()
+
+	// Volta o cabeçalho ao formato sem assinatura e versão, com as áreas logo depois dos 24 bytes dos campos antigos
+	arquivo, erro := os.OpenFile(caminho, os.O_RDWR, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	area := make([]byte, tamanhoCabecalho)
+	arquivo.ReadAt(area, 0)
+	antiga := append(append(area[:24:24], area[32:]...), make([]byte, 8)...)
+	arquivo.WriteAt(antiga, 0)
+	arquivo.Close()
+
+	if _, erro = meufs.AbrirVolume(caminho); !errors.Is(erro, meufs.ErrFormatoAntigo) {
+		t.Fatalf("abrir um volume antigo deveria falhar com ErrFormatoAntigo, falhou com %v", erro)
+	}
+	if erro = meufs.MigrarVolume(caminho); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = os.Stat(caminho + ".antigo"); erro == nil {
+		t.Fatal("a conversão do cabeçalho é feita no lugar e não deveria copiar o volume")
+	}
+	volume, erro = meufs.AbrirVolume(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer volume.Close()
+	if volume.Cabecalho.Versao != meufs.VersaoFormato {
+		t.Fatalf("o volume convertido deveria estar na versão %d, está na %d", meufs.VersaoFormato, volume.Cabecalho.Versao)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "conteúdo" {
+		t.Fatalf("a.txt deveria ter o conteúdo original, tem %q", texto)
+	}
+	if erro = meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatalf("a senha de administrador deveria continuar valendo: %v", erro)
+	}
+}
@@ -0,0 +1,179 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// itemArvore é uma entrada encontrada ao percorrer uma árvore de diretórios do meufs
+type itemArvore struct {
+	caminho []string
+	entrada DiretorioRoot
+}
+
+// MoverEntrada move a entrada indicada pela origem para o diretório caminhoDirDestino com o nome informado. Só a entrada
+// muda de diretório: os blocos de dados e, nos diretórios, todo o seu conteúdo continuam onde estão. Dentro do mesmo
+// diretório é o mesmo que RenomearEntradaComPolitica. Um nome já existente no destino é tratado conforme a política
+// e retorna o nome usado. Um diretório não pode ser movido para dentro dele mesmo. A identidade precisa de escrita
+// nos dois diretórios, e entradas imutáveis ou somente anexar não são movidas
+func MoverEntrada(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, origem []string, caminhoDirDestino []string, nomeNovo string, politica PoliticaDuplicado) (string, error) {
+	if len(origem) == 0 {
+		return "", NovoErroFS(fs.ErrInvalid, "o root não pode ser movido")
+	}
+	if slices.Equal(origem[:len(origem)-1], caminhoDirDestino) {
+		return RenomearEntradaComPolitica(cabecalho, meuFS, identidade, origem, nomeNovo, politica)
+	}
+	if erro := ValidarNome(nomeNovo); erro != nil {
+		return "", erro
+	}
+	if slices.Equal(caminhoDirDestino, origem) || ehDescendente(caminhoDirDestino, origem) {
+		return "", NovoErroFS(fs.ErrInvalid, "não é possível mover '/%s' para dentro dele mesmo", strings.Join(origem, "/"))
+	}
+	dirOrigem, indice, entradaDirOrigem, erro := resolverComPermissao(cabecalho, meuFS, identidade, origem)
+	if erro != nil {
+		return "", erro
+	}
+	entrada := dirOrigem.Entradas[indice]
+	if erro = verificarAlteracao(identidade, entradaDirOrigem, entrada, origem); erro != nil {
+		return "", erro
+	}
+	if erro = verificarEntradaAlteravel(entrada, origem); erro != nil {
+		return "", erro
+	}
+	destino, entradaDirDestino, erro := abrirComPermissao(cabecalho, meuFS, identidade, caminhoDirDestino)
+	if erro != nil {
+		return "", erro
+	}
+	if erro = verificarCriacao(identidade, entradaDirDestino, caminhoDirDestino); erro != nil {
+		return "", erro
+	}
+	if indiceDestino := BuscarEntrada(destino, nomeNovo); indiceDestino != -1 {
+		switch politica {
+		case DuplicadoSobrescrever:
+			if destino.Entradas[indiceDestino].EhDir != entrada.EhDir {
+				return "", NovoErroFS(fs.ErrExist, "'%s' já existe e não pode ser sobrescrito por um %s", nomeNovo, descreverTipo(entrada.EhDir == 1))
+			}
+			caminhoDestino := append(append([]string(nil), caminhoDirDestino...), nomeNovo)
+			if erro = RemoverEntrada(cabecalho, meuFS, identidade, caminhoDestino); erro != nil {
+				return "", erro
+			}
+			// A remoção já salvou o diretório, então ele é lido de novo
+			if destino, erro = AbrirDiretorio(cabecalho, meuFS, caminhoDirDestino); erro != nil {
+				return "", erro
+			}
+		case DuplicadoRenomear:
+			if nomeNovo, erro = NomeLivre(destino, nomeNovo); erro != nil {
+				return "", erro
+			}
+		case DuplicadoPular:
+			return origem[len(origem)-1], fmt.Errorf("'%s' %w", nomeNovo, ErrPulado)
+		default:
+			return "", NovoErroFS(fs.ErrExist, "um arquivo com o nome '%s' já existe no sistema", nomeNovo)
+		}
+	}
+	novoIndice := EntradaLivre(destino, nomeNovo)
+	if novoIndice == -1 {
+		return "", errors.New("diretorio de destino cheio")
+	}
+	// A entrada é gravada no destino antes de sair da origem: uma interrupção no meio deixa a entrada repetida, mas não a perde
+	EscreverEntrada(&destino, novoIndice, entrada, nomeNovo)
+	if erro = SalvarDiretorio(cabecalho, meuFS, destino); erro != nil {
+		return "", erro
+	}
+	// O diretório de origem pode ter mudado com a remoção de um destino sobrescrito, então é lido de novo
+	if dirOrigem, indice, erro = ResolverCaminho(cabecalho, meuFS, origem); erro != nil {
+		return "", erro
+	}
+	LiberarEntrada(&dirOrigem, indice)
+	if erro = SalvarDiretorio(cabecalho, meuFS, dirOrigem); erro != nil {
+		return "", erro
+	}
+	if erro = tocarDiretorio(cabecalho, meuFS, origem[:len(origem)-1]); erro != nil {
+		return "", erro
+	}
+	return nomeNovo, tocarDiretorio(cabecalho, meuFS, caminhoDirDestino)
+}
+
+// RemoverArvore remove a entrada indicada pelo caminho e, se for um diretório, tudo que há dentro dele, como o rm -r.
+// Antes de remover qualquer coisa confere se a identidade pode remover cada entrada da árvore e se há alguma entrada
+// protegida e, se houver algum problema, não remove nada. Com forcar as entradas somente leitura também são removidas,
+// desde que pertençam à identidade (e com a senha de administrador, se o volume tiver uma), mas as imutáveis e
+// somente anexar nunca são
+func RemoverArvore(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, forcar bool) error {
+	if len(caminho) == 0 {
+		return NovoErroFS(fs.ErrInvalid, "o root não pode ser removido")
+	}
+	dir, indice, entradaDir, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	itens, erro := listarArvore(cabecalho, meuFS, itemArvore{caminho, dir.Entradas[indice]})
+	if erro != nil {
+		return erro
+	}
+	// Entradas dos diretórios da árvore pelo caminho, para conferir a permissão de remover cada filho
+	diretorios := map[string]DiretorioRoot{strings.Join(caminho[:len(caminho)-1], "/"): entradaDir}
+	for _, item := range itens {
+		diretorios[strings.Join(item.caminho, "/")] = item.entrada
+	}
+	for _, item := range itens {
+		protegido := item.entrada.Atributos&AtributoSomenteLeitura != 0
+		if protegido && !forcar {
+			return NovoErroFS(fs.ErrPermission, "'/%s' está protegido, nada foi removido", strings.Join(item.caminho, "/"))
+		}
+		erro := verificarAlteracao(identidade, diretorios[strings.Join(item.caminho[:len(item.caminho)-1], "/")], item.entrada, item.caminho)
+		if erro == nil {
+			erro = verificarEntradaAlteravel(item.entrada, item.caminho)
+		}
+		if erro == nil && item.entrada.EhDir == 1 && !PodeAcessar(identidade, item.entrada, AcessoLeitura|AcessoEscrita|AcessoExecucao) {
+			erro = erroDePermissao(item.caminho, AcessoLeitura|AcessoEscrita|AcessoExecucao)
+		}
+		if erro == nil && protegido {
+			erro = verificarDono(identidade, item.entrada, item.caminho)
+		}
+		if erro == nil && protegido {
+			erro = exigirSenhaAdmin(cabecalho, meuFS, identidade)
+		}
+		if erro != nil {
+			return fmt.Errorf("%w, nada foi removido", erro)
+		}
+	}
+	// Os filhos vêm antes dos pais, então cada diretório já está vazio quando chega a sua vez
+	for _, item := range itens {
+		if item.entrada.Atributos&AtributoSomenteLeitura != 0 {
+			if erro = DefinirProtecao(cabecalho, meuFS, identidade, item.caminho, false); erro != nil {
+				return erro
+			}
+		}
+		if erro = RemoverEntrada(cabecalho, meuFS, identidade, item.caminho); erro != nil {
+			return fmt.Errorf("erro ao remover '/%s': %w", strings.Join(item.caminho, "/"), erro)
+		}
+	}
+	return nil
+}
+
+// listarArvore retorna a entrada e, se ela for um diretório, todas as entradas dentro dele, sempre os filhos antes dos pais
+func listarArvore(cabecalho Cabecalho, meuFS *MeuFS, raiz itemArvore) ([]itemArvore, error) {
+	var itens []itemArvore
+	if raiz.entrada.EhDir == 1 {
+		dir, erro := LerSubdiretorio(cabecalho, meuFS, raiz.entrada.EnderecoFAT)
+		if erro != nil {
+			return nil, erro
+		}
+		for indice, nome := range dir.Nomes {
+			if nome == "" {
+				continue
+			}
+			caminho := append(append([]string(nil), raiz.caminho...), nome)
+			filhos, erro := listarArvore(cabecalho, meuFS, itemArvore{caminho, dir.Entradas[indice]})
+			if erro != nil {
+				return nil, erro
+			}
+			itens = append(itens, filhos...)
+		}
+	}
+	return append(itens, raiz), nil
+}
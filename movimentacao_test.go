@@ -0,0 +1,130 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// criarDiretorio cria o diretório indicado pelo caminho, cujo pai já precisa existir
+func criarDiretorio(t *testing.T, volume *meufs.Volume, caminho ...string) {
+	t.Helper()
+	if _, erro := meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, caminho[:len(caminho)-1], caminho[len(caminho)-1], true, nil); erro != nil {
+		t.Fatal(erro)
+	}
+}
+
+func TestMoverEntreDiretorios(t *testing.T) {
+	volume := novoVolume(t)
+	criarDiretorio(t, volume, "a")
+	criarDiretorio(t, volume, "b")
+	criarDiretorio(t, volume, "a", "sub")
+	gravar(t, volume, "/a/x", "x")
+	gravar(t, volume, "/a/sub/y", "y")
+	gravar(t, volume, "/b/x", "outro x")
+	if _, erro := meufs.MoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a", "x"}, []string{"b"}, "x", meufs.DuplicadoFalhar); !errors.Is(erro, fs.ErrExist) {
+		t.Fatalf("mover para um nome que já existe deveria falhar com fs.ErrExist, veio %v", erro)
+	}
+	nome, erro := meufs.MoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a", "x"}, []string{"b"}, "x", meufs.DuplicadoRenomear)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if nome == "x" || conteudo(t, volume, "/b/"+nome) != "x" || conteudo(t, volume, "/b/x") != "outro x" {
+		t.Fatalf("x deveria ir para b com outro nome, foi como %q", nome)
+	}
+	if _, erro = volume.Open("/a/x"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("x deveria ter saído de a: %v", erro)
+	}
+	// Um diretório leva tudo o que há dentro dele, mas não pode ir para dentro de si mesmo
+	if _, erro = meufs.MoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a"}, []string{"a", "sub"}, "a", meufs.DuplicadoFalhar); !errors.Is(erro, fs.ErrInvalid) {
+		t.Fatalf("mover a para dentro de a/sub deveria falhar com fs.ErrInvalid, veio %v", erro)
+	}
+	if _, erro = meufs.MoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"a", "sub"}, []string{"b"}, "sub", meufs.DuplicadoFalhar); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/b/sub/y"); texto != "y" {
+		t.Fatalf("b/sub/y deveria ter vindo junto com o diretório, tem %q", texto)
+	}
+	verificar(t, volume)
+}
+
+func TestRemoverArvore(t *testing.T) {
+	volume := novoVolume(t)
+	original := strings.Repeat("meufs", 2000)
+	// A tabela de referências só é criada no primeiro bloco compartilhado, então ela já precisa existir antes de
+	// contar os blocos livres
+	gravar(t, volume, "/h", original)
+	gravar(t, volume, "/copia", original)
+	livresAntes := blocosLivres(t, volume)
+	criarDiretorio(t, volume, "d")
+	criarDiretorio(t, volume, "d", "e")
+	gravar(t, volume, "/d/e/f", strings.Repeat("f", 10000))
+	gravar(t, volume, "/d/g", original) // Compartilha os blocos de h
+	if erro := meufs.DefinirProtecao(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"d", "e", "f"}, true); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"d"}); erro == nil {
+		t.Fatal("remover um diretório com conteúdo sem -r deveria falhar")
+	}
+	// Com uma entrada protegida na árvore nada é removido
+	if erro := meufs.RemoverArvore(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"d"}, false); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("remover uma árvore com uma entrada protegida deveria falhar com fs.ErrPermission, veio %v", erro)
+	}
+	if texto := conteudo(t, volume, "/d/g"); texto != original {
+		t.Fatal("d/g não deveria ter sido removido")
+	}
+	if erro := meufs.RemoverArvore(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"d"}, true); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := volume.Open("/d"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("d deveria ter sido removido: %v", erro)
+	}
+	if livres := blocosLivres(t, volume); livres != livresAntes {
+		t.Fatalf("remover a árvore deveria liberar todos os blocos dela, faltam %d", livresAntes-livres)
+	}
+	if texto := conteudo(t, volume, "/h"); texto != original {
+		t.Fatal("h compartilhava blocos com d/g e não podia mudar")
+	}
+	verificar(t, volume)
+}
+
+// comEntrada executa a função com a entrada padrão trocada pelo texto, como se ele fosse digitado no menu
+func comEntrada(t *testing.T, texto string, funcao func()) {
+	t.Helper()
+	leitura, escrita, erro := os.Pipe()
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	escrita.WriteString(texto)
+	escrita.Close()
+	entrada := os.Stdin
+	os.Stdin = leitura
+	defer func() {
+		os.Stdin = entrada
+		leitura.Close()
+	}()
+	funcao()
+}
+
+func TestMenuRemoverDiretorio(t *testing.T) {
+	volume := novoVolume(t)
+	// O índice de conteúdo é criado na primeira gravação, antes de contar os blocos livres
+	gravar(t, volume, "/a", "a")
+	livresAntes := blocosLivres(t, volume)
+	criarDiretorio(t, volume, "d")
+	criarDiretorio(t, volume, "d", "e")
+	gravar(t, volume, "/d/e/f", strings.Repeat("f", 10000))
+	var erro error
+	comEntrada(t, "d\n", func() { erro = meufs.RemoverArquivo(volume.Arquivo, volume.Cabecalho) })
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if livres := blocosLivres(t, volume); livres != livresAntes {
+		t.Fatalf("remover o diretório pelo menu deveria liberar os blocos de tudo dentro dele, faltam %d", livresAntes-livres)
+	}
+	verificar(t, volume)
+}
@@ -0,0 +1,366 @@
+package meufs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Constantes do protocolo NBD (handshake newstyle fixo e fase de transmissão)
+const (
+	magicNBD           = 0x4e42444d41474943 // "NBDMAGIC"
+	magicOpcaoNBD      = 0x49484156454f5054 // "IHAVEOPT"
+	magicRespostaOpNBD = 0x3e889045565a9
+	magicRequisicaoNBD = 0x25609513
+	magicRespostaNBD   = 0x67446698
+
+	flagNewstyleFixoNBD = 1 << 0
+	flagSemZerosNBD     = 1 << 1
+
+	opcaoNomeExportNBD = 1
+	opcaoAbortarNBD    = 2
+	opcaoListarNBD     = 3
+	opcaoInfoNBD       = 6
+	opcaoGoNBD         = 7
+
+	respostaAckNBD       = 1
+	respostaServidorNBD  = 2
+	respostaInfoNBD      = 3
+	respostaErroNBD      = 1 << 31
+	respostaNaoSuportNBD = respostaErroNBD + 1
+	infoExportNBD        = 0
+
+	flagTemFlagsNBD    = 1 << 0
+	flagSomenteLeitNBD = 1 << 1
+	flagEnviaFlushNBD  = 1 << 2
+	flagEnviaFUANBD    = 1 << 3
+	flagEnviaTrimNBD   = 1 << 5
+	comandoFUANBD      = 1 << 0
+
+	comandoLerNBD         = 0
+	comandoEscreverNBD    = 1
+	comandoDesconectarNBD = 2
+	comandoFlushNBD       = 3
+	comandoTrimNBD        = 4
+
+	erroEPERMNBD  = 1
+	erroEIONBD    = 5
+	erroEINVALNBD = 22
+	erroENOSPCNBD = 28
+
+	nomeExportNBD      = "meufs"
+	tamanhoMaximoIONBD = 32 * 1024 * 1024
+)
+
+// ServidorNBD expõe o meufs.fs inteiro (cabeçalho, root, FAT e dados) como um dispositivo de blocos de rede.
+// O tamanho do dispositivo é o tamanho real do arquivo, e não o do cabeçalho, que pode ser alterado pelo cliente.
+// O volume e a sua trava são os mesmos de quem mais o usar no processo, então o cabeçalho do disco e o do volume
+// precisam continuar iguais: uma escrita que deixaria no disco um cabeçalho que não pode ser lido é recusada
+type ServidorNBD struct {
+	volume         *Volume
+	tamanho        uint64
+	somenteLeitura bool
+}
+
+// NovoServidorNBD cria um servidor NBD para o volume informado
+func NovoServidorNBD(volume *Volume, somenteLeitura bool) (*ServidorNBD, error) {
+	info, erro := volume.Arquivo.Stat()
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao obter tamanho do meufs: %w", erro)
+	}
+	return &ServidorNBD{volume: volume, tamanho: uint64(info.Size()), somenteLeitura: somenteLeitura}, nil
+}
+
+// Servir aceita conexões do listener e atende cada uma em uma goroutine
+func (s *ServidorNBD) Servir(listener net.Listener) error {
+	for {
+		conn, erro := listener.Accept()
+		if erro != nil {
+			return fmt.Errorf("erro ao aceitar conexão: %w", erro)
+		}
+		go func() {
+			if erro := s.ServirConexao(conn); erro != nil {
+				fmt.Printf("conexão NBD encerrada: %v\n", erro)
+			}
+		}()
+	}
+}
+
+// ServirConexao faz o handshake e atende os comandos de uma conexão até o cliente desconectar
+func (s *ServidorNBD) ServirConexao(conn net.Conn) error {
+	defer conn.Close()
+	transmitir, erro := s.negociar(conn)
+	if erro != nil {
+		return erro
+	}
+	// O handshake terminou sem export escolhido (NBD_OPT_ABORT)
+	if !transmitir {
+		return nil
+	}
+	return s.transmitir(conn)
+}
+
+// flagsDeTransmissao informa ao cliente os comandos aceitos pelo servidor
+func (s *ServidorNBD) flagsDeTransmissao() uint16 {
+	flags := uint16(flagTemFlagsNBD | flagEnviaFlushNBD | flagEnviaFUANBD | flagEnviaTrimNBD)
+	if s.somenteLeitura {
+		flags |= flagSomenteLeitNBD
+	}
+	return flags
+}
+
+// negociar faz o handshake newstyle fixo. Retorna false se o cliente abortou sem escolher o export
+func (s *ServidorNBD) negociar(conn net.Conn) (bool, error) {
+	var inicio []byte
+	inicio = binary.BigEndian.AppendUint64(inicio, magicNBD)
+	inicio = binary.BigEndian.AppendUint64(inicio, magicOpcaoNBD)
+	inicio = binary.BigEndian.AppendUint16(inicio, flagNewstyleFixoNBD|flagSemZerosNBD)
+	if _, erro := conn.Write(inicio); erro != nil {
+		return false, erro
+	}
+	var flagsCliente uint32
+	if erro := binary.Read(conn, binary.BigEndian, &flagsCliente); erro != nil {
+		return false, fmt.Errorf("erro ao ler flags do cliente: %w", erro)
+	}
+	semZeros := flagsCliente&flagSemZerosNBD != 0
+	for {
+		var cabecalhoOpcao struct {
+			Magic   uint64
+			Opcao   uint32
+			Tamanho uint32
+		}
+		if erro := binary.Read(conn, binary.BigEndian, &cabecalhoOpcao); erro != nil {
+			return false, fmt.Errorf("erro ao ler opção do cliente: %w", erro)
+		}
+		if cabecalhoOpcao.Magic != magicOpcaoNBD {
+			return false, errors.New("magic de opção NBD inválido")
+		}
+		if cabecalhoOpcao.Tamanho > 4096 {
+			return false, errors.New("opção NBD grande demais")
+		}
+		dados := make([]byte, cabecalhoOpcao.Tamanho)
+		if _, erro := io.ReadFull(conn, dados); erro != nil {
+			return false, erro
+		}
+		switch cabecalhoOpcao.Opcao {
+		case opcaoNomeExportNBD:
+			// Resposta antiga: tamanho e flags sem cabeçalho de resposta, seguida da transmissão
+			var resposta []byte
+			resposta = binary.BigEndian.AppendUint64(resposta, s.tamanho)
+			resposta = binary.BigEndian.AppendUint16(resposta, s.flagsDeTransmissao())
+			if !semZeros {
+				resposta = append(resposta, make([]byte, 124)...)
+			}
+			_, erro := conn.Write(resposta)
+			return erro == nil, erro
+		case opcaoAbortarNBD:
+			return false, responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaAckNBD, nil)
+		case opcaoListarNBD:
+			var nome []byte
+			nome = binary.BigEndian.AppendUint32(nome, uint32(len(nomeExportNBD)))
+			nome = append(nome, nomeExportNBD...)
+			if erro := responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaServidorNBD, nome); erro != nil {
+				return false, erro
+			}
+			if erro := responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaAckNBD, nil); erro != nil {
+				return false, erro
+			}
+		case opcaoInfoNBD, opcaoGoNBD:
+			// Só há um export, então o nome pedido é ignorado
+			var info []byte
+			info = binary.BigEndian.AppendUint16(info, infoExportNBD)
+			info = binary.BigEndian.AppendUint64(info, s.tamanho)
+			info = binary.BigEndian.AppendUint16(info, s.flagsDeTransmissao())
+			if erro := responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaInfoNBD, info); erro != nil {
+				return false, erro
+			}
+			if erro := responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaAckNBD, nil); erro != nil {
+				return false, erro
+			}
+			if cabecalhoOpcao.Opcao == opcaoGoNBD {
+				return true, nil
+			}
+		default:
+			if erro := responderOpcaoNBD(conn, cabecalhoOpcao.Opcao, respostaNaoSuportNBD, nil); erro != nil {
+				return false, erro
+			}
+		}
+	}
+}
+
+// responderOpcaoNBD envia uma resposta da fase de negociação
+func responderOpcaoNBD(conn net.Conn, opcao uint32, tipo uint32, dados []byte) error {
+	var resposta []byte
+	resposta = binary.BigEndian.AppendUint64(resposta, magicRespostaOpNBD)
+	resposta = binary.BigEndian.AppendUint32(resposta, opcao)
+	resposta = binary.BigEndian.AppendUint32(resposta, tipo)
+	resposta = binary.BigEndian.AppendUint32(resposta, uint32(len(dados)))
+	resposta = append(resposta, dados...)
+	_, erro := conn.Write(resposta)
+	return erro
+}
+
+// responderNBD envia uma resposta simples a um comando, seguida dos dados lidos se houver
+func responderNBD(conn net.Conn, codigoErro uint32, handle uint64, dados []byte) error {
+	var resposta []byte
+	resposta = binary.BigEndian.AppendUint32(resposta, magicRespostaNBD)
+	resposta = binary.BigEndian.AppendUint32(resposta, codigoErro)
+	resposta = binary.BigEndian.AppendUint64(resposta, handle)
+	resposta = append(resposta, dados...)
+	_, erro := conn.Write(resposta)
+	return erro
+}
+
+// transmitir atende os comandos de leitura, escrita, flush e trim até o cliente desconectar
+func (s *ServidorNBD) transmitir(conn net.Conn) error {
+	for {
+		var requisicao struct {
+			Magic   uint32
+			Flags   uint16
+			Tipo    uint16
+			Handle  uint64
+			Offset  uint64
+			Tamanho uint32
+		}
+		if erro := binary.Read(conn, binary.BigEndian, &requisicao); erro != nil {
+			if errors.Is(erro, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("erro ao ler comando NBD: %w", erro)
+		}
+		if requisicao.Magic != magicRequisicaoNBD {
+			return errors.New("magic de comando NBD inválido")
+		}
+		switch requisicao.Tipo {
+		case comandoLerNBD:
+			dados, codigo := s.ler(requisicao.Offset, requisicao.Tamanho)
+			if codigo != 0 {
+				dados = nil
+			}
+			if erro := responderNBD(conn, codigo, requisicao.Handle, dados); erro != nil {
+				return erro
+			}
+		case comandoEscreverNBD:
+			if requisicao.Tamanho > tamanhoMaximoIONBD {
+				return errors.New("escrita NBD grande demais")
+			}
+			dados := make([]byte, requisicao.Tamanho)
+			if _, erro := io.ReadFull(conn, dados); erro != nil {
+				return erro
+			}
+			codigo := s.escrever(requisicao.Offset, dados, requisicao.Flags&comandoFUANBD != 0)
+			if erro := responderNBD(conn, codigo, requisicao.Handle, nil); erro != nil {
+				return erro
+			}
+		case comandoFlushNBD:
+			if erro := responderNBD(conn, s.flush(), requisicao.Handle, nil); erro != nil {
+				return erro
+			}
+		case comandoTrimNBD:
+			// O trecho descartado passa a ser lido como zeros
+			codigo := uint32(erroEINVALNBD)
+			if requisicao.Tamanho <= tamanhoMaximoIONBD {
+				codigo = s.escrever(requisicao.Offset, make([]byte, requisicao.Tamanho), requisicao.Flags&comandoFUANBD != 0)
+			}
+			if erro := responderNBD(conn, codigo, requisicao.Handle, nil); erro != nil {
+				return erro
+			}
+		case comandoDesconectarNBD:
+			// O cliente espera que tudo esteja no disco ao desconectar
+			s.flush()
+			return nil
+		default:
+			if erro := responderNBD(conn, erroEINVALNBD, requisicao.Handle, nil); erro != nil {
+				return erro
+			}
+		}
+	}
+}
+
+// foraDoVolume verifica se o intervalo pedido ultrapassa o tamanho do meufs.fs
+func (s *ServidorNBD) foraDoVolume(offset uint64, tamanho uint32) bool {
+	return offset+uint64(tamanho) > s.tamanho || tamanho > tamanhoMaximoIONBD
+}
+
+func (s *ServidorNBD) ler(offset uint64, tamanho uint32) ([]byte, uint32) {
+	s.volume.Lock()
+	defer s.volume.Unlock()
+	if s.foraDoVolume(offset, tamanho) {
+		return nil, erroEINVALNBD
+	}
+	dados := make([]byte, tamanho)
+	if _, erro := s.volume.Arquivo.ReadAt(dados, int64(offset)); erro != nil {
+		return nil, erroEIONBD
+	}
+	return dados, 0
+}
+
+// escrever grava os bytes no meufs.fs. Se a escrita alcançar o cabeçalho, o cabeçalho que ela deixaria no disco é
+// conferido antes e só então passa a ser o do volume compartilhado, para que os dois nunca fiquem diferentes
+func (s *ServidorNBD) escrever(offset uint64, dados []byte, fua bool) uint32 {
+	s.volume.Lock()
+	defer s.volume.Unlock()
+	if s.somenteLeitura {
+		return erroEPERMNBD
+	}
+	if s.foraDoVolume(offset, uint32(len(dados))) {
+		return erroENOSPCNBD
+	}
+	cabecalho := s.volume.Cabecalho
+	if tamanho := uint64(binary.Size(Cabecalho{})); offset < tamanho {
+		bruto := make([]byte, tamanho)
+		if _, erro := s.volume.Arquivo.ReadAt(bruto, 0); erro != nil {
+			return erroEIONBD
+		}
+		copy(bruto[offset:], dados)
+		var erro error
+		if cabecalho, erro = decodificarCabecalho(bruto); erro != nil {
+			return erroEINVALNBD
+		}
+	}
+	if _, erro := s.volume.Arquivo.WriteAt(dados, int64(offset)); erro != nil {
+		// Uma escrita pela metade pode ter chegado ao cabeçalho, que é relido do disco
+		if lido, erroCabecalho := LerCabecalho(s.volume.Arquivo); erroCabecalho == nil {
+			s.volume.Cabecalho = lido
+		}
+		return erroEIONBD
+	}
+	s.volume.Cabecalho = cabecalho
+	if fua {
+		if erro := s.volume.Arquivo.Sync(); erro != nil {
+			return erroEIONBD
+		}
+	}
+	return 0
+}
+
+func (s *ServidorNBD) flush() uint32 {
+	s.volume.Lock()
+	defer s.volume.Unlock()
+	if erro := s.volume.Arquivo.Sync(); erro != nil {
+		return erroEIONBD
+	}
+	return 0
+}
+
+// ServirDispositivoNBD escuta no endereço informado e atende clientes NBD até ocorrer um erro. O volume é
+// compartilhado com quem mais o usar, sob a mesma trava
+func ServirDispositivoNBD(volume *Volume, endereco string, somenteLeitura bool) error {
+	rede, caminho, erro := EnderecoDeRede(endereco)
+	if erro != nil {
+		return erro
+	}
+	listener, erro := net.Listen(rede, caminho)
+	if erro != nil {
+		return fmt.Errorf("erro ao escutar em %s: %w", endereco, erro)
+	}
+	defer listener.Close()
+	fmt.Printf("servidor NBD escutando em %s\n", endereco)
+	servidor, erro := NovoServidorNBD(volume, somenteLeitura)
+	if erro != nil {
+		return erro
+	}
+	return servidor.Servir(listener)
+}
@@ -0,0 +1,206 @@
+package meufs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"meufs"
+)
+
+// clienteNBD é um cliente NBD mínimo, do lado de cá de um net.Pipe ligado ao servidor
+type clienteNBD struct {
+	t       *testing.T
+	conn    net.Conn
+	tamanho uint64
+	flags   uint16
+	handle  uint64
+}
+
+// conectarNBD atende uma conexão em memória com o servidor e faz o handshake newstyle fixo com NBD_OPT_GO
+func conectarNBD(t *testing.T, volume *meufs.Volume, somenteLeitura bool) *clienteNBD {
+	t.Helper()
+	servidor, erro := meufs.NovoServidorNBD(volume, somenteLeitura)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	conn, lado := net.Pipe()
+	encerrado := make(chan error, 1)
+	go func() { encerrado <- servidor.ServirConexao(lado) }()
+	t.Cleanup(func() {
+		conn.Close()
+		<-encerrado
+	})
+	cliente := &clienteNBD{t: t, conn: conn}
+
+	var inicio struct {
+		Magic, MagicOpcao uint64
+		Flags             uint16
+	}
+	cliente.ler(&inicio)
+	if inicio.Magic != 0x4e42444d41474943 || inicio.MagicOpcao != 0x49484156454f5054 {
+		t.Fatalf("magics do handshake inválidos: %x %x", inicio.Magic, inicio.MagicOpcao)
+	}
+	// Newstyle fixo e sem os 124 zeros, seguido de NBD_OPT_GO com o nome vazio e nenhum pedido de info
+	cliente.escrever(uint32(3))
+	cliente.escrever(struct {
+		Magic           uint64
+		Opcao, Tamanho  uint32
+		TamanhoNome     uint32
+		QuantidadeInfos uint16
+	}{0x49484156454f5054, 7, 6, 0, 0})
+	for {
+		var resposta struct {
+			Magic                uint64
+			Opcao, Tipo, Tamanho uint32
+		}
+		cliente.ler(&resposta)
+		if resposta.Magic != 0x3e889045565a9 || resposta.Opcao != 7 {
+			t.Fatalf("resposta de opção inválida: %+v", resposta)
+		}
+		if resposta.Tipo == 1 {
+			break
+		}
+		var info struct {
+			Tipo    uint16
+			Tamanho uint64
+			Flags   uint16
+		}
+		if resposta.Tipo != 3 || resposta.Tamanho != 12 {
+			t.Fatalf("o servidor deveria responder NBD_OPT_GO com NBD_REP_INFO, respondeu %+v", resposta)
+		}
+		cliente.ler(&info)
+		cliente.tamanho, cliente.flags = info.Tamanho, info.Flags
+	}
+	return cliente
+}
+
+func (c *clienteNBD) ler(dados any) {
+	c.t.Helper()
+	if erro := binary.Read(c.conn, binary.BigEndian, dados); erro != nil {
+		c.t.Fatal(erro)
+	}
+}
+
+func (c *clienteNBD) escrever(dados any) {
+	c.t.Helper()
+	if erro := binary.Write(c.conn, binary.BigEndian, dados); erro != nil {
+		c.t.Fatal(erro)
+	}
+}
+
+// comando envia um comando da fase de transmissão, com os dados de uma escrita, e retorna o código de erro da
+// resposta e os dados de uma leitura que deu certo
+func (c *clienteNBD) comando(tipo uint16, offset uint64, tamanho uint32, dados []byte) (uint32, []byte) {
+	c.t.Helper()
+	c.handle++
+	c.escrever(struct {
+		Magic       uint32
+		Flags, Tipo uint16
+		Handle      uint64
+		Offset      uint64
+		Tamanho     uint32
+	}{0x25609513, 0, tipo, c.handle, offset, tamanho})
+	if dados != nil {
+		if _, erro := c.conn.Write(dados); erro != nil {
+			c.t.Fatal(erro)
+		}
+	}
+	var resposta struct {
+		Magic, Erro uint32
+		Handle      uint64
+	}
+	c.ler(&resposta)
+	if resposta.Magic != 0x67446698 || resposta.Handle != c.handle {
+		c.t.Fatalf("resposta de comando inválida: %+v", resposta)
+	}
+	if tipo != 0 || resposta.Erro != 0 {
+		return resposta.Erro, nil
+	}
+	lido := make([]byte, tamanho)
+	if _, erro := io.ReadFull(c.conn, lido); erro != nil {
+		c.t.Fatal(erro)
+	}
+	return 0, lido
+}
+
+func TestServidorNBD(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", "conteúdo")
+	info, erro := volume.Arquivo.Stat()
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	cliente := conectarNBD(t, volume, false)
+	if cliente.tamanho != uint64(info.Size()) {
+		t.Fatalf("o dispositivo deveria ter o tamanho do meufs.fs, %d, e tem %d", info.Size(), cliente.tamanho)
+	}
+	if cliente.flags&(1<<1) != 0 || cliente.flags&(1<<2) == 0 || cliente.flags&(1<<5) == 0 {
+		t.Fatalf("o dispositivo deveria aceitar escritas, flush e trim, flags %b", cliente.flags)
+	}
+
+	// Escrita, leitura e flush no último bloco, que o meufs ainda não usa
+	offset := cliente.tamanho - 4096
+	dados := bytes.Repeat([]byte("nbd!"), 1024)
+	if codigo, _ := cliente.comando(1, offset, uint32(len(dados)), dados); codigo != 0 {
+		t.Fatalf("a escrita falhou com o código %d", codigo)
+	}
+	if codigo, lido := cliente.comando(0, offset, uint32(len(dados)), nil); codigo != 0 || !bytes.Equal(lido, dados) {
+		t.Fatalf("a leitura deveria devolver o que foi escrito, código %d", codigo)
+	}
+	if codigo, _ := cliente.comando(3, 0, 0, nil); codigo != 0 {
+		t.Fatalf("o flush falhou com o código %d", codigo)
+	}
+	// O trim zera o trecho descartado
+	if codigo, _ := cliente.comando(4, offset+100, 200, nil); codigo != 0 {
+		t.Fatalf("o trim falhou com o código %d", codigo)
+	}
+	copy(dados[100:300], make([]byte, 200))
+	if _, lido := cliente.comando(0, offset, uint32(len(dados)), nil); !bytes.Equal(lido, dados) {
+		t.Fatal("o trecho descartado pelo trim deveria ser lido como zeros")
+	}
+	if codigo, _ := cliente.comando(0, cliente.tamanho-10, 20, nil); codigo != 22 {
+		t.Fatalf("ler além do fim do dispositivo deveria falhar com EINVAL, falhou com %d", codigo)
+	}
+
+	// Reescrever o mesmo cabeçalho é aceito, mas um que não pode ser lido é recusado sem alterar o disco nem o volume
+	_, cabecalho := cliente.comando(0, 0, 512, nil)
+	if codigo, _ := cliente.comando(1, 0, 512, cabecalho); codigo != 0 {
+		t.Fatalf("reescrever o cabeçalho falhou com o código %d", codigo)
+	}
+	if codigo, _ := cliente.comando(1, 0, 512, make([]byte, 512)); codigo != 22 {
+		t.Fatalf("zerar o cabeçalho deveria falhar com EINVAL, falhou com %d", codigo)
+	}
+	if codigo, _ := cliente.comando(4, 0, 512, nil); codigo != 22 {
+		t.Fatalf("descartar o cabeçalho deveria falhar com EINVAL, falhou com %d", codigo)
+	}
+	if _, lido := cliente.comando(0, 0, 512, nil); !bytes.Equal(lido, cabecalho) {
+		t.Fatal("o cabeçalho recusado não deveria ter chegado ao disco")
+	}
+	// O volume é o mesmo do servidor e continua legível pela API de arquivos
+	if texto := conteudo(t, volume, "/a.txt"); texto != "conteúdo" {
+		t.Fatalf("a.txt deveria continuar com o conteúdo original, tem %q", texto)
+	}
+	verificar(t, volume)
+}
+
+func TestServidorNBDSomenteLeitura(t *testing.T) {
+	volume := novoVolume(t)
+	cliente := conectarNBD(t, volume, true)
+	if cliente.flags&(1<<1) == 0 {
+		t.Fatalf("o dispositivo deveria ser anunciado como somente leitura, flags %b", cliente.flags)
+	}
+	offset := cliente.tamanho - 4096
+	_, antes := cliente.comando(0, offset, 4096, nil)
+	if codigo, _ := cliente.comando(1, offset, 4096, bytes.Repeat([]byte{1}, 4096)); codigo != 1 {
+		t.Fatalf("a escrita deveria falhar com EPERM, falhou com %d", codigo)
+	}
+	if codigo, _ := cliente.comando(4, offset, 4096, nil); codigo != 1 {
+		t.Fatalf("o trim deveria falhar com EPERM, falhou com %d", codigo)
+	}
+	if _, depois := cliente.comando(0, offset, 4096, nil); !bytes.Equal(antes, depois) {
+		t.Fatal("o dispositivo somente leitura não deveria ter sido alterado")
+	}
+}
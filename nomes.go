@@ -0,0 +1,155 @@
+package meufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Nomes longos são guardados como nos nomes longos do VFAT: a entrada principal leva os primeiros bytes do nome
+// em NomeArquivo e, se o nome não couber, é seguida por entradas de continuação. Uma entrada de continuação
+// tem EhDir igual a marcadorContinuacao e todos os seus outros bytes são a continuação do nome, completada com zeros
+
+// TamanhoMaximoNome é o maior nome aceito, em bytes (não em caracteres)
+const TamanhoMaximoNome = 255
+
+// marcadorContinuacao é o valor de EhDir que marca uma entrada de continuação de nome
+const marcadorContinuacao uint8 = 0xFF
+
+// posicaoEhDir é a posição de EhDir na entrada gravada: NomeArquivo (20) + EnderecoFAT (4) + Tamanho (4) + Atributos (1)
+const posicaoEhDir = 29
+
+// bytesPorContinuacao retorna quantos bytes do nome cabem em uma entrada de continuação
+func bytesPorContinuacao() int {
+	return binary.Size(DiretorioRoot{}) - 1
+}
+
+// EntradasParaNome retorna quantas entradas do diretório o nome ocupa, contando a principal
+func EntradasParaNome(nome string) int {
+	resto := max(len(nome)-len(DiretorioRoot{}.NomeArquivo), 0)
+	return 1 + (resto+bytesPorContinuacao()-1)/bytesPorContinuacao()
+}
+
+// ValidarNome verifica se um nome pode ser guardado em uma entrada de diretório
+func ValidarNome(nome string) error {
+	if nome == "" || nome == "." || nome == ".." {
+		return fmt.Errorf("nome inválido: '%s'", nome)
+	}
+	if strings.ContainsAny(nome, "/\x00") {
+		return errors.New("nome não pode conter '/' nem bytes nulos")
+	}
+	if !utf8.ValidString(nome) {
+		return errors.New("nome não é um texto UTF-8 válido")
+	}
+	if len(nome) > TamanhoMaximoNome {
+		return fmt.Errorf("nome não pode ter mais de %d bytes (tem %d bytes em %d caracteres)", TamanhoMaximoNome, len(nome), utf8.RuneCountInString(nome))
+	}
+	return nil
+}
+
+// ehContinuacao informa se a entrada guarda só a continuação do nome da entrada anterior
+func ehContinuacao(entrada DiretorioRoot) bool {
+	return entrada.NomeArquivo[0] != 0 && entrada.EhDir == marcadorContinuacao
+}
+
+// DecodificarNomes monta o nome completo de cada entrada principal. Entradas livres e de continuação ficam com ""
+func DecodificarNomes(entradas []DiretorioRoot) []string {
+	nomes := make([]string, len(entradas))
+	for indice := 0; indice < len(entradas); indice++ {
+		entrada := entradas[indice]
+		if entrada.NomeArquivo[0] == 0 || ehContinuacao(entrada) {
+			continue
+		}
+		nome := bytes.TrimRight(entrada.NomeArquivo[:], "\x00")
+		for proxima := indice + 1; proxima < len(entradas) && ehContinuacao(entradas[proxima]); proxima++ {
+			nome = append(nome, bytes.TrimRight(bytesDaContinuacao(entradas[proxima]), "\x00")...)
+		}
+		nomes[indice] = string(nome)
+	}
+	return nomes
+}
+
+// bytesDaContinuacao retorna os bytes do nome guardados em uma entrada de continuação
+func bytesDaContinuacao(entrada DiretorioRoot) []byte {
+	var gravada bytes.Buffer
+	binary.Write(&gravada, binary.LittleEndian, entrada)
+	return append(gravada.Bytes()[:posicaoEhDir:posicaoEhDir], gravada.Bytes()[posicaoEhDir+1:]...)
+}
+
+// entradaDeContinuacao monta uma entrada de continuação com os bytes do nome informados
+func entradaDeContinuacao(parte []byte) DiretorioRoot {
+	gravada := make([]byte, binary.Size(DiretorioRoot{}))
+	copy(gravada, parte[:min(len(parte), posicaoEhDir)])
+	if len(parte) > posicaoEhDir {
+		copy(gravada[posicaoEhDir+1:], parte[posicaoEhDir:])
+	}
+	gravada[posicaoEhDir] = marcadorContinuacao
+	var entrada DiretorioRoot
+	binary.Read(bytes.NewReader(gravada), binary.LittleEndian, &entrada)
+	return entrada
+}
+
+// EscreverEntrada grava a entrada e seu nome a partir do índice, que deve ter EntradasParaNome(nome) entradas livres.
+// Só altera o diretório em memória
+func EscreverEntrada(dir *Diretorio, indice int, entrada DiretorioRoot, nome string) {
+	entrada.NomeArquivo = [20]byte{}
+	tamanhoPrincipal := copy(entrada.NomeArquivo[:], nome)
+	dir.Entradas[indice] = entrada
+	dir.Nomes[indice] = nome
+	resto := []byte(nome[tamanhoPrincipal:])
+	for proxima := indice + 1; len(resto) > 0; proxima++ {
+		parte := resto[:min(len(resto), bytesPorContinuacao())]
+		dir.Entradas[proxima] = entradaDeContinuacao(parte)
+		dir.Nomes[proxima] = ""
+		resto = resto[len(parte):]
+	}
+}
+
+// LiberarEntrada apaga a entrada principal do índice e suas entradas de continuação. Só altera o diretório em memória
+func LiberarEntrada(dir *Diretorio, indice int) {
+	dir.Entradas[indice] = DiretorioRoot{}
+	dir.Nomes[indice] = ""
+	for proxima := indice + 1; proxima < len(dir.Entradas) && ehContinuacao(dir.Entradas[proxima]); proxima++ {
+		dir.Entradas[proxima] = DiretorioRoot{}
+	}
+}
+
+// BuscarEntrada retorna o índice da entrada principal com o nome informado ou -1 se ela não existir
+func BuscarEntrada(dir Diretorio, nome string) int {
+	for indice, nomeDaEntrada := range dir.Nomes {
+		if nomeDaEntrada != "" && nomeDaEntrada == nome {
+			return indice
+		}
+	}
+	return -1
+}
+
+// EntradaLivre retorna o índice do primeiro trecho de entradas livres onde o nome cabe ou -1 se não houver espaço
+func EntradaLivre(dir Diretorio, nome string) int {
+	necessarias := EntradasParaNome(nome)
+	livresSeguidas := 0
+	for indice, entrada := range dir.Entradas {
+		if entrada.NomeArquivo[0] != 0 {
+			livresSeguidas = 0
+			continue
+		}
+		livresSeguidas++
+		if livresSeguidas == necessarias {
+			return indice - necessarias + 1
+		}
+	}
+	return -1
+}
+
+// DiretorioVazio informa se o diretório não tem nenhuma entrada
+func DiretorioVazio(dir Diretorio) bool {
+	for _, nome := range dir.Nomes {
+		if nome != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package meufs_test
+
+import (
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestValidarNome(t *testing.T) {
+	validos := []string{"a", strings.Repeat("n", 255), strings.Repeat("日", 85), "com espaço.txt", ".oculto"}
+	for _, nome := range validos {
+		if erro := meufs.ValidarNome(nome); erro != nil {
+			t.Errorf("%d bytes em %q... deveriam ser aceitos: %v", len(nome), nome[:min(len(nome), 10)], erro)
+		}
+	}
+	// 86 caracteres de 3 bytes passam de 255 bytes, mesmo sendo menos de 255 caracteres
+	invalidos := []string{"", ".", "..", strings.Repeat("n", 256), strings.Repeat("日", 86), "a/b", "a\x00b", "a\xffb"}
+	for _, nome := range invalidos {
+		if erro := meufs.ValidarNome(nome); erro == nil {
+			t.Errorf("%q deveria ser recusado", nome)
+		}
+	}
+}
+
+func TestNomesLongos(t *testing.T) {
+	volume := novoVolume(t)
+	// Nomes no limite da entrada principal, logo depois dele e no tamanho máximo, com caracteres de vários bytes
+	nomes := []string{
+		strings.Repeat("v", 20),
+		strings.Repeat("w", 21),
+		strings.Repeat("ação", 42),
+		strings.Repeat("x", 255),
+	}
+	for _, nome := range nomes {
+		gravar(t, volume, "/"+nome, nome)
+	}
+	infos, erro := meufs.ListarDiretorio(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, false)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if len(infos) != len(nomes) {
+		t.Fatalf("deveriam ser listadas %d entradas, foram %d", len(nomes), len(infos))
+	}
+	for i, nome := range nomes {
+		if infos[i].Nome != nome {
+			t.Fatalf("o nome %d deveria voltar inteiro, voltou com %d bytes", i, len(infos[i].Nome))
+		}
+		if texto := conteudo(t, volume, "/"+nome); texto != nome {
+			t.Fatalf("o arquivo de nome com %d bytes tem o conteúdo errado", len(nome))
+		}
+	}
+
+	// Renomear para um nome curto e apagar liberam as entradas de continuação, que podem ser usadas de novo
+	longo := []string{nomes[3]}
+	if _, erro = meufs.RenomearEntradaComPolitica(volume.Cabecalho, volume.Arquivo, volume.Identidade, longo, "curto", meufs.DuplicadoFalhar); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{nomes[2]}); erro != nil {
+		t.Fatal(erro)
+	}
+	root, erro := meufs.LerDiretorioRaiz(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	usadas := 0
+	for _, entrada := range root.Entradas {
+		if entrada.NomeArquivo[0] != 0 {
+			usadas++
+		}
+	}
+	if esperadas := meufs.EntradasParaNome(nomes[0]) + meufs.EntradasParaNome(nomes[1]) + 1; usadas != esperadas {
+		t.Fatalf("o root deveria usar %d entradas, usa %d", esperadas, usadas)
+	}
+	if _, erro = volume.Create("/" + strings.Repeat("y", 256)); erro == nil {
+		t.Fatal("um nome com mais de 255 bytes deveria ser recusado")
+	}
+	verificar(t, volume)
+}
@@ -0,0 +1,438 @@
+package meufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// FimDaCadeia é o valor da FAT que marca o último bloco de um arquivo
+const FimDaCadeia uint32 = 0xFFFFFFFF
+
+// SemBlocos é o EnderecoFAT de arquivos vazios, que não ocupam nenhum bloco.
+// Nunca é um índice válido da FAT, já que a área de dados tem bem menos de 2^32 blocos
+const SemBlocos uint32 = 0xFFFFFFFF
+
+// Volume agrupa o arquivo meufs.fs aberto e seu cabeçalho.
+// A trava serializa o acesso quando várias conexões (servidores de rede) usam o mesmo volume.
+// A Identidade é usada para conferir as permissões na API de arquivos (OpenFile, Open, Create)
+type Volume struct {
+	sync.Mutex
+	Arquivo    *MeuFS
+	Cabecalho  Cabecalho
+	Identidade Identidade
+	// SenhaArquivos abre os arquivos cifrados nos handles e no servidor 9P. Sem ela, o conteúdo deles não pode ser
+	// lido nem alterado, só apagado
+	SenhaArquivos string
+}
+
+// ErroFS é um erro com mensagem própria que errors.Is também reconhece como um dos erros do pacote io/fs
+// (fs.ErrNotExist, fs.ErrExist, fs.ErrPermission...), permitindo tratá-lo como os erros do pacote os
+type ErroFS struct {
+	Mensagem string
+	Tipo     error
+}
+
+func (e *ErroFS) Error() string { return e.Mensagem }
+func (e *ErroFS) Unwrap() error { return e.Tipo }
+
+// NovoErroFS cria um ErroFS do tipo informado com a mensagem formatada
+func NovoErroFS(tipo error, formato string, argumentos ...any) error {
+	return &ErroFS{Mensagem: fmt.Sprintf(formato, argumentos...), Tipo: tipo}
+}
+
+// Diretorio representa um diretório do meufs e suas entradas.
+// O root fica na área fixa após o cabeçalho, os demais diretórios ocupam um bloco da área de dados
+type Diretorio struct {
+	EhRoot   bool
+	Bloco    uint32
+	Entradas []DiretorioRoot
+	Nomes    []string // Nome completo de cada entrada principal, "" nas entradas livres e de continuação
+}
+
+// EntradasPorBloco retorna quantas entradas cabem no bloco de um subdiretório
+func EntradasPorBloco(cabecalho Cabecalho) int {
+	return int(cabecalho.TamanhoBloco) / binary.Size(DiretorioRoot{})
+}
+
+// PosicaoDoBloco retorna a posição no meufs.fs do bloco de dados informado
+func PosicaoDoBloco(cabecalho Cabecalho, bloco uint32) int64 {
+	return int64(cabecalho.InicioDados) + int64(bloco)*int64(cabecalho.TamanhoBloco)
+}
+
+// ErrCadeiaCorrompida é o tipo do ErroFS retornado por CadeiaDeBlocos quando a FAT aponta para fora dela, para um
+// bloco livre ou tem um laço. O fsck mostra onde está o problema
+var ErrCadeiaCorrompida = errors.New("cadeia de blocos corrompida")
+
+// CadeiaDeBlocos segue a FAT a partir do bloco inicial e retorna todos os blocos do arquivo.
+// Arquivos vazios (inicio igual a SemBlocos) não têm blocos. Uma cadeia nunca tem mais blocos que a FAT, então
+// passar disso é sinal de um laço
+func CadeiaDeBlocos(fat []uint32, inicio uint32) ([]uint32, error) {
+	if inicio == SemBlocos {
+		return nil, nil
+	}
+	var blocos []uint32
+	for bloco := inicio; bloco != FimDaCadeia; bloco = fat[bloco] {
+		if bloco >= uint32(len(fat)) || fat[bloco] == 0 {
+			return nil, NovoErroFS(ErrCadeiaCorrompida, "a cadeia do bloco %d passa pelo bloco %d, fora da FAT ou livre (rode o fsck)", inicio, bloco)
+		}
+		if len(blocos) == len(fat) {
+			return nil, NovoErroFS(ErrCadeiaCorrompida, "a cadeia do bloco %d tem um laço (rode o fsck)", inicio)
+		}
+		blocos = append(blocos, bloco)
+	}
+	return blocos, nil
+}
+
+// LerDiretorioRaiz lê o root como um Diretorio
+func LerDiretorioRaiz(cabecalho Cabecalho, meuFS *MeuFS) (Diretorio, error) {
+	root, erro := LerRoot(cabecalho, meuFS)
+	if erro != nil {
+		return Diretorio{}, erro
+	}
+	return Diretorio{EhRoot: true, Entradas: root, Nomes: DecodificarNomes(root)}, nil
+}
+
+// LerSubdiretorio lê as entradas do diretório guardado no bloco informado
+func LerSubdiretorio(cabecalho Cabecalho, meuFS *MeuFS, bloco uint32) (Diretorio, error) {
+	entradas := make([]DiretorioRoot, EntradasPorBloco(cabecalho))
+	// Posicionando ponteiro no bloco do diretório
+	_, erro := meuFS.Seek(PosicaoDoBloco(cabecalho, bloco), 0)
+	if erro != nil {
+		return Diretorio{}, fmt.Errorf("erro ao posicionar o ponteiro no bloco do diretorio: %w", erro)
+	}
+	// Lendo entradas
+	erro = binary.Read(meuFS, binary.LittleEndian, &entradas)
+	if erro != nil {
+		return Diretorio{}, fmt.Errorf("erro ao ler diretorio: %w", erro)
+	}
+	return Diretorio{Bloco: bloco, Entradas: entradas, Nomes: DecodificarNomes(entradas)}, nil
+}
+
+// SalvarDiretorio escreve as entradas do diretório de volta no meufs.fs
+func SalvarDiretorio(cabecalho Cabecalho, meuFS *MeuFS, dir Diretorio) error {
+	posicao := int64(cabecalho.InicioRoot)
+	if !dir.EhRoot {
+		posicao = PosicaoDoBloco(cabecalho, dir.Bloco)
+	}
+	// movendo ponteiro
+	_, erro := meuFS.Seek(posicao, 0)
+	if erro != nil {
+		return fmt.Errorf("erro ao posicionar o ponteiro no diretorio: %w", erro)
+	}
+	// escrevendo diretorio atualizado
+	erro = binary.Write(meuFS, binary.LittleEndian, dir.Entradas)
+	if erro != nil {
+		return fmt.Errorf("erro ao escrever diretorio atualizado: %w", erro)
+	}
+	return nil
+}
+
+// SalvarFAT escreve a FAT de volta no meufs.fs
+func SalvarFAT(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32) error {
+	// movendo ponteiro
+	_, erro := meuFS.Seek(int64(cabecalho.InicioFAT), 0)
+	if erro != nil {
+		return fmt.Errorf("erro ao posicionar ponteiro no inicio da FAT: %w", erro)
+	}
+	// escrevendo fat atualizada
+	erro = binary.Write(meuFS, binary.LittleEndian, fat)
+	if erro != nil {
+		return fmt.Errorf("erro ao escrever FAT atualizada: %w", erro)
+	}
+	return nil
+}
+
+// DividirCaminho separa um caminho do meufs em seus componentes, ignorando barras repetidas
+func DividirCaminho(caminho string) []string {
+	var partes []string
+	for _, parte := range strings.Split(caminho, "/") {
+		if parte != "" && parte != "." {
+			partes = append(partes, parte)
+		}
+	}
+	return partes
+}
+
+// AbrirDiretorio percorre os componentes a partir do root e retorna o diretório indicado
+func AbrirDiretorio(cabecalho Cabecalho, meuFS *MeuFS, partes []string) (Diretorio, error) {
+	dir, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return Diretorio{}, erro
+	}
+	for _, parte := range partes {
+		indice := BuscarEntrada(dir, parte)
+		if indice == -1 {
+			return Diretorio{}, NovoErroFS(fs.ErrNotExist, "diretorio '%s' não existe", parte)
+		}
+		if dir.Entradas[indice].EhDir != 1 {
+			return Diretorio{}, fmt.Errorf("'%s' não é um diretorio", parte)
+		}
+		dir, erro = LerSubdiretorio(cabecalho, meuFS, dir.Entradas[indice].EnderecoFAT)
+		if erro != nil {
+			return Diretorio{}, erro
+		}
+	}
+	return dir, nil
+}
+
+// ResolverCaminho retorna o diretório que contém o último componente do caminho e o índice da entrada nele
+func ResolverCaminho(cabecalho Cabecalho, meuFS *MeuFS, partes []string) (Diretorio, int, error) {
+	if len(partes) == 0 {
+		return Diretorio{}, -1, NovoErroFS(fs.ErrInvalid, "caminho vazio")
+	}
+	dir, erro := AbrirDiretorio(cabecalho, meuFS, partes[:len(partes)-1])
+	if erro != nil {
+		return Diretorio{}, -1, erro
+	}
+	nome := partes[len(partes)-1]
+	indice := BuscarEntrada(dir, nome)
+	if indice == -1 {
+		return Diretorio{}, -1, NovoErroFS(fs.ErrNotExist, "'%s' não existe no sistema de arquivos meufs", nome)
+	}
+	return dir, indice, nil
+}
+
+// LerConteudo lê os blocos de um arquivo e retorna seus bytes até o tamanho guardado na entrada.
+// A cifra é a do arquivo aberta com AbrirCifra, ou nil se ele não for cifrado
+func LerConteudo(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot, cifra *CifraArquivo) ([]byte, error) {
+	conteudo := bytes.NewBuffer(make([]byte, 0, entrada.Tamanho))
+	if erro := CopiarConteudo(cabecalho, meuFS, entrada, cifra, conteudo, 0, int64(entrada.Tamanho)); erro != nil {
+		return nil, erro
+	}
+	return conteudo.Bytes(), nil
+}
+
+// CopiarConteudo escreve no destino, bloco a bloco, até quantidade bytes do arquivo a partir do offset.
+// A cópia nunca passa do tamanho guardado na entrada. Arquivos cifrados são decifrados com a cifra, e sem ela
+// retornam ErrArquivoCifrado. Arquivos comprimidos são descomprimidos
+func CopiarConteudo(cabecalho Cabecalho, meuFS *MeuFS, entrada DiretorioRoot, cifra *CifraArquivo, destino io.Writer, offset int64, quantidade int64) error {
+	if offset < 0 || quantidade < 0 {
+		return errors.New("offset e quantidade não podem ser negativos")
+	}
+	if entrada.Atributos&AtributoCifrado != 0 && cifra == nil {
+		return ErrArquivoCifrado
+	}
+	fim := min(offset+quantidade, int64(entrada.Tamanho))
+	if offset >= fim {
+		return nil
+	}
+	if entrada.Atributos&AtributoCifrado != 0 {
+		return copiarCifrado(cabecalho, meuFS, entrada, cifra, destino, offset, fim)
+	}
+	if entrada.Atributos&AtributoComprimido != 0 {
+		return copiarComprimido(cabecalho, meuFS, entrada, destino, offset, fim)
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+	if erro != nil {
+		return erro
+	}
+	tamanhoBloco := int64(cabecalho.TamanhoBloco)
+	bloco := make([]byte, tamanhoBloco)
+	for i, indice := range blocos {
+		// Intervalo do arquivo guardado neste bloco
+		inicioBloco := int64(i) * tamanhoBloco
+		if inicioBloco >= fim {
+			break
+		}
+		if inicioBloco+tamanhoBloco <= offset {
+			continue
+		}
+		_, erro = meuFS.ReadAt(bloco, PosicaoDoBloco(cabecalho, indice))
+		if erro != nil {
+			return fmt.Errorf("erro ao ler bloco do arquivo: %w", erro)
+		}
+		de := max(offset-inicioBloco, 0)
+		ate := min(fim-inicioBloco, tamanhoBloco)
+		if _, erro = destino.Write(bloco[de:ate]); erro != nil {
+			return fmt.Errorf("erro ao escrever conteúdo do arquivo: %w", erro)
+		}
+	}
+	return nil
+}
+
+// GravarConteudo escreve os dados em blocos livres, encadeando-os na FAT em memória, e retorna o primeiro bloco.
+// Dados vazios não ocupam blocos e retornam SemBlocos. Quem chama é responsável por salvar a FAT
+func GravarConteudo(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, dados []byte) (uint32, error) {
+	numBlocos := (len(dados) + int(cabecalho.TamanhoBloco) - 1) / int(cabecalho.TamanhoBloco)
+	if numBlocos == 0 {
+		return SemBlocos, nil
+	}
+	// Procurando blocos livres
+	blocos := make([]uint32, 0, numBlocos)
+	for indice, entrada := range fat {
+		if len(blocos) == numBlocos {
+			break
+		}
+		if entrada == 0 {
+			blocos = append(blocos, uint32(indice))
+		}
+	}
+	if len(blocos) < numBlocos {
+		return 0, errors.New("arquivo não coube no sistema de arquivos")
+	}
+	// Escrevendo blocos, o último é completado com zeros
+	bloco := make([]byte, cabecalho.TamanhoBloco)
+	for i, indice := range blocos {
+		clear(bloco)
+		copy(bloco, dados[min(i*len(bloco), len(dados)):])
+		_, erro := meuFS.WriteAt(bloco, PosicaoDoBloco(cabecalho, indice))
+		if erro != nil {
+			return 0, fmt.Errorf("erro ao escrever bloco no meufs: %w", erro)
+		}
+	}
+	// Encadeando blocos na FAT
+	for i := 0; i < len(blocos)-1; i++ {
+		fat[blocos[i]] = blocos[i+1]
+	}
+	fat[blocos[len(blocos)-1]] = FimDaCadeia
+	return blocos[0], nil
+}
+
+// LiberarBlocos sobrescreve com zeros os blocos da cadeia iniciada em inicio e os marca livres na FAT em memória.
+// Blocos compartilhados com outros arquivos (ver deduplicacao.go) só perdem uma referência
+func LiberarBlocos(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, inicio uint32) error {
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	compartilhados, erro := soltarCadeia(cabecalho, meuFS, fat, referencias, inicio)
+	if erro != nil {
+		return erro
+	}
+	if compartilhados {
+		return salvarReferencias(cabecalho, meuFS, fat, referencias)
+	}
+	return nil
+}
+
+// CriarEntrada cria um arquivo (ou um diretório vazio, se ehDir) com o conteúdo informado no diretório indicado pelo caminho.
+// Falha com fs.ErrExist se o nome já existir, veja CriarEntradaComPolitica para as outras opções
+func CriarEntrada(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminhoDir []string, nome string, ehDir bool, dados []byte) (DiretorioRoot, error) {
+	entrada, _, erro := CriarEntradaComPolitica(cabecalho, meuFS, identidade, caminhoDir, nome, ehDir, dados, DuplicadoFalhar)
+	return entrada, erro
+}
+
+// criarEntrada grava a nova entrada em uma posição livre do diretório, que não deve ter outra com o mesmo nome.
+// A entrada pertence ao uid e ao gid da identidade
+func criarEntrada(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, dir Diretorio, nome string, ehDir bool, dados []byte) (DiretorioRoot, error) {
+	if erro := ValidarNome(nome); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	indiceLivre := EntradaLivre(dir, nome)
+	if indiceLivre == -1 {
+		return DiretorioRoot{}, errors.New("diretorio cheio")
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	novaEntrada := entradaNova(identidade)
+	novaEntrada.Tamanho = uint32(len(dados))
+	// Diretórios começam com um bloco zerado, ou seja, sem entradas. Arquivos iguais a outro já guardado
+	// compartilham os blocos dele
+	if ehDir {
+		novaEntrada.EhDir = 1
+		novaEntrada.Tamanho = 0
+		novaEntrada.Modo = ModoDiretorioPadrao
+		novaEntrada.EnderecoFAT, erro = GravarConteudo(cabecalho, meuFS, fat, make([]byte, cabecalho.TamanhoBloco))
+	} else {
+		novaEntrada.EnderecoFAT, erro = gravarDeduplicado(cabecalho, meuFS, fat, dados)
+	}
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	EscreverEntrada(&dir, indiceLivre, novaEntrada, nome)
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return novaEntrada, meuFS.Sync()
+}
+
+// entradaNova retorna a entrada de um arquivo recém-criado, ainda sem conteúdo, que pertence ao uid e ao gid da
+// identidade
+func entradaNova(identidade Identidade) DiretorioRoot {
+	var entrada DiretorioRoot
+	entrada.EnderecoFAT = SemBlocos
+	entrada.Criado = agora()
+	entrada.Modificado = entrada.Criado
+	entrada.Acessado = entrada.Criado
+	entrada.Modo = ModoArquivoPadrao
+	entrada.Dono = identidade.Uid
+	entrada.Grupo = identidade.Gid
+	return entrada
+}
+
+// RemoverEntrada remove o arquivo ou diretório vazio indicado pelo caminho, liberando seus blocos.
+// A identidade precisa de escrita no diretório onde a entrada está, e entradas somente leitura, imutáveis
+// ou somente anexar não são removidas
+func RemoverEntrada(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string) error {
+	dir, indice, entradaDir, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	entrada := dir.Entradas[indice]
+	if erro = verificarAlteracao(identidade, entradaDir, entrada, caminho); erro != nil {
+		return erro
+	}
+	if erro = verificarRemocao(entrada, caminho); erro != nil {
+		return erro
+	}
+	if entrada.EhDir == 1 {
+		subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+		if erro != nil {
+			return erro
+		}
+		if !DiretorioVazio(subdir) {
+			return errors.New("diretorio não está vazio")
+		}
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if erro = LiberarBlocos(cabecalho, meuFS, fat, entrada.EnderecoFAT); erro != nil {
+		return erro
+	}
+	LiberarEntrada(&dir, indice)
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return erro
+	}
+	return tocarDiretorio(cabecalho, meuFS, caminho[:len(caminho)-1])
+}
+
+// RenomearEntrada troca o nome da entrada indicada pelo caminho, mantendo-a no mesmo diretório.
+// Falha com fs.ErrExist se o nome novo já existir, veja RenomearEntradaComPolitica para as outras opções
+func RenomearEntrada(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, nomeNovo string) error {
+	_, erro := RenomearEntradaComPolitica(cabecalho, meuFS, identidade, caminho, nomeNovo, DuplicadoFalhar)
+	return erro
+}
+
+// DefinirProtecao liga ou desliga o atributo somente leitura da entrada indicada pelo caminho, mantendo os demais
+// atributos, o que só o dono e o root podem fazer
+func DefinirProtecao(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, protegido bool) error {
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	atributos := dir.Entradas[indice].Atributos &^ AtributoSomenteLeitura
+	if protegido {
+		atributos |= AtributoSomenteLeitura
+	}
+	return DefinirAtributos(cabecalho, meuFS, identidade, caminho, atributos)
+}
@@ -1,12 +1,13 @@
-package main
+package meufs
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
 type Cabecalho struct {
@@ -16,13 +17,84 @@ type Cabecalho struct {
 	InicioFAT        uint32
 	InicioRoot       uint32
 	InicioDados      uint32
+	Assinatura       [4]byte // assinaturaMeuFS, ausente nos volumes criados antes da versão de formato
+	Versao           uint32  // Versão do formato do volume, VersaoFormato nos volumes criados por esta versão
 }
 
+// VersaoFormato é a versão do formato dos volumes criados e lidos por esta versão do meufs. Volumes de versões
+// anteriores, sem Assinatura, são convertidos pelo subcomando migrate (ver migracao.go)
+const VersaoFormato uint32 = 1
+
+// assinaturaMeuFS marca os volumes que guardam a versão do formato no cabeçalho
+var assinaturaMeuFS = [4]byte{'M', 'F', 'S', 0xFF}
+
+// ErrFormatoAntigo é retornado ao abrir um meufs.fs criado por uma versão anterior do meufs, sem versão de formato
+var ErrFormatoAntigo = errors.New("meufs.fs foi criado por uma versão anterior do meufs e precisa ser convertido com o subcomando migrate")
+
 type DiretorioRoot struct {
-	NomeArquivo [20]byte // Máximo 19 caracteres
+	NomeArquivo [20]byte // Primeiros bytes do nome. O resto vai em entradas de continuação (ver nomes.go)
 	EnderecoFAT uint32
-	Protegido   uint8
+	Tamanho     uint32 // Tamanho do arquivo em bytes
+	Atributos   uint8  // Bits AtributoSomenteLeitura, AtributoImutavel... (ver atributos.go)
 	EhDir       uint8
+	Criado      int64 // Datas em nanossegundos desde 01/01/1970 (UTC)
+	Modificado  int64
+	Acessado    int64
+	Modo        uint32 // Bits de permissão no formato Unix (ex: 0644)
+	Dono        uint32 // uid e gid do dono no sistema real, SemDono se não forem conhecidos
+	Grupo       uint32
+}
+
+// ExecutarMenu mostra o menu numerado e executa as opções escolhidas até a opção 9 ou um erro de leitura
+func ExecutarMenu(meuFS *MeuFS, cabecalho Cabecalho) error {
+	for {
+		// Esperando ação do usuário
+		var escolha int
+		fmt.Println("O que deseja fazer?\n1. Uploadear arquivo\n2. Baixar arquivo\n3. Renomear arquivo\n4. Remover arquivo\n5. Listar arquivos\n6. Mostrar espaço livre\n7. Proteger/Desproteger arquivo (se o arquivo estiver protegido ele será desprotegido e vice-versa)\n8. Criar diretório\n9. Encerrar programa")
+		_, erro := fmt.Scanf("%d", &escolha)
+		if erro != nil {
+			return erro
+		}
+		// Limpando o buffer de entrada
+		reader := bufio.NewReader(os.Stdin)
+		reader.ReadString('\n') // Consome o '\n'
+		switch {
+		// Opção 1: Copiar arquivo para dentro do meufs.fs
+		case escolha == 1:
+			erro = CopiarParaMeuFS(meuFS, cabecalho)
+		// Opção 2: Copiar arquivo de dentro do meufs.fs para sistema de arquivos real
+		case escolha == 2:
+			erro = CopiarParaSistemaReal(meuFS, cabecalho)
+		// Opção 3: Renomear arquivo armazenado no meufs
+		case escolha == 3:
+			erro = RenomearArquivo(meuFS, cabecalho)
+		// Opção 4: Remover arquivo armazenado no meufs
+		case escolha == 4:
+			erro = RemoverArquivo(meuFS, cabecalho)
+		// Opção 5: Listar todos arquivos armazenados no meufs
+		case escolha == 5:
+			erro = ListarArquivos(meuFS, cabecalho)
+		// Opção 6: Mostrar espaço livre do meufs
+		case escolha == 6:
+			erro = MostrarEspacoLivre(meuFS, cabecalho)
+		// Opção 7: Proteger/Desproteger arquivo
+		case escolha == 7:
+			erro = ProtegerDesprotegerArquivo(meuFS, cabecalho)
+		// Opção 8: Criar diretório
+		case escolha == 8:
+			erro = CriarDiretorio(meuFS, cabecalho)
+		// Opção 9: Encerrar programa
+		case escolha == 9:
+			fmt.Println("Programa encerrado")
+			return nil
+		// Default: Opção inválida
+		default:
+			fmt.Println("Opção inválida")
+		}
+		if erro != nil {
+			fmt.Printf("%v\n", erro)
+		}
+	}
 }
 
 // CriarFS cria um arquivo meufs.fs com tamanho especificado pelo usuário e escreve o cabeçalho do sistema de arquivos nele
@@ -34,36 +106,68 @@ func CriarFS() error {
 	if erro != nil {
 		return fmt.Errorf("erro ao ler a entrada: %w", erro)
 	}
-	// Limpando o buffer de entrada
-	reader := bufio.NewReader(os.Stdin)
-	reader.ReadString('\n') // Consome o '\n'
 	// Validando o tamanho fornecido pelo usuário
 	if tamanhoArquivoMB < 100 || tamanhoArquivoMB > 800 {
 		return errors.New("o tamanho deve estar entre 100MB e 800MB")
 	}
-	// Criando o sistema de arquivos meufs.fs
-	meuFS, erro := os.Create("meufs.fs")
+	// Com uma senha, tudo depois do cabeçalho é cifrado (ver cifravolume.go). As respostas são lidas sem buffer
+	// para não consumir as linhas seguintes, que são do menu
+	var confirmacao, senha string
+	fmt.Println("Deseja cifrar o volume com uma senha? S/N")
+	fmt.Scanln(&confirmacao)
+	if confirmacao == "S" {
+		if senha, erro = lerNovaSenhaDe(bufio.NewReader(entradaSemBuffer{}), "senha do volume: "); erro != nil {
+			return erro
+		}
+		if senha == "" {
+			return errors.New("a senha do volume não pode ser vazia")
+		}
+	}
+	if erro = CriarVolume("meufs.fs", tamanhoArquivoMB, senha); erro != nil {
+		return erro
+	}
+	fmt.Printf("Sistema de arquivos criado com tamanho de %dMB\n", tamanhoArquivoMB)
+	fmt.Println("Cabeçalho criado e escrito no sistemas de arquivos com sucesso")
+	return nil
+}
+
+// tamanhoCabecalhoAtual é o espaço reservado para o cabeçalho nos volumes novos. Além dos campos do Cabecalho, ele
+// guarda a senha de administrador, as chaves do volume, as posições da tabela de referências, da lista de snapshots
+// e do índice de conteúdo e as tentativas erradas da senha. O root e os dados começam em múltiplos de tamanhoSetor,
+// para que cada bloco ocupe setores inteiros
+func tamanhoCabecalhoAtual() uint32 {
+	return arredondarSetor(uint32(binary.Size(Cabecalho{}) + binary.Size(CredencialAdmin{}) + binary.Size(AreaChaves{}) + binary.Size(AreaReferencias{}) + binary.Size(AreaSnapshots{}) + binary.Size(AreaIndiceConteudo{}) + binary.Size(AreaTentativas{})))
+}
+
+// CriarVolume cria no caminho informado um meufs.fs vazio com o tamanho em MB (de 100 a 800), sem perguntar nada ao
+// usuário. Com uma senha, o volume é cifrado (ver cifravolume.go)
+func CriarVolume(caminho string, tamanhoArquivoMB int, senha string) error {
+	if tamanhoArquivoMB < 100 || tamanhoArquivoMB > 800 {
+		return errors.New("o tamanho deve estar entre 100MB e 800MB")
+	}
+	// Criando o sistema de arquivos
+	arquivo, erro := os.Create(caminho)
 	if erro != nil {
 		return fmt.Errorf("falha ao criar o arquivo: %w", erro)
 	}
+	meuFS := &MeuFS{arquivo: arquivo}
 	defer meuFS.Close()
 	// Definindo tamanho do arquivo
 	tamanhoArquivoBytes := int64(tamanhoArquivoMB) * 1024 * 1024
-	if erro = meuFS.Truncate(tamanhoArquivoBytes); erro != nil {
+	if erro = arquivo.Truncate(tamanhoArquivoBytes); erro != nil {
 		return fmt.Errorf("erro ao definir o tamanho do arquivo: %v", erro)
 	}
-	fmt.Printf("Sistema de arquivos criado com tamanho de %dMB\n", tamanhoArquivoMB)
 	// Criando cabeçalho do sistema de arquivos e o escrevendo no meuFS
 	// Estrutura do meufs: cabeçalho root tad dados nessa ordem
 	// Calculando os endereços segundo estrutura acima
 	tamanhoBloco := uint32(4 * 1024) // 4kb
-	tamanhoCabecalho := uint32(binary.Size(Cabecalho{}))
+	tamanhoCabecalho := tamanhoCabecalhoAtual()
 	inicioRoot := tamanhoCabecalho
 	tamanhoRoot := uint32(binary.Size(DiretorioRoot{})) * 200 // máximo 200 arquivos
 	inicioFAT := inicioRoot + tamanhoRoot
 	// 4/4100 avos do espaço disponível após inserir cabeçalho e root. (4 bytes de fat para cada 4096 bytes (1 bloco) de dados)
 	tamanhoFAT := ((uint32(tamanhoArquivoBytes) - tamanhoCabecalho - tamanhoRoot) * 4) / (tamanhoBloco + 4)
-	inicioDados := inicioFAT + tamanhoFAT
+	inicioDados := arredondarSetor(inicioFAT + tamanhoFAT)
 	// Criando cabeçalho
 	cabecalho := Cabecalho{
 		TamanhoCabecalho: tamanhoCabecalho,
@@ -72,6 +176,8 @@ func CriarFS() error {
 		InicioRoot:       inicioRoot,
 		InicioFAT:        inicioFAT,
 		InicioDados:      inicioDados,
+		Assinatura:       assinaturaMeuFS,
+		Versao:           VersaoFormato,
 	}
 	// Movendo ponteiro para o início do meufs.fs
 	_, erro = meuFS.Seek(0, 0)
@@ -83,33 +189,54 @@ func CriarFS() error {
 	if erro != nil {
 		return fmt.Errorf("erro ao escrever cabecalho: %w", erro)
 	}
+	if senha != "" {
+		if erro = cifrarVolume(cabecalho, meuFS, senha); erro != nil {
+			return erro
+		}
+	}
 	// Garante que os dados estejam no disco
 	erro = meuFS.Sync()
 	if erro != nil {
 		return fmt.Errorf("erro ao sincronizar o arquivo: %w", erro)
 	}
-	fmt.Println("Cabeçalho criado e escrito no sistemas de arquivos com sucesso")
 	return nil
 }
 
 // LerCabecalho lê o cabeçalho e o mapeia para um struct
-func LerCabecalho(arquivo *os.File) (Cabecalho, error) {
-	// Movendo ponteiro para o inicio do arquivo
-	var cabecalho Cabecalho
-	_, erro := arquivo.Seek(0, 0)
-	if erro != nil {
-		return Cabecalho{}, fmt.Errorf("erro ao posicionar o ponteiro: %v", erro)
+func LerCabecalho(arquivo *MeuFS) (Cabecalho, error) {
+	// Lendo cabeçalho sem mover o ponteiro, que pode estar em uso por outra conexão do volume
+	dados := make([]byte, binary.Size(Cabecalho{}))
+	if _, erro := arquivo.ReadAt(dados, 0); erro != nil {
+		return Cabecalho{}, fmt.Errorf("erro ao ler o cabeçalho: %v", erro)
 	}
-	// Lendo cabeçalho e o mapeando para struct
-	erro = binary.Read(arquivo, binary.LittleEndian, &cabecalho)
-	if erro != nil {
+	return decodificarCabecalho(dados)
+}
+
+// decodificarCabecalho mapeia os bytes do começo do meufs.fs para um struct e confere se eles são um cabeçalho
+// válido do formato atual
+func decodificarCabecalho(dados []byte) (Cabecalho, error) {
+	var cabecalho Cabecalho
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &cabecalho); erro != nil {
 		return Cabecalho{}, fmt.Errorf("erro ao ler o cabeçalho: %v", erro)
 	}
+	// Volumes sem assinatura foram criados antes da versão de formato, com outro cabeçalho ou outro formato de entrada
+	if cabecalho.TamanhoCabecalho < uint32(binary.Size(cabecalho)) || cabecalho.Assinatura != assinaturaMeuFS {
+		return Cabecalho{}, ErrFormatoAntigo
+	}
+	if cabecalho.Versao > VersaoFormato {
+		return Cabecalho{}, fmt.Errorf("meufs.fs usa o formato %d, criado por uma versão mais nova do meufs (esta lê até o formato %d)", cabecalho.Versao, VersaoFormato)
+	}
+	if cabecalho.TamanhoCabecalho < tamanhoCabecalhoAtual() {
+		return Cabecalho{}, errors.New("meufs.fs tem um cabeçalho menor que o do seu formato")
+	}
+	if cabecalho.InicioFAT-cabecalho.InicioRoot != uint32(binary.Size(DiretorioRoot{}))*200 {
+		return Cabecalho{}, errors.New("meufs.fs tem um root de tamanho inválido")
+	}
 	return cabecalho, nil
 }
 
 // LerFAT lê FAT a mapeando para um slice
-func LerFAT(cabecalho Cabecalho, meuFS *os.File) ([]uint32, error) {
+func LerFAT(cabecalho Cabecalho, meuFS *MeuFS) ([]uint32, error) {
 	// Vendo quantas entradas a fat tem
 	numEntradasFAT := (cabecalho.TamanhoMeuFS - cabecalho.InicioDados) / cabecalho.TamanhoBloco
 	// Criando slice FAT
@@ -128,7 +255,7 @@ func LerFAT(cabecalho Cabecalho, meuFS *os.File) ([]uint32, error) {
 }
 
 // LerRoot lê o diretório raiz o mapeando para um slice
-func LerRoot(cabecalho Cabecalho, meuFS *os.File) ([]DiretorioRoot, error) {
+func LerRoot(cabecalho Cabecalho, meuFS *MeuFS) ([]DiretorioRoot, error) {
 	// Criando sliec root
 	root := make([]DiretorioRoot, 200) // 200 entradas
 	// Posicionando ponteiro no inicio do root
@@ -144,8 +271,22 @@ func LerRoot(cabecalho Cabecalho, meuFS *os.File) ([]DiretorioRoot, error) {
 	return root, nil
 }
 
+// PerguntarPoliticaDuplicado pergunta ao usuário o que fazer quando o nome escolhido já existe
+func PerguntarPoliticaDuplicado(nome string) PoliticaDuplicado {
+	var escolha int
+	fmt.Printf("já existe um arquivo com o nome '%s'. Digite 1 para cancelar, 2 para sobrescrever ou 3 para usar outro nome: \n", nome)
+	fmt.Scanln(&escolha)
+	switch escolha {
+	case 2:
+		return DuplicadoSobrescrever
+	case 3:
+		return DuplicadoRenomear
+	}
+	return DuplicadoFalhar
+}
+
 // CopiarParaMeuFS copia um arquivo escolhido pelo usuário para o sistema de arquivos meufs
-func CopiarParaMeuFS(meuFS *os.File, cabecalho Cabecalho) error {
+func CopiarParaMeuFS(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Solicitando caminho e nome do arquivo
 	var caminho string
 	fmt.Println("Digite o caminho do arquivo que deseja copiar para o meufs.fs: ")
@@ -153,164 +294,100 @@ func CopiarParaMeuFS(meuFS *os.File, cabecalho Cabecalho) error {
 	var nomeArquivo string
 	fmt.Println("Digite o nome que quer dar ao arquivo: ")
 	fmt.Scanln(&nomeArquivo)
-	if len(nomeArquivo) > 19 {
-		return errors.New("nome do arquivo nao pode ter mais de 19 caracteres")
-	}
-	// Abrindo arquivo novo
-	arquivoNovo, erro := os.Open(caminho)
-	if erro != nil {
-		return fmt.Errorf("erro ao abrir arquivo a ser guardado: %w", erro)
-	}
-	defer arquivoNovo.Close()
-	// Obtendo tamanho do arquivo novo
-	info, erro := arquivoNovo.Stat()
-	if erro != nil {
-		return fmt.Errorf("erro ao obter informações do arquivo a ser guardado: %w", erro)
-	}
-	tamanhoArquivo := info.Size()
-	if tamanhoArquivo == 0 {
-		return errors.New("arquivo escolhido não pode estar vazio")
-	}
-	// Calculando quantos blocos o arquivo ocupará
-	// converto o tamanho do bloco para int64 pois o tamanho do arquivo informado pode ser maior que 4gb
-	numBlocosArquivo := uint32((tamanhoArquivo + int64(cabecalho.TamanhoBloco) - 1) / int64(cabecalho.TamanhoBloco))
-	// Lendo FAT
-	fat, erro := LerFAT(cabecalho, meuFS)
-	if erro != nil {
+	if erro := ValidarNome(nomeArquivo); erro != nil {
 		return erro
 	}
-	// Vendo se tem espaço livre para guardar o arquivo
-	cabe := false
-	indicesLivresFAT := make([]uint32, 0, numBlocosArquivo)
-	for indice, entrada := range fat {
-		if entrada == 0 {
-			indicesLivresFAT = append(indicesLivresFAT, uint32(indice))
+	var confirmacao string
+	fmt.Println("Deseja guardar as permissões, a data de modificação e o dono do arquivo? S/N")
+	fmt.Scanln(&confirmacao)
+	preservar := confirmacao == "S"
+	identidade := IdentidadeDoProcesso()
+	// Com uma senha, o arquivo é guardado cifrado com AES-GCM
+	fmt.Println("Deseja cifrar o arquivo com uma senha? S/N")
+	fmt.Scanln(&confirmacao)
+	var cifra *CifraArquivo
+	if confirmacao == "S" {
+		// A senha não aparece no terminal e é pedida duas vezes, já que sem ela o arquivo não pode ser lido
+		senha, erro := lerNovaSenhaDe(bufio.NewReader(entradaSemBuffer{}), "Digite a senha do arquivo: ")
+		if erro != nil {
+			return erro
 		}
-		if uint32(len(indicesLivresFAT)) == numBlocosArquivo {
-			cabe = true
-			break
+		if cifra, erro = NovaCifraArquivo(senha); erro != nil {
+			return erro
 		}
 	}
-	if !cabe {
-		return errors.New("arquivo não coube no sistema de arquivos")
+	// Sem cifra, o arquivo pode ser guardado comprimido com DEFLATE
+	comprimido := false
+	if cifra == nil {
+		fmt.Println("Deseja comprimir o arquivo? S/N")
+		fmt.Scanln(&confirmacao)
+		comprimido = confirmacao == "S"
 	}
-	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
+	// Lendo arquivo novo
+	dados, erro := os.ReadFile(caminho)
 	if erro != nil {
-		return erro
-	}
-	// Vendo se tem espaço livre em root
-	var indiceLivreRoot int = -1
-	for indice, entrada := range root {
-		if string(entrada.NomeArquivo[:]) == nomeArquivo {
-			return fmt.Errorf("um arquivo com o nome '%s' já existe no sistema", nomeArquivo)
-		}
-		if entrada.NomeArquivo[0] == 0 && indiceLivreRoot == -1 {
-			indiceLivreRoot = indice
-		}
-	}
-	if indiceLivreRoot == -1 {
-		return errors.New("diretorio raiz cheio, maximo de 200 arquivos atingido")
+		return fmt.Errorf("erro ao ler arquivo a ser guardado: %w", erro)
 	}
-	// Separando o arquivo em blocos e os colocando no meufs.fs
-	blocoDoArquivo := make([]byte, cabecalho.TamanhoBloco)
-	for _, indiceLivre := range indicesLivresFAT {
-		// Pegando um bloco do arquivo
-		numBytes, erro := arquivoNovo.Read(blocoDoArquivo)
-		if erro != nil {
-			return fmt.Errorf("erro ao ler arquivo a ser guardado: %w", erro)
-		}
-		// Movendo ponteiro para posição que bloco será guardado
-		posicao := int64(cabecalho.InicioDados + (indiceLivre * cabecalho.TamanhoBloco))
-		_, erro = meuFS.Seek(posicao, 0)
-		if erro != nil {
-			return fmt.Errorf("erro ao posicionar ponteiro no meufs: %w", erro)
-		}
-		// Escrevendo bloco
-		// Necessita de :numBytes para escrever apenas os bytes usados pelo arquivo no último bloco
-		_, erro = meuFS.Write(blocoDoArquivo[:numBytes])
-		if erro != nil {
-			return fmt.Errorf("erro ao escrever bloco no meufs: %w", erro)
-		}
-	}
-	// Atualizando root
-	var novaEntradaRoot DiretorioRoot
-	copy(novaEntradaRoot.NomeArquivo[:], nomeArquivo)
-	novaEntradaRoot.EnderecoFAT = indicesLivresFAT[0]
-	novaEntradaRoot.Protegido = 0
-	novaEntradaRoot.EhDir = 0
-	root[indiceLivreRoot] = novaEntradaRoot
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioRoot), 0)
+	info, erro := os.Stat(caminho)
 	if erro != nil {
-		return fmt.Errorf("erro ao posicionar o ponteiro no início do diretorio raiz: %w", erro)
+		return fmt.Errorf("erro ao obter informações do arquivo a ser guardado: %w", erro)
 	}
-	// escrevendo root atualizado
-	erro = binary.Write(meuFS, binary.LittleEndian, root)
+	// Vendo se já existe uma entrada com esse nome, quando o usuário escolhe o que fazer
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
-		return fmt.Errorf("erro ao escrever root atualizado: %w", erro)
+		return erro
 	}
-	// Atualizando fat
-	for i := 0; i < len(indicesLivresFAT)-1; i++ {
-		fat[indicesLivresFAT[i]] = indicesLivresFAT[i+1]
+	politica := DuplicadoFalhar
+	if BuscarEntrada(raiz, nomeArquivo) != -1 {
+		politica = PerguntarPoliticaDuplicado(nomeArquivo)
 	}
-	fat[indicesLivresFAT[len(indicesLivresFAT)-1]] = 0xFFFFFFFF //numero hexadecimal uint32 muito maior que len da fat
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioFAT), 0)
+	// A criação é a mesma do put, com as mesmas permissões, a deduplicação e a cifra ou compressão
+	_, nomeUsado, erro := GuardarArquivo(cabecalho, meuFS, identidade, nil, nomeArquivo, dados, cifra, comprimido, politica)
 	if erro != nil {
-		return fmt.Errorf("erro ao posicionar ponteiro no inicio da FAT: %w", erro)
+		return erro
 	}
-	// escrevendo fat atualizada
-	erro = binary.Write(meuFS, binary.LittleEndian, fat)
-	if erro != nil {
-		return fmt.Errorf("erro ao escrever FAT atualizada: %w", erro)
+	if nomeUsado != nomeArquivo {
+		fmt.Printf("o arquivo foi guardado como '%s'\n", nomeUsado)
 	}
-	// Garante que os dados estejam no disco
-	erro = meuFS.Sync()
-	if erro != nil {
-		return fmt.Errorf("erro ao sincronizar o arquivo: %w", erro)
+	if preservar {
+		if erro = PreservarMetadados(cabecalho, meuFS, identidade, []string{nomeUsado}, LerMetadadosReais(info)); erro != nil {
+			return erro
+		}
 	}
 	fmt.Println("arquivo copiado com sucesso!")
 	return nil
 }
 
 // CopiarParaSistemaReal copia um arquivo de dentro do meuFS para um sistema de arquivos real (disco, pendrive, etc)
-func CopiarParaSistemaReal(meuFS *os.File, cabecalho Cabecalho) error {
+func CopiarParaSistemaReal(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Solicitando nome do arquivo a ser copiado para o sistema real
 	var nomeArquivo string
 	fmt.Println("Digite o nome do arquivo que deseja baixar: ")
 	fmt.Scanln(&nomeArquivo)
 	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
+	root := raiz.Entradas
 	// Vendo se arquivo existe no root
-	var indiceDoArquivoNoRoot int = -1
-	for indice, entrada := range root {
-		if strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00") == nomeArquivo {
-			indiceDoArquivoNoRoot = indice
-			break
-		}
-	}
+	indiceDoArquivoNoRoot := BuscarEntrada(raiz, nomeArquivo)
 	if indiceDoArquivoNoRoot == -1 {
 		return errors.New("arquivo com esse nome não existe no sistema de arquivos meufs")
 	}
+	// Vendo se o usuário pode ler o arquivo
+	if !PodeAcessar(IdentidadeDoProcesso(), root[indiceDoArquivoNoRoot], AcessoLeitura) {
+		return erroDePermissao([]string{nomeArquivo}, AcessoLeitura)
+	}
 	// Lendo FAT
 	fat, erro := LerFAT(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
-	// Obtendo endereço dos blocos do arquivo com a fat
-	posicaoNaFAT := root[indiceDoArquivoNoRoot].EnderecoFAT
-	var blocosDoArquivo []uint32
-	blocosDoArquivo = append(blocosDoArquivo, posicaoNaFAT)
-	for {
-		if fat[posicaoNaFAT] == 0xFFFFFFFF {
-			break
-		}
-		posicaoNaFAT = fat[posicaoNaFAT]
-		blocosDoArquivo = append(blocosDoArquivo, posicaoNaFAT)
+	// Obtendo endereço dos blocos do arquivo com a fat (arquivos vazios não têm blocos)
+	blocosDoArquivo, erro := CadeiaDeBlocos(fat, root[indiceDoArquivoNoRoot].EnderecoFAT)
+	if erro != nil {
+		return erro
 	}
 	// Solicitando onde no sistema real o arquivo vai ser copiado para
 	var caminho string
@@ -319,8 +396,38 @@ func CopiarParaSistemaReal(meuFS *os.File, cabecalho Cabecalho) error {
 	var nomeReal string
 	fmt.Println("Digite que nome deseja dar ao arquivo baixado: ")
 	fmt.Scanln(&nomeReal)
+	var confirmacao string
+	fmt.Println("Deseja aplicar ao arquivo baixado as permissões, as datas e o dono guardados? S/N")
+	fmt.Scanln(&confirmacao)
+	if erro = ValidarNomeReal(nomeReal); erro != nil {
+		return erro
+	}
+	// Um arquivo cifrado é decifrado antes de criar o arquivo real, para que uma senha errada não deixe nada pela metade.
+	// Um arquivo comprimido também é lido já descomprimido
+	var decifrado []byte
+	if root[indiceDoArquivoNoRoot].Atributos&AtributoComprimido != 0 {
+		if decifrado, erro = LerConteudo(cabecalho, meuFS, root[indiceDoArquivoNoRoot], nil); erro != nil {
+			return erro
+		}
+		blocosDoArquivo = nil
+	}
+	if root[indiceDoArquivoNoRoot].Atributos&AtributoCifrado != 0 {
+		senha, erro := LerSenha("Digite a senha do arquivo cifrado: ")
+		if erro != nil {
+			return erro
+		}
+		cifra, erro := AbrirCifra(cabecalho, meuFS, root[indiceDoArquivoNoRoot], senha)
+		if erro != nil {
+			return erro
+		}
+		if decifrado, erro = LerConteudo(cabecalho, meuFS, root[indiceDoArquivoNoRoot], cifra); erro != nil {
+			return erro
+		}
+		// Os blocos cifrados não são copiados, só o conteúdo decifrado
+		blocosDoArquivo = nil
+	}
 	// Criar o arquivo no sistema real
-	caminhoComleto := fmt.Sprintf("%s/%s", caminho, nomeReal)
+	caminhoComleto := filepath.Join(caminho, nomeReal)
 	arquivoReal, erro := os.Create(caminhoComleto)
 	if erro != nil {
 		return fmt.Errorf("erro ao criar o arquivo no sistema real: %w", erro)
@@ -328,6 +435,7 @@ func CopiarParaSistemaReal(meuFS *os.File, cabecalho Cabecalho) error {
 	defer arquivoReal.Close()
 	// Passando para o sistema real os blocos 1 por 1 da área de dados do meufs
 	blocoDoArquivo := make([]byte, cabecalho.TamanhoBloco)
+	bytesRestantes := root[indiceDoArquivoNoRoot].Tamanho
 	for _, entrada := range blocosDoArquivo {
 		// Obtendo posicao do bloco
 		posicaoBloco := int64(cabecalho.InicioDados + (cabecalho.TamanhoBloco * entrada))
@@ -342,18 +450,31 @@ func CopiarParaSistemaReal(meuFS *os.File, cabecalho Cabecalho) error {
 			return fmt.Errorf("erro ao ler bloco do arquivo a ser baixado: %w", erro)
 		}
 		// Escrevendo no sistemas de arquivo real
-		// Necessita de :numBytes para escrever apenas os bytes usados pelo arquivo no último bloco
+		// O último bloco é cortado no tamanho do arquivo para não levar o preenchimento do bloco
+		numBytes = min(numBytes, int(bytesRestantes))
+		bytesRestantes -= uint32(numBytes)
 		_, erro = arquivoReal.Write(blocoDoArquivo[:numBytes])
 		if erro != nil {
 			return fmt.Errorf("erro ao escrever bloco no arquivo no sistema real: %w", erro)
 		}
 	}
+	if _, erro = arquivoReal.Write(decifrado); erro != nil {
+		return fmt.Errorf("erro ao escrever no arquivo no sistema real: %w", erro)
+	}
+	if confirmacao == "S" {
+		if erro = AplicarMetadados(caminhoComleto, root[indiceDoArquivoNoRoot]); erro != nil {
+			return erro
+		}
+	}
+	if erro = MarcarAcesso(cabecalho, meuFS, []string{nomeArquivo}); erro != nil {
+		return erro
+	}
 	fmt.Println("arquivo baixado com sucesso!")
 	return nil
 }
 
 // RenomearArquivo renomeia um arquivo armazenado dentro do meufs
-func RenomearArquivo(meuFS *os.File, cabecalho Cabecalho) error {
+func RenomearArquivo(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Solicitando nome do arquivo a ser renomeado
 	var nomeAntigo string
 	fmt.Println("Digite o nome do arquivo que deseja renomear: ")
@@ -362,29 +483,55 @@ func RenomearArquivo(meuFS *os.File, cabecalho Cabecalho) error {
 	var nomeNovo string
 	fmt.Println("Digite o novo nome do arquivo que deseja renomear: ")
 	fmt.Scanln(&nomeNovo)
-	if len(nomeNovo) > 19 {
-		return errors.New("nome do arquivo nao pode ter mais de 19 caracteres")
+	if erro := ValidarNome(nomeNovo); erro != nil {
+		return erro
 	}
 	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
+	root := raiz.Entradas
 	// Vendo se arquivo existe no root
-	var indiceDoArquivoNoRoot int = -1
-	for indice, entrada := range root {
-		if strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00") == nomeAntigo {
-			indiceDoArquivoNoRoot = indice
-			break
-		}
-	}
+	indiceDoArquivoNoRoot := BuscarEntrada(raiz, nomeAntigo)
 	if indiceDoArquivoNoRoot == -1 {
 		return errors.New("arquivo com esse nome não existe no sistema de arquivos meufs")
 	}
-	// Renomeando arquivo
-	var nomeNovoArray [20]byte
-	copy(nomeNovoArray[:], nomeNovo)
-	root[indiceDoArquivoNoRoot].NomeArquivo = nomeNovoArray
+	// Vendo se o usuário pode renomear o arquivo (o root tem sticky bit, então só o dono pode)
+	identidade := IdentidadeDoProcesso()
+	if erro = verificarAlteracao(identidade, entradaDoRoot, root[indiceDoArquivoNoRoot], []string{nomeAntigo}); erro != nil {
+		return erro
+	}
+	// Vendo se os atributos deixam renomear o arquivo (imutável ou somente anexar)
+	if erro = verificarEntradaAlteravel(root[indiceDoArquivoNoRoot], []string{nomeAntigo}); erro != nil {
+		return erro
+	}
+	// Vendo se o novo nome já é usado por outra entrada
+	if indiceDestino := BuscarEntrada(raiz, nomeNovo); indiceDestino != -1 && indiceDestino != indiceDoArquivoNoRoot {
+		switch PerguntarPoliticaDuplicado(nomeNovo) {
+		case DuplicadoSobrescrever:
+			if _, erro = RenomearEntradaComPolitica(cabecalho, meuFS, identidade, []string{nomeAntigo}, nomeNovo, DuplicadoSobrescrever); erro != nil {
+				return erro
+			}
+			fmt.Println("arquivo renomeado com sucesso!")
+			return nil
+		case DuplicadoRenomear:
+			if nomeNovo, erro = NomeLivre(raiz, nomeNovo); erro != nil {
+				return erro
+			}
+			fmt.Printf("o arquivo será renomeado para '%s'\n", nomeNovo)
+		default:
+			return fmt.Errorf("um arquivo com o nome '%s' já existe no sistema", nomeNovo)
+		}
+	}
+	// Renomeando arquivo. Um nome maior pode precisar de mais entradas, então a entrada pode mudar de lugar
+	entradaRenomeada := root[indiceDoArquivoNoRoot]
+	LiberarEntrada(&raiz, indiceDoArquivoNoRoot)
+	novoIndice := EntradaLivre(raiz, nomeNovo)
+	if novoIndice == -1 {
+		return errors.New("diretorio raiz cheio, nao ha espaco para o novo nome")
+	}
+	EscreverEntrada(&raiz, novoIndice, entradaRenomeada, nomeNovo)
 	// Salvando root atualizado
 	// movendo ponteiro
 	_, erro = meuFS.Seek(int64(cabecalho.InicioRoot), 0)
@@ -405,112 +552,35 @@ func RenomearArquivo(meuFS *os.File, cabecalho Cabecalho) error {
 	return nil
 }
 
-// RemoverArquivo remove um arquivo de dentro do meufs
-func RemoverArquivo(meuFS *os.File, cabecalho Cabecalho) error {
-	// Solicitando nome do arquivo a ser renomeado
+// RemoverArquivo remove um arquivo ou diretório do root do meufs
+func RemoverArquivo(meuFS *MeuFS, cabecalho Cabecalho) error {
+	// Solicitando nome do arquivo a ser removido
 	var nomeArquivo string
 	fmt.Println("Digite o nome do arquivo que deseja remover: ")
 	fmt.Scanln(&nomeArquivo)
-	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
-	if erro != nil {
+	// A remoção é a mesma do rm -r: um diretório sai com tudo o que há dentro dele, e nada é removido se alguma
+	// entrada da árvore estiver protegida ou não puder ser removida pelo usuário
+	if erro := RemoverArvore(cabecalho, meuFS, IdentidadeDoProcesso(), []string{nomeArquivo}, false); erro != nil {
 		return erro
 	}
-	// Vendo se arquivo existe no root
-	var indiceDoArquivoNoRoot int = -1
-	for indice, entrada := range root {
-		if strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00") == nomeArquivo {
-			indiceDoArquivoNoRoot = indice
-			break
-		}
-	}
-	if indiceDoArquivoNoRoot == -1 {
-		return errors.New("arquivo com esse nome não existe no sistema de arquivos meufs")
-	}
-	// Vendo se arquivo é protegido
-	if root[indiceDoArquivoNoRoot].Protegido == 1 {
-		return errors.New("esse arquivo está protegido de ser excluido")
-	}
-	// Lendo FAT
-	fat, erro := LerFAT(cabecalho, meuFS)
-	if erro != nil {
-		return erro
-	}
-	// Obtendo endereço dos blocos do arquivo com a fat
-	posicaoNaFAT := root[indiceDoArquivoNoRoot].EnderecoFAT
-	var blocosDoArquivo []uint32
-	blocosDoArquivo = append(blocosDoArquivo, posicaoNaFAT)
-	for {
-		if fat[posicaoNaFAT] == 0xFFFFFFFF {
-			break
-		}
-		posicaoNaFAT = fat[posicaoNaFAT]
-		blocosDoArquivo = append(blocosDoArquivo, posicaoNaFAT)
-	}
-	// Colocando zeros no lugar dos blocos do arquivo e atualizando fat
-	blocoDeZeros := make([]byte, cabecalho.TamanhoBloco)
-	for _, entrada := range blocosDoArquivo {
-		// Obtendo posicao do bloco
-		posicaoBloco := int64(cabecalho.InicioDados + (cabecalho.TamanhoBloco * entrada))
-		// Movendo ponteiro para a posicao do bloco do arquivo
-		_, erro = meuFS.Seek(posicaoBloco, 0)
-		if erro != nil {
-			return fmt.Errorf("erro ao posicionar ponteiro no bloco do arquivo: %w", erro)
-		}
-		// Escrevendo zeros no bloco
-		_, erro = meuFS.Write(blocoDeZeros)
-		if erro != nil {
-			return fmt.Errorf("erro ao sobrescrever bloco do arquivo com zeros: %w", erro)
-		}
-		// Atualizando FAT
-		fat[entrada] = 0
-	}
-	// Atualizando root e o salvando no arquivo
-	root[indiceDoArquivoNoRoot] = DiretorioRoot{}
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioRoot), 0)
-	if erro != nil {
-		return fmt.Errorf("erro ao posicionar o ponteiro no início do diretorio raiz: %w", erro)
-	}
-	// escrevendo root atualizado
-	erro = binary.Write(meuFS, binary.LittleEndian, root)
-	if erro != nil {
-		return fmt.Errorf("erro ao escrever root atualizado: %w", erro)
-	}
-	// Salvando FAT atualizada
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioFAT), 0)
-	if erro != nil {
-		return fmt.Errorf("erro ao posicionar ponteiro no inicio da FAT: %w", erro)
-	}
-	// escrevendo fat atualizada
-	erro = binary.Write(meuFS, binary.LittleEndian, fat)
-	if erro != nil {
-		return fmt.Errorf("erro ao escrever FAT atualizada: %w", erro)
-	}
-	// Garante que os dados estejam no disco
-	erro = meuFS.Sync()
-	if erro != nil {
-		return fmt.Errorf("erro ao sincronizar o arquivo: %w", erro)
-	}
 	fmt.Println("arquivo removido com sucesso!")
 	return nil
 }
 
 // ListarArquivos imprime todos os arquivos armazenados no meufs
-func ListarArquivos(meuFS *os.File, cabecalho Cabecalho) error {
-	root, erro := LerRoot(cabecalho, meuFS)
+func ListarArquivos(meuFS *MeuFS, cabecalho Cabecalho) error {
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
 	nenhumArquivo := true
-	for _, entrada := range root {
-		if entrada.NomeArquivo[0] != 0 {
+	for indice, nome := range raiz.Nomes {
+		if nome != "" {
 			nenhumArquivo = false
-			if entrada.EhDir == 1 {
-				fmt.Printf("dir %s\n", strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00"))
+			if raiz.Entradas[indice].EhDir == 1 {
+				fmt.Printf("dir %s\n", nome)
 			} else {
-				fmt.Printf("%s\n", strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00"))
+				fmt.Printf("%s\n", nome)
 			}
 		}
 	}
@@ -521,7 +591,7 @@ func ListarArquivos(meuFS *os.File, cabecalho Cabecalho) error {
 }
 
 // MostrarEspacoLivre mostra quantos MB livres tem em relação ao total
-func MostrarEspacoLivre(meuFS *os.File, cabecalho Cabecalho) error {
+func MostrarEspacoLivre(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Calculando espaço de dados
 	espacoDados := cabecalho.TamanhoMeuFS - cabecalho.InicioDados
 	// Lendo fat para ver espaços livres
@@ -538,42 +608,71 @@ func MostrarEspacoLivre(meuFS *os.File, cabecalho Cabecalho) error {
 	espacoDados = espacoDados / (1024 * 1024)
 	espacoLivre = espacoLivre / (1024 * 1024)
 	fmt.Printf("%dMB livres de %dMB\n", espacoLivre, espacoDados)
+	// Mostrando quanto os arquivos comprimidos economizam
+	compressao, erro := CalcularCompressao(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if compressao.Arquivos > 0 {
+		fmt.Printf("%d arquivos comprimidos ocupam %dKB em vez de %dKB (%.1fx)\n", compressao.Arquivos, (compressao.Comprimido+1023)/1024, (compressao.Original+1023)/1024, compressao.Taxa)
+	}
+	// Mostrando o uso lógico e o físico quando há blocos compartilhados entre arquivos iguais
+	deduplicacao, erro := CalcularDeduplicacao(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if deduplicacao.BlocosCompartilhados > 0 {
+		fmt.Printf("%dKB de dados ocupam %dKB no disco, %d blocos compartilhados economizam %dKB\n", deduplicacao.BytesLogicos/1024, deduplicacao.BytesFisicos/1024, deduplicacao.BlocosCompartilhados, deduplicacao.BytesEconomizados/1024)
+	}
 	return nil
 }
 
 // ProtegerDesproteger arquivo protege ou desprotege um arquivo a depender se ele está protegido ou não
-func ProtegerDesprotegerArquivo(meuFS *os.File, cabecalho Cabecalho) error {
+func ProtegerDesprotegerArquivo(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Solicitando nome do arquivo a ser renomeado
 	var nomeArquivo string
 	fmt.Println("Digite o nome do arquivo que deseja proteger/desproteger: ")
 	fmt.Scanln(&nomeArquivo)
 	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
+	root := raiz.Entradas
 	// Vendo se arquivo existe no root
-	var indiceDoArquivoNoRoot int = -1
-	for indice, entrada := range root {
-		if strings.TrimRight(string(entrada.NomeArquivo[:]), "\x00") == nomeArquivo {
-			indiceDoArquivoNoRoot = indice
-			break
-		}
-	}
+	indiceDoArquivoNoRoot := BuscarEntrada(raiz, nomeArquivo)
 	if indiceDoArquivoNoRoot == -1 {
 		return errors.New("arquivo com esse nome não existe no sistema de arquivos meufs")
 	}
+	// Só o dono do arquivo pode mudar a proteção
+	if erro = verificarDono(IdentidadeDoProcesso(), root[indiceDoArquivoNoRoot], []string{nomeArquivo}); erro != nil {
+		return erro
+	}
 	var confirmacao string
 	var mensagem string
-	// Vendo se arquivo é protegido
-	if root[indiceDoArquivoNoRoot].Protegido == 1 {
+	// Vendo se arquivo é protegido (somente leitura)
+	if root[indiceDoArquivoNoRoot].Atributos&AtributoSomenteLeitura != 0 {
 		// Arquivo protegido = desproteger
 		fmt.Println("Esse arquivo está protegido. Deseja desprotege-lo? S/N")
 		fmt.Scanln(&confirmacao)
 		if confirmacao != "S" {
 			return errors.New("operação encerrada")
 		}
-		root[indiceDoArquivoNoRoot].Protegido = 0
+		// Se o volume tiver senha de administrador, ela é pedida antes de desproteger
+		definida, erro := SenhaAdminDefinida(cabecalho, meuFS)
+		if erro != nil {
+			return erro
+		}
+		if definida {
+			senha, erro := LerSenha("Digite a senha de administrador do volume: ")
+			if erro != nil {
+				return erro
+			}
+			if erro = VerificarSenhaAdmin(cabecalho, meuFS, IdentidadeDoProcesso(), senha); erro != nil {
+				return erro
+			}
+		}
+		root[indiceDoArquivoNoRoot].Atributos &^= AtributoSomenteLeitura
 		mensagem = "Arquivo desprotegido com sucesso"
 	} else {
 		// Arquivo não protegido = proteger
@@ -582,7 +681,7 @@ func ProtegerDesprotegerArquivo(meuFS *os.File, cabecalho Cabecalho) error {
 		if confirmacao != "S" {
 			return errors.New("operação encerrada")
 		}
-		root[indiceDoArquivoNoRoot].Protegido = 1
+		root[indiceDoArquivoNoRoot].Atributos |= AtributoSomenteLeitura
 		mensagem = "Arquivo protegido com sucesso"
 	}
 	// Salvando root atualizado
@@ -606,82 +705,32 @@ func ProtegerDesprotegerArquivo(meuFS *os.File, cabecalho Cabecalho) error {
 }
 
 // Criar diretório cria um diretório dentro do diretório atual
-func CriarDiretorio(meuFS *os.File, cabecalho Cabecalho) error {
+func CriarDiretorio(meuFS *MeuFS, cabecalho Cabecalho) error {
 	// Solicitando nome do diretório
 	var nomeDiretorio string
 	fmt.Println("Digite o nome que quer dar ao diretório: ")
 	fmt.Scanln(&nomeDiretorio)
-	if len(nomeDiretorio) > 19 {
-		return errors.New("nome do diretorio nao pode ter mais de 19 caracteres")
-	}
-	// OBS: com um limite de 157 entradas o diretório ocupará 1 bloco
-	// Lendo FAT
-	fat, erro := LerFAT(cabecalho, meuFS)
+	// Vendo se já existe uma entrada com esse nome, quando o usuário escolhe o que fazer
+	raiz, erro := LerDiretorioRaiz(cabecalho, meuFS)
 	if erro != nil {
 		return erro
 	}
-	// Vendo se tem espaço livre para guardar o diretorio
-	indiceLivreFAT := -1
-	for indice, entrada := range fat {
-		if entrada == 0 {
-			indiceLivreFAT = indice
-			break
+	politica := DuplicadoFalhar
+	if indiceExistente := BuscarEntrada(raiz, nomeDiretorio); indiceExistente != -1 {
+		politica = PerguntarPoliticaDuplicado(nomeDiretorio)
+		// Um diretório existente é mantido como está
+		if politica == DuplicadoSobrescrever && raiz.Entradas[indiceExistente].EhDir == 1 {
+			fmt.Println("o diretório já existe!")
+			return nil
 		}
 	}
-	if indiceLivreFAT == -1 {
-		return errors.New("sistema de arquivos está cheio")
-	}
-	// Lendo root
-	root, erro := LerRoot(cabecalho, meuFS)
+	// A criação é a mesma do mkdir: o diretório começa em um bloco zerado e pede escrita no root
+	_, nomeUsado, erro := CriarEntradaComPolitica(cabecalho, meuFS, IdentidadeDoProcesso(), nil, nomeDiretorio, true, nil, politica)
 	if erro != nil {
 		return erro
 	}
-	// Vendo se tem espaço livre em root
-	var indiceLivreRoot int = -1
-	for indice, entrada := range root {
-		if string(entrada.NomeArquivo[:]) == nomeDiretorio && entrada.EhDir == 1 {
-			return fmt.Errorf("um diretorio com o nome '%s' já existe no sistema", nomeDiretorio)
-		}
-		if entrada.NomeArquivo[0] == 0 && indiceLivreRoot == -1 {
-			indiceLivreRoot = indice
-		}
-	}
-	if indiceLivreRoot == -1 {
-		return errors.New("diretorio raiz cheio, maximo de 200 arquivos atingido")
-	}
-	// Atualizando root
-	var novaEntradaRoot DiretorioRoot
-	copy(novaEntradaRoot.NomeArquivo[:], nomeDiretorio)
-	novaEntradaRoot.EnderecoFAT = uint32(indiceLivreFAT)
-	novaEntradaRoot.Protegido = 0
-	novaEntradaRoot.EhDir = 1
-	root[indiceLivreRoot] = novaEntradaRoot
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioRoot), 0)
-	if erro != nil {
-		return fmt.Errorf("erro ao posicionar o ponteiro no início do diretorio raiz: %w", erro)
-	}
-	// escrevendo root atualizado
-	erro = binary.Write(meuFS, binary.LittleEndian, root)
-	if erro != nil {
-		return fmt.Errorf("erro ao escrever root atualizado: %w", erro)
-	}
-	// Atualizando fat
-	fat[indiceLivreFAT] = 0xFFFFFFFF //numero hexadecimal uint32 muito maior que len da fat
-	// movendo ponteiro
-	_, erro = meuFS.Seek(int64(cabecalho.InicioFAT), 0)
-	if erro != nil {
-		return fmt.Errorf("erro ao posicionar ponteiro no inicio da FAT: %w", erro)
-	}
-	// escrevendo fat atualizada
-	erro = binary.Write(meuFS, binary.LittleEndian, fat)
-	if erro != nil {
-		return fmt.Errorf("erro ao escrever FAT atualizada: %w", erro)
-	}
-	// Garante que os dados estejam no disco
-	erro = meuFS.Sync()
-	if erro != nil {
-		return fmt.Errorf("erro ao sincronizar o arquivo: %w", erro)
+	if nomeUsado != nomeDiretorio {
+		fmt.Printf("o diretório foi criado como '%s'\n", nomeUsado)
 	}
 	fmt.Println("diretório criado com sucesso!")
 	return nil
@@ -0,0 +1,92 @@
+package meufs_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestMenuCriarDiretorio(t *testing.T) {
+	volume := novoVolume(t)
+	// O primeiro bloco livre fica com lixo, que o diretório novo não pode herdar como entradas
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	livre := 0
+	for fat[livre] != 0 {
+		livre++
+	}
+	lixo := []byte(strings.Repeat("lixo", int(volume.Cabecalho.TamanhoBloco)/4))
+	if _, erro = volume.Arquivo.WriteAt(lixo, meufs.PosicaoDoBloco(volume.Cabecalho, uint32(livre))); erro != nil {
+		t.Fatal(erro)
+	}
+	comEntrada(t, "d\n", func() { erro = meufs.CriarDiretorio(volume.Arquivo, volume.Cabecalho) })
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	dir, indice, erro := meufs.ResolverCaminho(volume.Cabecalho, volume.Arquivo, []string{"d"})
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	subdir, erro := meufs.LerSubdiretorio(volume.Cabecalho, volume.Arquivo, dir.Entradas[indice].EnderecoFAT)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if !meufs.DiretorioVazio(subdir) {
+		t.Fatal("o diretório criado pelo menu deveria começar vazio")
+	}
+	if dono := meufs.IdentidadeDoProcesso().Uid; dir.Entradas[indice].Dono != dono {
+		t.Fatalf("o diretório deveria ser do usuário %d, é do %d", dono, dir.Entradas[indice].Dono)
+	}
+	// Com o nome repetido, a opção 3 cria o diretório com outro nome
+	comEntrada(t, "d\n3\n", func() { erro = meufs.CriarDiretorio(volume.Arquivo, volume.Cabecalho) })
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = volume.Open("/d(1)"); erro != nil {
+		t.Fatalf("o diretório repetido deveria ter sido criado como d(1): %v", erro)
+	}
+	verificar(t, volume)
+}
+
+func TestMenuCopiarParaMeuFS(t *testing.T) {
+	volume := novoVolume(t)
+	real := filepath.Join(t.TempDir(), "real.txt")
+	original := strings.Repeat("conteúdo real ", 1000)
+	if erro := os.WriteFile(real, []byte(original), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	gravar(t, volume, "/igual.txt", original)
+	// Caminho, nome, sem preservar, sem cifra e sem compressão
+	var erro error
+	comEntrada(t, real+"\na.txt\nN\nN\nN\n", func() { erro = meufs.CopiarParaMeuFS(volume.Arquivo, volume.Cabecalho) })
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != original {
+		t.Fatalf("a.txt tem %d bytes diferentes do original", len(texto))
+	}
+	// Como o put, o menu compartilha os blocos de um arquivo igual
+	if enderecoFAT(t, volume, "a.txt") != enderecoFAT(t, volume, "igual.txt") {
+		t.Fatal("a.txt deveria compartilhar os blocos de igual.txt")
+	}
+	// Com o nome repetido, a opção 2 sobrescreve o arquivo, agora comprimido
+	if erro = os.WriteFile(real, []byte("outro"), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	comEntrada(t, real+"\na.txt\nN\nN\nS\n2\n", func() { erro = meufs.CopiarParaMeuFS(volume.Arquivo, volume.Cabecalho) })
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != "outro" {
+		t.Fatalf("a.txt deveria ter sido sobrescrito, tem %q", texto)
+	}
+	if texto := conteudo(t, volume, "/igual.txt"); texto != original {
+		t.Fatal("igual.txt compartilhava blocos com a.txt e não podia mudar")
+	}
+	verificar(t, volume)
+}
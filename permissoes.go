@@ -0,0 +1,361 @@
+package meufs
+
+import (
+	"fmt"
+	"io/fs"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Identidade é quem pede uma operação: o uid, o gid e os grupos suplementares usados para conferir as permissões
+// das entradas. Root marca o root, que pode tudo, e precisa ser ligado de propósito (IdentidadeRoot,
+// IdentidadeDoProcesso e IdentidadeDoUsuario o ligam para o uid 0). A Identidade zero é a de ninguém: sem Root,
+// o uid 0 não é dono de nenhuma entrada nem faz parte de nenhum grupo, e só usa os bits dos outros.
+// Admin informa que a senha de administrador do volume foi conferida (VerificarSenhaAdmin), o que nem o root dispensa
+type Identidade struct {
+	Uid    uint32
+	Gid    uint32
+	Grupos []uint32
+	Root   bool
+	Admin  bool
+}
+
+// IdentidadeRoot não tem restrições de acesso
+var IdentidadeRoot = Identidade{Root: true}
+
+// Acessos conferidos pelas permissões, com os mesmos valores dos bits rwx do Unix
+const (
+	AcessoLeitura  uint32 = 4
+	AcessoEscrita  uint32 = 2
+	AcessoExecucao uint32 = 1
+)
+
+// MascaraCriacao são os bits tirados do modo pedido ao criar um arquivo pela API de arquivos, como o umask 022 usual
+const MascaraCriacao uint32 = 022
+
+// IdentidadeDoProcesso retorna a identidade do usuário que está rodando o meufs
+func IdentidadeDoProcesso() Identidade {
+	return identidadeDoProcesso()
+}
+
+// IdentidadeDoUsuario monta a identidade de um usuário do sistema real pelo nome ou pelo uid, com o grupo principal
+// e os grupos suplementares. Um uid sem usuário no sistema usa o próprio número como gid
+func IdentidadeDoUsuario(nome string) (Identidade, error) {
+	usuario, erro := user.Lookup(nome)
+	if erro != nil {
+		uid, erroNumero := strconv.ParseUint(nome, 10, 32)
+		if erroNumero != nil {
+			return Identidade{}, fmt.Errorf("usuário '%s' desconhecido", nome)
+		}
+		if usuario, erro = user.LookupId(nome); erro != nil {
+			return Identidade{Uid: uint32(uid), Gid: uint32(uid), Root: uid == 0}, nil
+		}
+	}
+	uid, erro := strconv.ParseUint(usuario.Uid, 10, 32)
+	if erro != nil {
+		return Identidade{}, fmt.Errorf("usuário '%s' não tem um uid numérico", nome)
+	}
+	gid, _ := strconv.ParseUint(usuario.Gid, 10, 32)
+	identidade := Identidade{Uid: uint32(uid), Gid: uint32(gid), Root: uid == 0}
+	grupos, _ := usuario.GroupIds()
+	for _, texto := range grupos {
+		if grupo, erro := strconv.ParseUint(texto, 10, 32); erro == nil {
+			identidade.Grupos = append(identidade.Grupos, uint32(grupo))
+		}
+	}
+	return identidade, nil
+}
+
+// LerDono interpreta o argumento do chown: "dono", "dono:grupo" ou ":grupo", com nomes ou números.
+// A parte omitida volta como SemDono, que DefinirDono entende como "manter o atual"
+func LerDono(texto string) (uint32, uint32, error) {
+	textoDono, textoGrupo, _ := strings.Cut(texto, ":")
+	dono, grupo := SemDono, SemDono
+	if textoDono != "" {
+		identidade, erro := IdentidadeDoUsuario(textoDono)
+		if erro != nil {
+			return 0, 0, erro
+		}
+		dono = identidade.Uid
+	}
+	if textoGrupo != "" {
+		numero, erro := strconv.ParseUint(textoGrupo, 10, 32)
+		if erro != nil {
+			encontrado, erroGrupo := user.LookupGroup(textoGrupo)
+			if erroGrupo != nil {
+				return 0, 0, fmt.Errorf("grupo '%s' desconhecido", textoGrupo)
+			}
+			if numero, erro = strconv.ParseUint(encontrado.Gid, 10, 32); erro != nil {
+				return 0, 0, fmt.Errorf("grupo '%s' não tem um gid numérico", textoGrupo)
+			}
+		}
+		grupo = uint32(numero)
+	}
+	if dono == SemDono && grupo == SemDono {
+		return 0, 0, fmt.Errorf("dono inválido '%s', use dono, dono:grupo ou :grupo", texto)
+	}
+	return dono, grupo, nil
+}
+
+// EhRoot informa se a identidade é a do root
+func (i Identidade) EhRoot() bool {
+	return i.Root
+}
+
+// ehNinguem informa se a identidade é a Identidade zero, que não é dona de nada nem faz parte de nenhum grupo
+func (i Identidade) ehNinguem() bool {
+	return !i.Root && i.Uid == 0
+}
+
+// ehDono informa se a identidade é a dona registrada em uma entrada
+func (i Identidade) ehDono(dono uint32) bool {
+	return !i.ehNinguem() && dono != SemDono && dono == i.Uid
+}
+
+// pertenceAoGrupo informa se o grupo é o principal ou um dos suplementares da identidade
+func (i Identidade) pertenceAoGrupo(grupo uint32) bool {
+	return !i.ehNinguem() && grupo != SemDono && (i.Gid == grupo || slices.Contains(i.Grupos, grupo))
+}
+
+// PodeAcessar confere se a identidade tem o acesso pedido (AcessoLeitura, AcessoEscrita e AcessoExecucao combinados)
+// na entrada, como no Unix: o dono usa os bits do dono, quem é do grupo os do grupo e os demais os dos outros.
+// O root lê e escreve qualquer entrada e executa as que têm algum bit de execução. Entradas SemDono só usam os bits dos outros
+func PodeAcessar(identidade Identidade, entrada DiretorioRoot, acesso uint32) bool {
+	if identidade.EhRoot() {
+		return acesso&AcessoExecucao == 0 || entrada.EhDir == 1 || entrada.Modo&0111 != 0
+	}
+	bits := entrada.Modo & 7
+	switch {
+	case identidade.ehDono(entrada.Dono):
+		bits = entrada.Modo >> 6 & 7
+	case identidade.pertenceAoGrupo(entrada.Grupo):
+		bits = entrada.Modo >> 3 & 7
+	}
+	return bits&acesso == acesso
+}
+
+// VerificarAcesso confere se a identidade pode atravessar os diretórios do caminho (execução em cada um) e tem
+// o acesso pedido na entrada indicada por ele. Retorna um erro reconhecido por errors.Is como fs.ErrPermission
+func VerificarAcesso(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, acesso uint32) error {
+	entrada := entradaDoRoot
+	if len(caminho) > 0 {
+		dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+		if erro != nil {
+			return erro
+		}
+		entrada = dir.Entradas[indice]
+	}
+	if !PodeAcessar(identidade, entrada, acesso) {
+		return erroDePermissao(caminho, acesso)
+	}
+	return nil
+}
+
+// DefinirModo muda as permissões da entrada indicada pelo caminho, o que só o dono e o root podem fazer, desde que
+// ela não seja imutável nem somente anexar. Como no Unix, o setgid de um arquivo é desligado se quem muda o modo
+// não for do grupo dele
+func DefinirModo(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, modo uint32) error {
+	if len(caminho) == 0 {
+		return NovoErroFS(fs.ErrPermission, "as permissões do root não podem ser alteradas")
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	entrada := &dir.Entradas[indice]
+	if erro = verificarDono(identidade, *entrada, caminho); erro != nil {
+		return erro
+	}
+	if erro = verificarEntradaAlteravel(*entrada, caminho); erro != nil {
+		return erro
+	}
+	modo &= 07777
+	if entrada.EhDir != 1 && !identidade.EhRoot() && !identidade.pertenceAoGrupo(entrada.Grupo) {
+		modo &^= 02000
+	}
+	entrada.Modo = modo
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// DefinirDono muda o dono e o grupo da entrada indicada pelo caminho. SemDono mantém o valor atual, como o -1 do chown.
+// Só o root troca o dono, e o dono só pode passar a entrada para um grupo do qual faça parte. Entradas imutáveis
+// e somente anexar não mudam de dono. Como no Unix, a troca desliga o setuid e o setgid dos arquivos
+func DefinirDono(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, dono uint32, grupo uint32) error {
+	if len(caminho) == 0 {
+		return NovoErroFS(fs.ErrPermission, "o dono do root não pode ser alterado")
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	entrada := &dir.Entradas[indice]
+	if erro = verificarEntradaAlteravel(*entrada, caminho); erro != nil {
+		return erro
+	}
+	if dono == SemDono {
+		dono = entrada.Dono
+	}
+	if grupo == SemDono {
+		grupo = entrada.Grupo
+	}
+	if !identidade.EhRoot() {
+		if dono != entrada.Dono {
+			return NovoErroFS(fs.ErrPermission, "só o root pode trocar o dono de '/%s'", strings.Join(caminho, "/"))
+		}
+		if erro = verificarDono(identidade, *entrada, caminho); erro != nil {
+			return erro
+		}
+		if grupo != entrada.Grupo && !identidade.pertenceAoGrupo(grupo) {
+			return NovoErroFS(fs.ErrPermission, "não é possível passar '/%s' para um grupo do qual você não faz parte", strings.Join(caminho, "/"))
+		}
+	}
+	if entrada.EhDir != 1 && (dono != entrada.Dono || grupo != entrada.Grupo) {
+		entrada.Modo &^= 06000
+	}
+	entrada.Dono, entrada.Grupo = dono, grupo
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// abrirComPermissao percorre os componentes a partir do root como AbrirDiretorio, conferindo a permissão de execução
+// de cada diretório atravessado, e retorna o diretório indicado e a sua entrada (sem conferir o acesso a ele)
+func abrirComPermissao(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, partes []string) (Diretorio, DiretorioRoot, error) {
+	dir, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return Diretorio{}, DiretorioRoot{}, erro
+	}
+	entrada := entradaDoRoot
+	for indiceParte, parte := range partes {
+		if !PodeAcessar(identidade, entrada, AcessoExecucao) {
+			return Diretorio{}, DiretorioRoot{}, erroDePermissao(partes[:indiceParte], AcessoExecucao)
+		}
+		indice := BuscarEntrada(dir, parte)
+		if indice == -1 {
+			return Diretorio{}, DiretorioRoot{}, NovoErroFS(fs.ErrNotExist, "diretorio '%s' não existe", parte)
+		}
+		entrada = dir.Entradas[indice]
+		if entrada.EhDir != 1 {
+			return Diretorio{}, DiretorioRoot{}, fmt.Errorf("'%s' não é um diretorio", parte)
+		}
+		if dir, erro = LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT); erro != nil {
+			return Diretorio{}, DiretorioRoot{}, erro
+		}
+	}
+	return dir, entrada, nil
+}
+
+// resolverComPermissao é o ResolverCaminho que confere a permissão de execução de cada diretório do caminho.
+// Retorna também a entrada do diretório que contém a entrada indicada
+func resolverComPermissao(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, partes []string) (Diretorio, int, DiretorioRoot, error) {
+	if len(partes) == 0 {
+		return Diretorio{}, -1, DiretorioRoot{}, NovoErroFS(fs.ErrInvalid, "caminho vazio")
+	}
+	caminhoDir := partes[:len(partes)-1]
+	dir, entradaDir, erro := abrirComPermissao(cabecalho, meuFS, identidade, caminhoDir)
+	if erro != nil {
+		return Diretorio{}, -1, DiretorioRoot{}, erro
+	}
+	if !PodeAcessar(identidade, entradaDir, AcessoExecucao) {
+		return Diretorio{}, -1, DiretorioRoot{}, erroDePermissao(caminhoDir, AcessoExecucao)
+	}
+	nome := partes[len(partes)-1]
+	indice := BuscarEntrada(dir, nome)
+	if indice == -1 {
+		return Diretorio{}, -1, DiretorioRoot{}, NovoErroFS(fs.ErrNotExist, "'%s' não existe no sistema de arquivos meufs", nome)
+	}
+	return dir, indice, entradaDir, nil
+}
+
+// verificarCriacao confere se a identidade pode criar entradas no diretório, o que pede escrita e execução nele
+// e que ele não seja imutável. A Identidade zero não cria nem tira entradas, já que elas ficariam sem um dono
+func verificarCriacao(identidade Identidade, entradaDir DiretorioRoot, caminhoDir []string) error {
+	if identidade.ehNinguem() {
+		return NovoErroFS(fs.ErrPermission, "é preciso uma identidade para alterar '/%s'", strings.Join(caminhoDir, "/"))
+	}
+	if !PodeAcessar(identidade, entradaDir, AcessoEscrita|AcessoExecucao) {
+		return erroDePermissao(caminhoDir, AcessoEscrita|AcessoExecucao)
+	}
+	return verificarDiretorioAlteravel(entradaDir, caminhoDir, true)
+}
+
+// verificarAlteracao confere se a identidade pode remover a entrada do diretório que a contém (ou renomeá-la ou
+// movê-la de lá). Além da escrita e da execução no diretório, se ele tiver o sticky bit (como o root, que é 1777)
+// só o dono da entrada, o dono do diretório e o root podem fazer isso, como no /tmp. Diretórios somente anexar
+// não deixam tirar entradas. Os atributos da própria entrada ficam para quem chama
+func verificarAlteracao(identidade Identidade, entradaDir DiretorioRoot, entrada DiretorioRoot, caminho []string) error {
+	if erro := verificarCriacao(identidade, entradaDir, caminho[:len(caminho)-1]); erro != nil {
+		return erro
+	}
+	if erro := verificarDiretorioAlteravel(entradaDir, caminho[:len(caminho)-1], false); erro != nil {
+		return erro
+	}
+	if entradaDir.Modo&01000 != 0 && !identidade.EhRoot() && !identidade.ehDono(entrada.Dono) && !identidade.ehDono(entradaDir.Dono) {
+		return NovoErroFS(fs.ErrPermission, "'/%s' pertence a outro usuário e está em um diretorio com sticky bit", strings.Join(caminho, "/"))
+	}
+	return nil
+}
+
+// verificarDono confere se a identidade é a dona da entrada ou o root, exigido para mudar modo, dono, datas e proteção
+func verificarDono(identidade Identidade, entrada DiretorioRoot, caminho []string) error {
+	if !identidade.EhRoot() && !identidade.ehDono(entrada.Dono) {
+		return NovoErroFS(fs.ErrPermission, "só o dono pode alterar '/%s'", strings.Join(caminho, "/"))
+	}
+	return nil
+}
+
+// erroDePermissao monta o erro de acesso negado ao caminho
+func erroDePermissao(caminho []string, acesso uint32) error {
+	return NovoErroFS(fs.ErrPermission, "sem permissão de %s em '/%s'", descreverAcesso(acesso), strings.Join(caminho, "/"))
+}
+
+// descreverAcesso retorna o nome dos acessos pedidos, usado nas mensagens de erro
+func descreverAcesso(acesso uint32) string {
+	var nomes []string
+	if acesso&AcessoLeitura != 0 {
+		nomes = append(nomes, "leitura")
+	}
+	if acesso&AcessoEscrita != 0 {
+		nomes = append(nomes, "escrita")
+	}
+	if acesso&AcessoExecucao != 0 {
+		nomes = append(nomes, "execução")
+	}
+	return strings.Join(nomes, " e ")
+}
+
+// TextoDoModo formata o tipo e as permissões como no ls -l do Unix (ex: drwxr-xr-x, -rwsr-x---, drwxrwxrwt)
+func TextoDoModo(ehDir bool, modo uint32) string {
+	texto := []byte("-rwxrwxrwx")
+	if ehDir {
+		texto[0] = 'd'
+	}
+	for bit := 0; bit < 9; bit++ {
+		if modo&(1<<(8-bit)) == 0 {
+			texto[bit+1] = '-'
+		}
+	}
+	// setuid, setgid e sticky aparecem no lugar do x correspondente, em maiúscula se o x estiver desligado
+	especiais := []struct {
+		bit     uint32
+		posicao int
+		letra   byte
+	}{{04000, 3, 's'}, {02000, 6, 's'}, {01000, 9, 't'}}
+	for _, especial := range especiais {
+		if modo&especial.bit == 0 {
+			continue
+		}
+		if texto[especial.posicao] == 'x' {
+			texto[especial.posicao] = especial.letra
+		} else {
+			texto[especial.posicao] = especial.letra - 'a' + 'A'
+		}
+	}
+	return string(texto)
+}
@@ -0,0 +1,66 @@
+package meufs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExecutarScript executa os comandos do shell guardados no arquivo, um por linha, parando no primeiro erro.
+// Linhas vazias e começadas por '#' são ignoradas. Com desfazer, se algum comando falhar todas
+// as alterações feitas pelo script são revertidas
+func ExecutarScript(meuFS *MeuFS, cabecalho Cabecalho, caminho string, desfazer bool) error {
+	script, erro := os.Open(caminho)
+	if erro != nil {
+		return fmt.Errorf("erro ao abrir script: %w", erro)
+	}
+	defer script.Close()
+	var transacao *Transacao
+	if desfazer {
+		if transacao, erro = IniciarTransacao(meuFS, cabecalho); erro != nil {
+			return erro
+		}
+		defer transacao.Encerrar()
+	}
+	erro = executarLinhas(NovoShell(meuFS, cabecalho), script)
+	if erro != nil && transacao != nil {
+		if erroDesfazer := transacao.Desfazer(); erroDesfazer != nil {
+			return fmt.Errorf("%w; erro ao desfazer alterações: %v", erro, erroDesfazer)
+		}
+		return fmt.Errorf("%w; alterações do script desfeitas", erro)
+	}
+	if erro != nil {
+		return erro
+	}
+	fmt.Println("script executado com sucesso!")
+	return nil
+}
+
+// executarLinhas executa cada linha do script no shell até o fim, um exit ou o primeiro erro
+func executarLinhas(shell *Shell, script *os.File) error {
+	leitor := bufio.NewScanner(script)
+	numeroLinha := 0
+	for leitor.Scan() {
+		numeroLinha++
+		linha := strings.TrimSpace(leitor.Text())
+		if linha == "" || strings.HasPrefix(linha, "#") {
+			continue
+		}
+		argumentos, erro := DividirArgumentos(linha)
+		if erro == nil {
+			var sair bool
+			sair, erro = shell.ExecutarComando(argumentos)
+			if sair {
+				return nil
+			}
+		}
+		if erro != nil {
+			return fmt.Errorf("linha %d (%s): %w", numeroLinha, linha, erro)
+		}
+	}
+	if erro := leitor.Err(); erro != nil {
+		return fmt.Errorf("erro ao ler script: %w", erro)
+	}
+	return nil
+}
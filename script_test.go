@@ -0,0 +1,87 @@
+package meufs_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// escreverScript grava as linhas em um script temporário e retorna o caminho dele
+func escreverScript(t *testing.T, linhas ...string) string {
+	t.Helper()
+	caminho := filepath.Join(t.TempDir(), "script.txt")
+	if erro := os.WriteFile(caminho, []byte(strings.Join(linhas, "\n")+"\n"), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	return caminho
+}
+
+// existe informa se o caminho, dado pelos componentes, existe no volume
+func existe(volume *meufs.Volume, caminho ...string) bool {
+	_, _, erro := meufs.ResolverCaminho(volume.Cabecalho, volume.Arquivo, caminho)
+	return erro == nil
+}
+
+func TestExecutarScript(t *testing.T) {
+	volume := novoVolume(t)
+	origem := filepath.Join(t.TempDir(), "receita.txt")
+	if erro := os.WriteFile(origem, []byte("receita"), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	script := escreverScript(t,
+		"# comentários e linhas vazias são ignorados",
+		"",
+		`mkdir "/meus docs"`,
+		fmt.Sprintf(`put '%s' "/meus docs/r.txt"`, origem),
+		"exit",
+		"mkdir /depois-do-exit",
+	)
+	comSaida(t, func() {
+		if erro := meufs.ExecutarScript(volume.Arquivo, volume.Cabecalho, script, false); erro != nil {
+			t.Fatal(erro)
+		}
+	})
+	if texto := conteudo(t, volume, "/meus docs/r.txt"); texto != "receita" {
+		t.Fatalf("r.txt deveria ter sido guardado pelo script, tem %q", texto)
+	}
+	if existe(volume, "depois-do-exit") {
+		t.Fatal("as linhas depois do exit não deveriam ser executadas")
+	}
+}
+
+func TestExecutarScriptComErro(t *testing.T) {
+	for _, desfazer := range []bool{false, true} {
+		volume := novoVolume(t)
+		gravar(t, volume, "/a.txt", "original")
+		script := escreverScript(t,
+			"mkdir /novo",
+			"mv /a.txt /novo/",
+			"rm /inexistente",
+			"mkdir /depois-do-erro",
+		)
+		var erro error
+		comSaida(t, func() {
+			erro = meufs.ExecutarScript(volume.Arquivo, volume.Cabecalho, script, desfazer)
+		})
+		if erro == nil || !strings.Contains(erro.Error(), "linha 3") {
+			t.Fatalf("o script deveria parar na linha 3, parou com %v", erro)
+		}
+		if existe(volume, "depois-do-erro") {
+			t.Fatal("as linhas depois do erro não deveriam ser executadas")
+		}
+		// Sem desfazer, o que foi feito antes do erro fica; com desfazer, o volume volta ao que era
+		if desfazer == existe(volume, "novo") {
+			t.Fatalf("com desfazer %v, /novo existir deveria ser %v", desfazer, !desfazer)
+		}
+		if desfazer {
+			if texto := conteudo(t, volume, "/a.txt"); texto != "original" {
+				t.Fatalf("a.txt deveria voltar para o root, tem %q", texto)
+			}
+			verificar(t, volume)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package meufs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// derivarChave deriva uma chave da senha com o scrypt (RFC 7914), que gasta n*r*128 bytes de memória para tornar caro
+// testar muitas senhas. n é o custo (potência de 2), r o tamanho dos blocos e p o paralelismo
+func derivarChave(senha []byte, sal []byte, n int, r int, p int, tamanho int) ([]byte, error) {
+	if n < 2 || n&(n-1) != 0 {
+		return nil, errors.New("o custo do scrypt precisa ser uma potência de 2 maior que 1")
+	}
+	if r < 1 || p < 1 || r*p >= 1<<30 || r > (1<<30)/128/p || n > (1<<30)/128/r {
+		return nil, errors.New("parâmetros do scrypt grandes demais")
+	}
+	b := pbkdf2SHA256(senha, sal, 1, p*128*r)
+	x := make([]uint32, 32*r)
+	v := make([]uint32, 32*r*n)
+	for i := 0; i < p; i++ {
+		misturarScrypt(b[i*128*r:(i+1)*128*r], x, v, n, r)
+	}
+	return pbkdf2SHA256(senha, b, 1, tamanho), nil
+}
+
+// pbkdf2SHA256 é o PBKDF2 (RFC 8018) com HMAC-SHA256, usado pelo scrypt no início e no fim
+func pbkdf2SHA256(senha []byte, sal []byte, iteracoes int, tamanho int) []byte {
+	prf := hmac.New(sha256.New, senha)
+	chave := make([]byte, 0, tamanho+sha256.Size)
+	contador := make([]byte, 4)
+	for bloco := uint32(1); len(chave) < tamanho; bloco++ {
+		binary.BigEndian.PutUint32(contador, bloco)
+		prf.Reset()
+		prf.Write(sal)
+		prf.Write(contador)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iteracoes; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		chave = append(chave, t...)
+	}
+	return chave[:tamanho]
+}
+
+// misturarScrypt é o scryptROMix: preenche v com n versões de b e depois lê v em posições que dependem dos dados
+func misturarScrypt(b []byte, x []uint32, v []uint32, n int, r int) {
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	tamanho := 32 * r
+	for i := 0; i < n; i++ {
+		copy(v[i*tamanho:], x)
+		misturarBlocos(x, r)
+	}
+	for i := 0; i < n; i++ {
+		j := int(x[(2*r-1)*16] & uint32(n-1))
+		for k := range x {
+			x[k] ^= v[j*tamanho+k]
+		}
+		misturarBlocos(x, r)
+	}
+	for i, palavra := range x {
+		binary.LittleEndian.PutUint32(b[i*4:], palavra)
+	}
+}
+
+// misturarBlocos é o scryptBlockMix com o Salsa20/8 sobre os 2*r blocos de 16 palavras de x
+func misturarBlocos(x []uint32, r int) {
+	var t [16]uint32
+	copy(t[:], x[(2*r-1)*16:])
+	y := make([]uint32, len(x))
+	for i := 0; i < 2*r; i++ {
+		for j := range t {
+			t[j] ^= x[i*16+j]
+		}
+		salsa208(&t)
+		// Os blocos pares vão para a primeira metade e os ímpares para a segunda
+		destino := (i/2 + (i%2)*r) * 16
+		copy(y[destino:], t[:])
+	}
+	copy(x, y)
+}
+
+// salsa208 aplica ao bloco as 8 rodadas do Salsa20 e soma o bloco original
+func salsa208(bloco *[16]uint32) {
+	x := *bloco
+	for rodada := 0; rodada < 8; rodada += 2 {
+		// Colunas
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+		// Linhas
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range bloco {
+		bloco[i] += x[i]
+	}
+}
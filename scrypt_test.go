@@ -0,0 +1,50 @@
+package meufs_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"meufs"
+)
+
+// Vetores de teste publicados na RFC 7914, seções 11 e 12
+func TestPBKDF2SHA256(t *testing.T) {
+	vetores := []struct {
+		senha, sal string
+		iteracoes  int
+		esperado   string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, vetor := range vetores {
+		chave := meufs.PBKDF2SHA256([]byte(vetor.senha), []byte(vetor.sal), vetor.iteracoes, 64)
+		if hex.EncodeToString(chave) != vetor.esperado {
+			t.Errorf("PBKDF2(%q, %q, %d) deveria ser %s, é %x", vetor.senha, vetor.sal, vetor.iteracoes, vetor.esperado, chave)
+		}
+	}
+}
+
+func TestScrypt(t *testing.T) {
+	vetores := []struct {
+		senha, sal string
+		n, r, p    int
+		esperado   string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, vetor := range vetores {
+		chave, erro := meufs.DerivarChave([]byte(vetor.senha), []byte(vetor.sal), vetor.n, vetor.r, vetor.p, 64)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if hex.EncodeToString(chave) != vetor.esperado {
+			t.Errorf("scrypt(%q, %q, %d, %d, %d) deveria ser %s, é %x", vetor.senha, vetor.sal, vetor.n, vetor.r, vetor.p, vetor.esperado, chave)
+		}
+	}
+	if _, erro := meufs.DerivarChave([]byte("senha"), nil, 1000, 8, 1, 64); erro == nil {
+		t.Fatal("um custo que não é potência de 2 deveria ser recusado")
+	}
+}
@@ -0,0 +1,253 @@
+package meufs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// CredencialAdmin guarda a senha de administrador do volume, logo depois do Cabecalho. Só o hash scrypt da senha
+// com um sal aleatório é guardado, junto com os parâmetros usados
+type CredencialAdmin struct {
+	Definida     uint8 // 1 se o volume tem senha de administrador
+	CustoLog2    uint8 // Parâmetros do scrypt: n = 2^CustoLog2, r e p
+	BlocosR      uint8
+	Paralelismo  uint8
+	Sal          [16]byte
+	Hash         [32]byte
+	Falhas       uint32 // Não são mais usados: as tentativas erradas ficam na AreaTentativas, separadas por uid
+	BloqueadoAte int64
+}
+
+// AreaTentativas fica no cabeçalho, logo depois da AreaIndiceConteudo, e guarda as tentativas erradas da senha de
+// administrador de cada uid. Assim quem erra a senha só bloqueia as próprias tentativas, e não as dos outros usuários.
+// Com todas as posições ocupadas, um uid novo toma o lugar do que tem o bloqueio mais antigo
+type AreaTentativas struct {
+	Uids [numTentativasUid]TentativasUid
+}
+
+// TentativasUid são as tentativas erradas seguidas de um uid
+type TentativasUid struct {
+	Ocupada      uint8 // 1 se a posição é de um uid
+	Uid          uint32
+	Falhas       uint32 // Tentativas erradas seguidas
+	BloqueadoAte int64  // Até quando novas tentativas são recusadas, em nanossegundos desde 01/01/1970 (UTC)
+}
+
+const numTentativasUid = 16
+
+// Parâmetros do scrypt das senhas novas: 32MB de memória e cerca de 100ms por tentativa
+const (
+	custoLog2Senha   = 15
+	blocosRSenha     = 8
+	paralelismoSenha = 1
+)
+
+// Depois de tentativasSemEspera erros seguidos de um uid, cada tentativa errada dele bloqueia as seguintes dele por um tempo que dobra
+// a cada erro, começando em esperaInicial e sem passar de esperaMaxima
+const (
+	tentativasSemEspera = 3
+	esperaInicial       = 30 * time.Second
+	esperaMaxima        = time.Hour
+)
+
+// ErrSenhaAdmin é retornado, também reconhecido como fs.ErrPermission, quando a operação pede a senha de
+// administrador do volume e a identidade não a conferiu com VerificarSenhaAdmin
+var ErrSenhaAdmin error = &ErroFS{Mensagem: "é preciso a senha de administrador do volume", Tipo: fs.ErrPermission}
+
+// posicaoCredencial é onde a credencial fica no meufs.fs, logo depois dos campos do Cabecalho
+func posicaoCredencial() int64 {
+	return int64(binary.Size(Cabecalho{}))
+}
+
+// LerCredencial lê a credencial de administrador do volume
+func LerCredencial(cabecalho Cabecalho, meuFS *MeuFS) (CredencialAdmin, error) {
+	var credencial CredencialAdmin
+	dados := make([]byte, binary.Size(credencial))
+	if _, erro := meuFS.ReadAt(dados, posicaoCredencial()); erro != nil {
+		return CredencialAdmin{}, fmt.Errorf("erro ao ler a senha de administrador: %w", erro)
+	}
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &credencial); erro != nil {
+		return CredencialAdmin{}, fmt.Errorf("erro ao ler a senha de administrador: %w", erro)
+	}
+	return credencial, nil
+}
+
+// posicaoAreaTentativas é onde a AreaTentativas fica no meufs.fs, logo depois da AreaIndiceConteudo
+func posicaoAreaTentativas() int64 {
+	return posicaoAreaIndice() + int64(binary.Size(AreaIndiceConteudo{}))
+}
+
+// LerTentativas lê as tentativas erradas da senha de administrador feitas pelo uid
+func LerTentativas(cabecalho Cabecalho, meuFS *MeuFS, uid uint32) (TentativasUid, error) {
+	area, erro := lerAreaTentativas(cabecalho, meuFS)
+	if erro != nil {
+		return TentativasUid{}, erro
+	}
+	for _, tentativas := range area.Uids {
+		if tentativas.Ocupada == 1 && tentativas.Uid == uid {
+			return tentativas, nil
+		}
+	}
+	return TentativasUid{}, nil
+}
+
+// lerAreaTentativas lê a AreaTentativas do cabeçalho
+func lerAreaTentativas(cabecalho Cabecalho, meuFS *MeuFS) (AreaTentativas, error) {
+	var area AreaTentativas
+	dados := make([]byte, binary.Size(area))
+	if _, erro := meuFS.ReadAt(dados, posicaoAreaTentativas()); erro != nil {
+		return AreaTentativas{}, fmt.Errorf("erro ao ler as tentativas de senha: %w", erro)
+	}
+	if erro := binary.Read(bytes.NewReader(dados), binary.LittleEndian, &area); erro != nil {
+		return AreaTentativas{}, fmt.Errorf("erro ao ler as tentativas de senha: %w", erro)
+	}
+	return area, nil
+}
+
+// salvarAreaTentativas grava a AreaTentativas no cabeçalho
+func salvarAreaTentativas(cabecalho Cabecalho, meuFS *MeuFS, area AreaTentativas) error {
+	var dados bytes.Buffer
+	binary.Write(&dados, binary.LittleEndian, area)
+	if _, erro := meuFS.WriteAt(dados.Bytes(), posicaoAreaTentativas()); erro != nil {
+		return fmt.Errorf("erro ao gravar as tentativas de senha: %w", erro)
+	}
+	return meuFS.Sync()
+}
+
+// posicao retorna a posição das tentativas do uid. Um uid sem posição recebe uma vazia ou, se não houver, a do
+// bloqueio mais antigo, zerada
+func (a *AreaTentativas) posicao(uid uint32) int {
+	escolhida := -1
+	for i, tentativas := range a.Uids {
+		if tentativas.Ocupada == 1 && tentativas.Uid == uid {
+			return i
+		}
+		if escolhida == -1 || a.Uids[escolhida].Ocupada == 1 && (tentativas.Ocupada == 0 || tentativas.BloqueadoAte < a.Uids[escolhida].BloqueadoAte) {
+			escolhida = i
+		}
+	}
+	a.Uids[escolhida] = TentativasUid{Ocupada: 1, Uid: uid}
+	return escolhida
+}
+
+// salvarCredencial grava a credencial de administrador no cabeçalho
+func salvarCredencial(cabecalho Cabecalho, meuFS *MeuFS, credencial CredencialAdmin) error {
+	var dados bytes.Buffer
+	binary.Write(&dados, binary.LittleEndian, credencial)
+	if _, erro := meuFS.WriteAt(dados.Bytes(), posicaoCredencial()); erro != nil {
+		return fmt.Errorf("erro ao gravar a senha de administrador: %w", erro)
+	}
+	return meuFS.Sync()
+}
+
+// SenhaAdminDefinida informa se o volume tem senha de administrador
+func SenhaAdminDefinida(cabecalho Cabecalho, meuFS *MeuFS) (bool, error) {
+	credencial, erro := LerCredencial(cabecalho, meuFS)
+	return credencial.Definida == 1, erro
+}
+
+// DefinirSenhaAdmin troca a senha de administrador do volume, ou a remove se a senha for vazia. Só o root define a
+// primeira senha, e trocar ou remover uma senha existente também pede que ela tenha sido conferida
+func DefinirSenhaAdmin(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senha string) error {
+	credencial, erro := LerCredencial(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if !identidade.EhRoot() {
+		return NovoErroFS(fs.ErrPermission, "só o root pode definir a senha de administrador")
+	}
+	if credencial.Definida == 1 && !identidade.Admin {
+		return ErrSenhaAdmin
+	}
+	// As tentativas erradas da senha antiga não contam para a nova
+	if erro = salvarAreaTentativas(cabecalho, meuFS, AreaTentativas{}); erro != nil {
+		return erro
+	}
+	if senha == "" {
+		return salvarCredencial(cabecalho, meuFS, CredencialAdmin{})
+	}
+	nova := CredencialAdmin{Definida: 1, CustoLog2: custoLog2Senha, BlocosR: blocosRSenha, Paralelismo: paralelismoSenha}
+	if _, erro = rand.Read(nova.Sal[:]); erro != nil {
+		return fmt.Errorf("erro ao gerar o sal da senha: %w", erro)
+	}
+	hash, erro := hashDaSenha(nova, senha)
+	if erro != nil {
+		return erro
+	}
+	copy(nova.Hash[:], hash)
+	return salvarCredencial(cabecalho, meuFS, nova)
+}
+
+// VerificarSenhaAdmin confere a senha de administrador do volume dada pela identidade. Depois de
+// tentativasSemEspera erros seguidos do mesmo uid, as novas tentativas dele são recusadas por um tempo que cresce
+// a cada erro, sem afetar os outros uids. O controle fica guardado no volume para valer também entre execuções
+// diferentes, e uma senha certa zera a contagem do uid
+func VerificarSenhaAdmin(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, senha string) error {
+	credencial, erro := LerCredencial(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if credencial.Definida != 1 {
+		return errors.New("o volume não tem senha de administrador")
+	}
+	area, erro := lerAreaTentativas(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	tentativas := &area.Uids[area.posicao(identidade.Uid)]
+	if espera := time.Until(TempoDaEntrada(tentativas.BloqueadoAte)); espera > 0 {
+		return NovoErroFS(fs.ErrPermission, "muitas tentativas erradas, tente de novo em %s", espera.Round(time.Second))
+	}
+	hash, erro := hashDaSenha(credencial, senha)
+	if erro != nil {
+		return erro
+	}
+	if subtle.ConstantTimeCompare(hash, credencial.Hash[:]) == 1 {
+		if tentativas.Falhas == 0 {
+			return nil
+		}
+		*tentativas = TentativasUid{}
+		return salvarAreaTentativas(cabecalho, meuFS, area)
+	}
+	tentativas.Falhas++
+	if tentativas.Falhas >= tentativasSemEspera {
+		espera := esperaMaxima
+		if excesso := tentativas.Falhas - tentativasSemEspera; excesso < 8 {
+			espera = min(esperaInicial<<excesso, esperaMaxima)
+		}
+		tentativas.BloqueadoAte = time.Now().Add(espera).UnixNano()
+	}
+	if erro = salvarAreaTentativas(cabecalho, meuFS, area); erro != nil {
+		return erro
+	}
+	return NovoErroFS(fs.ErrPermission, "senha de administrador incorreta")
+}
+
+// hashDaSenha calcula o hash scrypt da senha com o sal e os parâmetros da credencial
+func hashDaSenha(credencial CredencialAdmin, senha string) ([]byte, error) {
+	if credencial.CustoLog2 >= 31 {
+		return nil, errors.New("parâmetros da senha de administrador inválidos")
+	}
+	return derivarChave([]byte(senha), credencial.Sal[:], 1<<credencial.CustoLog2, int(credencial.BlocosR), int(credencial.Paralelismo), len(credencial.Hash))
+}
+
+// exigirSenhaAdmin retorna ErrSenhaAdmin se o volume tiver senha de administrador e a identidade não a tiver conferido
+func exigirSenhaAdmin(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade) error {
+	if identidade.Admin {
+		return nil
+	}
+	definida, erro := SenhaAdminDefinida(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if definida {
+		return ErrSenhaAdmin
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package meufs_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+func TestSenhaAdminBloqueioPorUid(t *testing.T) {
+	volume := novoVolume(t)
+	if erro := meufs.DefinirSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatal(erro)
+	}
+	usuario := meufs.Identidade{Uid: 1000, Gid: 1000}
+	for range 3 {
+		if erro := meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, usuario, "errada"); !errors.Is(erro, fs.ErrPermission) {
+			t.Fatalf("a senha errada deveria ser recusada com fs.ErrPermission, foi %v", erro)
+		}
+	}
+	// O uid que errou fica bloqueado, mesmo com a senha certa
+	erro := meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, usuario, "segredo")
+	if erro == nil || !strings.Contains(erro.Error(), "muitas tentativas") {
+		t.Fatalf("o uid 1000 deveria estar bloqueado, foi %v", erro)
+	}
+	// Os outros uids, inclusive o root, continuam podendo conferir a senha
+	if erro = meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatalf("o bloqueio do uid 1000 não deveria valer para o root: %v", erro)
+	}
+	outro := meufs.Identidade{Uid: 1001, Gid: 1001}
+	if erro = meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, outro, "errada"); erro == nil || strings.Contains(erro.Error(), "muitas tentativas") {
+		t.Fatalf("o uid 1001 ainda não errou e deveria só ter a senha recusada, foi %v", erro)
+	}
+	tentativas, erro := meufs.LerTentativas(volume.Cabecalho, volume.Arquivo, 1001)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if tentativas.Falhas != 1 {
+		t.Fatalf("o uid 1001 deveria ter 1 tentativa errada, tem %d", tentativas.Falhas)
+	}
+	// Trocar a senha zera as tentativas de todos
+	volume.Identidade.Admin = true
+	if erro = meufs.DefinirSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "outra"); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, usuario, "outra"); erro != nil {
+		t.Fatalf("depois da troca de senha o uid 1000 não deveria estar bloqueado: %v", erro)
+	}
+}
+
+func TestSenhaAdminTabelaCheia(t *testing.T) {
+	volume := novoVolume(t)
+	if erro := meufs.DefinirSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatal(erro)
+	}
+	// Mais uids do que posições na tabela: cada um erra uma vez e o primeiro acaba perdendo a posição
+	for uid := uint32(1); uid <= 17; uid++ {
+		meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, meufs.Identidade{Uid: uid}, "errada")
+	}
+	for uid := uint32(2); uid <= 17; uid++ {
+		if tentativas, erro := meufs.LerTentativas(volume.Cabecalho, volume.Arquivo, uid); erro != nil || tentativas.Falhas != 1 {
+			t.Fatalf("o uid %d deveria ter 1 tentativa errada, tem %d (%v)", uid, tentativas.Falhas, erro)
+		}
+	}
+	if tentativas, _ := meufs.LerTentativas(volume.Cabecalho, volume.Arquivo, 1); tentativas.Falhas != 0 {
+		t.Fatalf("o uid 1 deveria ter perdido a posição na tabela, tem %d tentativas", tentativas.Falhas)
+	}
+}
@@ -0,0 +1,835 @@
+package meufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos de mensagem do protocolo 9P2000
+const (
+	tversion9P = 100 + iota
+	rversion9P
+	tauth9P
+	rauth9P
+	tattach9P
+	rattach9P
+	terror9P // não é usada, existe só para manter a numeração
+	rerror9P
+	tflush9P
+	rflush9P
+	twalk9P
+	rwalk9P
+	topen9P
+	ropen9P
+	tcreate9P
+	rcreate9P
+	tread9P
+	rread9P
+	twrite9P
+	rwrite9P
+	tclunk9P
+	rclunk9P
+	tremove9P
+	rremove9P
+	tstat9P
+	rstat9P
+	twstat9P
+	rwstat9P
+)
+
+// Constantes do 9P2000 usadas pelo servidor
+const (
+	versao9P           = "9P2000"
+	semTag9P           = 0xFFFF
+	semFid9P           = 0xFFFFFFFF
+	qidDir9P           = 0x80
+	modoDir9P          = 0x80000000
+	modoAnexar9P       = 0x40000000
+	oEscrita9P         = 1
+	oLeituraEsc9P      = 2
+	oTruncar9P         = 0x10
+	oRemoverAoFechar9P = 0x40
+	msizeMaximo9P      = 64 * 1024
+	cabecalhoIO9P      = 24 // tamanho do cabeçalho de Rread/Twrite descontado do iounit
+)
+
+// Qid9P identifica unicamente um arquivo no servidor
+type Qid9P struct {
+	Tipo   uint8
+	Versao uint32
+	Path   uint64
+}
+
+// Stat9P é a estrutura de metadados trocada em Tstat/Twstat e nas leituras de diretório
+type Stat9P struct {
+	Tipo    uint16
+	Dev     uint32
+	Qid     Qid9P
+	Modo    uint32
+	Atime   uint32
+	Mtime   uint32
+	Tamanho uint64
+	Nome    string
+	Uid     string
+	Gid     string
+	Muid    string
+}
+
+// mensagem9P acumula os campos de uma mensagem sendo codificada ou decodificada
+type mensagem9P struct {
+	dados []byte
+	erro  bool
+}
+
+func (m *mensagem9P) u8() uint8 {
+	if len(m.dados) < 1 {
+		m.erro = true
+		return 0
+	}
+	v := m.dados[0]
+	m.dados = m.dados[1:]
+	return v
+}
+
+func (m *mensagem9P) u16() uint16 {
+	if len(m.dados) < 2 {
+		m.erro = true
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(m.dados)
+	m.dados = m.dados[2:]
+	return v
+}
+
+func (m *mensagem9P) u32() uint32 {
+	if len(m.dados) < 4 {
+		m.erro = true
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(m.dados)
+	m.dados = m.dados[4:]
+	return v
+}
+
+func (m *mensagem9P) u64() uint64 {
+	if len(m.dados) < 8 {
+		m.erro = true
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(m.dados)
+	m.dados = m.dados[8:]
+	return v
+}
+
+func (m *mensagem9P) bytes(n int) []byte {
+	if len(m.dados) < n {
+		m.erro = true
+		return nil
+	}
+	v := m.dados[:n]
+	m.dados = m.dados[n:]
+	return v
+}
+
+func (m *mensagem9P) texto() string {
+	return string(m.bytes(int(m.u16())))
+}
+
+func (m *mensagem9P) qid() Qid9P {
+	return Qid9P{Tipo: m.u8(), Versao: m.u32(), Path: m.u64()}
+}
+
+func (m *mensagem9P) stat() Stat9P {
+	m.u16() // tamanho da estrutura
+	return Stat9P{
+		Tipo:    m.u16(),
+		Dev:     m.u32(),
+		Qid:     m.qid(),
+		Modo:    m.u32(),
+		Atime:   m.u32(),
+		Mtime:   m.u32(),
+		Tamanho: m.u64(),
+		Nome:    m.texto(),
+		Uid:     m.texto(),
+		Gid:     m.texto(),
+		Muid:    m.texto(),
+	}
+}
+
+func (m *mensagem9P) putU8(v uint8) { m.dados = append(m.dados, v) }
+func (m *mensagem9P) putU16(v uint16) {
+	m.dados = binary.LittleEndian.AppendUint16(m.dados, v)
+}
+func (m *mensagem9P) putU32(v uint32) {
+	m.dados = binary.LittleEndian.AppendUint32(m.dados, v)
+}
+func (m *mensagem9P) putU64(v uint64) {
+	m.dados = binary.LittleEndian.AppendUint64(m.dados, v)
+}
+func (m *mensagem9P) putTexto(v string) {
+	m.putU16(uint16(len(v)))
+	m.dados = append(m.dados, v...)
+}
+func (m *mensagem9P) putQid(q Qid9P) {
+	m.putU8(q.Tipo)
+	m.putU32(q.Versao)
+	m.putU64(q.Path)
+}
+func (m *mensagem9P) putStat(s Stat9P) {
+	var corpo mensagem9P
+	corpo.putU16(s.Tipo)
+	corpo.putU32(s.Dev)
+	corpo.putQid(s.Qid)
+	corpo.putU32(s.Modo)
+	corpo.putU32(s.Atime)
+	corpo.putU32(s.Mtime)
+	corpo.putU64(s.Tamanho)
+	corpo.putTexto(s.Nome)
+	corpo.putTexto(s.Uid)
+	corpo.putTexto(s.Gid)
+	corpo.putTexto(s.Muid)
+	m.putU16(uint16(len(corpo.dados)))
+	m.dados = append(m.dados, corpo.dados...)
+}
+
+// lerMensagem9P lê uma mensagem completa da conexão e retorna seu tipo, tag e corpo
+func lerMensagem9P(conn io.Reader, msize uint32) (uint8, uint16, *mensagem9P, error) {
+	var tamanho [4]byte
+	if _, erro := io.ReadFull(conn, tamanho[:]); erro != nil {
+		return 0, 0, nil, erro
+	}
+	n := binary.LittleEndian.Uint32(tamanho[:])
+	if n < 7 || n > msize {
+		return 0, 0, nil, fmt.Errorf("mensagem 9P com tamanho inválido: %d", n)
+	}
+	dados := make([]byte, n-4)
+	if _, erro := io.ReadFull(conn, dados); erro != nil {
+		return 0, 0, nil, erro
+	}
+	m := &mensagem9P{dados: dados}
+	tipo := m.u8()
+	tag := m.u16()
+	return tipo, tag, m, nil
+}
+
+// escreverMensagem9P envia uma mensagem com o tipo, tag e corpo informados
+func escreverMensagem9P(conn io.Writer, tipo uint8, tag uint16, corpo []byte) error {
+	var m mensagem9P
+	m.putU32(uint32(7 + len(corpo)))
+	m.putU8(tipo)
+	m.putU16(tag)
+	m.dados = append(m.dados, corpo...)
+	_, erro := conn.Write(m.dados)
+	return erro
+}
+
+// Servidor9P expõe um volume meufs pelo protocolo 9P2000.
+// Como não há autenticação, clientes que se anexam como root (uid 0) são recusados, a não ser com PermitirRoot
+type Servidor9P struct {
+	volume       *Volume
+	PermitirRoot bool
+}
+
+// NovoServidor9P cria um servidor 9P para o volume informado
+func NovoServidor9P(volume *Volume) *Servidor9P {
+	return &Servidor9P{volume: volume}
+}
+
+// fid9P guarda o estado de um fid de uma conexão.
+// Diretórios abertos guardam a listagem montada no Topen, lida em partes pelos Tread, e o offset em que a próxima
+// leitura da listagem tem que começar
+type fid9P struct {
+	caminho        []string
+	aberto         bool
+	modo           uint8
+	listagem       []byte
+	offsetListagem uint64
+	cifra          *CifraArquivo
+}
+
+// conexao9P guarda o estado de uma conexão de um cliente.
+// A identidade vem do nome de usuário do Tattach e é usada para conferir as permissões
+type conexao9P struct {
+	servidor   *Servidor9P
+	conn       net.Conn
+	msize      uint32
+	fids       map[uint32]*fid9P
+	identidade Identidade
+}
+
+// EnderecoDeRede separa um endereço no formato "tcp:host:porta" ou "unix:/caminho" em rede e endereço
+func EnderecoDeRede(endereco string) (string, string, error) {
+	rede, resto, ok := strings.Cut(endereco, ":")
+	if !ok || (rede != "tcp" && rede != "unix") {
+		return "", "", fmt.Errorf("endereço inválido '%s', use tcp:host:porta ou unix:/caminho", endereco)
+	}
+	return rede, resto, nil
+}
+
+// Servir aceita conexões do listener e atende cada uma em uma goroutine
+func (s *Servidor9P) Servir(listener net.Listener) error {
+	for {
+		conn, erro := listener.Accept()
+		if erro != nil {
+			return fmt.Errorf("erro ao aceitar conexão: %w", erro)
+		}
+		go s.ServirConexao(conn)
+	}
+}
+
+// ServirConexao atende as mensagens de uma conexão até ela ser encerrada
+func (s *Servidor9P) ServirConexao(conn net.Conn) error {
+	defer conn.Close()
+	c := &conexao9P{servidor: s, conn: conn, msize: msizeMaximo9P, fids: make(map[uint32]*fid9P)}
+	// Ao desconectar, os fids são fechados para que os abertos com ORCLOSE sejam removidos
+	defer func() {
+		s.volume.Lock()
+		defer s.volume.Unlock()
+		for numero := range c.fids {
+			c.clunk(numero)
+		}
+	}()
+	for {
+		tipo, tag, m, erro := lerMensagem9P(conn, c.msize)
+		if erro != nil {
+			if errors.Is(erro, io.EOF) {
+				return nil
+			}
+			return erro
+		}
+		resposta, erro := c.atender(tipo, m)
+		if erro == nil && m.erro {
+			erro = errors.New("mensagem 9P mal formada")
+		}
+		if erro != nil {
+			var corpo mensagem9P
+			corpo.putTexto(erro.Error())
+			erro = escreverMensagem9P(conn, rerror9P, tag, corpo.dados)
+		} else {
+			erro = escreverMensagem9P(conn, tipo+1, tag, resposta)
+		}
+		if erro != nil {
+			return erro
+		}
+	}
+}
+
+// atender executa a requisição e retorna o corpo da resposta
+func (c *conexao9P) atender(tipo uint8, m *mensagem9P) ([]byte, error) {
+	volume := c.servidor.volume
+	volume.Lock()
+	defer volume.Unlock()
+	var r mensagem9P
+	switch tipo {
+	case tversion9P:
+		msize := m.u32()
+		versao := m.texto()
+		// Uma nova versão reinicia a sessão
+		for numero := range c.fids {
+			c.clunk(numero)
+		}
+		c.msize = min(msize, msizeMaximo9P)
+		if !strings.HasPrefix(versao, versao9P) {
+			versao = "unknown"
+		} else {
+			versao = versao9P
+		}
+		r.putU32(c.msize)
+		r.putTexto(versao)
+	case tauth9P:
+		return nil, errors.New("autenticação não é necessária")
+	case tattach9P:
+		fid := m.u32()
+		m.u32() // afid
+		usuario := m.texto()
+		m.texto()
+		if _, existe := c.fids[fid]; existe {
+			return nil, errors.New("fid já está em uso")
+		}
+		// Não há autenticação: o servidor confia no nome (ou uid) de usuário informado pelo cliente, menos no root
+		identidade, erro := IdentidadeDoUsuario(usuario)
+		if erro != nil {
+			return nil, erro
+		}
+		if identidade.EhRoot() && !c.servidor.PermitirRoot {
+			return nil, NovoErroFS(fs.ErrPermission, "anexar como root não é permitido neste servidor")
+		}
+		c.identidade = identidade
+		c.fids[fid] = &fid9P{}
+		r.putQid(Qid9P{Tipo: qidDir9P})
+	case tflush9P:
+		// As requisições são atendidas em ordem, não há o que cancelar
+		m.u16()
+	case twalk9P:
+		return c.walk(m)
+	case topen9P:
+		return c.open(m.u32(), m.u8())
+	case tcreate9P:
+		return c.create(m.u32(), m.texto(), m.u32(), m.u8())
+	case tread9P:
+		return c.read(m.u32(), m.u64(), m.u32())
+	case twrite9P:
+		fid := m.u32()
+		offset := m.u64()
+		dados := m.bytes(int(m.u32()))
+		return c.write(fid, offset, dados)
+	case tclunk9P:
+		fid := m.u32()
+		if _, existe := c.fids[fid]; !existe {
+			return nil, errors.New("fid desconhecido")
+		}
+		return nil, c.clunk(fid)
+	case tremove9P:
+		fid := m.u32()
+		f, existe := c.fids[fid]
+		if !existe {
+			return nil, errors.New("fid desconhecido")
+		}
+		// O fid é liberado mesmo se a remoção falhar
+		delete(c.fids, fid)
+		return nil, RemoverEntrada(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho)
+	case tstat9P:
+		f, existe := c.fids[m.u32()]
+		if !existe {
+			return nil, errors.New("fid desconhecido")
+		}
+		stat, erro := c.stat(f.caminho)
+		if erro != nil {
+			return nil, erro
+		}
+		var s mensagem9P
+		s.putStat(stat)
+		r.putU16(uint16(len(s.dados)))
+		r.dados = append(r.dados, s.dados...)
+	case twstat9P:
+		fid := m.u32()
+		m.u16()
+		return nil, c.wstat(fid, m.stat())
+	default:
+		return nil, fmt.Errorf("mensagem 9P não suportada: %d", tipo)
+	}
+	return r.dados, nil
+}
+
+// entrada retorna a entrada de diretório do caminho, ou uma entrada de diretório vazia para o root
+func (c *conexao9P) entrada(caminho []string) (DiretorioRoot, error) {
+	if len(caminho) == 0 {
+		return entradaDoRoot, nil
+	}
+	dir, indice, erro := ResolverCaminho(c.servidor.volume.Cabecalho, c.servidor.volume.Arquivo, caminho)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return dir.Entradas[indice], nil
+}
+
+// qidDaEntrada usa a data de criação da entrada, que nunca se repete (ver agora) e não muda ao escrever, renomear ou
+// mover, como identificador único, e o root é o path 0. A versão vem da data de modificação, que muda a cada escrita.
+// Entradas sem data de criação usam um hash do caminho com o bit mais alto ligado para não colidir com as demais
+func qidDaEntrada(entrada DiretorioRoot, caminho []string) Qid9P {
+	if len(caminho) == 0 {
+		return Qid9P{Tipo: qidDir9P}
+	}
+	qid := Qid9P{Path: uint64(entrada.Criado), Versao: uint32(entrada.Modificado) ^ uint32(entrada.Modificado>>32)}
+	if entrada.Criado == 0 {
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(caminho, "/")))
+		qid.Path = hash.Sum64() | 1<<63
+	}
+	if entrada.EhDir == 1 {
+		qid.Tipo = qidDir9P
+	}
+	return qid
+}
+
+// statDaEntrada monta a estrutura Stat9P de uma entrada do meufs
+func statDaEntrada(entrada DiretorioRoot, caminho []string) Stat9P {
+	nome := "/"
+	if len(caminho) > 0 {
+		nome = caminho[len(caminho)-1]
+	}
+	stat := Stat9P{
+		Qid:     qidDaEntrada(entrada, caminho),
+		Modo:    entrada.Modo & 0777,
+		Tamanho: uint64(entrada.Tamanho),
+		Atime:   uint32(TempoDaEntrada(entrada.Acessado).Unix()),
+		Mtime:   uint32(TempoDaEntrada(entrada.Modificado).Unix()),
+		Nome:    nome,
+		Uid:     nomeDoDono9P(entrada.Dono),
+		Gid:     nomeDoDono9P(entrada.Grupo),
+		Muid:    "meufs",
+	}
+	if entrada.EhDir == 1 {
+		stat.Modo = modoDir9P | entrada.Modo&0777
+		stat.Tamanho = 0
+	} else if entrada.Atributos&AtributoSomenteAnexar != 0 {
+		stat.Modo |= modoAnexar9P
+	}
+	return stat
+}
+
+// nomeDoDono9P usa o número do uid ou do gid como nome, já que o 9P2000 identifica usuários e grupos por nome
+func nomeDoDono9P(id uint32) string {
+	if id == SemDono {
+		return "meufs"
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func (c *conexao9P) stat(caminho []string) (Stat9P, error) {
+	entrada, erro := c.entrada(caminho)
+	if erro != nil {
+		return Stat9P{}, erro
+	}
+	return statDaEntrada(entrada, caminho), nil
+}
+
+func (c *conexao9P) walk(m *mensagem9P) ([]byte, error) {
+	fid := m.u32()
+	novoFid := m.u32()
+	nomes := make([]string, m.u16())
+	for i := range nomes {
+		nomes[i] = m.texto()
+	}
+	f, existe := c.fids[fid]
+	if !existe {
+		return nil, errors.New("fid desconhecido")
+	}
+	if f.aberto {
+		return nil, errors.New("fid já está aberto")
+	}
+	if _, existe := c.fids[novoFid]; existe && novoFid != fid {
+		return nil, errors.New("fid já está em uso")
+	}
+	caminho := append([]string(nil), f.caminho...)
+	var qids []Qid9P
+	for _, nome := range nomes {
+		entrada, erro := c.entrada(caminho)
+		if erro == nil && entrada.EhDir != 1 {
+			erro = errors.New("não é um diretorio")
+		}
+		if erro == nil && !PodeAcessar(c.identidade, entrada, AcessoExecucao) {
+			erro = erroDePermissao(caminho, AcessoExecucao)
+		}
+		if erro == nil {
+			if nome == ".." {
+				if len(caminho) > 0 {
+					caminho = caminho[:len(caminho)-1]
+				}
+			} else {
+				caminho = append(caminho, nome)
+			}
+			entrada, erro = c.entrada(caminho)
+		}
+		if erro != nil {
+			// Erro no primeiro nome é um erro, nos demais é um walk parcial
+			if len(qids) == 0 {
+				return nil, erro
+			}
+			break
+		}
+		qids = append(qids, qidDaEntrada(entrada, caminho))
+	}
+	if len(qids) == len(nomes) {
+		c.fids[novoFid] = &fid9P{caminho: caminho}
+	}
+	var r mensagem9P
+	r.putU16(uint16(len(qids)))
+	for _, qid := range qids {
+		r.putQid(qid)
+	}
+	return r.dados, nil
+}
+
+func (c *conexao9P) open(fid uint32, modo uint8) ([]byte, error) {
+	f, existe := c.fids[fid]
+	if !existe {
+		return nil, errors.New("fid desconhecido")
+	}
+	if f.aberto {
+		return nil, errors.New("fid já está aberto")
+	}
+	entrada, erro := c.entrada(f.caminho)
+	if erro != nil {
+		return nil, erro
+	}
+	escrita := modo&3 == oEscrita9P || modo&3 == oLeituraEsc9P || modo&oTruncar9P != 0
+	// Como no open do Unix, as permissões são conferidas ao abrir e valem para as leituras e escritas do fid
+	acesso := uint32(0)
+	if modo&3 != oEscrita9P {
+		acesso |= AcessoLeitura
+	}
+	if escrita {
+		acesso |= AcessoEscrita
+	}
+	if !PodeAcessar(c.identidade, entrada, acesso) {
+		return nil, erroDePermissao(f.caminho, acesso)
+	}
+	// Arquivos somente anexar podem ser abertos para escrita, mas não truncados, e só aceitam escritas no fim
+	if escrita && entrada.EhDir != 1 {
+		if erro = verificarConteudo(entrada, f.caminho, modo&oTruncar9P == 0); erro != nil {
+			return nil, erro
+		}
+	}
+	if entrada.EhDir == 1 {
+		if escrita {
+			return nil, errors.New("diretorios não podem ser abertos para escrita")
+		}
+		if f.listagem, erro = c.listagem(f.caminho); erro != nil {
+			return nil, erro
+		}
+	} else {
+		// Arquivos cifrados são abertos com a senha do volume. Sem ela, só podem ser esvaziados
+		volume := c.servidor.volume
+		truncar := modo&oTruncar9P != 0
+		if f.cifra, erro = AbrirCifra(volume.Cabecalho, volume.Arquivo, entrada, volume.SenhaArquivos); erro != nil && !(truncar && errors.Is(erro, ErrArquivoCifrado)) {
+			return nil, erro
+		}
+		if truncar {
+			if _, erro = TruncarArquivo(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, f.cifra, 0); erro != nil {
+				return nil, erro
+			}
+		}
+	}
+	if modo&3 != oEscrita9P {
+		volume := c.servidor.volume
+		if erro = MarcarAcesso(volume.Cabecalho, volume.Arquivo, f.caminho); erro != nil {
+			return nil, erro
+		}
+	}
+	f.aberto = true
+	f.modo = modo
+	var r mensagem9P
+	r.putQid(qidDaEntrada(entrada, f.caminho))
+	r.putU32(c.msize - cabecalhoIO9P)
+	return r.dados, nil
+}
+
+// listagem serializa o stat de cada entrada do diretório, formato esperado nas leituras de diretório
+func (c *conexao9P) listagem(caminho []string) ([]byte, error) {
+	volume := c.servidor.volume
+	dir, erro := AbrirDiretorio(volume.Cabecalho, volume.Arquivo, caminho)
+	if erro != nil {
+		return nil, erro
+	}
+	var r mensagem9P
+	for indice, nome := range dir.Nomes {
+		if nome != "" {
+			r.putStat(statDaEntrada(dir.Entradas[indice], append(append([]string(nil), caminho...), nome)))
+		}
+	}
+	return r.dados, nil
+}
+
+func (c *conexao9P) create(fid uint32, nome string, perm uint32, modo uint8) ([]byte, error) {
+	f, existe := c.fids[fid]
+	if !existe {
+		return nil, errors.New("fid desconhecido")
+	}
+	if f.aberto {
+		return nil, errors.New("fid já está aberto")
+	}
+	volume := c.servidor.volume
+	ehDir := perm&modoDir9P != 0
+	entradaDir, erro := c.entrada(f.caminho)
+	if erro != nil {
+		return nil, erro
+	}
+	entrada, erro := CriarEntrada(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, nome, ehDir, nil)
+	if erro != nil {
+		return nil, erro
+	}
+	caminho := append(append([]string(nil), f.caminho...), nome)
+	// Como no 9P2000, o novo arquivo não tem permissões que o diretório não tenha (só as de leitura e escrita nos arquivos)
+	mascara := uint32(0666)
+	if ehDir {
+		mascara = 0777
+	}
+	entrada.Modo = perm & (^mascara | entradaDir.Modo&mascara) & 0777
+	if erro = DefinirModo(volume.Cabecalho, volume.Arquivo, c.identidade, caminho, entrada.Modo); erro != nil {
+		return nil, erro
+	}
+	// O fid passa a representar o arquivo criado, já aberto
+	f.caminho = caminho
+	f.aberto = true
+	f.modo = modo
+	if ehDir {
+		f.listagem = []byte{}
+	}
+	var r mensagem9P
+	r.putQid(qidDaEntrada(entrada, f.caminho))
+	r.putU32(c.msize - cabecalhoIO9P)
+	return r.dados, nil
+}
+
+func (c *conexao9P) read(fid uint32, offset uint64, quantidade uint32) ([]byte, error) {
+	f, existe := c.fids[fid]
+	if !existe {
+		return nil, errors.New("fid desconhecido")
+	}
+	if !f.aberto {
+		return nil, errors.New("fid não está aberto")
+	}
+	quantidade = min(quantidade, c.msize-cabecalhoIO9P)
+	var dados []byte
+	if f.listagem != nil {
+		// Como no 9P2000, uma leitura de diretório começa no offset 0 ou onde a anterior parou, e só devolve entradas
+		// inteiras
+		if offset != 0 && offset != f.offsetListagem {
+			return nil, errors.New("offset de diretorio inválido")
+		}
+		resto := f.listagem[offset:]
+		fim := 0
+		for fim+2 <= len(resto) {
+			tamanho := 2 + int(binary.LittleEndian.Uint16(resto[fim:]))
+			if fim+tamanho > len(resto) || fim+tamanho > int(quantidade) {
+				break
+			}
+			fim += tamanho
+		}
+		dados = resto[:fim]
+		f.offsetListagem = offset + uint64(fim)
+	} else if f.modo&3 == oEscrita9P {
+		return nil, errors.New("arquivo não foi aberto para leitura")
+	} else {
+		entrada, erro := c.entrada(f.caminho)
+		if erro != nil {
+			return nil, erro
+		}
+		var conteudo bytes.Buffer
+		volume := c.servidor.volume
+		if offset < uint64(entrada.Tamanho) {
+			if erro = CopiarConteudo(volume.Cabecalho, volume.Arquivo, entrada, f.cifra, &conteudo, int64(offset), int64(quantidade)); erro != nil {
+				return nil, erro
+			}
+		}
+		dados = conteudo.Bytes()
+	}
+	var r mensagem9P
+	r.putU32(uint32(len(dados)))
+	r.dados = append(r.dados, dados...)
+	return r.dados, nil
+}
+
+func (c *conexao9P) write(fid uint32, offset uint64, dados []byte) ([]byte, error) {
+	f, existe := c.fids[fid]
+	if !existe {
+		return nil, errors.New("fid desconhecido")
+	}
+	if !f.aberto || (f.modo&3 != oEscrita9P && f.modo&3 != oLeituraEsc9P) {
+		return nil, errors.New("arquivo não foi aberto para escrita")
+	}
+	if f.listagem != nil {
+		return nil, errors.New("não é possível escrever em um diretorio")
+	}
+	volume := c.servidor.volume
+	if offset > uint64(volume.Cabecalho.TamanhoMeuFS) {
+		return nil, errors.New("arquivo não coube no sistema de arquivos")
+	}
+	if _, erro := EscreverNoArquivo(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, f.cifra, int64(offset), dados); erro != nil {
+		return nil, erro
+	}
+	var r mensagem9P
+	r.putU32(uint32(len(dados)))
+	return r.dados, nil
+}
+
+// clunk libera o fid, removendo o arquivo se ele foi aberto com ORCLOSE
+func (c *conexao9P) clunk(fid uint32) error {
+	f := c.fids[fid]
+	delete(c.fids, fid)
+	volume := c.servidor.volume
+	if f.aberto && f.modo&oRemoverAoFechar9P != 0 {
+		return RemoverEntrada(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho)
+	}
+	return nil
+}
+
+// wstat aceita renomear e alterar o tamanho, a data de modificação, as permissões e o grupo,
+// os demais campos precisam vir com o valor "não alterar"
+func (c *conexao9P) wstat(fid uint32, stat Stat9P) error {
+	f, existe := c.fids[fid]
+	if !existe {
+		return errors.New("fid desconhecido")
+	}
+	if len(f.caminho) == 0 {
+		return errors.New("o root não pode ser alterado")
+	}
+	volume := c.servidor.volume
+	if stat.Tamanho != ^uint64(0) {
+		entrada, erro := c.entrada(f.caminho)
+		if erro != nil {
+			return erro
+		}
+		if entrada.EhDir == 1 {
+			return errors.New("não é possível alterar o tamanho de um diretorio")
+		}
+		if stat.Tamanho > uint64(volume.Cabecalho.TamanhoMeuFS) {
+			return errors.New("arquivo não coube no sistema de arquivos")
+		}
+		if _, erro = TruncarArquivo(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, f.cifra, int64(stat.Tamanho)); erro != nil {
+			return erro
+		}
+	}
+	// Um mtime diferente de ~0 muda a data de modificação, como no touch
+	if stat.Mtime != ^uint32(0) {
+		if erro := DefinirTempos(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, time.Time{}, time.Unix(int64(stat.Mtime), 0)); erro != nil {
+			return erro
+		}
+	}
+	// O modo do 9P2000 só tem os bits rwx, então setuid, setgid e sticky são mantidos
+	if stat.Modo != ^uint32(0) {
+		entrada, erro := c.entrada(f.caminho)
+		if erro != nil {
+			return erro
+		}
+		if erro = DefinirModo(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, entrada.Modo&^0777|stat.Modo&0777); erro != nil {
+			return erro
+		}
+	}
+	if stat.Gid != "" {
+		_, grupo, erro := LerDono(":" + stat.Gid)
+		if erro != nil {
+			return erro
+		}
+		if erro = DefinirDono(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, SemDono, grupo); erro != nil {
+			return erro
+		}
+	}
+	nomeAtual := f.caminho[len(f.caminho)-1]
+	if stat.Nome != "" && stat.Nome != nomeAtual {
+		if erro := RenomearEntrada(volume.Cabecalho, volume.Arquivo, c.identidade, f.caminho, stat.Nome); erro != nil {
+			return erro
+		}
+		f.caminho[len(f.caminho)-1] = stat.Nome
+	}
+	return nil
+}
+
+// ServirArquivos9P escuta no endereço informado e atende clientes 9P até ocorrer um erro.
+// Clientes só podem se anexar como root com permitirRoot. O volume é compartilhado com quem mais o usar, sob a
+// mesma trava
+func ServirArquivos9P(volume *Volume, endereco string, permitirRoot bool) error {
+	rede, caminho, erro := EnderecoDeRede(endereco)
+	if erro != nil {
+		return erro
+	}
+	listener, erro := net.Listen(rede, caminho)
+	if erro != nil {
+		return fmt.Errorf("erro ao escutar em %s: %w", endereco, erro)
+	}
+	defer listener.Close()
+	fmt.Printf("servidor 9P escutando em %s\n", endereco)
+	servidor := NovoServidor9P(volume)
+	servidor.PermitirRoot = permitirRoot
+	return servidor.Servir(listener)
+}
@@ -0,0 +1,241 @@
+package meufs_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"meufs"
+)
+
+// Modos e bits do 9P2000 usados nos testes
+const (
+	leitura9P      = 0
+	escrita9P      = 1
+	truncar9P      = 0x10
+	diretorio9P    = 0x80000000
+	qidDiretorio9P = 0x80
+)
+
+// conectar9P liga um cliente ao servidor 9P de um volume novo por um net.Pipe
+func conectar9P(t *testing.T, permitirRoot bool) *meufs.Cliente9P {
+	t.Helper()
+	volume := novoVolume(t)
+	servidor, ponta := net.Pipe()
+	servidor9P := meufs.NovoServidor9P(volume)
+	servidor9P.PermitirRoot = permitirRoot
+	go servidor9P.ServirConexao(servidor)
+	t.Cleanup(func() { ponta.Close() })
+	cliente, erro := meufs.NovoCliente9P(ponta)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return cliente
+}
+
+// novoCliente9P liga um cliente como root ao servidor 9P de um volume novo e retorna o fid do root
+func novoCliente9P(t *testing.T) (*meufs.Cliente9P, uint32) {
+	t.Helper()
+	cliente := conectar9P(t, true)
+	root, erro := cliente.Anexar("0")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return cliente, root
+}
+
+// criar9P cria o arquivo no diretório com o conteúdo informado, escrito em uma só mensagem
+func criar9P(t *testing.T, cliente *meufs.Cliente9P, root uint32, dir []string, nome string, conteudo []byte) {
+	t.Helper()
+	fid, erro := cliente.Caminhar(root, dir...)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if erro = cliente.Criar(fid, nome, 0644, escrita9P); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = cliente.Escrever(fid, 0, conteudo); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Fechar(fid)
+}
+
+// ler9P lê o arquivo inteiro em partes de até 4000 bytes
+func ler9P(t *testing.T, cliente *meufs.Cliente9P, root uint32, caminho ...string) []byte {
+	t.Helper()
+	fid, erro := cliente.Caminhar(root, caminho...)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer cliente.Fechar(fid)
+	if erro = cliente.Abrir(fid, leitura9P); erro != nil {
+		t.Fatal(erro)
+	}
+	var lido []byte
+	for {
+		parte, erro := cliente.Ler(fid, uint64(len(lido)), 4000)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if len(parte) == 0 {
+			return lido
+		}
+		lido = append(lido, parte...)
+	}
+}
+
+// stat9P retorna o stat do caminho
+func stat9P(t *testing.T, cliente *meufs.Cliente9P, root uint32, caminho ...string) meufs.Stat9P {
+	t.Helper()
+	fid, erro := cliente.Caminhar(root, caminho...)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer cliente.Fechar(fid)
+	stat, erro := cliente.Stat(fid)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return stat
+}
+
+func TestServidor9PArquivos(t *testing.T) {
+	cliente, root := novoCliente9P(t)
+	dir, _ := cliente.Caminhar(root)
+	if erro := cliente.Criar(dir, "docs", diretorio9P|0755, leitura9P); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Fechar(dir)
+	// Um arquivo escrito em duas partes, maior que um bloco
+	grande := make([]byte, 10000)
+	for i := range grande {
+		grande[i] = byte(i)
+	}
+	fid, _ := cliente.Caminhar(root, "docs")
+	if erro := cliente.Criar(fid, "a.bin", 0644, escrita9P); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Escrever(fid, 0, grande[:5000])
+	cliente.Escrever(fid, 5000, grande[5000:])
+	cliente.Fechar(fid)
+	if lido := ler9P(t, cliente, root, "docs", "a.bin"); !bytes.Equal(lido, grande) {
+		t.Fatalf("leu %d bytes diferentes dos %d escritos", len(lido), len(grande))
+	}
+	stat := stat9P(t, cliente, root, "docs", "a.bin")
+	if stat.Nome != "a.bin" || stat.Tamanho != 10000 || stat.Modo&0777 != 0644 {
+		t.Fatalf("stat inesperado: %+v", stat)
+	}
+	if stat := stat9P(t, cliente, root, "docs"); stat.Qid.Tipo != qidDiretorio9P || stat.Modo&diretorio9P == 0 {
+		t.Fatalf("docs deveria ser um diretório: %+v", stat)
+	}
+	// Abrir com OTRUNC esvazia o arquivo
+	fid, _ = cliente.Caminhar(root, "docs", "a.bin")
+	if erro := cliente.Abrir(fid, escrita9P|truncar9P); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Fechar(fid)
+	if stat := stat9P(t, cliente, root, "docs", "a.bin"); stat.Tamanho != 0 {
+		t.Fatalf("o arquivo deveria ter sido esvaziado, tem %d bytes", stat.Tamanho)
+	}
+	// Um diretório com algo dentro não pode ser removido
+	fid, _ = cliente.Caminhar(root, "docs")
+	if erro := cliente.Remover(fid); erro == nil {
+		t.Fatal("remover um diretório com arquivos deveria falhar")
+	}
+	fid, _ = cliente.Caminhar(root, "docs", "a.bin")
+	if erro := cliente.Remover(fid); erro != nil {
+		t.Fatal(erro)
+	}
+	fid, _ = cliente.Caminhar(root, "docs")
+	if erro := cliente.Remover(fid); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := cliente.Caminhar(root, "docs"); erro == nil {
+		t.Fatal("docs deveria ter sido removido")
+	}
+}
+
+func TestServidor9PListagem(t *testing.T) {
+	cliente, root := novoCliente9P(t)
+	for _, nome := range []string{"a", "b", "c"} {
+		criar9P(t, cliente, root, nil, nome, []byte(nome))
+	}
+	fid, _ := cliente.Caminhar(root)
+	if erro := cliente.Abrir(fid, leitura9P); erro != nil {
+		t.Fatal(erro)
+	}
+	listagem, erro := cliente.Ler(fid, 0, 8000)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	// Um offset que não é 0 nem o fim da leitura anterior é recusado, e o servidor continua atendendo
+	for _, offset := range []uint64{1, uint64(len(listagem) - 1), uint64(len(listagem) + 10)} {
+		if _, erro = cliente.Ler(fid, offset, 8000); erro == nil {
+			t.Fatalf("leitura do diretório no offset %d deveria falhar", offset)
+		}
+	}
+	resto, erro := cliente.Ler(fid, uint64(len(listagem)), 8000)
+	if erro != nil || len(resto) != 0 {
+		t.Fatalf("leitura no fim da listagem: %d bytes, erro %v", len(resto), erro)
+	}
+	// Ler de novo a partir do 0 devolve a listagem inteira
+	denovo, erro := cliente.Ler(fid, 0, 8000)
+	if erro != nil || !bytes.Equal(denovo, listagem) {
+		t.Fatalf("releitura da listagem: erro %v", erro)
+	}
+	cliente.Fechar(fid)
+	if stat := stat9P(t, cliente, root, "a"); stat.Tamanho != 1 {
+		t.Fatalf("o servidor deveria continuar atendendo: %+v", stat)
+	}
+}
+
+func TestServidor9PQid(t *testing.T) {
+	cliente, root := novoCliente9P(t)
+	// Arquivos iguais compartilham os blocos, mas não o qid
+	conteudo := bytes.Repeat([]byte("meufs"), 2000)
+	criar9P(t, cliente, root, nil, "a", conteudo)
+	criar9P(t, cliente, root, nil, "b", conteudo)
+	a, b := stat9P(t, cliente, root, "a"), stat9P(t, cliente, root, "b")
+	if a.Qid.Path == b.Qid.Path {
+		t.Fatalf("arquivos diferentes com o mesmo qid: %+v", a.Qid)
+	}
+	// Escrever muda a versão, mesmo quando os blocos são copiados, mas não o path
+	fid, _ := cliente.Caminhar(root, "a")
+	if erro := cliente.Abrir(fid, escrita9P); erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro := cliente.Escrever(fid, 3, []byte("XYZ")); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Fechar(fid)
+	depois := stat9P(t, cliente, root, "a")
+	if depois.Qid.Path != a.Qid.Path {
+		t.Fatalf("o path do qid mudou ao escrever: %d -> %d", a.Qid.Path, depois.Qid.Path)
+	}
+	if depois.Qid.Versao == a.Qid.Versao {
+		t.Fatal("a versão do qid deveria mudar ao escrever")
+	}
+}
+
+func TestServidor9PAnexarRoot(t *testing.T) {
+	cliente := conectar9P(t, false)
+	for _, usuario := range []string{"0", "root"} {
+		if _, erro := cliente.Anexar(usuario); erro == nil {
+			t.Fatalf("anexar como %q deveria ser recusado sem PermitirRoot", usuario)
+		}
+	}
+	// Outros usuários continuam podendo se anexar, com as permissões deles
+	root, erro := cliente.Anexar("1000")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	fid, _ := cliente.Caminhar(root)
+	if erro = cliente.Criar(fid, "a", 0644, escrita9P); erro != nil {
+		t.Fatal(erro)
+	}
+	cliente.Escrever(fid, 0, []byte("de 1000"))
+	cliente.Fechar(fid)
+	if stat := stat9P(t, cliente, root, "a"); stat.Tamanho != 7 {
+		t.Fatalf("stat inesperado: %+v", stat)
+	}
+}
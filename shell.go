@@ -0,0 +1,1189 @@
+package meufs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Shell é um interpretador de comandos nomeados sobre o meufs, com diretório atual e histórico.
+// Os comandos são executados com a identidade do usuário que roda o shell
+type Shell struct {
+	meuFS      *MeuFS
+	cabecalho  Cabecalho
+	identidade Identidade
+	atual      []string
+	historico  []string
+	leitor     *bufio.Reader
+	// senhaArquivos é a última senha que abriu um arquivo cifrado, tentada antes de pedir outra
+	senhaArquivos string
+	// snapshot é o nome do snapshot aberto pelo snapshot browse, que só pode ser lido
+	snapshot string
+}
+
+// comandosSnapshot são os comandos aceitos dentro de um snapshot, que não alteram nada
+var comandosSnapshot = []string{"ls", "cd", "pwd", "get", "cat", "stat", "lsattr", "history", "help", "exit", "sair"}
+
+// comandosShell lista os comandos do shell, usados pela ajuda, pelas mensagens de uso e pelo TAB
+var comandosShell = []struct {
+	nome      string
+	uso       string
+	descricao string
+}{
+	{"ls", "ls [-l] [-a] [--sort=name|size|time] [--type=file|dir] [--json] [caminho]", "lista os arquivos do diretório (-l: tipo e permissões, atributos, dono, grupo, tamanho, blocos, primeiro bloco, fragmentos, data de modificação e taxa de compressão, -a: inclusive os ocultos e do sistema)"},
+	{"cd", "cd [caminho]", "muda o diretório atual (sem caminho volta ao root)"},
+	{"pwd", "pwd", "mostra o diretório atual"},
+	{"put", "put [-r] [-p] [--encrypt] [--compress] [--if-exists=fail|overwrite|rename|skip] <arquivo real> [destino]", "copia um arquivo do sistema real para o meufs (-r: um diretório inteiro, -p: guarda permissões, data de modificação e dono, --encrypt: cifra o arquivo com uma senha, --compress: guarda o arquivo comprimido)"},
+	{"get", "get [-r] [-p] [--if-exists=fail|overwrite|rename|skip] <arquivo> [destino real]", "copia um arquivo do meufs para o sistema real (-r: um diretório inteiro, -p: aplica permissões, datas e dono guardados)"},
+	{"append", "append <arquivo real> <arquivo>", "acrescenta o conteúdo de um arquivo real ao fim de um arquivo do meufs"},
+	{"overwrite", "overwrite <arquivo real> <arquivo>", "substitui o conteúdo de um arquivo do meufs reaproveitando seus blocos"},
+	{"truncate", "truncate <tamanho> <arquivo>", "muda o tamanho de um arquivo, liberando ou acrescentando blocos"},
+	{"cat", "cat [--offset=N] [--length=N] <arquivo>", "escreve o conteúdo de um arquivo na saída padrão"},
+	{"mv", "mv [--if-exists=fail|overwrite|rename|skip] <caminho> <destino>", "move ou renomeia um arquivo ou diretório (se o destino for um diretório, move para dentro dele)"},
+	{"rename", "rename [--if-exists=fail|overwrite|rename|skip] <caminho> <destino>", "o mesmo que mv"},
+	{"rm", "rm [-r [-f]] <caminho>", "remove um arquivo ou diretório vazio (-r: um diretório e tudo dentro dele, -f: inclusive o que estiver protegido)"},
+	{"mkdir", "mkdir [--if-exists=fail|overwrite|rename|skip] <caminho>", "cria um diretório (overwrite aceita um diretório já existente)"},
+	{"protect", "protect <caminho>", "protege um arquivo de ser alterado ou removido (o mesmo que chattr +r)"},
+	{"unprotect", "unprotect <caminho>", "desprotege um arquivo (o mesmo que chattr -r)"},
+	{"lsattr", "lsattr [-a] [caminho]", "mostra os atributos dos arquivos do diretório (r: somente leitura, i: imutável, a: somente anexar, h: oculto, s: sistema, E: cifrado, c: comprimido)"},
+	{"chattr", "chattr <+|-|=atributos> <caminho>", "liga (+), desliga (-) ou define (=) os atributos r, i, a, h e s (i, a e s só pelo root)"},
+	{"passwd", "passwd [--remove]", "define ou troca a senha de administrador do volume, exigida para desproteger arquivos (só o root)"},
+	{"unlock", "unlock", "confere a senha de administrador do volume, que vale até o fim do shell"},
+	{"lock", "lock", "esquece a senha de administrador conferida pelo unlock e a senha dos arquivos cifrados"},
+	{"compress", "compress <arquivo>", "guarda o conteúdo de um arquivo comprimido, lido e alterado de forma transparente"},
+	{"decompress", "decompress <arquivo>", "guarda sem compressão o conteúdo de um arquivo comprimido"},
+	{"keyslot", "keyslot list|add|change|remove", "lista, acrescenta, troca ou remove as senhas de um volume cifrado (só o root muda)"},
+	{"encrypt", "encrypt <arquivo>", "cifra o conteúdo de um arquivo com uma senha, pedida ao ler ou alterar o arquivo"},
+	{"decrypt", "decrypt <arquivo>", "guarda sem cifra o conteúdo de um arquivo cifrado"},
+	{"chmod", "chmod <modo> <caminho>", "muda as permissões de um arquivo ou diretório (modo em octal, ex: 0640)"},
+	{"chown", "chown <dono>[:<grupo>] <caminho>", "muda o dono e o grupo, por nome ou número (só o root troca o dono)"},
+	{"df", "df [--json]", "mostra o espaço livre e quanto os arquivos comprimidos e os blocos compartilhados economizam"},
+	{"stat", "stat [--json] <caminho>", "mostra os detalhes de um arquivo ou diretório"},
+	{"snapshot", "snapshot create|list|browse|restore|delete [--json] [nome]", "cria, lista, abre para leitura, restaura ou apaga um snapshot do volume inteiro (só o root cria, restaura e apaga)"},
+	{"fsck", "fsck [--json]", "verifica a consistência do sistema de arquivos"},
+	{"history", "history", "mostra os comandos digitados"},
+	{"help", "help", "mostra esta ajuda"},
+	{"exit", "exit", "encerra o shell"},
+}
+
+// NovoShell cria um shell posicionado no root
+func NovoShell(meuFS *MeuFS, cabecalho Cabecalho) *Shell {
+	return &Shell{meuFS: meuFS, cabecalho: cabecalho, identidade: IdentidadeDoProcesso(), leitor: bufio.NewReader(os.Stdin)}
+}
+
+// Rodar lê e executa comandos até exit ou o fim da entrada
+func (s *Shell) Rodar() error {
+	for {
+		prompt := fmt.Sprintf("meufs:%s> ", s.diretorioAtual())
+		if s.snapshot != "" {
+			prompt = fmt.Sprintf("meufs@%s:%s> ", s.snapshot, s.diretorioAtual())
+		}
+		linha, erro := s.lerLinha(prompt)
+		if erro == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if erro != nil {
+			return fmt.Errorf("erro ao ler comando: %w", erro)
+		}
+		if strings.TrimSpace(linha) == "" {
+			continue
+		}
+		s.historico = append(s.historico, linha)
+		argumentos, erro := DividirArgumentos(linha)
+		if erro != nil {
+			fmt.Printf("%v\n", erro)
+			continue
+		}
+		sair, erro := s.ExecutarComando(argumentos)
+		if erro != nil {
+			fmt.Printf("%v\n", erro)
+		}
+		if sair {
+			return nil
+		}
+	}
+}
+
+// DividirArgumentos separa uma linha em argumentos como um shell Unix:
+// espaços separam argumentos, aspas simples agrupam literalmente, aspas duplas agrupam aceitando \" e \\,
+// e fora de aspas a barra invertida escapa o próximo caractere
+func DividirArgumentos(linha string) ([]string, error) {
+	argumentos, aspas, _ := dividirArgumentos(linha)
+	if aspas != 0 {
+		return nil, fmt.Errorf("aspas %c não foram fechadas", aspas)
+	}
+	return argumentos, nil
+}
+
+// dividirArgumentos também aceita linhas incompletas (usado pelo TAB).
+// Retorna a aspa que ficou aberta e se a linha termina no meio de um argumento
+func dividirArgumentos(linha string) ([]string, rune, bool) {
+	var argumentos []string
+	var atual strings.Builder
+	var aspas rune
+	emArgumento := false
+	runas := []rune(linha)
+	for i := 0; i < len(runas); i++ {
+		r := runas[i]
+		switch {
+		case aspas == '\'':
+			if r == '\'' {
+				aspas = 0
+			} else {
+				atual.WriteRune(r)
+			}
+		case aspas == '"':
+			if r == '"' {
+				aspas = 0
+			} else if r == '\\' && i+1 < len(runas) && (runas[i+1] == '"' || runas[i+1] == '\\') {
+				i++
+				atual.WriteRune(runas[i])
+			} else {
+				atual.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			aspas = r
+			emArgumento = true
+		case r == '\\':
+			emArgumento = true
+			if i+1 < len(runas) {
+				i++
+				atual.WriteRune(runas[i])
+			}
+		case unicode.IsSpace(r):
+			if emArgumento {
+				argumentos = append(argumentos, atual.String())
+				atual.Reset()
+				emArgumento = false
+			}
+		default:
+			atual.WriteRune(r)
+			emArgumento = true
+		}
+	}
+	if emArgumento {
+		argumentos = append(argumentos, atual.String())
+	}
+	return argumentos, aspas, emArgumento
+}
+
+// escaparArgumento protege os caracteres especiais de um nome completado pelo TAB
+func escaparArgumento(texto string, aspas rune) string {
+	var escapado strings.Builder
+	for _, r := range texto {
+		switch {
+		case aspas == '\'':
+		case aspas == '"':
+			if r == '"' || r == '\\' {
+				escapado.WriteRune('\\')
+			}
+		case unicode.IsSpace(r) || strings.ContainsRune(`'"\`, r):
+			escapado.WriteRune('\\')
+		}
+		escapado.WriteRune(r)
+	}
+	return escapado.String()
+}
+
+func (s *Shell) diretorioAtual() string {
+	return "/" + strings.Join(s.atual, "/")
+}
+
+// caminho converte um caminho absoluto ou relativo ao diretório atual em componentes, resolvendo ".."
+func (s *Shell) caminho(argumento string) []string {
+	var partes []string
+	if !strings.HasPrefix(argumento, "/") {
+		partes = append(partes, s.atual...)
+	}
+	for _, parte := range DividirCaminho(argumento) {
+		if parte == ".." {
+			if len(partes) > 0 {
+				partes = partes[:len(partes)-1]
+			}
+		} else {
+			partes = append(partes, parte)
+		}
+	}
+	return partes
+}
+
+// ehDiretorio informa se os componentes indicam um diretório existente
+func (s *Shell) ehDiretorio(partes []string) bool {
+	_, erro := AbrirDiretorio(s.cabecalho, s.meuFS, partes)
+	return erro == nil
+}
+
+// entrada retorna a entrada de diretório indicada pelos componentes
+func (s *Shell) entrada(partes []string) (DiretorioRoot, error) {
+	dir, indice, erro := ResolverCaminho(s.cabecalho, s.meuFS, partes)
+	if erro != nil {
+		return DiretorioRoot{}, erro
+	}
+	return dir.Entradas[indice], nil
+}
+
+// verificarArgumentos retorna o uso do comando se a quantidade de argumentos estiver fora do intervalo
+func verificarArgumentos(argumentos []string, minimo int, maximo int) error {
+	if len(argumentos)-1 >= minimo && len(argumentos)-1 <= maximo {
+		return nil
+	}
+	for _, comando := range comandosShell {
+		if comando.nome == argumentos[0] {
+			return fmt.Errorf("uso: %s", comando.uso)
+		}
+	}
+	return errors.New("quantidade de argumentos inválida")
+}
+
+// extrairOpcao remove a opção dos argumentos e informa se ela estava presente
+func extrairOpcao(argumentos []string, opcao string) ([]string, bool) {
+	restantes := make([]string, 0, len(argumentos))
+	presente := false
+	for _, argumento := range argumentos {
+		if argumento == opcao {
+			presente = true
+		} else {
+			restantes = append(restantes, argumento)
+		}
+	}
+	return restantes, presente
+}
+
+// extrairValor remove a opção no formato --opcao=valor dos argumentos e retorna seu valor
+func extrairValor(argumentos []string, opcao string) ([]string, string) {
+	restantes := make([]string, 0, len(argumentos))
+	valor := ""
+	for _, argumento := range argumentos {
+		if texto, ok := strings.CutPrefix(argumento, opcao+"="); ok {
+			valor = texto
+		} else {
+			restantes = append(restantes, argumento)
+		}
+	}
+	return restantes, valor
+}
+
+// ExecutarComando executa um comando já separado em argumentos. Retorna true quando o shell deve ser encerrado
+func (s *Shell) ExecutarComando(argumentos []string) (bool, error) {
+	argumentos, emJSON := extrairOpcao(argumentos, "--json")
+	// --if-exists escolhe o que put, get -r, mv e mkdir fazem quando o nome de destino já existe
+	argumentos, textoPolitica := extrairValor(argumentos, "--if-exists")
+	politica, erro := LerPoliticaDuplicado(textoPolitica)
+	if erro != nil {
+		return false, erro
+	}
+	// Uma linha só com opções não tem comando para executar
+	if len(argumentos) == 0 {
+		return false, errors.New("falta o comando depois das opções (digite help para ver os comandos)")
+	}
+	if s.snapshot != "" && !slices.Contains(comandosSnapshot, argumentos[0]) {
+		return false, NovoErroFS(fs.ErrPermission, "o snapshot '%s' é somente leitura (use exit para voltar ao volume)", s.snapshot)
+	}
+	switch argumentos[0] {
+	case "ls":
+		argumentos, longa := extrairOpcao(argumentos, "-l")
+		argumentos, todas := extrairOpcao(argumentos, "-a")
+		argumentos, criterio := extrairValor(argumentos, "--sort")
+		argumentos, tipo := extrairValor(argumentos, "--type")
+		if erro := verificarArgumentos(argumentos, 0, 1); erro != nil {
+			return false, erro
+		}
+		return false, s.listar(append(argumentos, ".")[1], longa, todas, tipo, criterio, emJSON)
+	case "cd":
+		if erro := verificarArgumentos(argumentos, 0, 1); erro != nil {
+			return false, erro
+		}
+		partes := s.caminho(append(argumentos, "/")[1])
+		if _, erro := AbrirDiretorio(s.cabecalho, s.meuFS, partes); erro != nil {
+			return false, erro
+		}
+		if erro := VerificarAcesso(s.cabecalho, s.meuFS, s.identidade, partes, AcessoExecucao); erro != nil {
+			return false, erro
+		}
+		s.atual = partes
+	case "pwd":
+		fmt.Println(s.diretorioAtual())
+	case "put":
+		argumentos, preservar := extrairOpcao(argumentos, "-p")
+		argumentos, recursivo := extrairOpcao(argumentos, "-r")
+		argumentos, cifrar := extrairOpcao(argumentos, "--encrypt")
+		argumentos, comprimir := extrairOpcao(argumentos, "--compress")
+		if erro := verificarArgumentos(argumentos, 1, 2); erro != nil {
+			return false, erro
+		}
+		if cifrar && comprimir {
+			return false, errors.New("--encrypt e --compress não podem ser usados juntos")
+		}
+		if recursivo {
+			if cifrar {
+				return false, errors.New("--encrypt não pode ser usado com -r")
+			}
+			return false, s.putRecursivo(argumentos[1], append(argumentos, "")[2], politica, preservar, comprimir)
+		}
+		return false, s.put(argumentos[1], append(argumentos, "")[2], politica, preservar, cifrar, comprimir)
+	case "get":
+		argumentos, preservar := extrairOpcao(argumentos, "-p")
+		argumentos, recursivo := extrairOpcao(argumentos, "-r")
+		if erro := verificarArgumentos(argumentos, 1, 2); erro != nil {
+			return false, erro
+		}
+		if recursivo {
+			return false, s.getRecursivo(argumentos[1], append(argumentos, "")[2], politica, preservar)
+		}
+		return false, s.get(argumentos[1], append(argumentos, "")[2], preservar)
+	case "append", "overwrite":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		dados, erro := os.ReadFile(argumentos[1])
+		if erro != nil {
+			return false, fmt.Errorf("erro ao ler arquivo real: %w", erro)
+		}
+		partes := s.caminho(argumentos[2])
+		if erro = VerificarAcesso(s.cabecalho, s.meuFS, s.identidade, partes, AcessoEscrita); erro != nil {
+			return false, erro
+		}
+		cifra, erro := s.cifraDoCaminho(partes)
+		if erro != nil {
+			return false, erro
+		}
+		if argumentos[0] == "append" {
+			_, erro = AnexarAoArquivo(s.cabecalho, s.meuFS, s.identidade, partes, cifra, dados)
+		} else {
+			_, erro = SubstituirConteudo(s.cabecalho, s.meuFS, s.identidade, partes, cifra, dados)
+		}
+		return false, erro
+	case "truncate":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		tamanho, erro := strconv.ParseUint(argumentos[1], 10, 32)
+		if erro != nil {
+			return false, fmt.Errorf("tamanho inválido: %s", argumentos[1])
+		}
+		partes := s.caminho(argumentos[2])
+		if erro = VerificarAcesso(s.cabecalho, s.meuFS, s.identidade, partes, AcessoEscrita); erro != nil {
+			return false, erro
+		}
+		cifra, erro := s.cifraDoCaminho(partes)
+		if erro != nil {
+			return false, erro
+		}
+		_, erro = TruncarArquivo(s.cabecalho, s.meuFS, s.identidade, partes, cifra, int64(tamanho))
+		return false, erro
+	case "cat":
+		argumentos, textoOffset := extrairValor(argumentos, "--offset")
+		argumentos, textoQuantidade := extrairValor(argumentos, "--length")
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		return false, s.cat(argumentos[1], textoOffset, textoQuantidade)
+	case "mv", "rename":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		origem := s.caminho(argumentos[1])
+		destino := s.caminho(argumentos[2])
+		if len(origem) == 0 {
+			return false, errors.New("o root não pode ser movido")
+		}
+		// Como no mv do Unix, se o destino for um diretório a entrada vai para dentro dele com o mesmo nome
+		if len(destino) == 0 || (!slices.Equal(destino, origem) && s.ehDiretorio(destino)) {
+			destino = append(destino, origem[len(origem)-1])
+		}
+		nome, erro := MoverEntrada(s.cabecalho, s.meuFS, s.identidade, origem, destino[:len(destino)-1], destino[len(destino)-1], politica)
+		if erro == nil && nome != destino[len(destino)-1] {
+			fmt.Printf("renomeado para '%s'\n", nome)
+		}
+		return false, avisarPulado(erro)
+	case "rm":
+		argumentos, recursivoEForcado := extrairOpcao(argumentos, "-rf")
+		argumentos, recursivo := extrairOpcao(argumentos, "-r")
+		argumentos, forcar := extrairOpcao(argumentos, "-f")
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		if recursivoEForcado || recursivo {
+			return false, s.comSenhaAdmin(func() error {
+				return RemoverArvore(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]), recursivoEForcado || forcar)
+			})
+		}
+		if forcar {
+			return false, errors.New("-f só pode ser usado junto com -r")
+		}
+		return false, RemoverEntrada(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]))
+	case "mkdir":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		partes := s.caminho(argumentos[1])
+		if len(partes) == 0 {
+			return false, errors.New("o root já existe")
+		}
+		_, nome, erro := CriarEntradaComPolitica(s.cabecalho, s.meuFS, s.identidade, partes[:len(partes)-1], partes[len(partes)-1], true, nil, politica)
+		if erro == nil && nome != partes[len(partes)-1] {
+			fmt.Printf("diretório criado como '%s'\n", nome)
+		}
+		return false, avisarPulado(erro)
+	case "protect", "unprotect":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		return false, s.comSenhaAdmin(func() error {
+			return DefinirProtecao(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]), argumentos[0] == "protect")
+		})
+	case "lsattr":
+		argumentos, todas := extrairOpcao(argumentos, "-a")
+		if erro := verificarArgumentos(argumentos, 0, 1); erro != nil {
+			return false, erro
+		}
+		infos, erro := ListarDiretorio(s.cabecalho, s.meuFS, s.identidade, s.caminho(append(argumentos, ".")[1]), todas)
+		if erro != nil {
+			return false, erro
+		}
+		for _, info := range infos {
+			fmt.Printf("%s %s\n", info.Atributos, info.Nome)
+		}
+	case "chattr":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		partes := s.caminho(argumentos[2])
+		if len(partes) == 0 {
+			return false, errors.New("os atributos do root não podem ser alterados")
+		}
+		entrada, erro := s.entrada(partes)
+		if erro != nil {
+			return false, erro
+		}
+		atributos, erro := MudarAtributos(entrada.Atributos, argumentos[1])
+		if erro != nil {
+			return false, erro
+		}
+		return false, s.comSenhaAdmin(func() error {
+			return DefinirAtributos(s.cabecalho, s.meuFS, s.identidade, partes, atributos)
+		})
+	case "passwd":
+		argumentos, remover := extrairOpcao(argumentos, "--remove")
+		if erro := verificarArgumentos(argumentos, 0, 0); erro != nil {
+			return false, erro
+		}
+		return false, s.senhaAdmin(remover)
+	case "unlock":
+		return false, s.desbloquear()
+	case "lock":
+		s.identidade.Admin = false
+		s.senhaArquivos = ""
+	case "compress", "decompress":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		if argumentos[0] == "compress" {
+			return false, ComprimirArquivo(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]))
+		}
+		return false, DescomprimirArquivo(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]))
+	case "keyslot":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		return false, s.senhasVolume(argumentos[1])
+	case "encrypt":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		cifra, erro := s.novaCifra()
+		if erro != nil {
+			return false, erro
+		}
+		return false, CifrarArquivo(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]), cifra)
+	case "decrypt":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		partes := s.caminho(argumentos[1])
+		cifra, erro := s.cifraDoCaminho(partes)
+		if erro != nil {
+			return false, erro
+		}
+		if cifra == nil {
+			return false, fmt.Errorf("'%s' não está cifrado", argumentos[1])
+		}
+		return false, DecifrarArquivo(s.cabecalho, s.meuFS, s.identidade, partes, cifra)
+	case "chmod":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		modo, erro := strconv.ParseUint(argumentos[1], 8, 32)
+		if erro != nil || modo > 07777 {
+			return false, fmt.Errorf("modo inválido '%s', use um número octal como 0644", argumentos[1])
+		}
+		return false, DefinirModo(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[2]), uint32(modo))
+	case "chown":
+		if erro := verificarArgumentos(argumentos, 2, 2); erro != nil {
+			return false, erro
+		}
+		dono, grupo, erro := LerDono(argumentos[1])
+		if erro != nil {
+			return false, erro
+		}
+		return false, DefinirDono(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[2]), dono, grupo)
+	case "df":
+		if !emJSON {
+			return false, MostrarEspacoLivre(s.meuFS, s.cabecalho)
+		}
+		espaco, erro := CalcularEspaco(s.cabecalho, s.meuFS)
+		if erro != nil {
+			return false, erro
+		}
+		return false, ImprimirJSON(espaco)
+	case "stat":
+		if erro := verificarArgumentos(argumentos, 1, 1); erro != nil {
+			return false, erro
+		}
+		info, erro := DescreverCaminho(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumentos[1]))
+		if erro != nil {
+			return false, erro
+		}
+		if emJSON {
+			return false, ImprimirJSON(info)
+		}
+		ImprimirInfo(info)
+	case "snapshot":
+		if erro := verificarArgumentos(argumentos, 1, 2); erro != nil {
+			return false, erro
+		}
+		return false, s.snapshots(argumentos[1], append(argumentos, "")[2], emJSON)
+	case "fsck":
+		return false, s.fsck(emJSON)
+	case "history":
+		for indice, linha := range s.historico {
+			fmt.Printf("%4d  %s\n", indice+1, linha)
+		}
+	case "help":
+		for _, comando := range comandosShell {
+			fmt.Printf("%-30s %s\n", comando.uso, comando.descricao)
+		}
+	case "exit", "sair":
+		return true, nil
+	default:
+		return false, fmt.Errorf("comando desconhecido: %s (digite help para ver os comandos)", argumentos[0])
+	}
+	return false, nil
+}
+
+// listar imprime as entradas de um diretório, ou o nome do arquivo se o caminho for um arquivo.
+// As entradas ocultas e do sistema só aparecem com todas
+func (s *Shell) listar(argumento string, longa bool, todas bool, tipo string, criterio string, emJSON bool) error {
+	infos, erro := ListarDiretorio(s.cabecalho, s.meuFS, s.identidade, s.caminho(argumento), todas)
+	if erro != nil {
+		return erro
+	}
+	if infos, erro = FiltrarEOrdenar(infos, tipo, criterio); erro != nil {
+		return erro
+	}
+	if emJSON {
+		return ImprimirJSON(infos)
+	}
+	for _, info := range infos {
+		if longa {
+			ImprimirLonga(info)
+		} else if info.Tipo == "dir" {
+			fmt.Printf("dir %s\n", info.Nome)
+		} else {
+			fmt.Printf("%s\n", info.Nome)
+		}
+	}
+	return nil
+}
+
+// comSenhaAdmin executa a operação e, se ela pedir a senha de administrador do volume, pede a senha, confere e tenta
+// de novo. A senha conferida vale até o fim do shell ou até o lock
+func (s *Shell) comSenhaAdmin(operacao func() error) error {
+	erro := operacao()
+	if !errors.Is(erro, ErrSenhaAdmin) || s.identidade.Admin {
+		return erro
+	}
+	if erro = s.desbloquear(); erro != nil {
+		return erro
+	}
+	return operacao()
+}
+
+// desbloquear pede e confere a senha de administrador do volume
+func (s *Shell) desbloquear() error {
+	senha, erro := s.lerSenha("senha de administrador: ")
+	if erro != nil {
+		return erro
+	}
+	if erro = VerificarSenhaAdmin(s.cabecalho, s.meuFS, s.identidade, senha); erro != nil {
+		return erro
+	}
+	s.identidade.Admin = true
+	return nil
+}
+
+// senhaAdmin define, troca ou, com remover, tira a senha de administrador do volume. Trocar ou remover uma senha
+// existente pede a senha atual antes
+func (s *Shell) senhaAdmin(remover bool) error {
+	definida, erro := SenhaAdminDefinida(s.cabecalho, s.meuFS)
+	if erro != nil {
+		return erro
+	}
+	if definida && !s.identidade.Admin {
+		if erro = s.desbloquear(); erro != nil {
+			return erro
+		}
+	}
+	senha := ""
+	if !remover {
+		if senha, erro = s.lerNovaSenha("nova senha de administrador: "); erro != nil {
+			return erro
+		}
+		if senha == "" {
+			return errors.New("a senha não pode ser vazia, use passwd --remove para remover a senha")
+		}
+	}
+	return DefinirSenhaAdmin(s.cabecalho, s.meuFS, s.identidade, senha)
+}
+
+// senhasVolume executa o keyslot: list mostra os slots com senha, e add, change e remove pedem uma senha atual do
+// volume antes de acrescentar uma senha, trocá-la ou removê-la
+func (s *Shell) senhasVolume(acao string) error {
+	if !s.meuFS.Cifrado() {
+		return errors.New("o volume não é cifrado")
+	}
+	if acao == "list" {
+		ativos, erro := SlotsAtivos(s.cabecalho, s.meuFS)
+		if erro != nil {
+			return erro
+		}
+		for _, slot := range ativos {
+			fmt.Printf("slot %d: em uso\n", slot)
+		}
+		fmt.Printf("%d de %d slots em uso\n", len(ativos), numSlotsChave)
+		return nil
+	}
+	if acao != "add" && acao != "change" && acao != "remove" {
+		return fmt.Errorf("ação desconhecida '%s', use list, add, change ou remove", acao)
+	}
+	atual, erro := s.lerSenha("senha atual do volume: ")
+	if erro != nil {
+		return erro
+	}
+	if acao == "remove" {
+		return RemoverSenhaVolume(s.cabecalho, s.meuFS, s.identidade, atual)
+	}
+	nova, erro := s.lerNovaSenha("nova senha do volume: ")
+	if erro != nil {
+		return erro
+	}
+	if acao == "change" {
+		return TrocarSenhaVolume(s.cabecalho, s.meuFS, s.identidade, atual, nova)
+	}
+	slot, erro := AdicionarSenhaVolume(s.cabecalho, s.meuFS, s.identidade, atual, nova)
+	if erro == nil {
+		fmt.Printf("senha guardada no slot %d\n", slot)
+	}
+	return erro
+}
+
+// lerNovaSenha lê uma senha nova duas vezes e confere se as duas são iguais
+func (s *Shell) lerNovaSenha(prompt string) (string, error) {
+	return lerNovaSenhaDe(s.leitor, prompt)
+}
+
+// lerNovaSenhaDe é o lerNovaSenha com a entrada lida pelo leitor informado
+func lerNovaSenhaDe(leitor *bufio.Reader, prompt string) (string, error) {
+	senha, erro := lerSenhaDe(leitor, prompt)
+	if erro != nil {
+		return "", erro
+	}
+	confirmacao, erro := lerSenhaDe(leitor, "repita a nova senha: ")
+	if erro != nil {
+		return "", erro
+	}
+	if confirmacao != senha {
+		return "", errors.New("as senhas não conferem")
+	}
+	return senha, nil
+}
+
+// novaCifra pede a senha de um arquivo a ser cifrado e deriva dela uma chave nova
+func (s *Shell) novaCifra() (*CifraArquivo, error) {
+	senha, erro := s.lerNovaSenha("senha para cifrar o arquivo: ")
+	if erro != nil {
+		return nil, erro
+	}
+	return NovaCifraArquivo(senha)
+}
+
+// cifraDoCaminho abre a cifra do arquivo indicado pelos componentes com cifraDe
+func (s *Shell) cifraDoCaminho(partes []string) (*CifraArquivo, error) {
+	entrada, erro := s.entrada(partes)
+	if erro != nil {
+		return nil, erro
+	}
+	return s.cifraDe(entrada)
+}
+
+// cifraDe abre a cifra de um arquivo cifrado, tentando primeiro a última senha que funcionou e pedindo outra se ela
+// não servir. Arquivos sem cifra retornam nil
+func (s *Shell) cifraDe(entrada DiretorioRoot) (*CifraArquivo, error) {
+	if entrada.Atributos&AtributoCifrado == 0 {
+		return nil, nil
+	}
+	if s.senhaArquivos != "" {
+		cifra, erro := AbrirCifra(s.cabecalho, s.meuFS, entrada, s.senhaArquivos)
+		if !errors.Is(erro, fs.ErrPermission) {
+			return cifra, erro
+		}
+	}
+	senha, erro := s.lerSenha("senha do arquivo: ")
+	if erro != nil {
+		return nil, erro
+	}
+	cifra, erro := AbrirCifra(s.cabecalho, s.meuFS, entrada, senha)
+	if erro != nil {
+		return nil, erro
+	}
+	s.senhaArquivos = senha
+	return cifra, nil
+}
+
+// snapshots executa o snapshot: create, restore e delete mudam os snapshots, list os mostra e browse abre um shell
+// que enxerga o volume como ele era no snapshot, até o exit
+func (s *Shell) snapshots(acao string, nome string, emJSON bool) error {
+	if acao == "list" {
+		infos, erro := ListarSnapshots(s.cabecalho, s.meuFS)
+		if erro != nil {
+			return erro
+		}
+		if emJSON {
+			return ImprimirJSON(infos)
+		}
+		for _, info := range infos {
+			fmt.Printf("%-32s %s  %d arquivos, %d diretórios, %dKB só dele\n", info.Nome, textoDoTempo(&info.Criado), info.Arquivos, info.Diretorios, info.BytesExclusivos/1024)
+		}
+		return nil
+	}
+	if nome == "" {
+		return fmt.Errorf("informe o nome do snapshot: snapshot %s <nome>", acao)
+	}
+	switch acao {
+	case "create":
+		return CriarSnapshot(s.cabecalho, s.meuFS, s.identidade, nome)
+	case "restore":
+		return RestaurarSnapshot(s.cabecalho, s.meuFS, s.identidade, nome)
+	case "delete":
+		return ApagarSnapshot(s.cabecalho, s.meuFS, s.identidade, nome)
+	case "browse":
+		cabecalho, erro := AbrirSnapshot(s.cabecalho, s.meuFS, nome)
+		if erro != nil {
+			return erro
+		}
+		snapshot := &Shell{meuFS: s.meuFS, cabecalho: cabecalho, identidade: s.identidade, leitor: s.leitor, senhaArquivos: s.senhaArquivos, snapshot: nome}
+		erro = snapshot.Rodar()
+		s.senhaArquivos = snapshot.senhaArquivos
+		return erro
+	}
+	return fmt.Errorf("ação desconhecida '%s', use create, list, browse, restore ou delete", acao)
+}
+
+// fsck imprime o relatório de consistência e retorna erro se algum problema foi encontrado
+func (s *Shell) fsck(emJSON bool) error {
+	relatorio, erro := VerificarFS(s.cabecalho, s.meuFS)
+	if erro != nil {
+		return erro
+	}
+	if emJSON {
+		if erro = ImprimirJSON(relatorio); erro != nil {
+			return erro
+		}
+	} else {
+		fmt.Printf("%d arquivos, %d diretórios, %d blocos usados (%d compartilhados), %d snapshots\n", relatorio.Arquivos, relatorio.Diretorios, relatorio.BlocosUsados, relatorio.BlocosCompartilhados, relatorio.Snapshots)
+		for _, problema := range relatorio.Problemas {
+			fmt.Println(problema)
+		}
+	}
+	if !relatorio.Ok {
+		return fmt.Errorf("sistema de arquivos inconsistente: %d problemas encontrados", len(relatorio.Problemas))
+	}
+	return nil
+}
+
+// cat escreve na saída padrão o arquivo inteiro ou só o intervalo pedido por --offset e --length
+func (s *Shell) cat(caminho string, textoOffset string, textoQuantidade string) error {
+	partes := s.caminho(caminho)
+	if erro := VerificarAcesso(s.cabecalho, s.meuFS, s.identidade, partes, AcessoLeitura); erro != nil {
+		return erro
+	}
+	entrada, erro := s.entrada(partes)
+	if erro != nil {
+		return erro
+	}
+	if entrada.EhDir == 1 {
+		return fmt.Errorf("'%s' é um diretorio", caminho)
+	}
+	var offset uint64
+	quantidade := uint64(entrada.Tamanho)
+	if textoOffset != "" {
+		if offset, erro = strconv.ParseUint(textoOffset, 10, 32); erro != nil {
+			return fmt.Errorf("offset inválido: %s", textoOffset)
+		}
+	}
+	if textoQuantidade != "" {
+		if quantidade, erro = strconv.ParseUint(textoQuantidade, 10, 32); erro != nil {
+			return fmt.Errorf("tamanho inválido: %s", textoQuantidade)
+		}
+	}
+	cifra, erro := s.cifraDe(entrada)
+	if erro != nil {
+		return erro
+	}
+	saida := bufio.NewWriter(os.Stdout)
+	if erro = CopiarConteudo(s.cabecalho, s.meuFS, entrada, cifra, saida, int64(offset), int64(quantidade)); erro != nil {
+		return erro
+	}
+	if erro = saida.Flush(); erro != nil {
+		return erro
+	}
+	return MarcarAcesso(s.cabecalho, s.meuFS, partes)
+}
+
+// put copia um arquivo real para o meufs. Se o destino for um diretório o nome original é mantido.
+// A política decide o que fazer se o nome já existir. Com preservar, a entrada guarda o modo, a data
+// de modificação e o dono do arquivo real. Com cifrar, o conteúdo é cifrado com uma senha pedida antes
+func (s *Shell) put(origem string, destino string, politica PoliticaDuplicado, preservar bool, cifrar bool, comprimir bool) error {
+	dados, erro := os.ReadFile(origem)
+	if erro != nil {
+		return fmt.Errorf("erro ao ler arquivo a ser guardado: %w", erro)
+	}
+	info, erro := os.Stat(origem)
+	if erro != nil {
+		return fmt.Errorf("erro ao obter informações do arquivo a ser guardado: %w", erro)
+	}
+	partes := s.caminho(destino)
+	if destino == "" || s.ehDiretorio(partes) {
+		partes = append(partes, filepath.Base(origem))
+	}
+	var cifra *CifraArquivo
+	if cifrar {
+		if cifra, erro = s.novaCifra(); erro != nil {
+			return erro
+		}
+	}
+	_, nome, erro := GuardarArquivo(s.cabecalho, s.meuFS, s.identidade, partes[:len(partes)-1], partes[len(partes)-1], dados, cifra, comprimir, politica)
+	if erro != nil {
+		return avisarPulado(erro)
+	}
+	if nome != partes[len(partes)-1] {
+		fmt.Printf("guardado como '%s'\n", nome)
+	}
+	if preservar {
+		return PreservarMetadados(s.cabecalho, s.meuFS, s.identidade, append(partes[:len(partes)-1], nome), LerMetadadosReais(info))
+	}
+	return nil
+}
+
+// putRecursivo copia um diretório real inteiro para o meufs. Se o destino já for um diretório, a cópia fica
+// dentro dele com o nome original, como no cp -r. Cada item que não pôde ser copiado é mostrado no fim
+func (s *Shell) putRecursivo(origem string, destino string, politica PoliticaDuplicado, preservar bool, comprimir bool) error {
+	partes := s.caminho(destino)
+	if destino == "" || s.ehDiretorio(partes) {
+		partes = append(partes, filepath.Base(filepath.Clean(origem)))
+	}
+	relatorio, erro := ImportarDiretorio(s.cabecalho, s.meuFS, s.identidade, origem, partes, politica, preservar, comprimir)
+	if erro != nil {
+		return erro
+	}
+	return imprimirRelatorioCopia(relatorio)
+}
+
+// avisarPulado mostra como aviso, e não como erro, que --if-exists=skip manteve o que já existia
+func avisarPulado(erro error) error {
+	if errors.Is(erro, ErrPulado) {
+		fmt.Println(erro)
+		return nil
+	}
+	return erro
+}
+
+// imprimirRelatorioCopia mostra as falhas e o resumo de uma cópia recursiva, retornando erro se algo não foi copiado
+func imprimirRelatorioCopia(relatorio RelatorioCopia) error {
+	for _, falha := range relatorio.Falhas {
+		fmt.Printf("falha em '%s': %v\n", falha.Caminho, falha.Erro)
+	}
+	fmt.Printf("%d arquivos e %d diretórios copiados, %d arquivos já existentes mantidos\n", relatorio.Arquivos, relatorio.Diretorios, relatorio.Pulados)
+	if len(relatorio.Falhas) > 0 {
+		return fmt.Errorf("%d itens não foram copiados", len(relatorio.Falhas))
+	}
+	return nil
+}
+
+// get copia um arquivo do meufs para o sistema real. Se o destino for um diretório real o nome do arquivo é mantido.
+// Com preservar, o arquivo real recebe o modo, as datas de acesso e modificação e o dono guardados no meufs
+func (s *Shell) get(origem string, destino string, preservar bool) error {
+	partes := s.caminho(origem)
+	if erro := VerificarAcesso(s.cabecalho, s.meuFS, s.identidade, partes, AcessoLeitura); erro != nil {
+		return erro
+	}
+	entrada, erro := s.entrada(partes)
+	if erro != nil {
+		return erro
+	}
+	if entrada.EhDir == 1 {
+		return fmt.Errorf("'%s' é um diretorio", origem)
+	}
+	if destino == "" {
+		destino = "."
+	}
+	if info, erro := os.Stat(destino); erro == nil && info.IsDir() {
+		if erro = ValidarNomeReal(partes[len(partes)-1]); erro != nil {
+			return erro
+		}
+		destino = filepath.Join(destino, partes[len(partes)-1])
+	}
+	cifra, erro := s.cifraDe(entrada)
+	if erro != nil {
+		return erro
+	}
+	conteudo, erro := LerConteudo(s.cabecalho, s.meuFS, entrada, cifra)
+	if erro != nil {
+		return erro
+	}
+	if erro = os.WriteFile(destino, conteudo, 0644); erro != nil {
+		return fmt.Errorf("erro ao criar o arquivo no sistema real: %w", erro)
+	}
+	if preservar {
+		if erro = AplicarMetadados(destino, entrada); erro != nil {
+			return erro
+		}
+	}
+	return MarcarAcesso(s.cabecalho, s.meuFS, partes)
+}
+
+// getRecursivo copia um diretório do meufs inteiro para o sistema real. Se o destino real já for um diretório, a cópia
+// fica dentro dele com o nome original, como no cp -r. Cada item que não pôde ser copiado é mostrado no fim
+func (s *Shell) getRecursivo(origem string, destino string, politica PoliticaDuplicado, preservar bool) error {
+	partes := s.caminho(origem)
+	if destino == "" {
+		destino = "."
+	}
+	if info, erro := os.Stat(destino); erro == nil && info.IsDir() && len(partes) > 0 {
+		if erro = ValidarNomeReal(partes[len(partes)-1]); erro != nil {
+			return erro
+		}
+		destino = filepath.Join(destino, partes[len(partes)-1])
+	}
+	relatorio, erro := ExportarDiretorio(s.cabecalho, s.meuFS, s.identidade, partes, destino, politica, preservar)
+	if erro != nil {
+		return erro
+	}
+	return imprimirRelatorioCopia(relatorio)
+}
+
+// Completar retorna o texto a acrescentar ao fim da linha para completar o último argumento.
+// Se houver mais de uma opção e nada puder ser acrescentado, retorna as opções
+func (s *Shell) Completar(linha string) (string, []string) {
+	argumentos, aspas, noMeio := dividirArgumentos(linha)
+	prefixo := ""
+	if noMeio {
+		prefixo = argumentos[len(argumentos)-1]
+		argumentos = argumentos[:len(argumentos)-1]
+	}
+	var opcoes []string
+	diretorio := ""
+	base := prefixo
+	if len(argumentos) == 0 {
+		// Primeiro argumento: nome do comando
+		for _, comando := range comandosShell {
+			if strings.HasPrefix(comando.nome, prefixo) {
+				opcoes = append(opcoes, comando.nome)
+			}
+		}
+	} else {
+		// Demais argumentos: nomes guardados no meufs
+		if barra := strings.LastIndex(prefixo, "/"); barra != -1 {
+			diretorio, base = prefixo[:barra+1], prefixo[barra+1:]
+		}
+		dir, erro := AbrirDiretorio(s.cabecalho, s.meuFS, s.caminho(diretorio))
+		if erro != nil {
+			return "", nil
+		}
+		for indice, nome := range dir.Nomes {
+			if nome == "" || !strings.HasPrefix(nome, base) {
+				continue
+			}
+			if dir.Entradas[indice].EhDir == 1 {
+				nome += "/"
+			}
+			opcoes = append(opcoes, nome)
+		}
+	}
+	if len(opcoes) == 0 {
+		return "", nil
+	}
+	// Com uma opção ela é completada inteira, com várias só o prefixo comum a todas
+	comum := opcoes[0]
+	for _, opcao := range opcoes[1:] {
+		for !strings.HasPrefix(opcao, comum) {
+			_, tamanho := utf8.DecodeLastRuneInString(comum)
+			comum = comum[:len(comum)-tamanho]
+		}
+	}
+	complemento := escaparArgumento(comum[len(base):], aspas)
+	if len(opcoes) == 1 {
+		// Diretórios terminam em "/" para que o TAB continue dentro deles
+		if !strings.HasSuffix(comum, "/") {
+			// Fecha a aspa aberta antes do espaço que separa o próximo argumento
+			if aspas != 0 {
+				complemento += string(aspas)
+			}
+			complemento += " "
+		}
+		return complemento, nil
+	}
+	if complemento != "" {
+		return complemento, nil
+	}
+	slices.Sort(opcoes)
+	return "", opcoes
+}
+
+// lerSenha lê uma senha sem mostrá-la no terminal. Se a entrada não for um terminal, lê a linha inteira
+func (s *Shell) lerSenha(prompt string) (string, error) {
+	return lerSenhaDe(s.leitor, prompt)
+}
+
+// entradaSemBuffer lê a entrada padrão um byte por vez, para que as senhas sejam lidas sem consumir as linhas
+// seguintes, que são do menu ou do shell
+type entradaSemBuffer struct{}
+
+func (entradaSemBuffer) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p[:min(len(p), 1)])
+}
+
+// LerSenha lê uma senha da entrada padrão sem mostrá-la no terminal e sem consumir as linhas seguintes
+func LerSenha(prompt string) (string, error) {
+	return lerSenhaDe(bufio.NewReader(entradaSemBuffer{}), prompt)
+}
+
+// lerSenhaDe é o lerSenha com a entrada lida pelo leitor informado, para pedir senhas fora do shell
+func lerSenhaDe(leitor *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+	restaurar, erro := ModoBruto(int(os.Stdin.Fd()))
+	if erro != nil {
+		linha, erro := leitor.ReadString('\n')
+		if erro == io.EOF && linha != "" {
+			erro = nil
+		}
+		return strings.TrimRight(linha, "\r\n"), erro
+	}
+	defer restaurar()
+	var senha []rune
+	for {
+		r, _, erro := leitor.ReadRune()
+		if erro != nil {
+			return "", erro
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Print("\n")
+			return string(senha), nil
+		case 3: // Ctrl-C desiste
+			fmt.Print("^C\n")
+			return "", errors.New("senha não informada")
+		case 8, 127: // Backspace
+			if len(senha) > 0 {
+				senha = senha[:len(senha)-1]
+			}
+		default:
+			if unicode.IsPrint(r) {
+				senha = append(senha, r)
+			}
+		}
+	}
+}
+
+// lerLinha lê uma linha do terminal com edição, histórico (setas) e TAB.
+// Se a entrada não for um terminal, lê a linha inteira sem edição
+func (s *Shell) lerLinha(prompt string) (string, error) {
+	fmt.Print(prompt)
+	restaurar, erro := ModoBruto(int(os.Stdin.Fd()))
+	if erro != nil {
+		linha, erro := s.leitor.ReadString('\n')
+		if erro == io.EOF && linha != "" {
+			erro = nil
+		}
+		return strings.TrimRight(linha, "\r\n"), erro
+	}
+	defer restaurar()
+	var linha []rune
+	posicaoHistorico := len(s.historico)
+	redesenhar := func() {
+		fmt.Printf("\r\x1b[K%s%s", prompt, string(linha))
+	}
+	for {
+		r, _, erro := s.leitor.ReadRune()
+		if erro != nil {
+			return "", erro
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Print("\n")
+			return string(linha), nil
+		case 3: // Ctrl-C descarta a linha
+			fmt.Print("^C\n")
+			linha = nil
+			posicaoHistorico = len(s.historico)
+			fmt.Print(prompt)
+		case 4: // Ctrl-D na linha vazia encerra
+			if len(linha) == 0 {
+				return "", io.EOF
+			}
+		case 8, 127: // Backspace
+			if len(linha) > 0 {
+				linha = linha[:len(linha)-1]
+				redesenhar()
+			}
+		case '\t':
+			complemento, opcoes := s.Completar(string(linha))
+			linha = append(linha, []rune(complemento)...)
+			if len(opcoes) > 0 {
+				fmt.Printf("\n%s\n", strings.Join(opcoes, "  "))
+			}
+			redesenhar()
+		case 27: // Sequências de escape: setas para cima e para baixo navegam pelo histórico
+			if proximo, _, _ := s.leitor.ReadRune(); proximo != '[' {
+				continue
+			}
+			seta, _, _ := s.leitor.ReadRune()
+			if seta == 'A' && posicaoHistorico > 0 {
+				posicaoHistorico--
+				linha = []rune(s.historico[posicaoHistorico])
+			} else if seta == 'B' && posicaoHistorico < len(s.historico) {
+				posicaoHistorico++
+				linha = nil
+				if posicaoHistorico < len(s.historico) {
+					linha = []rune(s.historico[posicaoHistorico])
+				}
+			}
+			redesenhar()
+		default:
+			if unicode.IsPrint(r) {
+				linha = append(linha, r)
+				fmt.Print(string(r))
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package meufs_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"meufs"
+)
+
+// novoShell cria um shell sobre o volume, posicionado no root
+func novoShell(volume *meufs.Volume) *meufs.Shell {
+	return meufs.NovoShell(volume.Arquivo, volume.Cabecalho)
+}
+
+func TestShellSoOpcoes(t *testing.T) {
+	shell := novoShell(novoVolume(t))
+	for _, linha := range [][]string{{"--json"}, {"--if-exists=skip"}, {"--json", "--if-exists=rename"}} {
+		sair, erro := shell.ExecutarComando(linha)
+		if erro == nil || sair {
+			t.Fatalf("%q não tem comando e deveria falhar sem encerrar o shell (sair %v, erro %v)", linha, sair, erro)
+		}
+	}
+}
+
+// comSaida executa a função com a saída padrão trocada por um pipe e retorna o que foi escrito nela
+func comSaida(t *testing.T, funcao func()) string {
+	t.Helper()
+	leitura, escrita, erro := os.Pipe()
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	lido := make(chan string)
+	go func() {
+		dados, _ := io.ReadAll(leitura)
+		lido <- string(dados)
+	}()
+	saida := os.Stdout
+	os.Stdout = escrita
+	defer func() {
+		os.Stdout = saida
+	}()
+	funcao()
+	escrita.Close()
+	return <-lido
+}
+
+// executar roda uma linha no shell, separada como o shell separa, e falha o teste se o comando falhar
+func executar(t *testing.T, shell *meufs.Shell, linha string) string {
+	t.Helper()
+	argumentos, erro := meufs.DividirArgumentos(linha)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return comSaida(t, func() {
+		if _, erro = shell.ExecutarComando(argumentos); erro != nil {
+			t.Errorf("%s: %v", linha, erro)
+		}
+	})
+}
+
+func TestDividirArgumentos(t *testing.T) {
+	casos := []struct {
+		linha    string
+		esperado []string
+	}{
+		{"ls", []string{"ls"}},
+		{"  put   a.txt  /dest  ", []string{"put", "a.txt", "/dest"}},
+		{`cat 'meu arquivo.txt'`, []string{"cat", "meu arquivo.txt"}},
+		{`cat "meu \"arquivo\" \\ 1"`, []string{"cat", `meu "arquivo" \ 1`}},
+		{`cat 'sem \escape'`, []string{"cat", `sem \escape`}},
+		{`cat meu\ arquivo\'s`, []string{"cat", "meu arquivo's"}},
+		{`mkdir ""`, []string{"mkdir", ""}},
+		{`mv a"b c"d e`, []string{"mv", "ab cd", "e"}},
+		{"", nil},
+	}
+	for _, caso := range casos {
+		argumentos, erro := meufs.DividirArgumentos(caso.linha)
+		if erro != nil || !slices.Equal(argumentos, caso.esperado) {
+			t.Errorf("%q deveria virar %q, virou %q (%v)", caso.linha, caso.esperado, argumentos, erro)
+		}
+	}
+	for _, linha := range []string{`cat 'aberta`, `cat "aberta`} {
+		if _, erro := meufs.DividirArgumentos(linha); erro == nil {
+			t.Errorf("%q tem uma aspa aberta e deveria ser recusada", linha)
+		}
+	}
+}
+
+func TestShellDiretorioAtual(t *testing.T) {
+	volume := novoVolume(t)
+	shell := novoShell(volume)
+	executar(t, shell, `mkdir "meu dir"`)
+	executar(t, shell, `cd meu\ dir`)
+	if pwd := executar(t, shell, "pwd"); pwd != "/meu dir\n" {
+		t.Fatalf("pwd deveria mostrar /meu dir, mostrou %q", pwd)
+	}
+	// Caminhos relativos partem do diretório atual
+	origem := filepath.Join(t.TempDir(), "com espaço.txt")
+	if erro := os.WriteFile(origem, []byte("dentro"), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	executar(t, shell, fmt.Sprintf("put '%s'", origem))
+	executar(t, shell, "mkdir sub")
+	if lista := executar(t, shell, "ls"); lista != "com espaço.txt\ndir sub\n" {
+		t.Fatalf("ls deveria listar o arquivo e o subdiretório, listou %q", lista)
+	}
+	if texto := conteudo(t, volume, "/meu dir/com espaço.txt"); texto != "dentro" {
+		t.Fatalf("o arquivo deveria estar em /meu dir, tem %q", texto)
+	}
+	// O TAB completa os nomes guardados escapando os espaços
+	if complemento, opcoes := shell.Completar("cat com"); complemento != `\ espaço.txt ` || opcoes != nil {
+		t.Fatalf("o TAB deveria completar o nome escapado, completou %q %q", complemento, opcoes)
+	}
+	executar(t, shell, "cd sub/..")
+	if pwd := executar(t, shell, "pwd"); pwd != "/meu dir\n" {
+		t.Fatalf("cd sub/.. deveria voltar para /meu dir, está em %q", pwd)
+	}
+	if _, erro := shell.ExecutarComando([]string{"cd", "com espaço.txt"}); erro == nil {
+		t.Fatal("cd para um arquivo deveria falhar")
+	}
+	executar(t, shell, "cd")
+	if pwd := executar(t, shell, "pwd"); pwd != "/\n" {
+		t.Fatalf("cd sem argumento deveria voltar ao root, está em %q", pwd)
+	}
+}
+
+// decodificar lê a saída JSON de um comando do shell
+func decodificar(t *testing.T, saida string, valor any) {
+	t.Helper()
+	if erro := json.Unmarshal([]byte(saida), valor); erro != nil {
+		t.Fatalf("a saída deveria ser JSON: %v\n%s", erro, saida)
+	}
+}
+
+func TestShellJSON(t *testing.T) {
+	volume := novoVolume(t)
+	gravar(t, volume, "/a.txt", strings.Repeat("x", 5000))
+	gravar(t, volume, "/vazio.txt", "")
+	criarDiretorio(t, volume, "dir")
+	shell := novoShell(volume)
+	executar(t, shell, "protect /a.txt")
+
+	var lista []map[string]any
+	decodificar(t, executar(t, shell, "ls --json --sort=name"), &lista)
+	if len(lista) != 3 || lista[0]["name"] != "a.txt" || lista[1]["name"] != "dir" || lista[2]["name"] != "vazio.txt" {
+		t.Fatalf("ls --json deveria listar a.txt, dir e vazio.txt, listou %v", lista)
+	}
+	arquivo := lista[0]
+	if arquivo["type"] != "file" || arquivo["size"] != 5000.0 || arquivo["blocks"] != 2.0 || arquivo["protected"] != true || arquivo["first_block"] == nil || arquivo["modified"] == nil {
+		t.Fatalf("campos de a.txt incorretos: %v", arquivo)
+	}
+	if lista[1]["type"] != "dir" || lista[2]["first_block"] != nil || lista[2]["blocks"] != 0.0 {
+		t.Fatalf("dir deveria ser do tipo dir e vazio.txt não deveria ter blocos: %v %v", lista[1], lista[2])
+	}
+
+	var info meufs.InfoEntrada
+	decodificar(t, executar(t, shell, "stat --json /a.txt"), &info)
+	if info.Caminho != "/a.txt" || info.Tamanho != 5000 || info.PrimeiroBloco == nil || float64(*info.PrimeiroBloco) != arquivo["first_block"] {
+		t.Fatalf("stat --json deveria descrever /a.txt como o ls, descreveu %+v", info)
+	}
+
+	var espaco meufs.InfoEspaco
+	decodificar(t, executar(t, shell, "df --json"), &espaco)
+	if espaco.BlocosLivres != uint32(blocosLivres(t, volume)) || espaco.BytesLivres != uint64(espaco.BlocosLivres)*uint64(espaco.TamanhoBloco) || espaco.BytesUsados+espaco.BytesLivres != espaco.BytesTotais {
+		t.Fatalf("df --json tem contas incoerentes: %+v", espaco)
+	}
+
+	var relatorio meufs.RelatorioFsck
+	decodificar(t, executar(t, shell, "fsck --json"), &relatorio)
+	if !relatorio.Ok || relatorio.Arquivos != 2 || relatorio.Diretorios != 1 {
+		t.Fatalf("fsck --json deveria achar 2 arquivos e 1 diretório sem problemas, achou %+v", relatorio)
+	}
+}
+
+func TestShellCat(t *testing.T) {
+	volume := novoVolume(t)
+	var texto strings.Builder
+	for i := 0; texto.Len() < 10000; i++ {
+		fmt.Fprintf(&texto, "linha %d\n", i)
+	}
+	original := texto.String()
+	gravar(t, volume, "/a.txt", original)
+	criarDiretorio(t, volume, "dir")
+	shell := novoShell(volume)
+	if saida := executar(t, shell, "cat /a.txt"); saida != original {
+		t.Fatalf("cat deveria escrever os %d bytes do arquivo, escreveu %d", len(original), len(saida))
+	}
+	// O trecho atravessa o limite entre o primeiro e o segundo bloco
+	if saida := executar(t, shell, "cat --offset=4000 --length=200 a.txt"); saida != original[4000:4200] {
+		t.Fatalf("cat com --offset e --length escreveu %q", saida)
+	}
+	if saida := executar(t, shell, "cat --offset=9990 a.txt"); saida != original[9990:] {
+		t.Fatalf("cat só com --offset deveria ir até o fim do arquivo, escreveu %q", saida)
+	}
+	if saida := executar(t, shell, "cat --length=100000 a.txt"); saida != original {
+		t.Fatalf("cat não deveria passar do tamanho guardado, escreveu %d bytes", len(saida))
+	}
+	if saida := executar(t, shell, "cat --offset=20000 a.txt"); saida != "" {
+		t.Fatalf("cat depois do fim do arquivo não deveria escrever nada, escreveu %q", saida)
+	}
+	for _, linha := range [][]string{{"cat", "--offset=-1", "a.txt"}, {"cat", "--length=x", "a.txt"}, {"cat", "dir"}, {"cat", "b.txt"}} {
+		if _, erro := shell.ExecutarComando(linha); erro == nil {
+			t.Errorf("%q deveria falhar", linha)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package meufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// Um snapshot guarda o estado do volume em um momento. O root é copiado para blocos seguidos da área de dados e
+// cada subdiretório para um bloco próprio, com as entradas apontando para as cópias. Os arquivos não são copiados:
+// as cadeias deles ganham uma referência na tabela de referências (ver deduplicacao.go), e como alterar ou remover
+// um arquivo com blocos compartilhados nunca muda esses blocos, o conteúdo do snapshot continua o mesmo. A FAT não
+// precisa ser copiada, já que o próximo bloco de um bloco compartilhado também nunca muda
+
+// maxSnapshots é quantos snapshots a lista guarda
+const maxSnapshots = 32
+
+// EntradaSnapshot descreve um snapshot na lista de snapshots. Uma entrada com o nome vazio está livre
+type EntradaSnapshot struct {
+	Nome      [32]byte
+	Criado    int64  // Em nanossegundos desde 01/01/1970 (UTC)
+	BlocoRoot uint32 // Primeiro dos blocos seguidos com a cópia do root
+}
+
+// AreaSnapshots fica no cabeçalho, logo depois da AreaReferencias, e diz em que bloco está a lista de snapshots.
+// A lista só ocupa um bloco a partir do primeiro snapshot
+type AreaSnapshots struct {
+	Criada uint8  // 1 se a lista já existe
+	Bloco  uint32 // Bloco com as maxSnapshots entradas da lista
+}
+
+// InfoSnapshot descreve um snapshot para a listagem. Os bytes exclusivos são os que só o snapshot usa, liberados
+// ao apagá-lo
+type InfoSnapshot struct {
+	Nome            string    `json:"name"`
+	Criado          time.Time `json:"created"`
+	Arquivos        int       `json:"files"`
+	Diretorios      int       `json:"directories"`
+	BytesExclusivos uint64    `json:"exclusive_bytes"`
+}
+
+// posicaoAreaSnapshots é onde a AreaSnapshots fica no meufs.fs, logo depois da AreaReferencias
+func posicaoAreaSnapshots() int64 {
+	return posicaoAreaReferencias() + int64(binary.Size(AreaReferencias{}))
+}
+
+// lerSnapshots lê a AreaSnapshots e a lista de snapshots, que tem sempre maxSnapshots entradas
+func lerSnapshots(cabecalho Cabecalho, meuFS *MeuFS) (AreaSnapshots, []EntradaSnapshot, error) {
+	var area AreaSnapshots
+	lista := make([]EntradaSnapshot, maxSnapshots)
+	dados := make([]byte, binary.Size(area))
+	if _, erro := meuFS.ReadAt(dados, posicaoAreaSnapshots()); erro != nil {
+		return area, nil, fmt.Errorf("erro ao ler a posição da lista de snapshots: %w", erro)
+	}
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, &area)
+	if area.Criada == 0 {
+		return area, lista, nil
+	}
+	dados = make([]byte, binary.Size(lista))
+	if _, erro := meuFS.ReadAt(dados, PosicaoDoBloco(cabecalho, area.Bloco)); erro != nil {
+		return area, nil, fmt.Errorf("erro ao ler a lista de snapshots: %w", erro)
+	}
+	binary.Read(bytes.NewReader(dados), binary.LittleEndian, lista)
+	return area, lista, nil
+}
+
+// salvarSnapshots grava a lista de snapshots. Na primeira vez a lista é criada em um bloco livre da FAT em memória,
+// então quem chama é responsável por salvar a FAT
+func salvarSnapshots(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, area AreaSnapshots, lista []EntradaSnapshot) error {
+	var dados bytes.Buffer
+	if area.Criada == 0 {
+		livres, erro := buscarBlocosLivres(fat, 1)
+		if erro != nil {
+			return erro
+		}
+		fat[livres[0]] = FimDaCadeia
+		area = AreaSnapshots{Criada: 1, Bloco: livres[0]}
+		binary.Write(&dados, binary.LittleEndian, area)
+		if _, erro = meuFS.WriteAt(dados.Bytes(), posicaoAreaSnapshots()); erro != nil {
+			return fmt.Errorf("erro ao gravar a posição da lista de snapshots: %w", erro)
+		}
+		dados.Reset()
+	}
+	binary.Write(&dados, binary.LittleEndian, lista)
+	if _, erro := meuFS.WriteAt(dados.Bytes(), PosicaoDoBloco(cabecalho, area.Bloco)); erro != nil {
+		return fmt.Errorf("erro ao gravar a lista de snapshots: %w", erro)
+	}
+	return nil
+}
+
+// nomeDoSnapshot retorna o nome guardado na entrada da lista
+func nomeDoSnapshot(entrada EntradaSnapshot) string {
+	return string(bytes.TrimRight(entrada.Nome[:], "\x00"))
+}
+
+// buscarSnapshot retorna o índice do snapshot com o nome informado na lista ou um erro fs.ErrNotExist
+func buscarSnapshot(lista []EntradaSnapshot, nome string) (int, error) {
+	for indice, entrada := range lista {
+		if entrada.Nome[0] != 0 && nomeDoSnapshot(entrada) == nome {
+			return indice, nil
+		}
+	}
+	return -1, NovoErroFS(fs.ErrNotExist, "o snapshot '%s' não existe", nome)
+}
+
+// blocosDoRoot retorna quantos blocos seguidos a cópia do root ocupa
+func blocosDoRoot(cabecalho Cabecalho) int {
+	tamanhoRoot := binary.Size(DiretorioRoot{}) * 200
+	return (tamanhoRoot + int(cabecalho.TamanhoBloco) - 1) / int(cabecalho.TamanhoBloco)
+}
+
+// cabecalhoDoSnapshot retorna o cabeçalho com o root trocado pela cópia do root do snapshot. Com ele, as funções
+// que só leem o volume enxergam o volume como ele era no snapshot
+func cabecalhoDoSnapshot(cabecalho Cabecalho, entrada EntradaSnapshot) Cabecalho {
+	cabecalho.InicioRoot = uint32(PosicaoDoBloco(cabecalho, entrada.BlocoRoot))
+	return cabecalho
+}
+
+// ehSnapshot informa se o cabeçalho é um cabeçalho de snapshot, cujo root não fica logo antes da FAT
+func ehSnapshot(cabecalho Cabecalho) bool {
+	return cabecalho.InicioFAT-cabecalho.InicioRoot != uint32(binary.Size(DiretorioRoot{}))*200
+}
+
+// AbrirSnapshot retorna o cabeçalho que enxerga o volume como ele era no snapshot indicado (ver cabecalhoDoSnapshot).
+// Ele só deve ser usado para ler o volume
+func AbrirSnapshot(cabecalho Cabecalho, meuFS *MeuFS, nome string) (Cabecalho, error) {
+	_, lista, erro := lerSnapshots(cabecalho, meuFS)
+	if erro != nil {
+		return Cabecalho{}, erro
+	}
+	indice, erro := buscarSnapshot(lista, nome)
+	if erro != nil {
+		return Cabecalho{}, erro
+	}
+	return cabecalhoDoSnapshot(cabecalho, lista[indice]), nil
+}
+
+// buscarBlocosSeguidos retorna os primeiros quantidade blocos livres seguidos da FAT, sem marcá-los como usados
+func buscarBlocosSeguidos(fat []uint32, quantidade int) ([]uint32, error) {
+	seguidos := 0
+	for indice, entrada := range fat {
+		if entrada != 0 {
+			seguidos = 0
+			continue
+		}
+		seguidos++
+		if seguidos == quantidade {
+			blocos := make([]uint32, quantidade)
+			for i := range blocos {
+				blocos[i] = uint32(indice - quantidade + 1 + i)
+			}
+			return blocos, nil
+		}
+	}
+	return nil, fmt.Errorf("não há %d blocos livres seguidos para a cópia do root", quantidade)
+}
+
+// contarDiretorios conta os subdiretórios do diretório, em qualquer nível
+func contarDiretorios(cabecalho Cabecalho, meuFS *MeuFS, dir Diretorio) (int, error) {
+	total := 0
+	for indice, nome := range dir.Nomes {
+		if nome == "" || dir.Entradas[indice].EhDir != 1 {
+			continue
+		}
+		subdir, erro := LerSubdiretorio(cabecalho, meuFS, dir.Entradas[indice].EnderecoFAT)
+		if erro != nil {
+			return 0, erro
+		}
+		dentro, erro := contarDiretorios(cabecalho, meuFS, subdir)
+		if erro != nil {
+			return 0, erro
+		}
+		total += 1 + dentro
+	}
+	return total, nil
+}
+
+// copiarArvore retorna uma cópia das entradas do diretório em que cada subdiretório foi copiado, com tudo o que há
+// nele, para um bloco livre, e soma uma referência aos blocos de cada arquivo. Altera a FAT e as referências em
+// memória, então quem chama deve conferir antes se há um bloco livre para cada subdiretório
+func copiarArvore(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, referencias []uint32, dir Diretorio) ([]DiretorioRoot, error) {
+	copia := slices.Clone(dir.Entradas)
+	for indice, nome := range dir.Nomes {
+		entrada := &copia[indice]
+		if nome == "" || entrada.EnderecoFAT == SemBlocos {
+			continue
+		}
+		if entrada.EhDir != 1 {
+			if erro := referenciarCadeia(fat, referencias, entrada.EnderecoFAT); erro != nil {
+				return nil, erro
+			}
+			continue
+		}
+		subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+		if erro != nil {
+			return nil, erro
+		}
+		entradas, erro := copiarArvore(cabecalho, meuFS, fat, referencias, subdir)
+		if erro != nil {
+			return nil, erro
+		}
+		livres, erro := buscarBlocosLivres(fat, 1)
+		if erro != nil {
+			return nil, erro
+		}
+		fat[livres[0]] = FimDaCadeia
+		if erro = SalvarDiretorio(cabecalho, meuFS, Diretorio{Bloco: livres[0], Entradas: entradas}); erro != nil {
+			return nil, erro
+		}
+		entrada.EnderecoFAT = livres[0]
+	}
+	return copia, nil
+}
+
+// soltarArvore tira uma referência dos blocos de cada arquivo do diretório e libera cada subdiretório, com tudo o
+// que há nele. Altera a FAT e as referências em memória
+func soltarArvore(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, referencias []uint32, dir Diretorio) error {
+	for indice, nome := range dir.Nomes {
+		entrada := dir.Entradas[indice]
+		if nome == "" {
+			continue
+		}
+		if entrada.EhDir == 1 {
+			subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+			if erro != nil {
+				return erro
+			}
+			if erro = soltarArvore(cabecalho, meuFS, fat, referencias, subdir); erro != nil {
+				return erro
+			}
+		}
+		if _, erro := soltarCadeia(cabecalho, meuFS, fat, referencias, entrada.EnderecoFAT); erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+// exigirRoot recusa as mudanças nos snapshots, que afetam o volume inteiro, a quem não for o root
+func exigirRoot(identidade Identidade) error {
+	if !identidade.EhRoot() {
+		return NovoErroFS(fs.ErrPermission, "só o root pode criar, restaurar e apagar snapshots")
+	}
+	return nil
+}
+
+// CriarSnapshot guarda o estado atual do volume com o nome informado, o que só o root pode fazer. Os arquivos passam
+// a compartilhar os blocos com o snapshot, então ele só ocupa a cópia do root, uma cópia de cada diretório e, a
+// partir daí, os blocos que o volume deixar de usar
+func CriarSnapshot(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, nome string) error {
+	if erro := exigirRoot(identidade); erro != nil {
+		return erro
+	}
+	if erro := ValidarNome(nome); erro != nil {
+		return erro
+	}
+	if len(nome) > len(EntradaSnapshot{}.Nome) {
+		return fmt.Errorf("o nome do snapshot não pode ter mais de %d bytes", len(EntradaSnapshot{}.Nome))
+	}
+	area, lista, erro := lerSnapshots(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	if _, erro = buscarSnapshot(lista, nome); erro == nil {
+		return NovoErroFS(fs.ErrExist, "o snapshot '%s' já existe", nome)
+	}
+	livre := slices.IndexFunc(lista, func(entrada EntradaSnapshot) bool { return entrada.Nome[0] == 0 })
+	if livre == -1 {
+		return fmt.Errorf("o volume já tem %d snapshots, apague algum antes de criar outro", maxSnapshots)
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	root, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	// Os blocos da cópia do root são reservados primeiro, e cada subdiretório precisa de mais um bloco
+	blocosRoot, erro := buscarBlocosSeguidos(fat, blocosDoRoot(cabecalho))
+	if erro != nil {
+		return erro
+	}
+	for i, indice := range blocosRoot {
+		fat[indice] = FimDaCadeia
+		if i > 0 {
+			fat[blocosRoot[i-1]] = indice
+		}
+	}
+	diretorios, erro := contarDiretorios(cabecalho, meuFS, root)
+	if erro != nil {
+		return erro
+	}
+	if _, erro = buscarBlocosLivres(fat, diretorios+1); erro != nil {
+		return errors.New("não há blocos livres para copiar os diretórios do volume")
+	}
+	entradas, erro := copiarArvore(cabecalho, meuFS, fat, referencias, root)
+	if erro != nil {
+		return erro
+	}
+	entrada := EntradaSnapshot{Criado: agora(), BlocoRoot: blocosRoot[0]}
+	copy(entrada.Nome[:], nome)
+	if erro = SalvarDiretorio(cabecalhoDoSnapshot(cabecalho, entrada), meuFS, Diretorio{EhRoot: true, Entradas: entradas}); erro != nil {
+		return erro
+	}
+	lista[livre] = entrada
+	if erro = salvarSnapshots(cabecalho, meuFS, fat, area, lista); erro != nil {
+		return erro
+	}
+	if erro = salvarReferencias(cabecalho, meuFS, fat, referencias); erro != nil {
+		return erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// ApagarSnapshot apaga o snapshot indicado, o que só o root pode fazer, liberando os blocos que só ele usava
+func ApagarSnapshot(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, nome string) error {
+	if erro := exigirRoot(identidade); erro != nil {
+		return erro
+	}
+	area, lista, erro := lerSnapshots(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	indice, erro := buscarSnapshot(lista, nome)
+	if erro != nil {
+		return erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	root, erro := LerDiretorioRaiz(cabecalhoDoSnapshot(cabecalho, lista[indice]), meuFS)
+	if erro != nil {
+		return erro
+	}
+	if erro = soltarArvore(cabecalho, meuFS, fat, referencias, root); erro != nil {
+		return erro
+	}
+	if _, erro = soltarCadeia(cabecalho, meuFS, fat, referencias, lista[indice].BlocoRoot); erro != nil {
+		return erro
+	}
+	lista[indice] = EntradaSnapshot{}
+	if erro = salvarSnapshots(cabecalho, meuFS, fat, area, lista); erro != nil {
+		return erro
+	}
+	if erro = salvarReferencias(cabecalho, meuFS, fat, referencias); erro != nil {
+		return erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// RestaurarSnapshot devolve o volume ao estado guardado no snapshot indicado, o que só o root pode fazer. Tudo o que
+// foi criado ou alterado depois do snapshot se perde, e o snapshot continua existindo
+func RestaurarSnapshot(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, nome string) error {
+	if erro := exigirRoot(identidade); erro != nil {
+		return erro
+	}
+	cabecalhoSnapshot, erro := AbrirSnapshot(cabecalho, meuFS, nome)
+	if erro != nil {
+		return erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return erro
+	}
+	root, erro := LerDiretorioRaiz(cabecalho, meuFS)
+	if erro != nil {
+		return erro
+	}
+	rootSnapshot, erro := LerDiretorioRaiz(cabecalhoSnapshot, meuFS)
+	if erro != nil {
+		return erro
+	}
+	// Os diretórios do snapshot são copiados de novo, e os blocos dos diretórios atuais são liberados antes
+	necessarios, erro := contarDiretorios(cabecalho, meuFS, rootSnapshot)
+	if erro != nil {
+		return erro
+	}
+	atuais, erro := contarDiretorios(cabecalho, meuFS, root)
+	if erro != nil {
+		return erro
+	}
+	if _, erro = buscarBlocosLivres(fat, max(necessarios-atuais, 0)); erro != nil {
+		return errors.New("não há blocos livres para copiar os diretórios do snapshot")
+	}
+	if erro = soltarArvore(cabecalho, meuFS, fat, referencias, root); erro != nil {
+		return erro
+	}
+	entradas, erro := copiarArvore(cabecalho, meuFS, fat, referencias, rootSnapshot)
+	if erro != nil {
+		return erro
+	}
+	if erro = SalvarDiretorio(cabecalho, meuFS, Diretorio{EhRoot: true, Entradas: entradas}); erro != nil {
+		return erro
+	}
+	if erro = salvarReferencias(cabecalho, meuFS, fat, referencias); erro != nil {
+		return erro
+	}
+	if erro = SalvarFAT(cabecalho, meuFS, fat); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
+
+// ListarSnapshots descreve os snapshots do volume, do mais antigo para o mais novo
+func ListarSnapshots(cabecalho Cabecalho, meuFS *MeuFS) ([]InfoSnapshot, error) {
+	_, lista, erro := lerSnapshots(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	fat, erro := LerFAT(cabecalho, meuFS)
+	if erro != nil {
+		return nil, erro
+	}
+	referencias, erro := LerReferencias(cabecalho, meuFS, fat)
+	if erro != nil {
+		return nil, erro
+	}
+	infos := []InfoSnapshot{}
+	for _, entrada := range lista {
+		if entrada.Nome[0] == 0 {
+			continue
+		}
+		info := InfoSnapshot{Nome: nomeDoSnapshot(entrada), Criado: TempoDaEntrada(entrada.Criado)}
+		root, erro := LerDiretorioRaiz(cabecalhoDoSnapshot(cabecalho, entrada), meuFS)
+		if erro != nil {
+			return nil, erro
+		}
+		// Um bloco é só do snapshot quando todas as suas referências vêm da árvore do snapshot
+		usos := make(map[uint32]uint32)
+		blocosDoRoot, erro := CadeiaDeBlocos(fat, entrada.BlocoRoot)
+		if erro != nil {
+			return nil, erro
+		}
+		for _, indice := range blocosDoRoot {
+			usos[indice]++
+		}
+		if erro = contarUsos(cabecalho, meuFS, fat, root, usos, &info); erro != nil {
+			return nil, erro
+		}
+		for indice, quantidade := range usos {
+			if quantidade >= max(referencias[indice], 1) {
+				info.BytesExclusivos += uint64(cabecalho.TamanhoBloco)
+			}
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b InfoSnapshot) int { return a.Criado.Compare(b.Criado) })
+	return infos, nil
+}
+
+// contarUsos soma quantas vezes a árvore do diretório usa cada bloco e conta os arquivos e diretórios dela
+func contarUsos(cabecalho Cabecalho, meuFS *MeuFS, fat []uint32, dir Diretorio, usos map[uint32]uint32, info *InfoSnapshot) error {
+	for indice, nome := range dir.Nomes {
+		entrada := dir.Entradas[indice]
+		if nome == "" {
+			continue
+		}
+		blocos, erro := CadeiaDeBlocos(fat, entrada.EnderecoFAT)
+		if erro != nil {
+			return erro
+		}
+		for _, bloco := range blocos {
+			usos[bloco]++
+		}
+		if entrada.EhDir != 1 {
+			info.Arquivos++
+			continue
+		}
+		info.Diretorios++
+		subdir, erro := LerSubdiretorio(cabecalho, meuFS, entrada.EnderecoFAT)
+		if erro != nil {
+			return erro
+		}
+		if erro = contarUsos(cabecalho, meuFS, fat, subdir, usos, info); erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
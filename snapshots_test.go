@@ -0,0 +1,101 @@
+package meufs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"meufs"
+)
+
+// abrirSnapshot retorna um volume só para leitura que enxerga o volume como ele era no snapshot
+func abrirSnapshot(t *testing.T, volume *meufs.Volume, nome string) *meufs.Volume {
+	t.Helper()
+	cabecalho, erro := meufs.AbrirSnapshot(volume.Cabecalho, volume.Arquivo, nome)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return &meufs.Volume{Arquivo: volume.Arquivo, Cabecalho: cabecalho, Identidade: meufs.IdentidadeRoot}
+}
+
+func TestSnapshots(t *testing.T) {
+	volume := novoVolume(t)
+	original := string(bytes.Repeat([]byte("meufs"), 2000))
+	gravar(t, volume, "/a", original)
+	if _, erro := meufs.CriarEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, nil, "d", true, nil); erro != nil {
+		t.Fatal(erro)
+	}
+	gravar(t, volume, "/d/b", "b")
+	if erro := meufs.CriarSnapshot(volume.Cabecalho, volume.Arquivo, meufs.Identidade{Uid: 1000, Gid: 1000}, "s"); !errors.Is(erro, fs.ErrPermission) {
+		t.Fatalf("só o root deveria criar snapshots, o uid 1000 recebeu %v", erro)
+	}
+	if erro := meufs.CriarSnapshot(volume.Cabecalho, volume.Arquivo, volume.Identidade, "s"); erro != nil {
+		t.Fatal(erro)
+	}
+	inicio := enderecoFAT(t, volume, "a")
+
+	// Depois do snapshot, alterar um arquivo copia os blocos compartilhados em vez de mudá-los
+	arquivo, erro := volume.OpenFile("/a", os.O_WRONLY, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if _, erro = arquivo.WriteAt([]byte("MEUFS"), 0); erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.Close()
+	if enderecoFAT(t, volume, "a") == inicio {
+		t.Fatal("alterar a depois do snapshot deveria gravar em blocos novos")
+	}
+	if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"d", "b"}); erro != nil {
+		t.Fatal(erro)
+	}
+	gravar(t, volume, "/c", "c")
+	snapshot := abrirSnapshot(t, volume, "s")
+	if texto := conteudo(t, snapshot, "/a"); texto != original {
+		t.Fatal("o snapshot deveria manter o conteúdo original de a")
+	}
+	if texto := conteudo(t, snapshot, "/d/b"); texto != "b" {
+		t.Fatalf("o snapshot deveria manter d/b, que tem %q", texto)
+	}
+	if _, erro = snapshot.Open("/c"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("c foi criado depois do snapshot e não deveria estar nele: %v", erro)
+	}
+	if texto := conteudo(t, volume, "/a"); texto != "MEUFS"+original[5:] {
+		t.Fatal("o volume deveria ter a alteração de a")
+	}
+	verificar(t, volume)
+
+	if erro = meufs.RestaurarSnapshot(volume.Cabecalho, volume.Arquivo, volume.Identidade, "s"); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a"); texto != original {
+		t.Fatal("restaurar deveria voltar o conteúdo original de a")
+	}
+	if texto := conteudo(t, volume, "/d/b"); texto != "b" {
+		t.Fatalf("restaurar deveria voltar d/b, que tem %q", texto)
+	}
+	if _, erro = volume.Open("/c"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("c foi criado depois do snapshot e deveria sumir ao restaurar: %v", erro)
+	}
+	verificar(t, volume)
+
+	// Apagar o snapshot libera só o que era dele: a cópia do root e a do diretório d. Os arquivos continuam no volume
+	livresAntes := blocosLivres(t, volume)
+	if erro = meufs.ApagarSnapshot(volume.Cabecalho, volume.Arquivo, volume.Identidade, "s"); erro != nil {
+		t.Fatal(erro)
+	}
+	blocosDoRoot := (binary.Size(meufs.DiretorioRoot{})*200 + int(volume.Cabecalho.TamanhoBloco) - 1) / int(volume.Cabecalho.TamanhoBloco)
+	if livres := blocosLivres(t, volume); livres != livresAntes+blocosDoRoot+1 {
+		t.Fatalf("apagar o snapshot deveria liberar %d blocos, liberou %d", blocosDoRoot+1, livres-livresAntes)
+	}
+	if _, erro = meufs.AbrirSnapshot(volume.Cabecalho, volume.Arquivo, "s"); !errors.Is(erro, fs.ErrNotExist) {
+		t.Fatalf("o snapshot apagado não deveria mais existir: %v", erro)
+	}
+	if texto := conteudo(t, volume, "/a"); texto != original {
+		t.Fatal("apagar o snapshot não deveria mudar a")
+	}
+	verificar(t, volume)
+}
@@ -0,0 +1,65 @@
+package meufs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExecutarSubcomando executa a operação pedida na linha de comando (ex: meufs 9p tcp:127.0.0.1:5640)
+func ExecutarSubcomando(meuFS *MeuFS, cabecalho Cabecalho, argumentos []string) error {
+	// Os servidores de rede usam o mesmo volume, e a mesma trava, em todas as conexões
+	volume := &Volume{Arquivo: meuFS, Cabecalho: cabecalho}
+	switch argumentos[0] {
+	// Servidor 9P2000, o endereço padrão é tcp:127.0.0.1:5640
+	case "9p":
+		endereco := "tcp:127.0.0.1:5640"
+		permitirRoot := false
+		for _, argumento := range argumentos[1:] {
+			if argumento == "--permitir-root" {
+				permitirRoot = true
+			} else {
+				endereco = argumento
+			}
+		}
+		return ServirArquivos9P(volume, endereco, permitirRoot)
+	// Servidor NBD do meufs.fs inteiro, o endereço padrão é unix:meufs.sock
+	case "nbd":
+		endereco := "unix:meufs.sock"
+		somenteLeitura := false
+		for _, argumento := range argumentos[1:] {
+			if argumento == "--somente-leitura" {
+				somenteLeitura = true
+			} else {
+				endereco = argumento
+			}
+		}
+		return ServirDispositivoNBD(volume, endereco, somenteLeitura)
+	// Shell interativo com comandos nomeados
+	case "shell":
+		return NovoShell(meuFS, cabecalho).Rodar()
+	// Executa um script de comandos do shell, --desfazer reverte tudo se algum comando falhar
+	case "run":
+		desfazer := false
+		var script string
+		for _, argumento := range argumentos[1:] {
+			if argumento == "--desfazer" {
+				desfazer = true
+			} else {
+				script = argumento
+			}
+		}
+		if script == "" {
+			return errors.New("uso: run [--desfazer] <script>")
+		}
+		return ExecutarScript(meuFS, cabecalho, script, desfazer)
+	default:
+		// Os comandos do shell também podem ser usados como subcomandos (ex: meufs ls --json /docs)
+		for _, comando := range comandosShell {
+			if comando.nome == argumentos[0] {
+				_, erro := NovoShell(meuFS, cabecalho).ExecutarComando(argumentos)
+				return erro
+			}
+		}
+		return fmt.Errorf("subcomando desconhecido: %s", argumentos[0])
+	}
+}
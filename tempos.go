@@ -0,0 +1,84 @@
+package meufs
+
+import (
+	"sync"
+	"time"
+)
+
+// ultimoInstante é o último instante retornado por agora
+var (
+	ultimoInstante int64
+	mutexInstante  sync.Mutex
+)
+
+// agora retorna o instante atual no formato guardado nas entradas: nanossegundos desde 01/01/1970 (UTC). Dois
+// instantes nunca são iguais, então a data de criação também identifica a entrada (ver qidDaEntrada)
+func agora() int64 {
+	mutexInstante.Lock()
+	defer mutexInstante.Unlock()
+	ultimoInstante = max(time.Now().UnixNano(), ultimoInstante+1)
+	return ultimoInstante
+}
+
+// TempoDaEntrada converte um tempo guardado em uma entrada para time.Time. Zero significa que não há tempo
+func TempoDaEntrada(nanossegundos int64) time.Time {
+	if nanossegundos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanossegundos)
+}
+
+// DefinirTempos muda as datas de acesso e de modificação da entrada indicada pelo caminho, o que só o dono e o root
+// podem fazer, desde que ela não seja imutável nem somente anexar. Um time.Time zero mantém a data atual.
+// O root não guarda datas, então é ignorado
+func DefinirTempos(cabecalho Cabecalho, meuFS *MeuFS, identidade Identidade, caminho []string, acesso time.Time, modificacao time.Time) error {
+	if len(caminho) == 0 {
+		return nil
+	}
+	dir, indice, _, erro := resolverComPermissao(cabecalho, meuFS, identidade, caminho)
+	if erro != nil {
+		return erro
+	}
+	if erro = verificarDono(identidade, dir.Entradas[indice], caminho); erro != nil {
+		return erro
+	}
+	if erro = verificarEntradaAlteravel(dir.Entradas[indice], caminho); erro != nil {
+		return erro
+	}
+	return atualizarTempos(cabecalho, meuFS, caminho, acesso, modificacao)
+}
+
+// MarcarAcesso registra que o conteúdo da entrada foi lido agora. Quem chama já conferiu a permissão de leitura.
+// Ler um snapshot não muda nada nele
+func MarcarAcesso(cabecalho Cabecalho, meuFS *MeuFS, caminho []string) error {
+	if ehSnapshot(cabecalho) {
+		return nil
+	}
+	return atualizarTempos(cabecalho, meuFS, caminho, time.Now(), time.Time{})
+}
+
+// tocarDiretorio atualiza a data de modificação do diretório depois de uma entrada ser criada, removida ou renomeada nele
+func tocarDiretorio(cabecalho Cabecalho, meuFS *MeuFS, caminhoDir []string) error {
+	return atualizarTempos(cabecalho, meuFS, caminhoDir, time.Time{}, time.Now())
+}
+
+// atualizarTempos é o DefinirTempos das datas mantidas pelo próprio meufs, que não depende de quem fez a operação
+func atualizarTempos(cabecalho Cabecalho, meuFS *MeuFS, caminho []string, acesso time.Time, modificacao time.Time) error {
+	if len(caminho) == 0 {
+		return nil
+	}
+	dir, indice, erro := ResolverCaminho(cabecalho, meuFS, caminho)
+	if erro != nil {
+		return erro
+	}
+	if !acesso.IsZero() {
+		dir.Entradas[indice].Acessado = acesso.UnixNano()
+	}
+	if !modificacao.IsZero() {
+		dir.Entradas[indice].Modificado = modificacao.UnixNano()
+	}
+	if erro = SalvarDiretorio(cabecalho, meuFS, dir); erro != nil {
+		return erro
+	}
+	return meuFS.Sync()
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package meufs
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// ModoBruto desliga o eco e o modo canônico do terminal, para que o shell receba cada tecla (ex: TAB).
+// Retorna uma função que restaura o modo original, ou erro se a entrada não for um terminal
+func ModoBruto(fd int) (func(), error) {
+	var original syscall.Termios
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(&original)))
+	if e != 0 {
+		return nil, e
+	}
+	bruto := original
+	bruto.Iflag &^= syscall.ICRNL | syscall.IXON
+	bruto.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	bruto.Cc[syscall.VMIN] = 1
+	bruto.Cc[syscall.VTIME] = 0
+	_, _, e = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(&bruto)))
+	if e != 0 {
+		return nil, e
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(&original)))
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package meufs
+
+import "errors"
+
+// ModoBruto só é suportado no Linux, nos demais sistemas o shell lê linhas inteiras e não completa nomes com TAB
+func ModoBruto(fd int) (func(), error) {
+	return nil, errors.New("modo bruto do terminal não suportado neste sistema")
+}
@@ -0,0 +1,100 @@
+package meufs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Transacao guarda o estado do meufs antes de uma sequência de operações para que elas possam ser desfeitas.
+// Enquanto ela está ativa, toda escrita no meufs.fs copia antes, para um arquivo temporário, os setores de
+// tamanhoSetor bytes que vai alterar, só na primeira vez em que cada um é alterado. Assim só o que as operações
+// realmente mudam (cabeçalho, entradas, FAT e blocos) é copiado e restaurado. Os setores são copiados como estão
+// no disco, então num volume cifrado o arquivo temporário não guarda os dados decifrados.
+// A CredencialAdmin e a AreaTentativas não são restauradas, para que desfazer não volte atrás a senha de
+// administrador nem as tentativas erradas dela
+type Transacao struct {
+	meuFS     *MeuFS
+	cabecalho Cabecalho
+	copia     *os.File
+	setores   map[int64]int64 // Setor do meufs.fs -> posição da cópia dele no arquivo temporário
+}
+
+// IniciarTransacao começa a registrar as alterações feitas no meufs, até Desfazer ou Encerrar
+func IniciarTransacao(meuFS *MeuFS, cabecalho Cabecalho) (*Transacao, error) {
+	if meuFS.transacao != nil {
+		return nil, errors.New("já existe uma transação em andamento")
+	}
+	copia, erro := os.CreateTemp("", "meufs-transacao-*")
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao criar cópia temporária: %w", erro)
+	}
+	t := &Transacao{meuFS: meuFS, cabecalho: cabecalho, copia: copia, setores: make(map[int64]int64)}
+	meuFS.transacao = t
+	return t, nil
+}
+
+// guardar copia os setores do trecho que ainda não foram copiados, antes de ele ser escrito
+func (t *Transacao) guardar(offset int64, tamanho int) error {
+	setor := make([]byte, tamanhoSetor)
+	for indice := offset / tamanhoSetor; indice*tamanhoSetor < offset+int64(tamanho); indice++ {
+		if _, copiado := t.setores[indice]; copiado {
+			continue
+		}
+		n, erro := t.meuFS.lerBruto(setor, indice*tamanhoSetor)
+		if n < len(setor) && erro != nil {
+			return fmt.Errorf("erro ao copiar setor alterado: %w", erro)
+		}
+		posicao := int64(len(t.setores)) * tamanhoSetor
+		if _, erro = t.copia.WriteAt(setor, posicao); erro != nil {
+			return fmt.Errorf("erro ao copiar setor alterado: %w", erro)
+		}
+		t.setores[indice] = posicao
+	}
+	return nil
+}
+
+// Desfazer devolve o meufs ao estado de quando a transação foi iniciada, menos a CredencialAdmin e a AreaTentativas.
+// A transação termina, e as escritas seguintes não são mais registradas
+func (t *Transacao) Desfazer() error {
+	t.meuFS.transacao = nil
+	// Trechos do meufs.fs que ficam como estão, em ordem
+	preservados := [][2]int64{
+		{posicaoCredencial(), posicaoCredencial() + int64(binary.Size(CredencialAdmin{}))},
+		{posicaoAreaTentativas(), posicaoAreaTentativas() + int64(binary.Size(AreaTentativas{}))},
+	}
+	setor := make([]byte, tamanhoSetor)
+	for indice, posicao := range t.setores {
+		if _, erro := t.copia.ReadAt(setor, posicao); erro != nil {
+			return fmt.Errorf("erro ao ler cópia do setor: %w", erro)
+		}
+		base := indice * tamanhoSetor
+		inicio, fim := base, base+tamanhoSetor
+		// Os trechos do setor antes, entre e depois dos preservados
+		var trechos [][2]int64
+		for _, preservado := range preservados {
+			trechos = append(trechos, [2]int64{inicio, min(fim, preservado[0])})
+			inicio = max(inicio, preservado[1])
+		}
+		trechos = append(trechos, [2]int64{inicio, fim})
+		for _, trecho := range trechos {
+			if trecho[0] >= trecho[1] {
+				continue
+			}
+			if _, erro := t.meuFS.escreverBruto(setor[trecho[0]-base:trecho[1]-base], trecho[0]); erro != nil {
+				return fmt.Errorf("erro ao restaurar setor: %w", erro)
+			}
+		}
+	}
+	return t.meuFS.Sync()
+}
+
+// Encerrar descarta a cópia temporária, a partir daí a transação não pode mais ser desfeita
+func (t *Transacao) Encerrar() error {
+	if t.meuFS.transacao == t {
+		t.meuFS.transacao = nil
+	}
+	t.copia.Close()
+	return os.Remove(t.copia.Name())
+}
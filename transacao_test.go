@@ -0,0 +1,81 @@
+package meufs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"meufs"
+)
+
+func TestTransacaoDesfazer(t *testing.T) {
+	volume := novoVolume(t)
+	grande := string(bytes.Repeat([]byte("meufs"), 3000))
+	gravar(t, volume, "/a.txt", grande)
+	gravar(t, volume, "/b.txt", "b")
+	if erro := meufs.DefinirSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "segredo"); erro != nil {
+		t.Fatal(erro)
+	}
+	livresAntes := blocosLivres(t, volume)
+	transacao, erro := meufs.IniciarTransacao(volume.Arquivo, volume.Cabecalho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer transacao.Encerrar()
+	if _, erro = meufs.IniciarTransacao(volume.Arquivo, volume.Cabecalho); erro == nil {
+		t.Fatal("duas transações ao mesmo tempo no mesmo volume deveriam ser recusadas")
+	}
+	gravar(t, volume, "/a.txt", "trocado")
+	gravar(t, volume, "/c.txt", grande+grande)
+	if erro = meufs.RemoverEntrada(volume.Cabecalho, volume.Arquivo, volume.Identidade, []string{"b.txt"}); erro != nil {
+		t.Fatal(erro)
+	}
+	// Uma tentativa errada de senha durante a transação continua contando depois de desfazer
+	if meufs.VerificarSenhaAdmin(volume.Cabecalho, volume.Arquivo, volume.Identidade, "errada") == nil {
+		t.Fatal("a senha errada deveria ser recusada")
+	}
+	if erro = transacao.Desfazer(); erro != nil {
+		t.Fatal(erro)
+	}
+	if texto := conteudo(t, volume, "/a.txt"); texto != grande {
+		t.Fatalf("a.txt deveria voltar ao conteúdo original, tem %d bytes", len(texto))
+	}
+	if texto := conteudo(t, volume, "/b.txt"); texto != "b" {
+		t.Fatalf("b.txt deveria voltar, tem %q", texto)
+	}
+	if _, erro = volume.Open("/c.txt"); erro == nil {
+		t.Fatal("c.txt foi criado na transação e deveria ter sumido")
+	}
+	if livres := blocosLivres(t, volume); livres != livresAntes {
+		t.Fatalf("depois de desfazer há %d blocos livres, antes havia %d", livres, livresAntes)
+	}
+	tentativas, erro := meufs.LerTentativas(volume.Cabecalho, volume.Arquivo, volume.Identidade.Uid)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if tentativas.Falhas != 1 {
+		t.Fatalf("desfazer não pode voltar o contador de tentativas erradas, que ficou em %d", tentativas.Falhas)
+	}
+	// Depois de desfeita, as escritas não são mais registradas e outra transação pode começar
+	gravar(t, volume, "/d.txt", "d")
+	outra, erro := meufs.IniciarTransacao(volume.Arquivo, volume.Cabecalho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	outra.Encerrar()
+}
+
+// blocosLivres conta os blocos livres na FAT
+func blocosLivres(t *testing.T, volume *meufs.Volume) int {
+	t.Helper()
+	fat, erro := meufs.LerFAT(volume.Cabecalho, volume.Arquivo)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	livres := 0
+	for _, entrada := range fat {
+		if entrada == 0 {
+			livres++
+		}
+	}
+	return livres
+}